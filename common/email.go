@@ -3,6 +3,7 @@ package common
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -30,13 +31,20 @@ const (
 var htmlTagPattern = regexp.MustCompile(`<[^>]+>`)
 
 type postmarkEmailRequest struct {
-	From          string            `json:"From"`
-	To            string            `json:"To"`
-	Subject       string            `json:"Subject"`
-	HtmlBody      string            `json:"HtmlBody,omitempty"`
-	TextBody      string            `json:"TextBody,omitempty"`
-	MessageStream string            `json:"MessageStream,omitempty"`
-	Metadata      map[string]string `json:"Metadata,omitempty"`
+	From          string               `json:"From"`
+	To            string               `json:"To"`
+	Subject       string               `json:"Subject"`
+	HtmlBody      string               `json:"HtmlBody,omitempty"`
+	TextBody      string               `json:"TextBody,omitempty"`
+	MessageStream string               `json:"MessageStream,omitempty"`
+	Metadata      map[string]string    `json:"Metadata,omitempty"`
+	Attachments   []postmarkAttachment `json:"Attachments,omitempty"`
+}
+
+type postmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"`
+	ContentType string `json:"ContentType"`
 }
 
 type postmarkEmailResponse struct {
@@ -175,6 +183,12 @@ type EmailRecipientContext struct {
 	PublishedAt   time.Time
 }
 
+type EmailAttachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
 type BatchEmailEntry struct {
 	Recipient string
 	Subject   string
@@ -204,6 +218,42 @@ func SendEmailWithIdempotencyKeyAndContext(subject string, receiver string, cont
 	return sendEmail(subject, receiver, content, idempotencyKey, ctx)
 }
 
+// SendEmailWithAttachments 发送带附件的邮件，多个收件人时逐个单独发送
+func SendEmailWithAttachments(subject string, receiver string, content string, attachments []EmailAttachment, ctx EmailRecipientContext) error {
+	if err := validatePostmarkConfiguration(); err != nil {
+		return err
+	}
+	receivers := splitEmailReceivers(receiver)
+	if len(receivers) == 0 {
+		return fmt.Errorf("收件人邮箱未配置")
+	}
+	from, err := currentPostmarkSender()
+	if err != nil {
+		return err
+	}
+	for _, recipient := range receivers {
+		recipientCtx := ctx
+		recipientCtx.Email = recipient
+		request, err := buildPostmarkEmailRequest(from, subject, content, recipientCtx, "")
+		if err != nil {
+			return err
+		}
+		for _, attachment := range attachments {
+			request.Attachments = append(request.Attachments, postmarkAttachment{
+				Name:        attachment.Name,
+				Content:     base64.StdEncoding.EncodeToString(attachment.Content),
+				ContentType: attachment.ContentType,
+			})
+		}
+		if _, err = sendPostmarkSingleWithRetry(*request); err != nil {
+			err = fmt.Errorf("Postmark 邮件发送失败: %w", err)
+			SysError(fmt.Sprintf("failed to send email to %s via Postmark: %v", recipient, err))
+			return err
+		}
+	}
+	return nil
+}
+
 func SendBatchEmailsWithIdempotencyKey(entries []BatchEmailEntry, idempotencyKey string) ([]BatchEmailResult, error) {
 	if err := validatePostmarkConfiguration(); err != nil {
 		return nil, err
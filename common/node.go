@@ -0,0 +1,24 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	nodeId     string
+	nodeIdOnce sync.Once
+)
+
+// GetNodeId 返回当前进程在集群中的标识（主机名-进程号-随机后缀），用于任务租约与跨节点缓存失效消息
+func GetNodeId() string {
+	nodeIdOnce.Do(func() {
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "node"
+		}
+		nodeId = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), GetRandomString(6))
+	})
+	return nodeId
+}
@@ -61,6 +61,14 @@ func InitRedisClient() (err error) {
 	return err
 }
 
+// CloseRedisClient 关闭 Redis 连接池，用于服务关闭前
+func CloseRedisClient() error {
+	if RDB == nil {
+		return nil
+	}
+	return RDB.Close()
+}
+
 func ParseRedisOption() *redis.Options {
 	opt, err := redis.ParseURL(os.Getenv("REDIS_CONN_STRING"))
 	if err != nil {
@@ -10,13 +10,16 @@ const (
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
 
 	/* token related keys */
-	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
-	ContextKeyTokenKey               ContextKey = "token_key"
-	ContextKeyTokenId                ContextKey = "token_id"
-	ContextKeyTokenGroup             ContextKey = "token_group"
-	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
-	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
-	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenUnlimited          ContextKey = "token_unlimited_quota"
+	ContextKeyTokenKey                ContextKey = "token_key"
+	ContextKeyTokenId                 ContextKey = "token_id"
+	ContextKeyTokenGroup              ContextKey = "token_group"
+	ContextKeyTokenSpecificChannelId  ContextKey = "specific_channel_id"
+	ContextKeyTokenModelLimitEnabled  ContextKey = "token_model_limit_enabled"
+	ContextKeyTokenModelLimit         ContextKey = "token_model_limit"
+	ContextKeyTokenModelFallbacks     ContextKey = "token_model_fallbacks"
+	ContextKeyTokenTaskCallbackUrl    ContextKey = "token_task_callback_url"
+	ContextKeyTokenTaskCallbackSecret ContextKey = "token_task_callback_secret"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -35,6 +38,7 @@ const (
 	ContextKeyChannelIsMultiKey        ContextKey = "channel_is_multi_key"
 	ContextKeyChannelMultiKeyIndex     ContextKey = "channel_multi_key_index"
 	ContextKeyChannelKey               ContextKey = "channel_key"
+	ContextKeyChannelKeyUsageSnapshot  ContextKey = "channel_key_usage_snapshot"
 
 	/* user related keys */
 	ContextKeyUserId      ContextKey = "id"
@@ -51,8 +55,14 @@ const (
 
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
+	ContextKeyModelCapabilityRequirement ContextKey = "model_capability_requirement"
+
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
 
+	ContextKeySessionAffinityKey       ContextKey = "session_affinity_key"
+	ContextKeySessionAffinityChannelId ContextKey = "session_affinity_channel_id"
+	ContextKeySessionAffinityKeyIndex  ContextKey = "session_affinity_key_index"
+
 	ContextKeyAdminAuditMeta ContextKey = "admin_audit_meta"
 	ContextKeyAdminAuditSkip ContextKey = "admin_audit_skip"
 )
@@ -134,7 +134,7 @@ func SelfQuotaTakeAway(c *gin.Context) {
 		return
 	}
 
-	if err := model.DecreaseUserQuota(userId, int(quotaToTake)); err != nil {
+	if err := model.DecreaseUserQuota(userId, int(quotaToTake), model.QuotaLedgerTypeSelfDeduct); err != nil {
 		common.ApiError(c, err)
 		return
 	}
@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCaptureSinkStatus 训练数据采集各写入目标在当前节点上的队列与写入情况
+func GetCaptureSinkStatus(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"node_id": common.GetNodeId(),
+		"sinks":   service.GetCaptureSinkStatus(),
+	})
+}
@@ -495,11 +495,10 @@ func UpdateAllChannelsBalance(c *gin.Context) {
 	return
 }
 
-func AutomaticallyUpdateChannels(frequency int) {
-	for {
-		time.Sleep(time.Duration(frequency) * time.Minute)
-		common.SysLog("updating all channels")
-		_ = updateAllChannelsBalance()
-		common.SysLog("channels update done")
-	}
+// UpdateAllChannelsBalanceJob 定时更新所有渠道余额，由后台任务调度器调用
+func UpdateAllChannelsBalanceJob() error {
+	common.SysLog("updating all channels")
+	err := updateAllChannelsBalance()
+	common.SysLog("channels update done")
+	return err
 }
@@ -642,7 +642,7 @@ func DeleteChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -656,7 +656,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -692,7 +692,7 @@ func DisableTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -715,7 +715,7 @@ func EnableTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -767,7 +767,7 @@ func EditTagChannels(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -795,7 +795,7 @@ func DeleteChannelBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -911,7 +911,7 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
 	clearChannelInfo(&channel.Channel)
@@ -1019,7 +1019,7 @@ func BatchSetChannelTag(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -1114,19 +1114,27 @@ func CopyChannel(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
 		return
 	}
-	model.InitChannelCache()
+	model.RefreshChannelCache()
 	// success
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "", "data": gin.H{"id": clone.Id}})
 }
 
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
-	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
-	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
-	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
-	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
-	Status    *int   `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	ChannelId int                  `json:"channel_id"`
+	Action    string               `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status", "get_key_usage", "set_key_limit", "clear_key_cooldown"
+	KeyIndex  *int                 `json:"key_index,omitempty"` // for disable_key, enable_key, delete_key and clear_key_cooldown actions; set_key_limit sets the default limit when nil
+	Page      int                  `json:"page,omitempty"`      // for get_key_status pagination
+	PageSize  int                  `json:"page_size,omitempty"` // for get_key_status pagination
+	Status    *int                 `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	Limit     *model.MultiKeyLimit `json:"limit,omitempty"`     // for set_key_limit, nil or empty removes the limit
+}
+
+// MultiKeyUsageResponse represents the response for key usage query
+type MultiKeyUsageResponse struct {
+	MultiKeyMode constant.MultiKeyMode         `json:"multi_key_mode"`
+	DefaultLimit *model.MultiKeyLimit          `json:"default_limit,omitempty"`
+	Keys         []model.ChannelKeyUsageDetail `json:"keys"`
 }
 
 // MultiKeyStatusResponse represents the response for key status query
@@ -1331,7 +1339,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已禁用",
@@ -1373,7 +1381,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已启用",
@@ -1397,7 +1405,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已启用 %d 个密钥", enabledCount),
@@ -1444,7 +1452,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已禁用 %d 个密钥", disabledCount),
@@ -1474,6 +1482,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newLimits = make(map[int]model.MultiKeyLimit)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1500,6 +1509,9 @@ func ManageMultiKeys(c *gin.Context) {
 					newDisabledReason[newIndex] = r
 				}
 			}
+			if limit, exists := channel.ChannelInfo.MultiKeyLimits[i]; exists {
+				newLimits[newIndex] = limit
+			}
 			newIndex++
 		}
 
@@ -1517,6 +1529,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyLimits = newLimits
 
 		err = channel.Update()
 		if err != nil {
@@ -1524,7 +1537,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已删除",
@@ -1538,6 +1551,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newLimits = make(map[int]model.MultiKeyLimit)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1553,6 +1567,9 @@ func ManageMultiKeys(c *gin.Context) {
 				deletedCount++
 			} else {
 				remainingKeys = append(remainingKeys, key)
+				if limit, exists := channel.ChannelInfo.MultiKeyLimits[i]; exists {
+					newLimits[newIndex] = limit
+				}
 				// 保留非自动禁用密钥的状态信息，重新索引
 				if status != 1 {
 					newStatusList[newIndex] = status
@@ -1585,6 +1602,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyLimits = newLimits
 
 		err = channel.Update()
 		if err != nil {
@@ -1592,7 +1610,7 @@ func ManageMultiKeys(c *gin.Context) {
 			return
 		}
 
-		model.InitChannelCache()
+		model.RefreshChannelCache()
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已删除 %d 个自动禁用的密钥", deletedCount),
@@ -1600,6 +1618,95 @@ func ManageMultiKeys(c *gin.Context) {
 		})
 		return
 
+	case "get_key_usage":
+		details, err := model.GetChannelKeyUsageDetails(channel)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, MultiKeyUsageResponse{
+			MultiKeyMode: channel.ChannelInfo.MultiKeyMode,
+			DefaultLimit: channel.ChannelInfo.MultiKeyDefaultLimit,
+			Keys:         details,
+		})
+		return
+
+	case "set_key_limit":
+		if request.Limit != nil {
+			if err := request.Limit.Validate(); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
+		removeLimit := request.Limit == nil || request.Limit.IsEmpty()
+
+		if request.KeyIndex == nil {
+			// 未指定密钥索引时设置默认限额
+			if removeLimit {
+				channel.ChannelInfo.MultiKeyDefaultLimit = nil
+			} else {
+				channel.ChannelInfo.MultiKeyDefaultLimit = request.Limit
+			}
+		} else {
+			keyIndex := *request.KeyIndex
+			if keyIndex < 0 || keyIndex >= channel.ChannelInfo.MultiKeySize {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "密钥索引超出范围",
+				})
+				return
+			}
+			if channel.ChannelInfo.MultiKeyLimits == nil {
+				channel.ChannelInfo.MultiKeyLimits = make(map[int]model.MultiKeyLimit)
+			}
+			if removeLimit {
+				delete(channel.ChannelInfo.MultiKeyLimits, keyIndex)
+			} else {
+				channel.ChannelInfo.MultiKeyLimits[keyIndex] = *request.Limit
+			}
+		}
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.RefreshChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥限额已更新",
+		})
+		return
+
+	case "clear_key_cooldown":
+		if request.KeyIndex == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定要解除冷却的密钥索引",
+			})
+			return
+		}
+
+		keys := channel.GetKeys()
+		keyIndex := *request.KeyIndex
+		if keyIndex < 0 || keyIndex >= len(keys) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+		if err := model.ClearChannelKeyCooldown(channel.Id, keys[keyIndex]); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥冷却已解除",
+		})
+		return
+
 	default:
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -1608,3 +1715,22 @@ func ManageMultiKeys(c *gin.Context) {
 		return
 	}
 }
+
+// GetChannelAffinityStats 获取各渠道的会话粘性命中率与 prompt 缓存命中率
+func GetChannelAffinityStats(c *gin.Context) {
+	stats, err := service.GetChannelAffinityStats()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stats)
+}
+
+// ResetChannelAffinityStats 清空会话粘性与缓存命中统计
+func ResetChannelAffinityStats(c *gin.Context) {
+	if err := service.ResetChannelAffinityStats(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBackgroundJobs 列出已注册的后台任务及其租约持有节点、最近运行结果与下次运行时间
+func GetBackgroundJobs(c *gin.Context) {
+	statuses, err := service.GetBackgroundJobStatuses()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"node_id": common.GetNodeId(),
+		"jobs":    statuses,
+	})
+}
+
+// RunBackgroundJob 手动触发后台任务，由持有该任务租约的节点在下一次调度检查时运行
+func RunBackgroundJob(c *gin.Context) {
+	if err := service.TriggerBackgroundJob(c.Param("name")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -1,12 +1,19 @@
 package controller
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -31,17 +38,23 @@ func GetAllLogs(c *gin.Context) {
 		common.ApiSuccess(c, pageInfo)
 		return
 	}
-	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group)
+	page, err := service.GetAllLogsWithArchive(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
-	pageInfo.SetTotal(int(total))
-	pageInfo.SetItems(logs)
-	common.ApiSuccess(c, pageInfo)
+	pageInfo.SetTotal(int(page.Total))
+	pageInfo.SetItems(page.Logs)
+	common.ApiSuccess(c, archivedLogPageInfo{PageInfo: pageInfo, TotalTruncated: page.Truncated})
 	return
 }
 
+// archivedLogPageInfo 日志分页结果，TotalTruncated 为 true 时 total 只是下限，后续页可能仍有归档日志
+type archivedLogPageInfo struct {
+	*common.PageInfo
+	TotalTruncated bool `json:"total_truncated"`
+}
+
 func GetUserLogs(c *gin.Context) {
 	pageInfo := common.GetPageQuery(c)
 	userId := c.GetInt("id")
@@ -210,3 +223,118 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+func exportLogs(c *gin.Context, filter model.LogExportFilter, forUser bool) {
+	format, err := service.ParseLogExportFormat(c.Query("format"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if filter.LogType == model.LogTypeManage {
+		common.ApiErrorMsg(c, "管理日志不支持导出")
+		return
+	}
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", format.FileName("logs")))
+	c.Status(http.StatusOK)
+	if err = service.ExportLogs(c.Writer, format, filter, forUser); err != nil {
+		// 响应已开始写出时无法再返回 JSON 错误，只能记录日志并中断
+		logger.LogError(c, "export logs failed: "+err.Error())
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			common.ApiError(c, err)
+		}
+	}
+}
+
+func ExportAllLogs(c *gin.Context) {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	exportLogs(c, model.LogExportFilter{
+		UserId:         userId,
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+		TokenName:      c.Query("token_name"),
+		Channel:        channel,
+		Group:          c.Query("group"),
+	}, false)
+}
+
+func ExportUserLogs(c *gin.Context) {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	exportLogs(c, model.LogExportFilter{
+		UserId:         c.GetInt("id"),
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		TokenName:      c.Query("token_name"),
+		Group:          c.Query("group"),
+	}, true)
+}
+
+type runUsageReportRequest struct {
+	Period string `json:"period"`
+}
+
+// RunUsageReports 手动生成并投递指定月份（默认上月）的用量报告，异步执行
+func RunUsageReports(c *gin.Context) {
+	var req runUsageReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.Period == "" {
+		now := time.Now()
+		req.Period = now.AddDate(0, 0, -now.Day()).Format("2006-01")
+	}
+	if _, _, err := service.UsageReportPeriodRange(req.Period); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	gopool.Go(func() {
+		if err := service.RunMonthlyUsageReports(req.Period); err != nil {
+			common.SysError(fmt.Sprintf("failed to run usage reports for %s: %s", req.Period, err.Error()))
+		}
+	})
+	common.ApiSuccess(c, gin.H{"period": req.Period})
+}
+
+// GetLogArchives 分页列出日志归档清单
+func GetLogArchives(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	archives, total, err := model.GetAllLogArchives(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(archives)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RunLogArchive 立即执行一次日志归档，异步执行
+func RunLogArchive(c *gin.Context) {
+	if !system_setting.GetObjectStorageSettings().IsConfigured() {
+		common.ApiErrorMsg(c, "对象存储未配置")
+		return
+	}
+	gopool.Go(func() {
+		result, err := service.RunLogArchive(context.Background())
+		if err != nil {
+			common.SysError("failed to archive logs: " + err.Error())
+			return
+		}
+		common.SysLog(fmt.Sprintf("archived %d logs into %d archives", result.ArchivedRows, result.Archives))
+	})
+	common.ApiSuccess(c, nil)
+}
@@ -20,179 +20,198 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func UpdateMidjourneyTaskBulk() {
+// UpdateMidjourneyTaskBulk 批量拉取未完成的 Midjourney 任务进度，由后台任务调度器定期调用
+func UpdateMidjourneyTaskBulk() error {
 	//imageModel := "midjourney"
 	ctx := context.TODO()
-	for {
-		time.Sleep(time.Duration(15) * time.Second)
 
-		tasks := model.GetAllUnFinishTasks()
-		if len(tasks) == 0 {
+	tasks := model.GetAllUnFinishTasks()
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	logger.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
+	taskChannelM := make(map[int][]string)
+	taskM := make(map[string]*model.Midjourney)
+	nullTaskIds := make([]int, 0)
+	for _, task := range tasks {
+		if task.MjId == "" {
+			// 统计失败的未完成任务
+			nullTaskIds = append(nullTaskIds, task.Id)
 			continue
 		}
+		taskM[task.MjId] = task
+		taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
+	}
+	if len(nullTaskIds) > 0 {
+		err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
+		}
+	}
+	if len(taskChannelM) == 0 {
+		return nil
+	}
 
-		logger.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
-		taskChannelM := make(map[int][]string)
-		taskM := make(map[string]*model.Midjourney)
-		nullTaskIds := make([]int, 0)
-		for _, task := range tasks {
-			if task.MjId == "" {
-				// 统计失败的未完成任务
-				nullTaskIds = append(nullTaskIds, task.Id)
-				continue
-			}
-			taskM[task.MjId] = task
-			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
+	for channelId, taskIds := range taskChannelM {
+		logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
+		if len(taskIds) == 0 {
+			continue
 		}
-		if len(nullTaskIds) > 0 {
-			err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
-				"status":   "FAILURE",
-				"progress": "100%",
+		midjourneyChannel, err := model.CacheGetChannel(channelId)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
+			failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
+			err := model.MjBulkUpdate(taskIds, map[string]any{
+				"fail_reason": failReason,
+				"status":      "FAILURE",
+				"progress":    "100%",
 			})
 			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Fix null mj_id task error: %v", err))
-			} else {
-				logger.LogInfo(ctx, fmt.Sprintf("Fix null mj_id task success: %v", nullTaskIds))
+				logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+				continue
+			}
+			for _, taskId := range taskIds {
+				task := taskM[taskId]
+				if task.Status == "FAILURE" {
+					continue
+				}
+				task.FailReason = failReason
+				task.Status = "FAILURE"
+				task.Progress = "100%"
+				service.NotifyMidjourneyTaskStatusChanged(task)
 			}
+			continue
+		}
+		requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+
+		body, _ := json.Marshal(map[string]any{
+			"ids": taskIds,
+		})
+		req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
+			continue
 		}
-		if len(taskChannelM) == 0 {
+		requestCtx, cancel := context.WithTimeout(context.Background(), service.LongUpstreamRequestTimeout())
+		// 使用带有超时的 context 创建新的请求
+		req = req.WithContext(requestCtx)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+		resp, err := service.WithoutTotalTimeout(service.GetHttpClient()).Do(req)
+		if err != nil {
+			cancel()
+			logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			cancel()
+			logger.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
+			continue
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			cancel()
+			logger.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
 			continue
 		}
+		var responseItems []dto.MidjourneyDto
+		err = json.Unmarshal(responseBody, &responseItems)
+		if err != nil {
+			resp.Body.Close()
+			cancel()
+			logger.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
+			continue
+		}
+		resp.Body.Close()
+		req.Body.Close()
+		cancel()
 
-		for channelId, taskIds := range taskChannelM {
-			logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
-			if len(taskIds) == 0 {
-				continue
-			}
-			midjourneyChannel, err := model.CacheGetChannel(channelId)
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("CacheGetChannel: %v", err))
-				err := model.MjBulkUpdate(taskIds, map[string]any{
-					"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
-					"status":      "FAILURE",
-					"progress":    "100%",
-				})
-				if err != nil {
-					logger.LogInfo(ctx, fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
-				}
-				continue
-			}
-			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
+		for _, responseItem := range responseItems {
+			task := taskM[responseItem.MjId]
 
-			body, _ := json.Marshal(map[string]any{
-				"ids": taskIds,
-			})
-			req, err := http.NewRequest("POST", requestUrl, bytes.NewBuffer(body))
-			if err != nil {
-				logger.LogError(ctx, fmt.Sprintf("Get Task error: %v", err))
-				continue
+			useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
+			// 如果时间超过一小时，且进度不是100%，则认为任务失败
+			if useTime > 3600000 && task.Progress != "100%" {
+				responseItem.FailReason = "上游任务超时（超过1小时）"
+				responseItem.Status = "FAILURE"
 			}
-			requestCtx, cancel := context.WithTimeout(context.Background(), service.LongUpstreamRequestTimeout())
-			// 使用带有超时的 context 创建新的请求
-			req = req.WithContext(requestCtx)
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
-			resp, err := service.WithoutTotalTimeout(service.GetHttpClient()).Do(req)
-			if err != nil {
-				cancel()
-				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
-				continue
-			}
-			if resp.StatusCode != http.StatusOK {
-				resp.Body.Close()
-				cancel()
-				logger.LogError(ctx, fmt.Sprintf("Get Task status code: %d", resp.StatusCode))
+			if !checkMjTaskNeedUpdate(task, responseItem) {
 				continue
 			}
-			responseBody, err := io.ReadAll(resp.Body)
-			if err != nil {
-				resp.Body.Close()
-				cancel()
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error: %v", err))
-				continue
+			preStatus := task.Status
+			task.Code = 1
+			task.Progress = responseItem.Progress
+			task.PromptEn = responseItem.PromptEn
+			task.State = responseItem.State
+			task.SubmitTime = responseItem.SubmitTime
+			task.StartTime = responseItem.StartTime
+			task.FinishTime = responseItem.FinishTime
+			task.ImageUrl = responseItem.ImageUrl
+			task.Status = responseItem.Status
+			task.FailReason = responseItem.FailReason
+			if responseItem.Properties != nil {
+				propertiesStr, _ := json.Marshal(responseItem.Properties)
+				task.Properties = string(propertiesStr)
 			}
-			var responseItems []dto.MidjourneyDto
-			err = json.Unmarshal(responseBody, &responseItems)
-			if err != nil {
-				resp.Body.Close()
-				cancel()
-				logger.LogError(ctx, fmt.Sprintf("Get Task parse body error2: %v, body: %s", err, string(responseBody)))
-				continue
+			if responseItem.Buttons != nil {
+				buttonStr, _ := json.Marshal(responseItem.Buttons)
+				task.Buttons = string(buttonStr)
 			}
-			resp.Body.Close()
-			req.Body.Close()
-			cancel()
+			// 映射 VideoUrl
+			task.VideoUrl = responseItem.VideoUrl
 
-			for _, responseItem := range responseItems {
-				task := taskM[responseItem.MjId]
-
-				useTime := (time.Now().UnixNano() / int64(time.Millisecond)) - task.SubmitTime
-				// 如果时间超过一小时，且进度不是100%，则认为任务失败
-				if useTime > 3600000 && task.Progress != "100%" {
-					responseItem.FailReason = "上游任务超时（超过1小时）"
-					responseItem.Status = "FAILURE"
-				}
-				if !checkMjTaskNeedUpdate(task, responseItem) {
-					continue
-				}
-				task.Code = 1
-				task.Progress = responseItem.Progress
-				task.PromptEn = responseItem.PromptEn
-				task.State = responseItem.State
-				task.SubmitTime = responseItem.SubmitTime
-				task.StartTime = responseItem.StartTime
-				task.FinishTime = responseItem.FinishTime
-				task.ImageUrl = responseItem.ImageUrl
-				task.Status = responseItem.Status
-				task.FailReason = responseItem.FailReason
-				if responseItem.Properties != nil {
-					propertiesStr, _ := json.Marshal(responseItem.Properties)
-					task.Properties = string(propertiesStr)
-				}
-				if responseItem.Buttons != nil {
-					buttonStr, _ := json.Marshal(responseItem.Buttons)
-					task.Buttons = string(buttonStr)
-				}
-				// 映射 VideoUrl
-				task.VideoUrl = responseItem.VideoUrl
-
-				// 映射 VideoUrls - 将数组序列化为 JSON 字符串
-				if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
-					videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
-					if err != nil {
-						logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
-						task.VideoUrls = "[]" // 失败时设置为空数组
-					} else {
-						task.VideoUrls = string(videoUrlsStr)
-					}
+			// 映射 VideoUrls - 将数组序列化为 JSON 字符串
+			if responseItem.VideoUrls != nil && len(responseItem.VideoUrls) > 0 {
+				videoUrlsStr, err := json.Marshal(responseItem.VideoUrls)
+				if err != nil {
+					logger.LogError(ctx, fmt.Sprintf("序列化 VideoUrls 失败: %v", err))
+					task.VideoUrls = "[]" // 失败时设置为空数组
 				} else {
-					task.VideoUrls = "" // 空值时清空字段
+					task.VideoUrls = string(videoUrlsStr)
 				}
+			} else {
+				task.VideoUrls = "" // 空值时清空字段
+			}
 
-				shouldReturnQuota := false
-				if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
-					logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
-					task.Progress = "100%"
-					if task.Quota != 0 {
-						shouldReturnQuota = true
+			shouldReturnQuota := false
+			if (task.Progress != "100%" && responseItem.FailReason != "") || (task.Progress == "100%" && task.Status == "FAILURE") {
+				logger.LogInfo(ctx, task.MjId+" 构建失败，"+task.FailReason)
+				task.Progress = "100%"
+				if task.Quota != 0 {
+					shouldReturnQuota = true
+				}
+			}
+			err = task.Update()
+			if err != nil {
+				logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
+			} else {
+				if task.Status != preStatus {
+					if task.Status == "SUCCESS" && service.IsMediaArchiveEnabled() {
+						service.ArchiveMidjourneyMediaAndNotify(task)
+					} else {
+						service.NotifyMidjourneyTaskStatusChanged(task)
 					}
 				}
-				err = task.Update()
-				if err != nil {
-					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
-				} else {
-					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
-						if err != nil {
-							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-						}
-						logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(int64(task.Quota)))
-						model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+				if shouldReturnQuota {
+					err = model.IncreaseUserQuota(task.UserId, task.Quota, false, model.QuotaLedgerTypeRefund)
+					if err != nil {
+						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 					}
+					logContent := fmt.Sprintf("构图失败 %s，补偿 %s", task.MjId, logger.LogQuota(int64(task.Quota)))
+					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
 				}
 			}
 		}
 	}
+	return nil
 }
 
 func checkMjTaskNeedUpdate(oldTask *model.Midjourney, newTask dto.MidjourneyDto) bool {
@@ -268,7 +268,22 @@ func EnabledListModels(c *gin.Context) {
 
 func RetrieveModel(c *gin.Context, modelType int) {
 	modelId := c.Param("model")
-	if aiModel, ok := openAIModelsMap[modelId]; ok {
+	aiModel, ok := openAIModelsMap[modelId]
+	capability, hasCapability := model.GetModelCapability(modelId)
+	if !ok && hasCapability {
+		aiModel = dto.OpenAIModels{
+			Id:      modelId,
+			Object:  "model",
+			Created: 1626777600,
+			OwnedBy: "custom",
+		}
+		ok = true
+	}
+	if ok {
+		aiModel.SupportedEndpointTypes = model.GetModelSupportEndpointTypes(modelId)
+		if hasCapability {
+			aiModel.Capabilities = &capability
+		}
 		switch modelType {
 		case constant.ChannelTypeAnthropic:
 			c.JSON(200, dto.AnthropicModel{
@@ -9,6 +9,7 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -64,6 +65,39 @@ type upstreamModel struct {
 	Status      int             `json:"status"`
 	Tags        string          `json:"tags"`
 	VendorName  string          `json:"vendor_name"`
+
+	ContextLength     int             `json:"context_length"`
+	MaxOutputTokens   int             `json:"max_output_tokens"`
+	InputModalities   json.RawMessage `json:"input_modalities"`
+	OutputModalities  json.RawMessage `json:"output_modalities"`
+	SupportsTools     *bool           `json:"supports_tools"`
+	SupportsReasoning *bool           `json:"supports_reasoning"`
+}
+
+// parseUpstreamModalities 兼容上游以数组或逗号分隔字符串表示的模态列表
+func parseUpstreamModalities(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var arr []string
+	if err := json.Unmarshal(raw, &arr); err == nil {
+		return model.NormalizeModalities(strings.Join(arr, ","))
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return model.NormalizeModalities(str)
+	}
+	return ""
+}
+
+// applyUpstreamCapability 将上游能力元数据写入本地模型
+func applyUpstreamCapability(local *model.Model, up upstreamModel) {
+	local.ContextLength = up.ContextLength
+	local.MaxOutputTokens = up.MaxOutputTokens
+	local.InputModalities = parseUpstreamModalities(up.InputModalities)
+	local.OutputModalities = parseUpstreamModalities(up.OutputModalities)
+	local.SupportsTools = up.SupportsTools
+	local.SupportsReasoning = up.SupportsReasoning
 }
 
 type upstreamVendor struct {
@@ -351,6 +385,7 @@ func SyncUpstreamModels(c *gin.Context) {
 			Status:      chooseStatus(up.Status, 1),
 			NameRule:    up.NameRule,
 		}
+		applyUpstreamCapability(mi, up)
 		if err := mi.Insert(); err == nil {
 			createdModels++
 			createdList = append(createdList, name)
@@ -407,6 +442,10 @@ func SyncUpstreamModels(c *gin.Context) {
 					local.Status = chooseStatus(up.Status, local.Status)
 					needUpdate = true
 				}
+				if containsField(ow.Fields, "capabilities") {
+					applyUpstreamCapability(&local, up)
+					needUpdate = true
+				}
 				if !needUpdate {
 					return nil
 				}
@@ -563,7 +602,7 @@ func SyncUpstreamPreview(c *gin.Context) {
 		if !ok {
 			continue
 		}
-		fields := make([]conflictField, 0, 6)
+		fields := make([]conflictField, 0, 7)
 		if strings.TrimSpace(local.Description) != strings.TrimSpace(up.Description) {
 			fields = append(fields, conflictField{Field: "description", Local: local.Description, Upstream: up.Description})
 		}
@@ -584,6 +623,11 @@ func SyncUpstreamPreview(c *gin.Context) {
 		if local.Status != chooseStatus(up.Status, local.Status) {
 			fields = append(fields, conflictField{Field: "status", Local: local.Status, Upstream: up.Status})
 		}
+		var upCapability model.Model
+		applyUpstreamCapability(&upCapability, up)
+		if !reflect.DeepEqual(local.Capability(), upCapability.Capability()) {
+			fields = append(fields, conflictField{Field: "capabilities", Local: local.Capability(), Upstream: upCapability.Capability()})
+		}
 		if len(fields) > 0 {
 			conflicts = append(conflicts, conflictItem{ModelName: local.ModelName, Fields: fields})
 		}
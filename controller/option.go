@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
@@ -173,6 +174,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelContextTiers":
+		err = ratio_setting.CheckModelContextTiers(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "长上下文分档倍率设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "GroupPricingSchedules":
+		err = ratio_setting.CheckGroupPricingSchedules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分组分时倍率设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(option.Value.(string))
 		if err != nil {
@@ -218,6 +237,15 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "model_fallback.chains":
+		err = model_setting.CheckModelFallbackChains(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "console_setting.api_info":
 		err = console_setting.ValidateConsoleSettings(option.Value.(string), "ApiInfo")
 		if err != nil {
@@ -260,6 +288,13 @@ func UpdateOption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	// 直接修改价格配置后与价格簿版本不再一致，不再在日志中标记版本
+	if ratio_setting.IsPriceBookKey(option.Key) && ratio_setting.GetActivePriceBookVersion() != 0 {
+		if err = model.UpdateOption(model.PriceBookVersionOptionKey, "0"); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
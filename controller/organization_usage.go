@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type usageBucketWidth struct {
+	seconds      int64
+	defaultLimit int
+	maxLimit     int
+}
+
+var completionsUsageBucketWidths = map[string]usageBucketWidth{
+	"1m": {seconds: 60, defaultLimit: 60, maxLimit: 1440},
+	"1h": {seconds: 3600, defaultLimit: 24, maxLimit: 168},
+	"1d": {seconds: 86400, defaultLimit: 7, maxLimit: 31},
+}
+
+var costsBucketWidths = map[string]usageBucketWidth{
+	"1d": {seconds: 86400, defaultLimit: 7, maxLimit: 180},
+}
+
+// OpenAI group_by 取值到日志聚合维度的映射；令牌同时作为 project 与 api_key 暴露，group 为网关扩展
+var completionsUsageGroupBy = map[string]string{
+	"model":      model.LogUsageGroupByModel,
+	"project_id": model.LogUsageGroupByToken,
+	"api_key_id": model.LogUsageGroupByToken,
+	"user_id":    model.LogUsageGroupByUser,
+	"group":      model.LogUsageGroupByGroup,
+}
+
+var costsGroupBy = map[string]string{
+	"line_item":  model.LogUsageGroupByModel,
+	"project_id": model.LogUsageGroupByToken,
+	"group":      model.LogUsageGroupByGroup,
+}
+
+type organizationUsageRequest struct {
+	query  model.LogUsageQuery
+	width  usageBucketWidth
+	window int64 // 本页窗口起点
+	end    int64
+}
+
+func organizationUsageError(c *gin.Context, statusCode int, message string) {
+	errorType := "invalid_request_error"
+	if statusCode >= http.StatusInternalServerError {
+		errorType = "server_error"
+	}
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    errorType,
+		},
+	})
+}
+
+// queryArray 同时兼容 `models=a&models=b` 与 `models[]=a` 两种数组参数写法
+func queryArray(c *gin.Context, name string) []string {
+	var values []string
+	for _, raw := range append(c.QueryArray(name), c.QueryArray(name+"[]")...) {
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func queryIntArray(c *gin.Context, name string) ([]int, error) {
+	var ids []int
+	for _, value := range queryArray(c, name) {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", name, value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseOrganizationUsageRequest(c *gin.Context, widths map[string]usageBucketWidth, groupByMapping map[string]string) (*organizationUsageRequest, error) {
+	startTime, err := strconv.ParseInt(c.Query("start_time"), 10, 64)
+	if err != nil || startTime <= 0 {
+		return nil, fmt.Errorf("start_time is required")
+	}
+	endTime := time.Now().Unix()
+	if raw := c.Query("end_time"); raw != "" {
+		endTime, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || endTime <= startTime {
+			return nil, fmt.Errorf("end_time must be greater than start_time")
+		}
+	}
+	bucketWidth := c.DefaultQuery("bucket_width", "1d")
+	width, ok := widths[bucketWidth]
+	if !ok {
+		return nil, fmt.Errorf("unsupported bucket_width: %s", bucketWidth)
+	}
+	limit := width.defaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > width.maxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d for bucket_width %s", width.maxLimit, bucketWidth)
+		}
+	}
+
+	window := startTime - startTime%width.seconds
+	if page := c.Query("page"); page != "" {
+		pageStart, err := strconv.ParseInt(page, 10, 64)
+		if err != nil || pageStart < window || pageStart >= endTime {
+			return nil, fmt.Errorf("invalid page: %s", page)
+		}
+		window = pageStart - pageStart%width.seconds
+	}
+
+	req := &organizationUsageRequest{width: width, window: window, end: endTime}
+	req.query = model.LogUsageQuery{
+		StartTime:   max(startTime, window),
+		EndTime:     min(endTime, window+int64(limit)*width.seconds),
+		BucketWidth: width.seconds,
+		ModelNames:  queryArray(c, "models"),
+		Groups:      queryArray(c, "groups"),
+	}
+
+	tokenIds, err := queryIntArray(c, "api_key_ids")
+	if err != nil {
+		return nil, err
+	}
+	projectIds, err := queryIntArray(c, "project_ids")
+	if err != nil {
+		return nil, err
+	}
+	req.query.TokenIds = append(tokenIds, projectIds...)
+
+	userId := c.GetInt("id")
+	if model.IsAdmin(userId) {
+		// 管理员令牌可查看全站用量，并可按用户过滤
+		if req.query.UserIds, err = queryIntArray(c, "user_ids"); err != nil {
+			return nil, err
+		}
+	} else {
+		req.query.UserIds = []int{userId}
+	}
+
+	seen := make(map[string]bool)
+	for _, groupBy := range queryArray(c, "group_by") {
+		dimension, ok := groupByMapping[groupBy]
+		if !ok {
+			return nil, fmt.Errorf("unsupported group_by: %s", groupBy)
+		}
+		if !seen[dimension] {
+			seen[dimension] = true
+			req.query.GroupBy = append(req.query.GroupBy, dimension)
+		}
+	}
+	return req, nil
+}
+
+// buildOrganizationUsagePage 将聚合结果按时间桶展开为分页响应，没有数据的时间桶返回空 results
+func buildOrganizationUsagePage(req *organizationUsageRequest, rows []*model.LogUsageRow, toResult func(row *model.LogUsageRow) any) dto.OrganizationUsagePage {
+	rowsByBucket := make(map[int64][]any)
+	for _, row := range rows {
+		rowsByBucket[row.BucketStart] = append(rowsByBucket[row.BucketStart], toResult(row))
+	}
+	page := dto.OrganizationUsagePage{
+		Object: "page",
+		Data:   []dto.OrganizationUsageBucket{},
+	}
+	for start := req.window; start < req.query.EndTime; start += req.width.seconds {
+		results := rowsByBucket[start]
+		if results == nil {
+			results = []any{}
+		}
+		page.Data = append(page.Data, dto.OrganizationUsageBucket{
+			Object:    "bucket",
+			StartTime: start,
+			EndTime:   start + req.width.seconds,
+			Results:   results,
+		})
+	}
+	if req.query.EndTime < req.end {
+		next := strconv.FormatInt(req.query.EndTime, 10)
+		page.HasMore = true
+		page.NextPage = &next
+	}
+	return page
+}
+
+func hasUsageGroupBy(query model.LogUsageQuery, dimension string) bool {
+	for _, groupBy := range query.GroupBy {
+		if groupBy == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOrganizationCompletionsUsage OpenAI 兼容的 /v1/organization/usage/completions
+func GetOrganizationCompletionsUsage(c *gin.Context) {
+	req, err := parseOrganizationUsageRequest(c, completionsUsageBucketWidths, completionsUsageGroupBy)
+	if err != nil {
+		organizationUsageError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := model.GetLogUsageBuckets(req.query)
+	if err != nil {
+		common.SysError("failed to query organization usage: " + err.Error())
+		organizationUsageError(c, http.StatusInternalServerError, "failed to query usage")
+		return
+	}
+	byModel := hasUsageGroupBy(req.query, model.LogUsageGroupByModel)
+	byToken := hasUsageGroupBy(req.query, model.LogUsageGroupByToken)
+	byUser := hasUsageGroupBy(req.query, model.LogUsageGroupByUser)
+	byGroup := hasUsageGroupBy(req.query, model.LogUsageGroupByGroup)
+	c.JSON(http.StatusOK, buildOrganizationUsagePage(req, rows, func(row *model.LogUsageRow) any {
+		result := dto.OrganizationCompletionsUsageResult{
+			Object:           "organization.usage.completions.result",
+			InputTokens:      row.PromptTokens,
+			OutputTokens:     row.CompletionTokens,
+			NumModelRequests: row.NumRequests,
+		}
+		if byModel {
+			result.Model = common.GetPointer(row.ModelName)
+		}
+		if byToken {
+			tokenId := strconv.Itoa(row.TokenId)
+			result.ProjectId = &tokenId
+			result.ApiKeyId = &tokenId
+		}
+		if byUser {
+			result.UserId = common.GetPointer(strconv.Itoa(row.UserId))
+		}
+		if byGroup {
+			result.Group = common.GetPointer(row.Group)
+		}
+		return result
+	}))
+}
+
+// GetOrganizationCosts OpenAI 兼容的 /v1/organization/costs，金额按额度换算为美元
+func GetOrganizationCosts(c *gin.Context) {
+	req, err := parseOrganizationUsageRequest(c, costsBucketWidths, costsGroupBy)
+	if err != nil {
+		organizationUsageError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := model.GetLogUsageBuckets(req.query)
+	if err != nil {
+		common.SysError("failed to query organization usage: " + err.Error())
+		organizationUsageError(c, http.StatusInternalServerError, "failed to query usage")
+		return
+	}
+	byModel := hasUsageGroupBy(req.query, model.LogUsageGroupByModel)
+	byToken := hasUsageGroupBy(req.query, model.LogUsageGroupByToken)
+	byGroup := hasUsageGroupBy(req.query, model.LogUsageGroupByGroup)
+	c.JSON(http.StatusOK, buildOrganizationUsagePage(req, rows, func(row *model.LogUsageRow) any {
+		result := dto.OrganizationCostsResult{
+			Object: "organization.costs.result",
+			Amount: dto.OrganizationCostAmount{
+				Value:    float64(row.Quota) / common.QuotaPerUnit,
+				Currency: "usd",
+			},
+		}
+		if byModel {
+			result.LineItem = common.GetPointer(row.ModelName)
+		}
+		if byToken {
+			result.ProjectId = common.GetPointer(strconv.Itoa(row.TokenId))
+		}
+		if byGroup {
+			result.Group = common.GetPointer(row.Group)
+		}
+		return result
+	}))
+}
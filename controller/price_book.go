@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type priceBookVersionRequest struct {
+	Name          string                           `json:"name"`
+	Description   string                           `json:"description"`
+	EffectiveFrom int64                            `json:"effective_from"`
+	NotifyUsers   bool                             `json:"notify_users"`
+	Snapshot      *ratio_setting.PriceBookSnapshot `json:"snapshot"`
+}
+
+type priceBookVersionDetail struct {
+	*model.PriceBookVersion
+	Snapshot ratio_setting.PriceBookSnapshot `json:"snapshot"`
+	Changes  []ratio_setting.PriceBookChange `json:"changes"`
+}
+
+// buildPriceBookSnapshot 未提交的配置项沿用 base，便于只提交本次调整的部分
+func buildPriceBookSnapshot(req *priceBookVersionRequest, base ratio_setting.PriceBookSnapshot) (ratio_setting.PriceBookSnapshot, error) {
+	var snapshot ratio_setting.PriceBookSnapshot
+	if req.Snapshot != nil {
+		snapshot = *req.Snapshot
+	}
+	snapshot.FillMissing(base)
+	return snapshot, snapshot.Validate()
+}
+
+func getPriceBookVersionParam(c *gin.Context) (*model.PriceBookVersion, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return nil, false
+	}
+	version, err := model.GetPriceBookVersionById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return version, true
+}
+
+// GetPriceBookVersions 分页列出价格簿版本
+func GetPriceBookVersions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	versions, total, err := model.GetPriceBookVersions(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(versions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetPriceBookVersion 获取版本详情，附带与 against 版本（默认当前生效价格）的差异
+func GetPriceBookVersion(c *gin.Context) {
+	version, ok := getPriceBookVersionParam(c)
+	if !ok {
+		return
+	}
+	against, _ := strconv.Atoi(c.Query("against"))
+	base, err := service.PriceBookBaseSnapshot(against)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	snapshot, err := version.GetSnapshot()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, priceBookVersionDetail{
+		PriceBookVersion: version,
+		Snapshot:         snapshot,
+		Changes:          ratio_setting.DiffPriceBookSnapshots(base, snapshot),
+	})
+}
+
+// PreviewPriceBookVersion 预览一份价格配置相对当前生效价格的差异，不保存
+func PreviewPriceBookVersion(c *gin.Context) {
+	var req priceBookVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	base := ratio_setting.CurrentPriceBookSnapshot()
+	snapshot, err := buildPriceBookSnapshot(&req, base)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"changes": ratio_setting.DiffPriceBookSnapshots(base, snapshot),
+	})
+}
+
+// CreatePriceBookVersion 创建定时生效的价格簿版本
+func CreatePriceBookVersion(c *gin.Context) {
+	var req priceBookVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	if req.EffectiveFrom <= 0 {
+		common.ApiErrorMsg(c, "生效时间不能为空")
+		return
+	}
+	snapshot, err := buildPriceBookSnapshot(&req, ratio_setting.CurrentPriceBookSnapshot())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	version := &model.PriceBookVersion{
+		Name:          strings.TrimSpace(req.Name),
+		Description:   strings.TrimSpace(req.Description),
+		Status:        model.PriceBookStatusScheduled,
+		EffectiveFrom: req.EffectiveFrom,
+		NotifyUsers:   req.NotifyUsers,
+		CreatedBy:     c.GetInt("id"),
+	}
+	if err = version.SetSnapshot(snapshot); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.CreatePriceBookVersion(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, version)
+}
+
+// UpdatePriceBookVersion 修改尚未生效的版本，未提交的配置项保留原版本内容
+func UpdatePriceBookVersion(c *gin.Context) {
+	version, ok := getPriceBookVersionParam(c)
+	if !ok {
+		return
+	}
+	if version.Status != model.PriceBookStatusScheduled {
+		common.ApiErrorMsg(c, "仅可修改未生效的版本")
+		return
+	}
+	var req priceBookVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	base, err := version.GetSnapshot()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	snapshot, err := buildPriceBookSnapshot(&req, base)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.EffectiveFrom > 0 && req.EffectiveFrom != version.EffectiveFrom {
+		version.EffectiveFrom = req.EffectiveFrom
+		// 生效时间变更后需要重新通知
+		version.NotifiedAt = 0
+	}
+	version.Name = strings.TrimSpace(req.Name)
+	version.Description = strings.TrimSpace(req.Description)
+	version.NotifyUsers = req.NotifyUsers
+	if err = version.SetSnapshot(snapshot); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err = model.SavePriceBookVersion(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, version)
+}
+
+// CancelPriceBookVersion 取消尚未生效的版本
+func CancelPriceBookVersion(c *gin.Context) {
+	version, ok := getPriceBookVersionParam(c)
+	if !ok {
+		return
+	}
+	if version.Status != model.PriceBookStatusScheduled {
+		common.ApiErrorMsg(c, "仅可取消未生效的版本")
+		return
+	}
+	version.Status = model.PriceBookStatusCancelled
+	if err := model.SavePriceBookVersion(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, version)
+}
+
+// ActivatePriceBookVersion 立即生效指定版本，可用于回滚到历史版本
+func ActivatePriceBookVersion(c *gin.Context) {
+	version, ok := getPriceBookVersionParam(c)
+	if !ok {
+		return
+	}
+	if version.Status == model.PriceBookStatusCancelled {
+		common.ApiErrorMsg(c, "已取消的版本无法生效")
+		return
+	}
+	if err := service.ActivatePriceBookVersionNow(version); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, version)
+}
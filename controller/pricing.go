@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -39,16 +41,46 @@ func GetPricing(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"success":            true,
-		"data":               pricing,
-		"vendors":            model.GetVendors(),
-		"group_ratio":        groupRatio,
-		"usable_group":       usableGroup,
-		"supported_endpoint": model.GetSupportedEndpointMap(),
-		"auto_groups":        service.GetUserAutoGroup(group),
+		"success":               true,
+		"data":                  pricing,
+		"vendors":               model.GetVendors(),
+		"group_ratio":           groupRatio,
+		"group_pricing_windows": getGroupPricingWindows(groupRatio, time.Now()),
+		"usable_group":          usableGroup,
+		"supported_endpoint":    model.GetSupportedEndpointMap(),
+		"auto_groups":           service.GetUserAutoGroup(group),
 	})
 }
 
+type groupPricingWindowInfo struct {
+	Timezone string                                 `json:"timezone"`
+	Windows  []ratio_setting.GroupPricingWindow     `json:"windows"`
+	Active   *ratio_setting.GroupPricingWindowState `json:"active"`
+	Next     *ratio_setting.GroupPricingWindowState `json:"next"`
+}
+
+// getGroupPricingWindows 返回可用分组的分时计价窗口，包括当前生效窗口与下一个窗口，便于客户端安排批量任务
+func getGroupPricingWindows(groupRatio map[string]float64, now time.Time) map[string]groupPricingWindowInfo {
+	windows := make(map[string]groupPricingWindowInfo)
+	for group, schedule := range ratio_setting.GetGroupPricingSchedulesCopy() {
+		if _, ok := groupRatio[group]; !ok || len(schedule.Windows) == 0 {
+			continue
+		}
+		active, next := ratio_setting.GetGroupPricingWindows(group, now)
+		timezone := schedule.Timezone
+		if timezone == "" {
+			timezone = "UTC"
+		}
+		windows[group] = groupPricingWindowInfo{
+			Timezone: timezone,
+			Windows:  schedule.Windows,
+			Active:   active,
+			Next:     next,
+		}
+	}
+	return windows
+}
+
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := ratio_setting.DefaultModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
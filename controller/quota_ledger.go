@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserQuotaLedgers 查看指定用户的额度流水
+func GetUserQuotaLedgers(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	ledgers, total, err := model.GetUserQuotaLedgers(userId, c.Query("type"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetQuotaReconciliationReport 列出余额或已用额度与额度流水不一致的用户
+func GetQuotaReconciliationReport(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	items, total, err := model.GetQuotaReconciliationReport(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
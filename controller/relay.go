@@ -110,6 +110,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	if newAPIError = ensureChannelCapability(c, originalModel); newAPIError != nil {
+		return
+	}
+
 	meta := request.GetTokenCountMeta()
 
 	if shouldRejectDetectMagicString(relayFormat) && requestContainsDetectMagicString(request, meta) {
@@ -168,6 +172,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetPromptTokens(tokens)
 
+	if newAPIError = helper.ValidateContextWindow(relayInfo, tokens, meta); newAPIError != nil {
+		return
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -213,31 +221,80 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
-	for i := 0; i <= common.RetryTimes; i++ {
-		channel, err := getChannel(c, originalModel, i)
-		if err != nil {
-			logger.LogError(c, err.Error())
-			newAPIError = err
+	newAPIError = relayWithModelFallback(c, originalModel,
+		func(modelName string, useContextChannel bool) *types.NewAPIError {
+			return relayWithChannelRetry(c, relayInfo, relayFormat, modelName, useContextChannel)
+		},
+		func(fallbackModel string) bool {
+			return prepareFallbackModel(c, relayInfo, originalModel, fallbackModel, tokens, meta)
+		})
+
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		logger.LogInfo(c, retryLogStr)
+	}
+}
+
+// relayWithModelFallback 先在原模型的渠道间重试，重试耗尽且错误允许回退时依次切换到回退链中的模型；
+// relay 按模型转发并在其渠道间重试，prepare 将请求切换到回退模型，返回 false 时跳过该模型
+func relayWithModelFallback(c *gin.Context, originalModel string, relay func(modelName string, useContextChannel bool) *types.NewAPIError, prepare func(fallbackModel string) bool) *types.NewAPIError {
+	newAPIError := relay(originalModel, true)
+	if newAPIError == nil || !shouldFallback(c, newAPIError) {
+		return newAPIError
+	}
+	for _, fallbackModel := range service.GetModelFallbackChain(c, originalModel) {
+		if !prepare(fallbackModel) {
+			continue
+		}
+		logger.LogWarn(c, fmt.Sprintf("模型 %s 的渠道均不可用，回退到模型 %s", originalModel, fallbackModel))
+		newAPIError = relay(fallbackModel, false)
+		if newAPIError == nil || !shouldFallback(c, newAPIError) {
 			break
 		}
+	}
+	return newAPIError
+}
 
-		addUsedChannel(c, channel.Id)
-		requestBody, _ := common.GetRequestBody(c)
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-
+// relayWithChannelRetry 在模型的可用渠道间重试转发；useContextChannel 为 true 时首次使用分发阶段选出的渠道
+func relayWithChannelRetry(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, modelName string, useContextChannel bool) *types.NewAPIError {
+	pick := selectChannel
+	if useContextChannel {
+		pick = getChannel
+	}
+	return retryRelayChannels(c, modelName, pick, func() *types.NewAPIError {
 		switch relayFormat {
 		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
+			return relay.WssHelper(c, relayInfo)
 		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
+			return relay.ClaudeHelper(c, relayInfo)
 		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
+			return geminiRelayHandler(c, relayInfo)
 		default:
-			newAPIError = relayHandler(c, relayInfo)
+			return relayHandler(c, relayInfo)
+		}
+	})
+}
+
+// retryRelayChannels 按 pick 选出的渠道依次调用 attempt，直到成功、错误不可重试或重试次数耗尽
+func retryRelayChannels(c *gin.Context, modelName string, pick func(c *gin.Context, modelName string, retryCount int) (*model.Channel, *types.NewAPIError), attempt func() *types.NewAPIError) *types.NewAPIError {
+	var newAPIError *types.NewAPIError
+	for i := 0; i <= common.RetryTimes; i++ {
+		channel, err := pick(c, modelName, i)
+		if err != nil {
+			logger.LogError(c, err.Error())
+			return err
 		}
 
+		addUsedChannel(c, channel.Id)
+		requestBody, _ := common.GetRequestBody(c)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		c.Header(servedModelHeader, modelName)
+
+		newAPIError = attempt()
 		if newAPIError == nil {
-			return
+			service.RecordSessionAffinity(c)
+			return nil
 		}
 
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
@@ -246,12 +303,49 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 	}
+	return newAPIError
+}
 
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		logger.LogInfo(c, retryLogStr)
+// shouldFallback 判断渠道重试耗尽后是否可以回退到其他模型：仅在渠道不可用或上游故障时回退，
+// 请求本身错误、指定渠道或已向客户端写出响应时不回退
+func shouldFallback(c *gin.Context, err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if c.Writer.Written() {
+		return false
+	}
+	if err.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return true
+	}
+	if types.IsChannelError(err) {
+		return true
+	}
+	if types.IsSkipRetryError(err) {
+		return false
+	}
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode/100 == 5
+}
+
+// prepareFallbackModel 将请求切换到回退模型并按回退模型重新计价，回退模型不可用时返回 false
+func prepareFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, originalModel string, fallbackModel string, tokens int, meta *types.TokenCountMeta) bool {
+	previousModel := relayInfo.OriginModelName
+	relayInfo.OriginModelName = fallbackModel
+	if err := helper.ValidateContextWindow(relayInfo, tokens, meta); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("skip fallback model %s: %s", fallbackModel, err.Error()))
+		relayInfo.OriginModelName = previousModel
+		return false
+	}
+	if _, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("skip fallback model %s: %s", fallbackModel, err.Error()))
+		relayInfo.OriginModelName = previousModel
+		return false
 	}
+	relayInfo.FallbackFromModel = originalModel
+	return true
 }
 
 func shouldRejectDetectMagicString(relayFormat types.RelayFormat) bool {
@@ -285,8 +379,7 @@ var upgrader = websocket.Upgrader{
 }
 
 const forceRetryTempDisabledKey = "force_retry_temp_disabled_channel"
-const autoOneChannelKeyword = "auto-1"
-const autoOneLoadKeyword = "负载"
+const servedModelHeader = "X-Served-Model"
 
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
@@ -308,7 +401,29 @@ func getChannel(c *gin.Context, originalModel string, retryCount int) (*model.Ch
 			AutoBan: &autoBanInt,
 		}, nil
 	}
+	return selectChannel(c, originalModel, retryCount)
+}
+
+// ensureChannelCapability 分发阶段选出的渠道在请求解析前确定，若其映射后的模型不满足请求的能力要求，则按能力要求重新选择
+func ensureChannelCapability(c *gin.Context, originalModel string) *types.NewAPIError {
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return nil
+	}
+	if !service.HasCapabilityRequirement(c) {
+		return nil
+	}
+	channel, err := model.CacheGetChannel(c.GetInt("channel_id"))
+	if err != nil {
+		return nil
+	}
+	if missing := service.ChannelUnsatisfiedCapability(c, channel, originalModel); missing == "" {
+		return nil
+	}
+	_, newAPIError := selectChannel(c, originalModel, 0)
+	return newAPIError
+}
 
+func selectChannel(c *gin.Context, originalModel string, retryCount int) (*model.Channel, *types.NewAPIError) {
 	currentGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 	if currentGroup == "" {
 		currentGroup = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
@@ -428,11 +543,14 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
-	if strings.Contains(strings.ToLower(channelError.ChannelName), autoOneChannelKeyword) && containsAutoOneLoadKeyword(err) {
-		reason := fmt.Sprintf("auto-1 channel temporarily disabled due to error: %s", err.Error())
-		expireAt := service.TemporarilyDisableChannel(channelError.ChannelId, 5*time.Minute, reason)
-		logger.LogWarn(c, fmt.Sprintf("channel #%d (%s) matched auto-1 policy, temporarily disabled until %s", channelError.ChannelId, channelError.ChannelName, expireAt.Format(time.RFC3339)))
-		c.Set(forceRetryTempDisabledKey, true)
+	if channel, cacheErr := model.CacheGetChannel(channelError.ChannelId); cacheErr == nil {
+		otherSettings := channel.GetOtherSettings()
+		if keyword, ok := otherSettings.MatchTempDisableKeyword(err.Error()); ok {
+			reason := fmt.Sprintf("channel temporarily disabled due to error matching keyword %q: %s", keyword, err.Error())
+			expireAt := service.TemporarilyDisableChannel(channelError.ChannelId, otherSettings.GetTempDisableDuration(), reason)
+			logger.LogWarn(c, fmt.Sprintf("channel #%d (%s) matched temp disable keyword %q, temporarily disabled until %s", channelError.ChannelId, channelError.ChannelName, keyword, expireAt.Format(time.RFC3339)))
+			c.Set(forceRetryTempDisabledKey, true)
+		}
 	}
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
 		gopool.Go(func() {
@@ -487,13 +605,6 @@ func shouldForceRetryTemporarilyDisabledChannel(c *gin.Context, retryTimes int)
 	return true
 }
 
-func containsAutoOneLoadKeyword(err *types.NewAPIError) bool {
-	if err == nil {
-		return false
-	}
-	return strings.Contains(err.Error(), autoOneLoadKeyword)
-}
-
 func RelayMidjourney(c *gin.Context) {
 	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatMjProxy, nil, nil)
 
@@ -561,6 +672,157 @@ func RelayNotFound(c *gin.Context) {
 	})
 }
 
+// RelayCountTokens 处理 Claude / Gemini / Responses 的 token 计数请求，不扣费但计入速率限制
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	requestId := c.GetString(common.RequestIdKey)
+
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError != nil {
+			logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			if relayFormat == types.RelayFormatClaude {
+				c.JSON(newAPIError.StatusCode, gin.H{
+					"type":  "error",
+					"error": newAPIError.ToClaudeError(),
+				})
+			} else {
+				c.JSON(newAPIError.StatusCode, gin.H{
+					"error": newAPIError.ToOpenAIError(),
+				})
+			}
+		}
+	}()
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+
+	newAPIError = relay.CountTokensHelper(c, relayInfo)
+	if newAPIError != nil {
+		return
+	}
+	settleFreeUsageReservation(c, relayInfo)
+}
+
+// RelayStoredResponse 处理 response 的查询、删除、取消与输入项列表：转发到生成该 response 的渠道，
+// 渠道不可用时使用本地保存的内容
+func RelayStoredResponse(c *gin.Context) {
+	requestId := c.GetString(common.RequestIdKey)
+	responseId := c.Param("id")
+
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError != nil {
+			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"error": newAPIError.ToOpenAIError(),
+			})
+		}
+	}()
+
+	stored, err := model.GetStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		return
+	}
+	if stored == nil {
+		newAPIError = types.NewErrorWithStatusCode(fmt.Errorf("No response found with id '%s'", responseId), types.ErrorCodeInvalidRequest, http.StatusNotFound, types.ErrOptionWithSkipRetry())
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, nil, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+
+	channel, err := model.CacheGetChannel(stored.ChannelId)
+	if err == nil && channel.Status == common.ChannelStatusEnabled {
+		newAPIError = middleware.SetupContextForSelectedChannel(c, channel, stored.Model)
+		if newAPIError != nil {
+			return
+		}
+		relayInfo.InitChannelMeta(c)
+	}
+	if relayInfo.ChannelMeta != nil && relay.SupportsStoredResponses(relayInfo) {
+		newAPIError = relay.StoredResponseHelper(c, relayInfo)
+		if newAPIError == nil {
+			applyStoredResponseChange(c, stored)
+			settleFreeUsageReservation(c, relayInfo)
+			return
+		}
+		// 上游已不保存该 response 时，查询类请求回退到本地内容
+		if newAPIError.StatusCode != http.StatusNotFound || c.Request.Method != http.MethodGet || !stored.HasLocalContent() {
+			return
+		}
+	}
+
+	newAPIError = relayStoredResponseLocally(c, stored)
+	if newAPIError == nil {
+		settleFreeUsageReservation(c, relayInfo)
+	}
+}
+
+// applyStoredResponseChange 上游删除或取消成功后同步本地记录
+func applyStoredResponseChange(c *gin.Context, stored *model.StoredResponse) {
+	var err error
+	switch {
+	case c.Request.Method == http.MethodDelete:
+		err = model.DeleteStoredResponse(stored.UserId, stored.ResponseId)
+	case strings.HasSuffix(c.Request.URL.Path, "/cancel"):
+		err = model.UpdateStoredResponseStatus(stored.UserId, stored.ResponseId, model.StoredResponseStatusCancelled)
+	}
+	if err != nil {
+		logger.LogError(c, "failed to update stored response: "+err.Error())
+	}
+}
+
+func relayStoredResponseLocally(c *gin.Context, stored *model.StoredResponse) *types.NewAPIError {
+	switch {
+	case c.Request.Method == http.MethodDelete:
+		if err := model.DeleteStoredResponse(stored.UserId, stored.ResponseId); err != nil {
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":      stored.ResponseId,
+			"object":  "response",
+			"deleted": true,
+		})
+		return nil
+	case strings.HasSuffix(c.Request.URL.Path, "/cancel"):
+		return types.NewErrorWithStatusCode(errors.New("the channel that created this response is unavailable, it cannot be cancelled"), types.ErrorCodeGetChannelFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	if !stored.HasLocalContent() {
+		return types.NewErrorWithStatusCode(errors.New("the channel that created this response is unavailable and the response is not stored locally"), types.ErrorCodeGetChannelFailed, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+	if strings.HasSuffix(c.Request.URL.Path, "/input_items") {
+		inputItems, err := service.BuildLocalResponseInputItems(stored)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody, types.ErrOptionWithSkipRetry())
+		}
+		c.JSON(http.StatusOK, inputItems)
+		return nil
+	}
+	c.JSON(http.StatusOK, service.BuildLocalStoredResponse(stored))
+	return nil
+}
+
+// settleFreeUsageReservation 不计费的请求只占用请求次数
+func settleFreeUsageReservation(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
+	if err := service.SettleUsageReservation(relayInfo, 0, 0); err != nil {
+		logger.LogError(c, "settle usage reservation failed: "+err.Error())
+	}
+}
+
 func RelayTask(c *gin.Context) {
 	retryTimes := common.RetryTimes
 	channelId := c.GetInt("channel_id")
@@ -608,7 +870,7 @@ func RelayTask(c *gin.Context) {
 func taskRelayHandler(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.TaskError {
 	var err *dto.TaskError
 	switch relayInfo.RelayMode {
-	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID, relayconstant.RelayModeVideoFetchByID:
+	case relayconstant.RelayModeSunoFetch, relayconstant.RelayModeSunoFetchByID, relayconstant.RelayModeVideoFetchByID, relayconstant.RelayModeImageJobFetchByID:
 		err = relay.RelayTaskFetch(c, relayInfo.RelayMode)
 	default:
 		err = relay.RelayTaskSubmit(c, relayInfo)
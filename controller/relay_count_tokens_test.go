@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// countTokensTestUpstream 模拟上游计数接口：记录请求路径与请求体，按预设状态码返回
+type countTokensTestUpstream struct {
+	server *httptest.Server
+	calls  atomic.Int32
+	path   atomic.Value
+	body   atomic.Value
+}
+
+func newCountTokensTestUpstream(t *testing.T, status int, responseBody string) *countTokensTestUpstream {
+	t.Helper()
+	upstream := &countTokensTestUpstream{}
+	upstream.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstream.calls.Add(1)
+		upstream.path.Store(r.URL.Path)
+		upstream.body.Store(string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(responseBody))
+	}))
+	t.Cleanup(upstream.server.Close)
+	return upstream
+}
+
+func setupCountTokensTest(t *testing.T) {
+	t.Helper()
+	originalDB, originalCountToken := model.DB, constant.CountToken
+	t.Cleanup(func() {
+		model.DB = originalDB
+		constant.CountToken = originalCountToken
+	})
+	// 请求校验会读取模型能力元数据
+	db, err := gorm.Open(sqlite.Open("file:count-tokens-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.Model{}, &model.Vendor{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	model.DB = db
+	constant.CountToken = true
+	service.InitHttpClient()
+	service.InitTokenEncoders()
+	gin.SetMode(gin.TestMode)
+}
+
+// newCountTokensTestContext 构造分发中间件处理后的请求上下文：已选出渠道且请求体已缓存
+func newCountTokensTestContext(t *testing.T, path, body string, channelType int, baseURL string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	var request map[string]any
+	if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+		t.Fatal(err)
+	}
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "count-model")
+	common.SetContextKey(c, constant.ContextKeyChannelId, 1)
+	common.SetContextKey(c, constant.ContextKeyChannelType, channelType)
+	common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, baseURL)
+	common.SetContextKey(c, constant.ContextKeyChannelKey, "sk-test")
+	return c, recorder
+}
+
+func TestRelayCountTokens(t *testing.T) {
+	setupCountTokensTest(t)
+
+	claudeBody := `{"model":"count-model","messages":[{"role":"user","content":"hello, how many tokens is this?"}]}`
+	geminiBody := `{"contents":[{"role":"user","parts":[{"text":"hello, how many tokens is this?"}]}]}`
+	responsesBody := `{"model":"count-model","input":"hello, how many tokens is this?"}`
+
+	cases := []struct {
+		name         string
+		format       types.RelayFormat
+		path         string
+		body         string
+		channelType  int
+		upstream     int // 上游状态码，0 表示不应请求上游
+		upstreamPath string
+		upstreamBody string
+		wantBody     string   // 非空时要求原样返回上游响应
+		wantFields   []string // 本地计算时响应中应包含的字段
+	}{
+		{
+			name:         "claude forwards to upstream",
+			format:       types.RelayFormatClaude,
+			path:         "/v1/messages/count_tokens",
+			body:         claudeBody,
+			channelType:  constant.ChannelTypeAnthropic,
+			upstream:     http.StatusOK,
+			upstreamPath: "/v1/messages/count_tokens",
+			upstreamBody: `{"input_tokens":42}`,
+			wantBody:     `{"input_tokens":42}`,
+		},
+		{
+			name:         "gemini forwards to upstream",
+			format:       types.RelayFormatGemini,
+			path:         "/v1beta/models/count-model:countTokens",
+			body:         geminiBody,
+			channelType:  constant.ChannelTypeGemini,
+			upstream:     http.StatusOK,
+			upstreamPath: "/v1beta/models/count-model:countTokens",
+			upstreamBody: `{"totalTokens":42}`,
+			wantBody:     `{"totalTokens":42}`,
+		},
+		{
+			name:         "responses forwards to upstream",
+			format:       types.RelayFormatOpenAIResponses,
+			path:         "/v1/responses/input_tokens",
+			body:         responsesBody,
+			channelType:  constant.ChannelTypeOpenAI,
+			upstream:     http.StatusOK,
+			upstreamPath: "/v1/responses/input_tokens",
+			upstreamBody: `{"object":"response.input_tokens","input_tokens":42}`,
+			wantBody:     `{"object":"response.input_tokens","input_tokens":42}`,
+		},
+		{
+			name:         "claude falls back to local count when upstream fails",
+			format:       types.RelayFormatClaude,
+			path:         "/v1/messages/count_tokens",
+			body:         claudeBody,
+			channelType:  constant.ChannelTypeAnthropic,
+			upstream:     http.StatusInternalServerError,
+			upstreamPath: "/v1/messages/count_tokens",
+			upstreamBody: `{"error":"boom"}`,
+			wantFields:   []string{`"input_tokens":`},
+		},
+		{
+			name:         "gemini falls back to local count when upstream fails",
+			format:       types.RelayFormatGemini,
+			path:         "/v1beta/models/count-model:countTokens",
+			body:         geminiBody,
+			channelType:  constant.ChannelTypeGemini,
+			upstream:     http.StatusBadGateway,
+			upstreamPath: "/v1beta/models/count-model:countTokens",
+			upstreamBody: `{"error":"boom"}`,
+			wantFields:   []string{`"totalTokens":`},
+		},
+		{
+			name:        "claude format on a non-native channel counts locally",
+			format:      types.RelayFormatClaude,
+			path:        "/v1/messages/count_tokens",
+			body:        claudeBody,
+			channelType: constant.ChannelTypeOpenAI,
+			wantFields:  []string{`"input_tokens":`},
+		},
+		{
+			name:        "responses format on a non-native channel counts locally",
+			format:      types.RelayFormatOpenAIResponses,
+			path:        "/v1/responses/input_tokens",
+			body:        responsesBody,
+			channelType: constant.ChannelTypeAnthropic,
+			wantFields:  []string{`"object":"response.input_tokens"`, `"input_tokens":`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := tc.upstream
+			if status == 0 {
+				status = http.StatusOK
+			}
+			upstream := newCountTokensTestUpstream(t, status, tc.upstreamBody)
+			c, recorder := newCountTokensTestContext(t, tc.path, tc.body, tc.channelType, upstream.server.URL)
+
+			RelayCountTokens(c, tc.format)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+			}
+			if tc.upstream == 0 {
+				if upstream.calls.Load() != 0 {
+					t.Fatalf("expected no upstream request, got %d", upstream.calls.Load())
+				}
+			} else {
+				if upstream.calls.Load() != 1 {
+					t.Fatalf("expected 1 upstream request, got %d", upstream.calls.Load())
+				}
+				if got := upstream.path.Load(); got != tc.upstreamPath {
+					t.Fatalf("expected upstream path %s, got %v", tc.upstreamPath, got)
+				}
+				if got := upstream.body.Load(); got != tc.body {
+					t.Fatalf("expected request body to be forwarded as is, got %v", got)
+				}
+			}
+			got := strings.TrimSpace(recorder.Body.String())
+			if tc.wantBody != "" && got != tc.wantBody {
+				t.Fatalf("expected upstream response %s, got %s", tc.wantBody, got)
+			}
+			for _, field := range tc.wantFields {
+				if !strings.Contains(got, field) {
+					t.Fatalf("expected local count response to contain %s, got %s", field, got)
+				}
+			}
+			if strings.Contains(got, `:0`) {
+				t.Fatalf("expected a positive token count, got %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackTestRelay 模拟各模型的渠道：记录每次尝试的模型，按模型返回预设的状态码，0 表示成功
+type fallbackTestRelay struct {
+	statusByModel map[string]int
+	attempts      []string
+}
+
+func (r *fallbackTestRelay) relay(c *gin.Context, modelName string) *types.NewAPIError {
+	channelId := 0
+	pick := func(c *gin.Context, modelName string, retryCount int) (*model.Channel, *types.NewAPIError) {
+		channelId++
+		return &model.Channel{Id: channelId, Name: modelName}, nil
+	}
+	return retryRelayChannels(c, modelName, pick, func() *types.NewAPIError {
+		r.attempts = append(r.attempts, modelName)
+		status := r.statusByModel[modelName]
+		if status == 0 {
+			return nil
+		}
+		return types.NewOpenAIError(errors.New("upstream error"), types.ErrorCodeBadResponseStatusCode, status)
+	})
+}
+
+func newRelayFallbackTestContext(t *testing.T, chain []string) *gin.Context {
+	t.Helper()
+	settings := model_setting.GetModelFallbackSettings()
+	originalSettings := *settings
+	originalRetryTimes := common.RetryTimes
+	originalMemoryCache := common.MemoryCacheEnabled
+	originalAutoDisable := common.AutomaticDisableChannelEnabled
+	originalErrorLog := constant.ErrorLogEnabled
+	t.Cleanup(func() {
+		*settings = originalSettings
+		common.RetryTimes = originalRetryTimes
+		common.MemoryCacheEnabled = originalMemoryCache
+		common.AutomaticDisableChannelEnabled = originalAutoDisable
+		constant.ErrorLogEnabled = originalErrorLog
+	})
+	settings.Enabled = true
+	settings.Chains = map[string]map[string][]string{"gpt-4o": {"*": chain}}
+	common.RetryTimes = 2
+	// 渠道缓存为空时不会查询数据库
+	common.MemoryCacheEnabled = true
+	common.AutomaticDisableChannelEnabled = false
+	constant.ErrorLogEnabled = false
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	return c
+}
+
+func TestRelayWithModelFallback(t *testing.T) {
+	cases := []struct {
+		name          string
+		chain         []string
+		statusByModel map[string]int
+		skip          map[string]bool
+		wantAttempts  []string
+		wantStatus    int
+	}{
+		{
+			name:          "falls back after channel retries are exhausted",
+			chain:         []string{"gpt-4o-mini", "claude-3-5-sonnet"},
+			statusByModel: map[string]int{"gpt-4o": http.StatusInternalServerError},
+			wantAttempts:  []string{"gpt-4o", "gpt-4o", "gpt-4o", "gpt-4o-mini"},
+		},
+		{
+			name:          "walks the chain in order",
+			chain:         []string{"gpt-4o-mini", "claude-3-5-sonnet"},
+			statusByModel: map[string]int{"gpt-4o": http.StatusTooManyRequests, "gpt-4o-mini": http.StatusServiceUnavailable},
+			wantAttempts:  []string{"gpt-4o", "gpt-4o", "gpt-4o", "gpt-4o-mini", "gpt-4o-mini", "gpt-4o-mini", "claude-3-5-sonnet"},
+		},
+		{
+			name:          "skips fallback models that cannot be prepared",
+			chain:         []string{"gpt-4o-mini", "claude-3-5-sonnet"},
+			statusByModel: map[string]int{"gpt-4o": http.StatusInternalServerError},
+			skip:          map[string]bool{"gpt-4o-mini": true},
+			wantAttempts:  []string{"gpt-4o", "gpt-4o", "gpt-4o", "claude-3-5-sonnet"},
+		},
+		{
+			name:         "no fallback when the original model succeeds",
+			chain:        []string{"gpt-4o-mini"},
+			wantAttempts: []string{"gpt-4o"},
+		},
+		{
+			name:          "no fallback for client errors",
+			chain:         []string{"gpt-4o-mini"},
+			statusByModel: map[string]int{"gpt-4o": http.StatusBadRequest},
+			wantAttempts:  []string{"gpt-4o"},
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "returns the last error when the chain is exhausted",
+			chain:         []string{"gpt-4o-mini"},
+			statusByModel: map[string]int{"gpt-4o": http.StatusInternalServerError, "gpt-4o-mini": http.StatusBadGateway},
+			wantAttempts:  []string{"gpt-4o", "gpt-4o", "gpt-4o", "gpt-4o-mini", "gpt-4o-mini", "gpt-4o-mini"},
+			wantStatus:    http.StatusBadGateway,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newRelayFallbackTestContext(t, tc.chain)
+			relay := &fallbackTestRelay{statusByModel: tc.statusByModel}
+			useContextChannel := make(map[string]bool)
+			newAPIError := relayWithModelFallback(c, "gpt-4o",
+				func(modelName string, fromContext bool) *types.NewAPIError {
+					useContextChannel[modelName] = fromContext
+					return relay.relay(c, modelName)
+				},
+				func(fallbackModel string) bool {
+					return !tc.skip[fallbackModel]
+				})
+
+			if !reflect.DeepEqual(relay.attempts, tc.wantAttempts) {
+				t.Fatalf("expected attempts %v, got %v", tc.wantAttempts, relay.attempts)
+			}
+			if tc.wantStatus == 0 {
+				if newAPIError != nil {
+					t.Fatalf("expected success, got %v", newAPIError)
+				}
+			} else if newAPIError == nil || newAPIError.StatusCode != tc.wantStatus {
+				t.Fatalf("expected status %d, got %v", tc.wantStatus, newAPIError)
+			}
+			// 只有原模型使用分发阶段选出的渠道
+			for modelName, fromContext := range useContextChannel {
+				if fromContext != (modelName == "gpt-4o") {
+					t.Fatalf("unexpected context channel usage for %s: %v", modelName, fromContext)
+				}
+			}
+			if got := c.Writer.Header().Get(servedModelHeader); got != relay.attempts[len(relay.attempts)-1] {
+				t.Fatalf("expected served model header %s, got %s", relay.attempts[len(relay.attempts)-1], got)
+			}
+		})
+	}
+}
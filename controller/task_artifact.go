@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMediaArtifact 通过签名网关地址读取归档文件，无需令牌
+func GetMediaArtifact(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if id <= 0 || !service.VerifyMediaArtifactSignature(id, expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"message": "invalid or expired signature",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	artifact, err := model.GetTaskArtifactById(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "media not found",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	serveMediaArtifact(c, artifact)
+}
+
+// serveMediaArtifact 对象存储重定向到预签名地址，本地磁盘直接返回文件
+func serveMediaArtifact(c *gin.Context, artifact *model.TaskArtifact) {
+	redirectURL, localPath, err := service.ResolveMediaArtifact(c.Request.Context(), artifact)
+	if err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve media artifact %d: %s", artifact.Id, err.Error()))
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "media not available",
+				"type":    "server_error",
+			},
+		})
+		return
+	}
+	if redirectURL != "" {
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+	c.Header("Content-Type", artifact.ContentType)
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.File(localPath)
+}
+
+// GetUserTaskArtifacts 当前用户的归档文件列表，可按 task_id 过滤
+func GetUserTaskArtifacts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	artifacts, total, err := model.GetUserTaskArtifacts(c.GetInt("id"), c.Query("task_id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, artifact := range artifacts {
+		artifact.Url = service.MediaArtifactURL(artifact)
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(artifacts)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetUserTaskArtifactUsage 当前用户的归档存储占用
+func GetUserTaskArtifactUsage(c *gin.Context) {
+	usage, err := model.GetUserTaskArtifactUsage(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, usage)
+}
+
+// GetTaskArtifactUsages 管理员查看各用户的归档存储占用
+func GetTaskArtifactUsages(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	usages, total, err := model.GetTaskArtifactUsages(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(usages)
+	common.ApiSuccess(c, pageInfo)
+}
@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// taskPollLease 任务被取出后推迟的下次拉取时间，拉取结束后按最新进度重新计算；节点中途退出时由其他节点在租约过期后接手
+const taskPollLease = 5 * time.Minute
+
+// TaskPlatformPollStats 当前节点上各平台最近一轮拉取的情况
+type TaskPlatformPollStats struct {
+	Running        bool   `json:"running"`
+	LastStartedAt  int64  `json:"last_started_at"`
+	LastDurationMs int64  `json:"last_duration_ms"`
+	LastPolled     int    `json:"last_polled"`
+	LastTimedOut   int    `json:"last_timed_out"`
+	TotalPolled    int64  `json:"total_polled"`
+	TotalTimedOut  int64  `json:"total_timed_out"`
+	LastError      string `json:"last_error"`
+}
+
+// TaskPlatformPollStatus 平台积压与当前节点的拉取情况
+type TaskPlatformPollStatus struct {
+	model.TaskBacklog
+	TaskPlatformPollStats
+}
+
+var (
+	taskPollLock  sync.Mutex
+	taskPollStats = make(map[constant.TaskPlatform]*TaskPlatformPollStats)
+)
+
+// TaskPollDispatchInterval 任务轮询调度的检查间隔
+func TaskPollDispatchInterval() time.Duration {
+	return time.Duration(max(operation_setting.GetTaskPollSetting().DispatchIntervalSeconds, 1)) * time.Second
+}
+
+// UpdateTaskBulk 按平台取出到达下次拉取时间的未完成任务并分发拉取，由后台任务调度器定期调用
+// 各平台分别取出、在独立协程中拉取，上一轮仍未结束的平台本轮不取任务，慢平台不会占用其他平台的名额
+func UpdateTaskBulk() error {
+	setting := operation_setting.GetTaskPollSetting()
+	now := time.Now()
+	platforms, err := model.GetDueTaskPlatforms(now.Unix())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range platforms {
+		platform := constant.TaskPlatform(name)
+		if !beginTaskPlatformPoll(platform, now) {
+			continue
+		}
+		tasks, err := model.GetDueUnfinishedTasks(name, now.Unix(), max(setting.BatchSize, 1))
+		if err == nil && len(tasks) > 0 {
+			ids := make([]int64, 0, len(tasks))
+			for _, task := range tasks {
+				ids = append(ids, task.ID)
+			}
+			// 先推迟本轮取出的任务，避免拉取期间被下一轮重复取出
+			err = model.TaskBulkUpdateByID(ids, map[string]any{"next_poll_at": now.Add(taskPollLease).Unix()})
+		}
+		if err != nil || len(tasks) == 0 {
+			finishTaskPlatformPoll(platform, now, 0, 0, err)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		gopool.Go(func() {
+			pollTaskPlatform(platform, tasks)
+		})
+	}
+	return errors.Join(errs...)
+}
+
+func pollTaskPlatform(platform constant.TaskPlatform, tasks []*model.Task) {
+	startedAt := time.Now()
+	ctx := context.Background()
+	setting := operation_setting.GetTaskPollSetting()
+
+	tasks, timedOut := failTimedOutTasks(ctx, platform, tasks, startedAt)
+
+	taskChannelM := make(map[int][]string)
+	taskM := make(map[string]*model.Task)
+	nullTaskIds := make([]int64, 0)
+	nullTasks := make([]*model.Task, 0)
+	for _, task := range tasks {
+		if task.TaskID == "" {
+			// 统计失败的未完成任务
+			nullTaskIds = append(nullTaskIds, task.ID)
+			nullTasks = append(nullTasks, task)
+			continue
+		}
+		taskM[task.TaskID] = task
+		taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
+	}
+	var errLock sync.Mutex
+	var pollErr error
+	if len(nullTaskIds) > 0 {
+		pollErr = model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if pollErr != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", pollErr))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+			settleFailedTasks(ctx, nullTasks, "")
+		}
+	}
+
+	// 每个渠道一个工作协程，同一平台最多 PlatformConcurrency 个渠道同时拉取；
+	// 每个渠道拉取结束后立即安排其任务的下次拉取，不等待同平台的其他渠道
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, max(setting.PlatformConcurrency, 1))
+	for channelId, taskIds := range taskChannelM {
+		wg.Add(1)
+		workers <- struct{}{}
+		gopool.Go(func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			UpdateTaskByPlatform(platform, map[int][]string{channelId: taskIds}, taskM)
+			if err := rescheduleTasks(setting, taskM, taskIds); err != nil {
+				errLock.Lock()
+				pollErr = err
+				errLock.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	finishTaskPlatformPoll(platform, startedAt, len(taskM), timedOut, pollErr)
+}
+
+// rescheduleTasks 按拉取后的进度安排未结束任务的下次拉取
+func rescheduleTasks(setting *operation_setting.TaskPollSetting, taskM map[string]*model.Task, taskIds []string) error {
+	now := time.Now()
+	var lastErr error
+	for _, taskId := range taskIds {
+		task := taskM[taskId]
+		if task == nil || task.Status == model.TaskStatusSuccess || task.Status == model.TaskStatusFailure {
+			continue
+		}
+		if err := model.UpdateTaskNextPollAt(task.ID, now.Add(taskPollInterval(setting, task, now)).Unix()); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// taskPollInterval 计算任务下次拉取的间隔：从平台最小间隔开始随任务已运行时长线性增加，接近完成时回到最小间隔
+func taskPollInterval(setting *operation_setting.TaskPollSetting, task *model.Task, now time.Time) time.Duration {
+	minInterval := setting.GetMinIntervalSeconds(string(task.Platform))
+	maxInterval := max(setting.MaxIntervalSeconds, minInterval)
+	interval := float64(minInterval)
+	if age := now.Unix() - task.SubmitTime; task.SubmitTime > 0 && age > 0 {
+		interval += float64(age) * setting.AgeBackoffRatio
+	}
+	if setting.NearCompleteProgress > 0 && parseTaskProgress(task.Progress) >= setting.NearCompleteProgress {
+		interval = float64(minInterval)
+	}
+	interval = min(max(interval, float64(minInterval)), float64(maxInterval))
+	return time.Duration(interval * float64(time.Second))
+}
+
+func parseTaskProgress(progress string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(progress, "%")))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// failTimedOutTasks 将超过平台超时时长仍未完成的任务标记为失败并退还额度，返回其余任务与超时任务数
+func failTimedOutTasks(ctx context.Context, platform constant.TaskPlatform, tasks []*model.Task, now time.Time) ([]*model.Task, int) {
+	timeoutMinutes := operation_setting.GetTaskPollSetting().GetTimeoutMinutes(string(platform))
+	if timeoutMinutes <= 0 {
+		return tasks, 0
+	}
+	deadline := now.Add(-time.Duration(timeoutMinutes) * time.Minute).Unix()
+	remaining := tasks[:0:0]
+	timedOut := 0
+	for _, task := range tasks {
+		if task.SubmitTime <= 0 || task.SubmitTime > deadline {
+			remaining = append(remaining, task)
+			continue
+		}
+		reason := fmt.Sprintf("任务超时（超过 %d 分钟未完成）", timeoutMinutes)
+		failed, err := model.FailUnfinishedTask(task.ID, reason, now.Unix())
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to mark task %s as timed out: %s", task.TaskID, err.Error()))
+			continue
+		}
+		if !failed {
+			continue
+		}
+		timedOut++
+		task.Status = model.TaskStatusFailure
+		task.Progress = "100%"
+		task.FailReason = reason
+		task.FinishTime = now.Unix()
+		logger.LogInfo(ctx, fmt.Sprintf("Task %s timed out after %d minutes", task.TaskID, timeoutMinutes))
+		service.RefundFailedTask(ctx, task, model.TaskRefundReasonTimeout)
+		service.NotifyTaskStatusChanged(task)
+	}
+	return remaining, timedOut
+}
+
+// failTaskBulk 渠道不可用等原因批量标记失败后，同步内存中的任务状态并按退款策略退还额度
+func failTaskBulk(ctx context.Context, taskIds []string, taskM map[string]*model.Task, failReason string) {
+	tasks := make([]*model.Task, 0, len(taskIds))
+	for _, taskId := range taskIds {
+		if task := taskM[taskId]; task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+	settleFailedTasks(ctx, tasks, failReason)
+}
+
+func settleFailedTasks(ctx context.Context, tasks []*model.Task, failReason string) {
+	for _, task := range tasks {
+		preStatus := task.Status
+		task.Status = model.TaskStatusFailure
+		task.Progress = "100%"
+		if failReason != "" {
+			task.FailReason = failReason
+		}
+		service.RefundFailedTask(ctx, task, model.TaskRefundReasonFailed)
+		if preStatus != task.Status {
+			service.NotifyTaskStatusChanged(task)
+		}
+	}
+}
+
+func beginTaskPlatformPoll(platform constant.TaskPlatform, now time.Time) bool {
+	taskPollLock.Lock()
+	defer taskPollLock.Unlock()
+	stats := taskPollStats[platform]
+	if stats == nil {
+		stats = &TaskPlatformPollStats{}
+		taskPollStats[platform] = stats
+	}
+	if stats.Running {
+		return false
+	}
+	stats.Running = true
+	stats.LastStartedAt = now.Unix()
+	return true
+}
+
+func finishTaskPlatformPoll(platform constant.TaskPlatform, startedAt time.Time, polled int, timedOut int, err error) {
+	taskPollLock.Lock()
+	defer taskPollLock.Unlock()
+	stats := taskPollStats[platform]
+	stats.Running = false
+	stats.LastDurationMs = time.Since(startedAt).Milliseconds()
+	stats.LastPolled = polled
+	stats.LastTimedOut = timedOut
+	stats.TotalPolled += int64(polled)
+	stats.TotalTimedOut += int64(timedOut)
+	stats.LastError = ""
+	if err != nil {
+		stats.LastError = err.Error()
+		common.SysLog(fmt.Sprintf("task poll of platform %s failed: %s", platform, err.Error()))
+	}
+}
+
+// GetTaskPollStatus 各平台未完成任务积压与当前节点的拉取情况
+func GetTaskPollStatus(c *gin.Context) {
+	backlog, err := model.GetTaskBacklog(time.Now().Unix())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	statuses := make(map[string]*TaskPlatformPollStatus, len(backlog))
+	for _, item := range backlog {
+		statuses[item.Platform] = &TaskPlatformPollStatus{TaskBacklog: *item}
+	}
+	taskPollLock.Lock()
+	for platform, stats := range taskPollStats {
+		status := statuses[string(platform)]
+		if status == nil {
+			status = &TaskPlatformPollStatus{TaskBacklog: model.TaskBacklog{Platform: string(platform)}}
+			statuses[string(platform)] = status
+		}
+		status.TaskPlatformPollStats = *stats
+	}
+	taskPollLock.Unlock()
+
+	platforms := make([]*TaskPlatformPollStatus, 0, len(statuses))
+	for _, status := range statuses {
+		platforms = append(platforms, status)
+	}
+	sort.Slice(platforms, func(i, j int) bool {
+		return platforms[i].Platform < platforms[j].Platform
+	})
+	common.ApiSuccess(c, gin.H{
+		"node_id":   common.GetNodeId(),
+		"platforms": platforms,
+	})
+}
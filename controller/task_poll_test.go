@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTaskPollInterval(t *testing.T) {
+	setting := &operation_setting.TaskPollSetting{
+		MinIntervalSeconds:         10,
+		MaxIntervalSeconds:         300,
+		AgeBackoffRatio:            0.1,
+		NearCompleteProgress:       90,
+		PlatformMinIntervalSeconds: map[string]int{"suno": 5},
+	}
+	now := time.Now()
+	cases := []struct {
+		name     string
+		task     *model.Task
+		expected time.Duration
+	}{
+		{"new task", &model.Task{Platform: "1", SubmitTime: now.Unix()}, 10 * time.Second},
+		{"ten minutes old", &model.Task{Platform: "1", SubmitTime: now.Add(-10 * time.Minute).Unix(), Progress: "30%"}, 70 * time.Second},
+		{"capped", &model.Task{Platform: "1", SubmitTime: now.Add(-24 * time.Hour).Unix()}, 300 * time.Second},
+		{"near complete", &model.Task{Platform: "1", SubmitTime: now.Add(-time.Hour).Unix(), Progress: "95%"}, 10 * time.Second},
+		{"platform minimum", &model.Task{Platform: "suno", SubmitTime: now.Unix()}, 5 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := taskPollInterval(setting, tc.task, now); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestTaskPollDueTasksAndTimeout(t *testing.T) {
+	setting := operation_setting.GetTaskPollSetting()
+	originalDB, originalTimeouts := model.DB, setting.PlatformTimeoutMinutes
+	t.Cleanup(func() {
+		model.DB = originalDB
+		setting.PlatformTimeoutMinutes = originalTimeouts
+	})
+	db, err := gorm.Open(sqlite.Open("file:task-poll-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Task{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	model.DB = db
+	setting.PlatformTimeoutMinutes = map[string]int{"1": 60}
+
+	now := time.Now()
+	tasks := []*model.Task{
+		{TaskID: "due", Platform: "1", Status: model.TaskStatusInProgress, Progress: "30%", SubmitTime: now.Add(-time.Minute).Unix()},
+		{TaskID: "stale", Platform: "1", Status: model.TaskStatusInProgress, Progress: "30%", SubmitTime: now.Add(-2 * time.Hour).Unix()},
+		{TaskID: "later", Platform: "1", Status: model.TaskStatusQueued, Progress: "20%", SubmitTime: now.Unix(), NextPollAt: now.Add(time.Minute).Unix()},
+		{TaskID: "done", Platform: "1", Status: model.TaskStatusSuccess, Progress: "100%", SubmitTime: now.Unix()},
+		{TaskID: "suno", Platform: "suno", Status: model.TaskStatusInProgress, Progress: "30%", SubmitTime: now.Unix(), NextPollAt: now.Add(-time.Hour).Unix()},
+	}
+	for _, task := range tasks {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	platforms, err := model.GetDueTaskPlatforms(now.Unix())
+	if err != nil || len(platforms) != 2 || platforms[0] != "1" || platforms[1] != "suno" {
+		t.Fatalf("expected both platforms to be due, got %v, %v", platforms, err)
+	}
+	// 按平台取出，更早到期的其他平台任务不占用该平台的名额
+	due, err := model.GetDueUnfinishedTasks("1", now.Unix(), 1)
+	if err != nil || len(due) != 1 || due[0].Platform != "1" {
+		t.Fatalf("expected 1 due task of platform 1, got %d, %v", len(due), err)
+	}
+	due, err = model.GetDueUnfinishedTasks("1", now.Unix(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 {
+		t.Fatalf("expected 2 due tasks, got %d", len(due))
+	}
+	backlog, err := model.GetTaskBacklog(now.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlog) != 2 || backlog[0].Unfinished != 3 || backlog[0].Due != 2 || backlog[0].OldestSubmitTime != tasks[1].SubmitTime {
+		t.Fatalf("unexpected backlog: %+v", backlog[0])
+	}
+
+	remaining, timedOut := failTimedOutTasks(context.Background(), constant.TaskPlatform("1"), due, now)
+	if timedOut != 1 || len(remaining) != 1 || remaining[0].TaskID != "due" {
+		t.Fatalf("expected stale task to time out, got %d timed out and %d remaining", timedOut, len(remaining))
+	}
+	stale := &model.Task{}
+	if err := db.First(stale, tasks[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stale.Status != model.TaskStatusFailure || stale.Progress != "100%" || stale.FinishTime != now.Unix() {
+		t.Fatalf("unexpected timed out task: %+v", stale)
+	}
+	// 已结束的任务不会再次被标记
+	if failed, err := model.FailUnfinishedTask(tasks[1].ID, "again", now.Unix()); err != nil || failed {
+		t.Fatalf("finished task should not be failed again: %v %v", failed, err)
+	}
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserTaskRefunds 当前用户的异步任务退款记录
+func GetUserTaskRefunds(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	refunds, total, err := model.GetUserTaskRefunds(c.GetInt("id"), c.Query("task_id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(refunds)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetTaskRefunds 所有用户的异步任务退款记录，可按用户与任务 ID 过滤
+func GetTaskRefunds(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	refunds, total, err := model.GetTaskRefunds(userId, c.Query("task_id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(refunds)
+	common.ApiSuccess(c, pageInfo)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -15,8 +16,12 @@ import (
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
 )
 
 func UpdateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
@@ -35,13 +40,16 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	}
 	cacheGetChannel, err := model.CacheGetChannel(channelId)
 	if err != nil {
+		failReason := fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId)
 		errUpdate := model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("Failed to get channel info, channel ID: %d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if errUpdate != nil {
 			common.SysLog(fmt.Sprintf("UpdateVideoTask error: %v", errUpdate))
+		} else {
+			failTaskBulk(ctx, taskIds, taskM, failReason)
 		}
 		return fmt.Errorf("CacheGetChannel failed: %w", err)
 	}
@@ -55,11 +63,23 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	}
 	info.ApiKey = cacheGetChannel.Key
 	adaptor.Init(info)
+	// 视频任务逐个查询，同一渠道最多 ChannelConcurrency 个请求同时进行
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, max(operation_setting.GetTaskPollSetting().ChannelConcurrency, 1))
 	for _, taskId := range taskIds {
-		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
-			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
-		}
+		wg.Add(1)
+		workers <- struct{}{}
+		gopool.Go(func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
+			}
+		})
 	}
+	wg.Wait()
 	return nil
 }
 
@@ -118,9 +138,6 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		taskResult = relaycommon.FailTaskInfo("upstream returned empty status")
 	}
 
-	// 记录原本的状态，防止重复退款
-	shouldRefund := false
-	quota := task.Quota
 	preStatus := task.Status
 
 	task.Status = model.TaskStatus(taskResult.Status)
@@ -191,7 +208,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 									logger.LogQuota(int64(preConsumedQuota)),
 									taskResult.TotalTokens,
 								))
-								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
+								if err := model.DecreaseUserQuota(task.UserId, quotaDelta, model.QuotaLedgerTypeConsume); err != nil {
 									logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
 								} else {
 									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
@@ -214,7 +231,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 									logger.LogQuota(int64(preConsumedQuota)),
 									taskResult.TotalTokens,
 								))
-								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
+								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false, model.QuotaLedgerTypeRefund); err != nil {
 									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
 								} else {
 									task.Quota = actualQuota // 更新任务记录的实际扣费额度
@@ -245,13 +262,6 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		task.FailReason = taskResult.Reason
 		logger.LogInfo(ctx, fmt.Sprintf("Task %s failed: %s", task.TaskID, task.FailReason))
 		taskResult.Progress = "100%"
-		if quota != 0 {
-			if preStatus != model.TaskStatusFailure {
-				shouldRefund = true
-			} else {
-				logger.LogWarn(ctx, fmt.Sprintf("Task %s already in failure status, skip refund", task.TaskID))
-			}
-		}
 	default:
 		return fmt.Errorf("unknown task status %s for task %s", taskResult.Status, taskId)
 	}
@@ -260,18 +270,17 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	}
 	if err := task.Update(); err != nil {
 		common.SysLog("UpdateVideoTask task error: " + err.Error())
-		shouldRefund = false
+		return nil
 	}
-
-	if shouldRefund {
-		// 任务失败且之前状态不是失败才退还额度，防止重复退还
-		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
-			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
-		}
-		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(int64(quota)))
-		model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
+	// 退款记录保证同一任务只退还一次
+	if task.Status == model.TaskStatusFailure {
+		service.RefundFailedTask(ctx, task, model.TaskRefundReasonFailed)
+	} else if task.Status == model.TaskStatusSuccess {
+		service.RefundPartialTask(ctx, task, taskResult.TotalOutputs, taskResult.FailedOutputs)
+	}
+	if task.Status != preStatus {
+		notifyVideoTaskStatusChanged(task)
 	}
-
 	return nil
 }
 
@@ -308,3 +317,22 @@ func truncateBase64(s string) string {
 	}
 	return s[:maxKeep] + "..."
 }
+
+// notifyVideoTaskStatusChanged 任务成功且启用了生成结果归档时，先归档视频再发送状态回调
+func notifyVideoTaskStatusChanged(task *model.Task) {
+	if task.Status != model.TaskStatusSuccess || !service.IsMediaArchiveEnabled() {
+		service.NotifyTaskStatusChanged(task)
+		return
+	}
+	if task.Platform == constant.TaskPlatformMidjourney {
+		service.ArchiveTaskMediaAndNotify(task, []service.MediaSource{{Url: task.FailReason, Kind: model.TaskArtifactKindImage}})
+		return
+	}
+	source, err := resolveVideoContentSource(task)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to resolve video content of task %s: %s", task.TaskID, err.Error()))
+		service.NotifyTaskStatusChanged(task)
+		return
+	}
+	service.ArchiveTaskMediaAndNotify(task, []service.MediaSource{source})
+}
@@ -150,6 +150,20 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if _, err := model.ParseTokenModelFallbacks(token.ModelFallbacks); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := service.ValidateTaskCallback(token.TaskCallbackUrl, token.TaskCallbackSecret); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -189,6 +203,9 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              primaryGroup,
 		Groups:             model.TokenGroups(orderedGroups),
+		ModelFallbacks:     token.ModelFallbacks,
+		TaskCallbackUrl:    token.TaskCallbackUrl,
+		TaskCallbackSecret: token.TaskCallbackSecret,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -233,6 +250,20 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if _, err := model.ParseTokenModelFallbacks(token.ModelFallbacks); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := service.ValidateTaskCallback(token.TaskCallbackUrl, token.TaskCallbackSecret); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -292,6 +323,9 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = primaryGroup
 		cleanToken.Groups = model.TokenGroups(orderedGroups)
+		cleanToken.ModelFallbacks = token.ModelFallbacks
+		cleanToken.TaskCallbackUrl = token.TaskCallbackUrl
+		cleanToken.TaskCallbackSecret = token.TaskCallbackSecret
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -316,6 +316,9 @@ func EpayNotify(c *gin.Context) {
 			if err := tx.Model(&model.User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 				return err
 			}
+			if err := model.RecordQuotaLedgerTx(tx, topUp.UserId, model.QuotaLedgerTypeTopUp, int64(quotaToAdd), 0, topUp.TradeNo); err != nil {
+				return err
+			}
 
 			var rebateErr error
 			rebateResult, rebateErr = model.ApplyAffRebateTx(tx, topUp.UserId, topUp.Id, int64(quotaToAdd), topUp.Money)
@@ -1415,6 +1415,7 @@ type UpdateUserSettingRequest struct {
 	AcceptUnsetModelRatioModel bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                bool    `json:"record_ip_log"`
 	AllowTrainingDataGroups    bool    `json:"allow_training_data_groups"`
+	UsageReportEnabled         bool    `json:"usage_report_enabled"`
 }
 
 func UpdateUserSetting(c *gin.Context) {
@@ -1471,6 +1472,7 @@ func UpdateUserSetting(c *gin.Context) {
 	settings.AcceptUnsetRatioModel = req.AcceptUnsetModelRatioModel
 	settings.RecordIpLog = req.RecordIpLog
 	settings.AllowTrainingDataGroups = req.AllowTrainingDataGroups
+	settings.UsageReportEnabled = req.UsageReportEnabled
 
 	// 更新用户设置
 	user.SetSetting(settings)
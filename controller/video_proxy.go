@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -58,30 +60,32 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
-	channel, err := model.CacheGetChannel(task.ChannelId)
+	for _, artifact := range service.GetArchivedTaskMedia(string(task.Platform), task.TaskID) {
+		if artifact.Kind == model.TaskArtifactKindVideo {
+			serveMediaArtifact(c, artifact)
+			return
+		}
+	}
+
+	source, err := resolveVideoContentSource(task)
 	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get task %s: not found", taskID))
-		c.JSON(http.StatusInternalServerError, gin.H{
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve video content of task %s: %s", taskID, err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{
 			"error": gin.H{
-				"message": "Failed to retrieve channel information",
+				"message": "Failed to resolve video content URL",
 				"type":    "server_error",
 			},
 		})
 		return
 	}
-	baseURL := channel.GetBaseURL()
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
-	}
-
-	var videoURL string
+	videoURL := source.Url
 	client := &http.Client{
 		Timeout: 60 * time.Second,
 	}
 
-	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, "", nil)
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, videoURL, nil)
 	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create request: %s", err.Error()))
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create request for %s: %s", videoURL, err.Error()))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"message": "Failed to create proxy request",
@@ -90,52 +94,8 @@ func VideoProxy(c *gin.Context) {
 		})
 		return
 	}
-
-	switch channel.Type {
-	case constant.ChannelTypeGemini:
-		apiKey := task.PrivateData.Key
-		if apiKey == "" {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Missing stored API key for Gemini task %s", taskID))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": "API key not stored for task",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-
-		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Gemini video URL for task %s: %s", taskID, err.Error()))
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error": gin.H{
-					"message": "Failed to resolve Gemini video URL",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-		req.Header.Set("x-goog-api-key", apiKey)
-	case constant.ChannelTypeAli:
-		// Video URL is directly in task.FailReason
-		videoURL = task.FailReason
-	default:
-		// Default (Sora, etc.): Use original logic
-		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
-	}
-
-	req.URL, err = url.Parse(videoURL)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to parse URL %s: %s", videoURL, err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": "Failed to create proxy request",
-				"type":    "server_error",
-			},
-		})
-		return
+	for key, value := range source.Headers {
+		req.Header.Set(key, value)
 	}
 
 	resp, err := client.Do(req)
@@ -175,3 +135,40 @@ func VideoProxy(c *gin.Context) {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream video content: %s", err.Error()))
 	}
 }
+
+// resolveVideoContentSource 返回视频任务结果的下载地址及所需的鉴权头，代理播放与归档共用
+func resolveVideoContentSource(task *model.Task) (service.MediaSource, error) {
+	source := service.MediaSource{Kind: model.TaskArtifactKindVideo, Headers: map[string]string{}}
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return source, fmt.Errorf("failed to retrieve channel information: %w", err)
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		apiKey := task.PrivateData.Key
+		if apiKey == "" {
+			return source, errors.New("API key not stored for task")
+		}
+		source.Url, err = getGeminiVideoURL(channel, task, apiKey)
+		if err != nil {
+			return source, fmt.Errorf("failed to resolve Gemini video URL: %w", err)
+		}
+		source.Headers["x-goog-api-key"] = apiKey
+	case constant.ChannelTypeAli:
+		// Video URL is directly in task.FailReason
+		source.Url = task.FailReason
+	default:
+		// Default (Sora, etc.): Use original logic
+		source.Url = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
+		source.Headers["Authorization"] = "Bearer " + channel.Key
+	}
+	if _, err = url.Parse(source.Url); err != nil {
+		return source, err
+	}
+	return source, nil
+}
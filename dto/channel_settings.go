@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"strings"
+	"time"
+)
+
 type ChannelSettings struct {
 	ForceFormat            bool   `json:"force_format,omitempty"`
 	ThinkingToContent      bool   `json:"thinking_to_content,omitempty"`
@@ -31,11 +36,41 @@ type ChannelOtherSettings struct {
 	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
 	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AwsGuardrailId        string        `json:"aws_guardrail_id,omitempty"`      // Bedrock Converse 默认护栏 ID，请求中的 guardrailConfig 优先
+	AwsGuardrailVersion   string        `json:"aws_guardrail_version,omitempty"` // 护栏版本，为空时使用 DRAFT
+	AwsGuardrailTrace     bool          `json:"aws_guardrail_trace,omitempty"`
+	// 上游错误信息包含任一关键词时临时禁用渠道（替代旧的渠道名称包含 auto-1 的约定）
+	TempDisableKeywords []string `json:"temp_disable_keywords,omitempty"`
+	TempDisableMinutes  int      `json:"temp_disable_minutes,omitempty"` // 临时禁用时长（分钟），为 0 时使用默认值
+	// Claude 单次缓存创建 tokens 超过该值时不计缓存创建费用（替代旧的渠道名称 cache-creation-skip_N 约定），为 0 时不启用
+	CacheCreationSkipThreshold int `json:"cache_creation_skip_threshold,omitempty"`
 }
 
+const DefaultTempDisableMinutes = 5
+
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
 	if s == nil || s.OpenRouterEnterprise == nil {
 		return false
 	}
 	return *s.OpenRouterEnterprise
 }
+
+// MatchTempDisableKeyword 返回错误信息命中的临时禁用关键词
+func (s *ChannelOtherSettings) MatchTempDisableKeyword(message string) (string, bool) {
+	if s == nil || message == "" {
+		return "", false
+	}
+	for _, keyword := range s.TempDisableKeywords {
+		if keyword != "" && strings.Contains(message, keyword) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+func (s *ChannelOtherSettings) GetTempDisableDuration() time.Duration {
+	if s == nil || s.TempDisableMinutes <= 0 {
+		return DefaultTempDisableMinutes * time.Minute
+	}
+	return time.Duration(s.TempDisableMinutes) * time.Minute
+}
@@ -527,6 +527,10 @@ type ClaudeCacheCreationUsage struct {
 	Ephemeral1hInputTokens int `json:"ephemeral_1h_input_tokens,omitempty"`
 }
 
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
 func (u *ClaudeUsage) GetCacheCreation5mTokens() int {
 	if u == nil || u.CacheCreation == nil {
 		return 0
@@ -458,6 +458,16 @@ type GeminiBatchEmbeddingResponse struct {
 	Embeddings []*ContentEmbedding `json:"embeddings"`
 }
 
+// GeminiCountTokensRequest models:countTokens 请求，contents 与 generateContentRequest 二选一
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
 type ContentEmbedding struct {
 	Values []float64 `json:"values"`
 }
@@ -0,0 +1,51 @@
+package dto
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ImageJobRequest OpenAI 风格的异步图像任务请求，按 model 区分生成与变换、放大等操作
+type ImageJobRequest struct {
+	Model  string   `json:"model"`
+	Prompt string   `json:"prompt,omitempty"`
+	Images []string `json:"images,omitempty"`  // 参考图，base64 data URI
+	TaskId string   `json:"task_id,omitempty"` // 变换、放大时的原任务 ID
+	Index  int      `json:"index,omitempty"`   // 变换、放大原任务中的第几张图，从 1 开始
+}
+
+// OpenAIImageJob 异步图像任务对象，状态取值与 OpenAIVideo 相同
+type OpenAIImageJob struct {
+	ID          string               `json:"id"`
+	Object      string               `json:"object"`
+	Model       string               `json:"model"`
+	Status      string               `json:"status"`
+	Progress    int                  `json:"progress"`
+	CreatedAt   int64                `json:"created_at"`
+	CompletedAt int64                `json:"completed_at,omitempty"`
+	Data        []OpenAIImageJobData `json:"data,omitempty"`
+	Error       *OpenAIVideoError    `json:"error,omitempty"`
+	Metadata    map[string]any       `json:"metadata,omitempty"`
+}
+
+type OpenAIImageJobData struct {
+	Url string `json:"url"`
+}
+
+func (m *OpenAIImageJob) SetProgressStr(progress string) {
+	progress = strings.TrimSuffix(progress, "%")
+	m.Progress, _ = strconv.Atoi(progress)
+}
+
+func (m *OpenAIImageJob) SetMetadata(k string, v any) {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]any)
+	}
+	m.Metadata[k] = v
+}
+
+func NewOpenAIImageJob() *OpenAIImageJob {
+	return &OpenAIImageJob{
+		Object: "image.job",
+	}
+}
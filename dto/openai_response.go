@@ -415,3 +415,9 @@ func GetOpenAIError(errorField any) *types.OpenAIError {
 		}
 	}
 }
+
+// OpenAIResponsesInputTokensResponse /v1/responses/input_tokens 的响应
+type OpenAIResponsesInputTokensResponse struct {
+	Object      string `json:"object"`
+	InputTokens int    `json:"input_tokens"`
+}
@@ -0,0 +1,49 @@
+package dto
+
+// OpenAI 兼容的组织用量 / 成本 API 响应结构
+// https://platform.openai.com/docs/api-reference/usage
+
+type OrganizationUsagePage struct {
+	Object   string                    `json:"object"`
+	Data     []OrganizationUsageBucket `json:"data"`
+	HasMore  bool                      `json:"has_more"`
+	NextPage *string                   `json:"next_page"`
+}
+
+type OrganizationUsageBucket struct {
+	Object    string `json:"object"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Results   []any  `json:"results"`
+}
+
+type OrganizationCompletionsUsageResult struct {
+	Object            string  `json:"object"`
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	InputCachedTokens int64   `json:"input_cached_tokens"`
+	InputAudioTokens  int64   `json:"input_audio_tokens"`
+	OutputAudioTokens int64   `json:"output_audio_tokens"`
+	NumModelRequests  int64   `json:"num_model_requests"`
+	ProjectId         *string `json:"project_id"`
+	UserId            *string `json:"user_id"`
+	ApiKeyId          *string `json:"api_key_id"`
+	Model             *string `json:"model"`
+	Batch             *bool   `json:"batch"`
+	// Group 网关扩展字段：令牌所用分组
+	Group *string `json:"group,omitempty"`
+}
+
+type OrganizationCostAmount struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+}
+
+type OrganizationCostsResult struct {
+	Object    string                 `json:"object"`
+	Amount    OrganizationCostAmount `json:"amount"`
+	LineItem  *string                `json:"line_item"`
+	ProjectId *string                `json:"project_id"`
+	// Group 网关扩展字段：令牌所用分组
+	Group *string `json:"group,omitempty"`
+}
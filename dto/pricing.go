@@ -1,6 +1,9 @@
 package dto
 
-import "github.com/QuantumNous/new-api/constant"
+import (
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+)
 
 // 这里不好动就不动了，本来想独立出来的（
 type OpenAIModels struct {
@@ -9,6 +12,7 @@ type OpenAIModels struct {
 	Created                int                     `json:"created"`
 	OwnedBy                string                  `json:"owned_by"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
+	Capabilities           *types.ModelCapability  `json:"capabilities,omitempty"`
 }
 
 type AnthropicModel struct {
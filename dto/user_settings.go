@@ -14,6 +14,7 @@ type UserSetting struct {
 	RecordIpLog             bool    `json:"record_ip_log,omitempty"`                  // 是否记录请求和错误日志IP
 	AllowTrainingDataGroups bool    `json:"allow_training_data_groups,omitempty"`     // 是否允许使用会采集提示和补全的分组
 	SidebarModules          string  `json:"sidebar_modules,omitempty"`                // SidebarModules 左侧边栏模块配置
+	UsageReportEnabled      bool    `json:"usage_report_enabled,omitempty"`           // UsageReportEnabled 是否接收月度用量报告邮件
 }
 
 var (
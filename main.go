@@ -2,13 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -19,6 +24,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -86,36 +92,20 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
-	// 热更新配置
+	// 热更新配置：配置与渠道修改后立即通知其他节点，定期同步作为兜底
 	go model.SyncOptions(common.SyncFrequency)
+	model.StartCacheInvalidationListener()
 
 	// 数据看板
 	go model.UpdateQuotaData()
 
-	// Subscription quota reset (only on master)
-	if common.IsMasterNode {
-		model.StartSubscriptionQuotaResetLoop()
-		model.StartTopUpCouponCleanupLoop()
-	}
-
-	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
-		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
-		if err != nil {
-			common.FatalLog("failed to parse CHANNEL_UPDATE_FREQUENCY: " + err.Error())
-		}
-		go controller.AutomaticallyUpdateChannels(frequency)
-	}
+	// 价格簿到达生效时间时在本节点内存中切换（所有节点），持久化与通知由后台任务完成
+	service.StartPriceBookScheduler()
 
-	go controller.AutomaticallyTestChannels()
+	// 后台任务：各任务通过独立租约在集群中选出运行节点
+	registerBackgroundJobs()
+	service.StartJobScheduler()
 
-	if common.IsMasterNode && constant.UpdateTask {
-		gopool.Go(func() {
-			controller.UpdateMidjourneyTaskBulk()
-		})
-		gopool.Go(func() {
-			controller.UpdateTaskBulk()
-		})
-	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
 		common.SysLog("batch update enabled with interval " + strconv.Itoa(common.BatchUpdateInterval) + "s")
@@ -165,9 +155,188 @@ func main() {
 	// Log startup success message
 	common.LogStartupSuccess(startTime, port)
 
-	err = server.Run(":" + port)
-	if err != nil {
-		common.FatalLog("failed to start HTTP server: " + err.Error())
+	// 请求上下文派生自 baseCtx，优雅关闭超时后取消它以结束仍在进行的流式响应
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	httpServer := &http.Server{
+		Addr:    ":" + port,
+		Handler: server,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+	gopool.Go(func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	})
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	gracefulShutdown(httpServer, cancelRequests)
+}
+
+// gracefulShutdown 停止接收新的中继请求，等待进行中的请求结束并完成结算，最后落库缓冲数据并关闭 Redis
+// 数据库连接由 main 中的 defer 关闭
+func gracefulShutdown(httpServer *http.Server, cancelRequests context.CancelFunc) {
+	timeout := time.Duration(common.GetEnvOrDefault("GRACEFUL_SHUTDOWN_TIMEOUT", 30)) * time.Second
+	common.SysLog(fmt.Sprintf("shutdown signal received, draining in-flight requests (timeout %s)", timeout))
+	service.BeginShutdown()
+	service.StopJobScheduler()
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+	if !service.WaitRelayRequests(drainCtx) {
+		// 超时后取消剩余请求，流式响应提前结束，按已产生的用量结算或退回预扣费与预留额度
+		cancelRequests()
+		forceCtx, cancelForce := context.WithTimeout(context.Background(), 10*time.Second)
+		service.WaitRelayRequests(forceCtx)
+		cancelForce()
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		common.SysLog("failed to shutdown HTTP server: " + err.Error())
+	}
+	cancelRequests()
+
+	settleCtx, cancelSettle := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelSettle()
+	service.WaitPendingSettlements(settleCtx)
+	service.FlushCaptureSinks(settleCtx)
+	// 运行中的后台任务与请求排空共用关闭期限，结束后才刷新批量更新并关闭 Redis 与数据库
+	service.WaitBackgroundJobs(drainCtx)
+
+	model.FlushBatchUpdates()
+	if common.DataExportEnabled {
+		model.SaveQuotaDataCache()
+	}
+	if common.RedisEnabled {
+		if err := common.CloseRedisClient(); err != nil {
+			common.SysLog("failed to close redis client: " + err.Error())
+		}
+	}
+	common.SysLog("graceful shutdown finished")
+}
+
+// registerBackgroundJobs 注册需要在集群中单节点运行的后台任务
+func registerBackgroundJobs() {
+	fixedInterval := func(interval time.Duration) func() time.Duration {
+		return func() time.Duration { return interval }
+	}
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "price_book_activation",
+		Description: "持久化到达生效时间的价格簿版本并发送变更通知",
+		Interval:    fixedInterval(service.PriceBookCheckInterval),
+		Run:         service.RunPriceBookActivation,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "subscription_quota_reset",
+		Description: "重置到期的订阅额度",
+		Interval:    fixedInterval(model.SubscriptionQuotaResetInterval),
+		Run:         model.RunSubscriptionQuotaReset,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "topup_coupon_cleanup",
+		Description: "清理过期的充值优惠券与促销状态",
+		Interval:    fixedInterval(model.TopUpCouponCleanupInterval),
+		Run:         model.RunTopUpCouponCleanup,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "usage_report",
+		Description: "生成并投递月度用量报告",
+		Interval:    fixedInterval(service.UsageReportCheckInterval),
+		Enabled:     func() bool { return operation_setting.GetUsageReportSetting().Enabled },
+		Run:         service.RunUsageReportCheck,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "log_archive",
+		Description: "归档过期日志到对象存储",
+		Interval:    service.LogArchiveInterval,
+		Enabled:     func() bool { return operation_setting.GetLogArchiveSetting().Enabled },
+		Run:         service.RunScheduledLogArchive,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "stored_response_cleanup",
+		Description: "清理超过保留天数的 response 记录",
+		Interval:    fixedInterval(model.StoredResponseCleanupInterval),
+		Run:         model.CleanupStoredResponses,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "quota_reconcile",
+		Description: "额度账本对账",
+		Interval:    fixedInterval(model.QuotaLedgerReconcileInterval),
+		Run:         model.ReconcileQuotaLedgers,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "quota_ledger_compact",
+		Description: "合并超过保留天数的额度流水",
+		Interval:    fixedInterval(model.QuotaLedgerCompactInterval),
+		Run:         model.CompactQuotaLedgers,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "cache_change_feed_cleanup",
+		Description: "清理过期的缓存失效变更流（未启用 Redis 时）",
+		Interval:    fixedInterval(model.CacheChangeFeedRetention),
+		Run:         model.CleanupCacheChangeEvents,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "task_callback_retry",
+		Description: "重试失败的异步任务回调",
+		Interval:    fixedInterval(service.TaskCallbackRetryInterval),
+		Run:         service.RetryTaskCallbacks,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "task_callback_cleanup",
+		Description: "清理过期的任务回调投递记录",
+		Interval:    fixedInterval(time.Hour),
+		Run:         service.CleanupTaskCallbackDeliveries,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "media_archive_cleanup",
+		Description: "删除超过保留时间的任务生成结果归档",
+		Interval:    fixedInterval(service.MediaArchiveCleanupInterval),
+		Run:         service.CleanupExpiredTaskArtifacts,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "media_archive_billing",
+		Description: "按天扣除任务生成结果归档的存储费用",
+		Interval:    fixedInterval(service.MediaArchiveBillingInterval),
+		Run:         service.BillTaskArtifacts,
+	})
+	service.RegisterBackgroundJob(&service.BackgroundJob{
+		Name:        "channel_auto_test",
+		Description: "定时测试所有渠道",
+		Interval:    controller.AutoTestChannelInterval,
+		Enabled:     func() bool { return operation_setting.GetMonitorSetting().AutoTestChannelEnabled },
+		Run:         controller.TestAllChannelsJob,
+	})
+	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
+		frequency, err := strconv.Atoi(os.Getenv("CHANNEL_UPDATE_FREQUENCY"))
+		if err != nil {
+			common.FatalLog("failed to parse CHANNEL_UPDATE_FREQUENCY: " + err.Error())
+		}
+		service.RegisterBackgroundJob(&service.BackgroundJob{
+			Name:        "channel_balance_update",
+			Description: "定时更新所有渠道余额",
+			Interval:    fixedInterval(time.Duration(frequency) * time.Minute),
+			Run:         controller.UpdateAllChannelsBalanceJob,
+		})
+	}
+	if constant.UpdateTask {
+		service.RegisterBackgroundJob(&service.BackgroundJob{
+			Name:        "midjourney_task_update",
+			Description: "拉取未完成的 Midjourney 任务进度",
+			Interval:    fixedInterval(15 * time.Second),
+			Run:         controller.UpdateMidjourneyTaskBulk,
+		})
+		service.RegisterBackgroundJob(&service.BackgroundJob{
+			Name:        "task_update",
+			Description: "按各任务的下次拉取时间分平台拉取未完成的异步任务进度，并处理超时任务",
+			Interval:    controller.TaskPollDispatchInterval,
+			Run:         controller.UpdateTaskBulk,
+		})
 	}
 }
 
@@ -533,6 +533,13 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	} else {
 		c.Set("token_model_limit_enabled", false)
 	}
+	if fallbacks := token.GetModelFallbacks(); len(fallbacks) > 0 {
+		common.SetContextKey(c, constant.ContextKeyTokenModelFallbacks, fallbacks)
+	}
+	if token.TaskCallbackUrl != "" {
+		common.SetContextKey(c, constant.ContextKeyTokenTaskCallbackUrl, token.TaskCallbackUrl)
+		common.SetContextKey(c, constant.ContextKeyTokenTaskCallbackSecret, token.TaskCallbackSecret)
+	}
 	tokenGroup := token.PrimaryGroup()
 	if usingGroups := common.GetContextKeyStringSlice(c, constant.ContextKeyUsingGroups); len(usingGroups) > 0 {
 		tokenGroup = usingGroups[0]
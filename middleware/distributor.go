@@ -22,8 +22,9 @@ import (
 )
 
 type ModelRequest struct {
-	Model string `json:"model"`
-	Group string `json:"group,omitempty"`
+	Model              string `json:"model"`
+	Group              string `json:"group,omitempty"`
+	PreviousResponseId string `json:"previous_response_id,omitempty"`
 }
 
 func Distribute() func(c *gin.Context) {
@@ -77,6 +78,18 @@ func Distribute() func(c *gin.Context) {
 				}
 			}
 
+			// 携带 previous_response_id 的 Responses 请求优先使用生成该 response 的渠道
+			if shouldSelectChannel && c.Request.URL.Path == "/v1/responses" && modelRequest.PreviousResponseId != "" {
+				channel = service.GetPinnedResponseChannel(c, modelRequest.Model, modelRequest.PreviousResponseId)
+				shouldSelectChannel = channel == nil
+			}
+
+			// 开启会话粘性时，同一会话优先使用上次成功的渠道，渠道不可用时回退到常规选路；playground 按所选分组常规选路
+			if shouldSelectChannel && !strings.HasPrefix(c.Request.URL.Path, "/pg/") {
+				channel = service.GetSessionAffinityChannel(c, modelRequest.Model)
+				shouldSelectChannel = channel == nil
+			}
+
 			if shouldSelectChannel {
 				if modelRequest.Model == "" {
 					abortWithOpenAiMessage(c, http.StatusBadRequest, "未指定模型名称，模型名称不能为空")
@@ -266,6 +279,21 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		if _, ok := c.Get("relay_mode"); !ok {
 			c.Set("relay_mode", relayMode)
 		}
+	} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/jobs") {
+		// 异步图像任务，目前由 Midjourney 渠道承接
+		relayMode := relayconstant.RelayModeUnknown
+		if c.Request.Method == http.MethodPost {
+			req, err := getModelFromRequest(c)
+			if err != nil {
+				return nil, false, err
+			}
+			modelRequest.Model = req.Model
+			relayMode = relayconstant.RelayModeImageJobSubmit
+		} else if c.Request.Method == http.MethodGet {
+			relayMode = relayconstant.RelayModeImageJobFetchByID
+			shouldSelectChannel = false
+		}
+		c.Set("relay_mode", relayMode)
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") || strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
 		relayMode := relayconstant.RelayModeGemini
@@ -362,7 +390,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	key, index, newAPIError := getChannelKey(c, channel)
 	if newAPIError != nil {
 		return newAPIError
 	}
@@ -401,6 +429,30 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	return nil
 }
 
+// getChannelKey 优先使用会话粘性绑定的多密钥下标，该密钥不可用时按渠道的多密钥模式选择
+func getChannelKey(c *gin.Context, channel *model.Channel) (string, int, *types.NewAPIError) {
+	if index, ok := service.GetSessionAffinityKeyIndex(c, channel.Id); ok {
+		if key, enabled := channel.GetEnabledKeyAt(index); enabled {
+			return key, index, nil
+		}
+	}
+	return channel.GetNextEnabledKeyWithSnapshot(takeChannelKeyUsageSnapshot(c, channel.Id))
+}
+
+// takeChannelKeyUsageSnapshot 取出选路时为该渠道读取的 key 实时状态，只使用一次，重试时重新读取
+func takeChannelKeyUsageSnapshot(c *gin.Context, channelId int) *model.ChannelKeyUsageSnapshot {
+	value, ok := common.GetContextKey(c, constant.ContextKeyChannelKeyUsageSnapshot)
+	if !ok {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelKeyUsageSnapshot, nil)
+	snapshot, ok := value.(*model.ChannelKeyUsageSnapshot)
+	if !ok || snapshot == nil || snapshot.ChannelId != channelId {
+		return nil
+	}
+	return snapshot
+}
+
 // extractModelNameFromGeminiPath 从 Gemini API URL 路径中提取模型名
 // 输入格式: /v1beta/models/gemini-2.0-flash:generateContent
 // 输出: gemini-2.0-flash
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShutdownGuard 服务优雅关闭期间拒绝新的中继请求，并登记进行中的请求以便关闭时等待其完成
+func ShutdownGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.AcquireRelayRequest() {
+			c.Header("Connection", "close")
+			c.Header("Retry-After", "1")
+			abortWithOpenAiMessage(c, http.StatusServiceUnavailable, "server is shutting down, please retry", "server_shutting_down")
+			return
+		}
+		defer service.ReleaseRelayRequest()
+		c.Next()
+	}
+}
@@ -12,25 +12,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-const langfuseResponseCaptureLimit = 512 * 1024
+const captureResponseLimit = 512 * 1024
 
-type langfuseCaptureWriter struct {
+type captureResponseWriter struct {
 	gin.ResponseWriter
 	body bytes.Buffer
 	max  int
 }
 
-func (w *langfuseCaptureWriter) Write(data []byte) (int, error) {
+func (w *captureResponseWriter) Write(data []byte) (int, error) {
 	w.capture(data)
 	return w.ResponseWriter.Write(data)
 }
 
-func (w *langfuseCaptureWriter) WriteString(data string) (int, error) {
+func (w *captureResponseWriter) WriteString(data string) (int, error) {
 	w.capture([]byte(data))
 	return w.ResponseWriter.WriteString(data)
 }
 
-func (w *langfuseCaptureWriter) capture(data []byte) {
+func (w *captureResponseWriter) capture(data []byte) {
 	if w.max <= 0 || len(data) == 0 || w.body.Len() >= w.max {
 		return
 	}
@@ -41,7 +41,7 @@ func (w *langfuseCaptureWriter) capture(data []byte) {
 	_, _ = w.body.Write(data)
 }
 
-func LangfuseCapture() func(c *gin.Context) {
+func TrainingDataCapture() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		if c.Request.Method != http.MethodPost {
 			c.Next()
@@ -49,9 +49,9 @@ func LangfuseCapture() func(c *gin.Context) {
 		}
 
 		startedAt := time.Now()
-		writer := &langfuseCaptureWriter{
+		writer := &captureResponseWriter{
 			ResponseWriter: c.Writer,
-			max:            langfuseResponseCaptureLimit,
+			max:            captureResponseLimit,
 		}
 		c.Writer = writer
 		c.Next()
@@ -79,7 +79,7 @@ func LangfuseCapture() func(c *gin.Context) {
 			statusCode = http.StatusOK
 		}
 
-		service.CaptureRelayToLangfuse(service.LangfuseCaptureRequest{
+		service.CaptureRelay(service.CaptureRequest{
 			UserID:              common.GetContextKeyInt(c, constant.ContextKeyUserId),
 			TokenID:             common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 			TokenName:           c.GetString("token_name"),
@@ -349,6 +349,6 @@ func FixAbility() (int, int, error) {
 			}
 		}
 	}
-	InitChannelCache()
+	RefreshChannelCache()
 	return successCount, failCount, nil
 }
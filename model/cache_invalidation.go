@@ -0,0 +1,154 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 跨节点缓存失效消息的主题，只用于各节点的本地内存缓存；令牌与用户缓存保存在共享的 Redis 中，修改时直接删除即可
+const (
+	CacheTopicOption  = "option"  // Target 为配置键
+	CacheTopicChannel = "channel" // Target 为渠道 ID，批量修改时为空
+)
+
+const (
+	cacheInvalidationRedisChannel = "cache_invalidation"
+	cacheChangeFeedBatchSize      = 500
+	CacheChangeFeedRetention      = time.Hour
+)
+
+// CacheChangeEvent 未启用 Redis 时的缓存失效变更流，各节点轮询读取其他节点写入的事件
+type CacheChangeEvent struct {
+	Id        int64  `json:"id"`
+	Topic     string `json:"topic" gorm:"type:varchar(32)"`
+	Target    string `json:"target" gorm:"type:varchar(255)"`
+	Node      string `json:"node" gorm:"type:varchar(128)"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+type cacheInvalidationMessage struct {
+	Node   string `json:"node"`
+	Topic  string `json:"topic"`
+	Target string `json:"target"`
+}
+
+var (
+	cacheInvalidationOnce sync.Once
+	channelReloadPending  atomic.Bool
+)
+
+// PublishCacheInvalidation 通知其他节点刷新本地缓存；当前节点应已自行更新，收到自己发出的消息时忽略
+// 发布失败只记录日志，其他节点仍会通过 SyncOptions / SyncChannelCache 的定期同步兜底
+func PublishCacheInvalidation(topic string, target string) {
+	message := cacheInvalidationMessage{Node: common.GetNodeId(), Topic: topic, Target: target}
+	var err error
+	if common.RedisEnabled && common.RDB != nil {
+		var payload []byte
+		payload, err = common.Marshal(message)
+		if err == nil {
+			err = common.RDB.Publish(context.Background(), cacheInvalidationRedisChannel, string(payload)).Err()
+		}
+	} else if DB != nil {
+		err = DB.Create(&CacheChangeEvent{
+			Topic:     topic,
+			Target:    target,
+			Node:      message.Node,
+			CreatedAt: common.GetTimestamp(),
+		}).Error
+	}
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to publish cache invalidation: topic=%s, target=%s, error=%v", topic, target, err))
+	}
+}
+
+// StartCacheInvalidationListener 订阅其他节点发出的缓存失效消息：启用 Redis 时使用 pub/sub，否则轮询 cache_change_events 表
+func StartCacheInvalidationListener() {
+	cacheInvalidationOnce.Do(func() {
+		if common.RedisEnabled {
+			go listenRedisCacheInvalidation()
+			return
+		}
+		interval := time.Duration(common.GetEnvOrDefault("CACHE_CHANGE_FEED_INTERVAL", 2)) * time.Second
+		go pollCacheChangeFeed(interval)
+	})
+}
+
+func listenRedisCacheInvalidation() {
+	// go-redis 在连接断开后会自动重新订阅，断开期间丢失的消息由定期同步兜底
+	pubsub := common.RDB.Subscribe(context.Background(), cacheInvalidationRedisChannel)
+	for msg := range pubsub.Channel() {
+		var message cacheInvalidationMessage
+		if err := common.UnmarshalJsonStr(msg.Payload, &message); err != nil {
+			common.SysLog("failed to parse cache invalidation message: " + err.Error())
+			continue
+		}
+		if message.Node == common.GetNodeId() {
+			continue
+		}
+		applyCacheInvalidation(message.Topic, message.Target)
+	}
+}
+
+func pollCacheChangeFeed(interval time.Duration) {
+	var lastId int64
+	if err := DB.Model(&CacheChangeEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastId).Error; err != nil {
+		common.SysLog("failed to load cache change feed position: " + err.Error())
+	}
+	for {
+		time.Sleep(interval)
+		var events []*CacheChangeEvent
+		err := DB.Where("id > ? AND node <> ?", lastId, common.GetNodeId()).
+			Order("id asc").
+			Limit(cacheChangeFeedBatchSize).
+			Find(&events).Error
+		if err != nil {
+			common.SysLog("failed to poll cache change feed: " + err.Error())
+			continue
+		}
+		for _, event := range events {
+			applyCacheInvalidation(event.Topic, event.Target)
+			lastId = event.Id
+		}
+	}
+}
+
+func applyCacheInvalidation(topic string, target string) {
+	switch topic {
+	case CacheTopicOption:
+		reloadOptionFromDatabase(target)
+	case CacheTopicChannel:
+		reloadChannelCacheAsync()
+	}
+}
+
+// reloadChannelCacheAsync 重新加载渠道缓存，短时间内的多条渠道消息只触发一次重新加载
+func reloadChannelCacheAsync() {
+	if !common.MemoryCacheEnabled || !channelReloadPending.CompareAndSwap(false, true) {
+		return
+	}
+	gopool.Go(func() {
+		channelReloadPending.Store(false)
+		InitChannelCache()
+	})
+}
+
+// RefreshChannelCache 修改渠道后重新加载本节点的渠道缓存并通知其他节点
+func RefreshChannelCache() {
+	InitChannelCache()
+	PublishCacheInvalidation(CacheTopicChannel, "")
+}
+
+// CleanupCacheChangeEvents 删除超过保留时间的缓存失效事件，由后台任务调度器定期调用
+func CleanupCacheChangeEvents() error {
+	if common.RedisEnabled {
+		return nil
+	}
+	return DB.Where("created_at < ?", time.Now().Add(-CacheChangeFeedRetention).Unix()).Delete(&CacheChangeEvent{}).Error
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCacheChangeFeedOptionInvalidation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:cache-change-feed-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Option{}, &CacheChangeEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldRedisEnabled, oldOptionMap := DB, common.RedisEnabled, common.OptionMap
+	DB = db
+	common.RedisEnabled = false
+	common.OptionMap = map[string]string{}
+	t.Cleanup(func() {
+		DB = oldDB
+		common.RedisEnabled = oldRedisEnabled
+		common.OptionMap = oldOptionMap
+	})
+
+	// 修改配置时写入变更流，供其他节点轮询
+	if err = UpdateOption("CacheFeedTestOption", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	var events []*CacheChangeEvent
+	if err = db.Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Topic != CacheTopicOption || events[0].Target != "CacheFeedTestOption" || events[0].Node != common.GetNodeId() {
+		t.Fatalf("unexpected change events: %+v", events)
+	}
+
+	// 模拟其他节点修改了数据库中的配置，收到事件后只重新读取该配置项
+	if err = db.Model(&Option{}).Where(optionKeyEquals("CacheFeedTestOption")).Update("value", "v2").Error; err != nil {
+		t.Fatal(err)
+	}
+	applyCacheInvalidation(CacheTopicOption, "CacheFeedTestOption")
+	if common.OptionMap["CacheFeedTestOption"] != "v2" {
+		t.Fatalf("option should be reloaded, got %q", common.OptionMap["CacheFeedTestOption"])
+	}
+
+	if err = db.Model(&CacheChangeEvent{}).Where("1 = 1").Update("created_at", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = CleanupCacheChangeEvents(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&CacheChangeEvent{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expired change events should be removed, got %d", count)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -65,6 +66,19 @@ type ChannelInfo struct {
 	MultiKeyDisabledTime   map[int]int64         `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
 	MultiKeyPollingIndex   int                   `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
 	MultiKeyMode           constant.MultiKeyMode `json:"multi_key_mode"`
+	MultiKeyLimits         map[int]MultiKeyLimit `json:"multi_key_limits,omitempty"`        // key限额列表，key index -> limit
+	MultiKeyDefaultLimit   *MultiKeyLimit        `json:"multi_key_default_limit,omitempty"` // 未单独设置限额的key使用的默认限额
+}
+
+// GetKeyLimit 返回指定key的限额，未单独设置时使用默认限额
+func (c ChannelInfo) GetKeyLimit(index int) MultiKeyLimit {
+	if limit, ok := c.MultiKeyLimits[index]; ok {
+		return limit
+	}
+	if c.MultiKeyDefaultLimit != nil {
+		return *c.MultiKeyDefaultLimit
+	}
+	return MultiKeyLimit{}
 }
 
 // Value implements driver.Valuer interface
@@ -103,6 +117,12 @@ func (channel *Channel) GetKeys() []string {
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	return channel.GetNextEnabledKeyWithSnapshot(nil)
+}
+
+// GetNextEnabledKeyWithSnapshot 按多密钥模式选择 key，复用选路时读取的 key 实时状态；
+// snapshot 为空时在加锁前现场读取，避免持锁等待 Redis 与数据库
+func (channel *Channel) GetNextEnabledKeyWithSnapshot(snapshot *ChannelKeyUsageSnapshot) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -114,6 +134,9 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		// No keys available, return error, should disable the channel
 		return "", 0, types.NewError(errors.New("no keys available"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	if snapshot == nil || snapshot.ChannelId != channel.Id {
+		snapshot = channel.LoadKeyUsageSnapshot()
+	}
 
 	lock := GetChannelPollingLock(channel.Id)
 	lock.Lock()
@@ -145,7 +168,16 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 跳过冷却中或已触及限额的key；全部不可用时退回到所有启用的key，由上游决定是否限流
+	states := snapshot.states
+	if availableIdx := channel.filterAvailableKeys(enabledIdx, states); len(availableIdx) > 0 {
+		enabledIdx = availableIdx
+	}
+
 	switch channel.ChannelInfo.MultiKeyMode {
+	case constant.MultiKeyModeLeastUsed:
+		selectedIdx := channel.selectLeastUsedKey(enabledIdx, states)
+		return keys[selectedIdx], selectedIdx, nil
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
 		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
@@ -175,7 +207,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if lo.Contains(enabledIdx, idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -189,6 +221,26 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	}
 }
 
+// GetEnabledKeyAt 返回多密钥渠道指定下标的密钥，下标越界或该密钥未启用时返回 false
+func (channel *Channel) GetEnabledKeyAt(index int) (string, bool) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.Key, index == 0
+	}
+	keys := channel.GetKeys()
+	if index < 0 || index >= len(keys) {
+		return "", false
+	}
+
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if status, ok := channel.ChannelInfo.MultiKeyStatusList[index]; ok && status != common.ChannelStatusEnabled {
+		return "", false
+	}
+	return keys[index], true
+}
+
 func (channel *Channel) SaveChannelInfo() error {
 	return DB.Model(channel).Update("channel_info", channel.ChannelInfo).Error
 }
@@ -685,6 +737,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			return false
 		}
 	}
+	PublishCacheInvalidation(CacheTopicChannel, strconv.Itoa(channelId))
 	return true
 }
 
@@ -764,7 +817,9 @@ func EditChannelByTag(tag string, newTag *string, modelMapping *string, models *
 
 func UpdateChannelUsedQuota(id int, quota int) {
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeChannelUsedQuota, id, quota)
+		if err := appendPendingQuotaLedgers(&QuotaLedger{ChannelId: id, Type: QuotaLedgerTypeChannelUsage, UsedQuotaDelta: int64(quota)}); err != nil {
+			common.SysLog(fmt.Sprintf("failed to record channel used quota: channel_id=%d, delta_quota=%d, error=%v", id, quota, err))
+		}
 		return
 	}
 	updateChannelUsedQuota(id, quota)
@@ -858,6 +913,23 @@ func (channel *Channel) ValidateSettings() error {
 			return err
 		}
 	}
+	if channel.OtherSettings != "" {
+		otherSettings := &dto.ChannelOtherSettings{}
+		if err := common.UnmarshalJsonStr(channel.OtherSettings, otherSettings); err != nil {
+			return err
+		}
+		for _, keyword := range otherSettings.TempDisableKeywords {
+			if strings.TrimSpace(keyword) == "" {
+				return errors.New("temp_disable_keywords 不能包含空关键词")
+			}
+		}
+		if otherSettings.TempDisableMinutes < 0 {
+			return errors.New("temp_disable_minutes 不能为负数")
+		}
+		if otherSettings.CacheCreationSkipThreshold < 0 {
+			return errors.New("cache_creation_skip_threshold 不能为负数")
+		}
+	}
 	return nil
 }
 
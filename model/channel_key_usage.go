@@ -0,0 +1,558 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MultiKeyQuotaPeriodTotal = ""
+	MultiKeyQuotaPeriodDay   = "day"
+	MultiKeyQuotaPeriodMonth = "month"
+
+	channelKeyWindowExpiration = 2 * time.Minute
+	channelKeyQuotaCacheTTL    = time.Minute
+)
+
+// MultiKeyLimit 多密钥渠道中单个key的限额，0 表示不限制
+type MultiKeyLimit struct {
+	RPM         int    `json:"rpm,omitempty"`
+	TPM         int    `json:"tpm,omitempty"`
+	QuotaLimit  int    `json:"quota_limit,omitempty"`  // 额度上限，按 QuotaPeriod 累计
+	QuotaPeriod string `json:"quota_period,omitempty"` // 额度周期：空为累计，day 为按天，month 为按月
+}
+
+func (l MultiKeyLimit) IsEmpty() bool {
+	return l.RPM <= 0 && l.TPM <= 0 && l.QuotaLimit <= 0
+}
+
+func (l MultiKeyLimit) Validate() error {
+	if l.RPM < 0 || l.TPM < 0 || l.QuotaLimit < 0 {
+		return fmt.Errorf("限额不能为负数")
+	}
+	switch l.QuotaPeriod {
+	case MultiKeyQuotaPeriodTotal, MultiKeyQuotaPeriodDay, MultiKeyQuotaPeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("无效的额度周期: %s", l.QuotaPeriod)
+	}
+}
+
+// ChannelKeyUsage 多密钥渠道中单个key的按天用量，以key指纹而非下标标识，删除key后其余key的用量不受影响
+type ChannelKeyUsage struct {
+	Id               int    `json:"id"`
+	ChannelId        int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_key_usage_day"`
+	KeyHash          string `json:"key_hash" gorm:"size:32;uniqueIndex:idx_channel_key_usage_day"`
+	Day              int    `json:"day" gorm:"uniqueIndex:idx_channel_key_usage_day"` // 20060102
+	RequestCount     int64  `json:"request_count" gorm:"bigint;default:0"`
+	TokenCount       int64  `json:"token_count" gorm:"bigint;default:0"`
+	UsedQuota        int64  `json:"used_quota" gorm:"bigint;default:0"`
+	RateLimitedCount int64  `json:"rate_limited_count" gorm:"bigint;default:0"`
+}
+
+// ChannelKeyUsageSummary key 的累计用量与今日用量
+type ChannelKeyUsageSummary struct {
+	TotalRequests    int64 `json:"total_requests"`
+	TotalTokens      int64 `json:"total_tokens"`
+	TotalQuota       int64 `json:"total_quota"`
+	TotalRateLimited int64 `json:"total_rate_limited"`
+	TodayRequests    int64 `json:"today_requests"`
+	TodayTokens      int64 `json:"today_tokens"`
+	TodayQuota       int64 `json:"today_quota"`
+}
+
+// channelKeyUsageState key 的实时状态：当前分钟的请求数与 token 数、冷却截止时间与当前额度周期的已用额度
+type channelKeyUsageState struct {
+	Requests      int64
+	Tokens        int64
+	CooldownUntil int64
+	PeriodQuota   int64
+}
+
+type channelKeyWindow struct {
+	minute        int64
+	requests      int64
+	tokens        int64
+	cooldownUntil int64
+}
+
+type channelKeyQuotaCache struct {
+	quota    int64
+	loadedAt time.Time
+}
+
+// 未启用 Redis 时在内存中记录分钟窗口与冷却状态；过期条目在分钟切换时清理，避免删除的 key 与渠道一直占用内存
+var (
+	channelKeyWindows          = make(map[string]*channelKeyWindow)
+	channelKeyWindowsLock      sync.Mutex
+	channelKeyWindowsPrunedMin int64
+
+	channelKeyQuotaCaches          = make(map[string]*channelKeyQuotaCache)
+	channelKeyQuotaCachesLock      sync.Mutex
+	channelKeyQuotaCachesPrunedMin int64
+)
+
+// ChannelKeyHash 返回key的指纹，用于在用量统计中标识key
+func ChannelKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func channelKeyDay(t time.Time) int {
+	day, _ := strconv.Atoi(t.Format("20060102"))
+	return day
+}
+
+func channelKeyPeriodStartDay(period string, now time.Time) int {
+	switch period {
+	case MultiKeyQuotaPeriodDay:
+		return channelKeyDay(now)
+	case MultiKeyQuotaPeriodMonth:
+		return channelKeyDay(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+	default:
+		return 0
+	}
+}
+
+func channelKeyRedisKey(kind string, channelId int, keyHash string) string {
+	if kind == "cooldown" {
+		return fmt.Sprintf("channel_key_cooldown:%d:%s", channelId, keyHash)
+	}
+	return fmt.Sprintf("channel_key_%s:%d:%s:%d", kind, channelId, keyHash, time.Now().Unix()/60)
+}
+
+// pruneChannelKeyWindows 每分钟最多清理一次：删除不在当前分钟且不在冷却中的窗口，需持有 channelKeyWindowsLock
+func pruneChannelKeyWindows(now time.Time) {
+	minute := now.Unix() / 60
+	if channelKeyWindowsPrunedMin == minute {
+		return
+	}
+	channelKeyWindowsPrunedMin = minute
+	for mapKey, window := range channelKeyWindows {
+		if window.minute != minute && window.cooldownUntil <= now.Unix() {
+			delete(channelKeyWindows, mapKey)
+		}
+	}
+}
+
+// pruneChannelKeyQuotaCaches 每分钟最多清理一次：删除已过期的额度缓存，过去周期的缓存不再刷新，也随之删除，
+// 需持有 channelKeyQuotaCachesLock
+func pruneChannelKeyQuotaCaches(now time.Time) {
+	minute := now.Unix() / 60
+	if channelKeyQuotaCachesPrunedMin == minute {
+		return
+	}
+	channelKeyQuotaCachesPrunedMin = minute
+	for cacheKey, cache := range channelKeyQuotaCaches {
+		if now.Sub(cache.loadedAt) >= channelKeyQuotaCacheTTL {
+			delete(channelKeyQuotaCaches, cacheKey)
+		}
+	}
+}
+
+func getChannelKeyWindow(channelId int, keyHash string) *channelKeyWindow {
+	pruneChannelKeyWindows(time.Now())
+	mapKey := fmt.Sprintf("%d:%s", channelId, keyHash)
+	window, ok := channelKeyWindows[mapKey]
+	if !ok {
+		window = &channelKeyWindow{}
+		channelKeyWindows[mapKey] = window
+	}
+	if minute := time.Now().Unix() / 60; window.minute != minute {
+		window.minute = minute
+		window.requests = 0
+		window.tokens = 0
+	}
+	return window
+}
+
+func incrChannelKeyWindow(channelId int, keyHash string, requests int64, tokens int64) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.Pipeline()
+		if requests != 0 {
+			key := channelKeyRedisKey("rpm", channelId, keyHash)
+			pipe.IncrBy(ctx, key, requests)
+			pipe.Expire(ctx, key, channelKeyWindowExpiration)
+		}
+		if tokens != 0 {
+			key := channelKeyRedisKey("tpm", channelId, keyHash)
+			pipe.IncrBy(ctx, key, tokens)
+			pipe.Expire(ctx, key, channelKeyWindowExpiration)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError("failed to record channel key window: " + err.Error())
+		}
+		return
+	}
+	channelKeyWindowsLock.Lock()
+	defer channelKeyWindowsLock.Unlock()
+	window := getChannelKeyWindow(channelId, keyHash)
+	window.requests += requests
+	window.tokens += tokens
+}
+
+// incrChannelKeyUsage 累加 key 的当日用量
+func incrChannelKeyUsage(channelId int, keyHash string, updates map[string]interface{}) {
+	gopool.Go(func() {
+		usage := ChannelKeyUsage{ChannelId: channelId, KeyHash: keyHash, Day: channelKeyDay(time.Now())}
+		err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error
+		if err == nil {
+			err = DB.Model(&ChannelKeyUsage{}).
+				Where("channel_id = ? AND key_hash = ? AND day = ?", usage.ChannelId, usage.KeyHash, usage.Day).
+				Updates(updates).Error
+		}
+		if err != nil {
+			common.SysError("failed to update channel key usage: " + err.Error())
+		}
+	})
+}
+
+// RecordChannelKeyRequest 记录一次发往上游的请求
+func RecordChannelKeyRequest(channelId int, key string) {
+	keyHash := ChannelKeyHash(key)
+	incrChannelKeyWindow(channelId, keyHash, 1, 0)
+	incrChannelKeyUsage(channelId, keyHash, map[string]interface{}{
+		"request_count": gorm.Expr("request_count + ?", 1),
+	})
+}
+
+// RecordChannelKeyConsume 记录一次请求消耗的 token 与额度
+func RecordChannelKeyConsume(channelId int, key string, tokens int, quota int) {
+	if tokens <= 0 && quota <= 0 {
+		return
+	}
+	keyHash := ChannelKeyHash(key)
+	incrChannelKeyWindow(channelId, keyHash, 0, int64(tokens))
+	incrChannelKeyUsage(channelId, keyHash, map[string]interface{}{
+		"token_count": gorm.Expr("token_count + ?", tokens),
+		"used_quota":  gorm.Expr("used_quota + ?", quota),
+	})
+
+	// 额度缓存在重新加载前按本地消耗累加
+	prefix := fmt.Sprintf("%d:%s:", channelId, keyHash)
+	channelKeyQuotaCachesLock.Lock()
+	for cacheKey, cache := range channelKeyQuotaCaches {
+		if strings.HasPrefix(cacheKey, prefix) {
+			cache.quota += int64(quota)
+		}
+	}
+	channelKeyQuotaCachesLock.Unlock()
+}
+
+// CooldownChannelKey 上游限流时暂停使用该 key 直至冷却结束
+func CooldownChannelKey(channelId int, key string, duration time.Duration) {
+	keyHash := ChannelKeyHash(key)
+	cooldownUntil := time.Now().Add(duration).Unix()
+	if common.RedisEnabled {
+		err := common.RDB.Set(context.Background(), channelKeyRedisKey("cooldown", channelId, keyHash), cooldownUntil, duration).Err()
+		if err != nil {
+			common.SysError("failed to set channel key cooldown: " + err.Error())
+		}
+	} else {
+		channelKeyWindowsLock.Lock()
+		getChannelKeyWindow(channelId, keyHash).cooldownUntil = cooldownUntil
+		channelKeyWindowsLock.Unlock()
+	}
+	incrChannelKeyUsage(channelId, keyHash, map[string]interface{}{
+		"rate_limited_count": gorm.Expr("rate_limited_count + ?", 1),
+	})
+}
+
+// ClearChannelKeyCooldown 解除 key 的冷却状态
+func ClearChannelKeyCooldown(channelId int, key string) error {
+	keyHash := ChannelKeyHash(key)
+	if common.RedisEnabled {
+		return common.RDB.Del(context.Background(), channelKeyRedisKey("cooldown", channelId, keyHash)).Err()
+	}
+	channelKeyWindowsLock.Lock()
+	getChannelKeyWindow(channelId, keyHash).cooldownUntil = 0
+	channelKeyWindowsLock.Unlock()
+	return nil
+}
+
+// getChannelKeyWindows 批量读取 key 的当前分钟窗口与冷却状态
+func getChannelKeyWindows(channelId int, keyHashes []string) ([]channelKeyWindow, error) {
+	windows := make([]channelKeyWindow, len(keyHashes))
+	if len(keyHashes) == 0 {
+		return windows, nil
+	}
+	if common.RedisEnabled {
+		redisKeys := make([]string, 0, len(keyHashes)*3)
+		for _, keyHash := range keyHashes {
+			redisKeys = append(redisKeys,
+				channelKeyRedisKey("rpm", channelId, keyHash),
+				channelKeyRedisKey("tpm", channelId, keyHash),
+				channelKeyRedisKey("cooldown", channelId, keyHash))
+		}
+		values, err := common.RDB.MGet(context.Background(), redisKeys...).Result()
+		if err != nil {
+			return windows, err
+		}
+		parse := func(value interface{}) int64 {
+			str, ok := value.(string)
+			if !ok {
+				return 0
+			}
+			parsed, _ := strconv.ParseInt(str, 10, 64)
+			return parsed
+		}
+		for i := range keyHashes {
+			windows[i] = channelKeyWindow{
+				requests:      parse(values[i*3]),
+				tokens:        parse(values[i*3+1]),
+				cooldownUntil: parse(values[i*3+2]),
+			}
+		}
+		return windows, nil
+	}
+	channelKeyWindowsLock.Lock()
+	defer channelKeyWindowsLock.Unlock()
+	for i, keyHash := range keyHashes {
+		windows[i] = *getChannelKeyWindow(channelId, keyHash)
+	}
+	return windows, nil
+}
+
+// getChannelKeyPeriodQuota 返回 key 在当前额度周期内的已用额度，结果缓存一分钟
+func getChannelKeyPeriodQuota(channelId int, keyHash string, period string) int64 {
+	now := time.Now()
+	startDay := channelKeyPeriodStartDay(period, now)
+	cacheKey := fmt.Sprintf("%d:%s:%s:%d", channelId, keyHash, period, startDay)
+
+	channelKeyQuotaCachesLock.Lock()
+	cache, ok := channelKeyQuotaCaches[cacheKey]
+	channelKeyQuotaCachesLock.Unlock()
+	if ok && now.Sub(cache.loadedAt) < channelKeyQuotaCacheTTL {
+		return cache.quota
+	}
+
+	var quota int64
+	err := DB.Model(&ChannelKeyUsage{}).
+		Where("channel_id = ? AND key_hash = ? AND day >= ?", channelId, keyHash, startDay).
+		Select("COALESCE(SUM(used_quota), 0)").Scan(&quota).Error
+	if err != nil {
+		common.SysError("failed to get channel key quota: " + err.Error())
+		if ok {
+			return cache.quota
+		}
+		return 0
+	}
+	channelKeyQuotaCachesLock.Lock()
+	pruneChannelKeyQuotaCaches(now)
+	channelKeyQuotaCaches[cacheKey] = &channelKeyQuotaCache{quota: quota, loadedAt: now}
+	channelKeyQuotaCachesLock.Unlock()
+	return quota
+}
+
+// getKeyUsageStates 读取启用 key 的实时状态，下标与 keys 一致；读取失败时视为无用量
+func (channel *Channel) getKeyUsageStates(keys []string, enabledIdx []int) map[int]channelKeyUsageState {
+	states := make(map[int]channelKeyUsageState, len(enabledIdx))
+	keyHashes := make([]string, len(enabledIdx))
+	for i, idx := range enabledIdx {
+		keyHashes[i] = ChannelKeyHash(keys[idx])
+	}
+	windows, err := getChannelKeyWindows(channel.Id, keyHashes)
+	if err != nil {
+		common.SysError("failed to get channel key windows: " + err.Error())
+	}
+	for i, idx := range enabledIdx {
+		state := channelKeyUsageState{
+			Requests:      windows[i].requests,
+			Tokens:        windows[i].tokens,
+			CooldownUntil: windows[i].cooldownUntil,
+		}
+		if limit := channel.ChannelInfo.GetKeyLimit(idx); limit.QuotaLimit > 0 {
+			state.PeriodQuota = getChannelKeyPeriodQuota(channel.Id, keyHashes[i], limit.QuotaPeriod)
+		}
+		states[idx] = state
+	}
+	return states
+}
+
+// keyHeadroom 返回 key 在各项限额中最小的剩余比例，未设置限额时为 1
+func keyHeadroom(limit MultiKeyLimit, state channelKeyUsageState) float64 {
+	headroom := 1.0
+	check := func(used int64, max int) {
+		if max <= 0 {
+			return
+		}
+		if remaining := 1 - float64(used)/float64(max); remaining < headroom {
+			headroom = remaining
+		}
+	}
+	check(state.Requests, limit.RPM)
+	check(state.Tokens, limit.TPM)
+	check(state.PeriodQuota, limit.QuotaLimit)
+	return headroom
+}
+
+// filterAvailableKeys 过滤掉冷却中或已触及任一限额的 key
+func (channel *Channel) filterAvailableKeys(enabledIdx []int, states map[int]channelKeyUsageState) []int {
+	now := time.Now().Unix()
+	available := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		state := states[idx]
+		if state.CooldownUntil > now {
+			continue
+		}
+		if keyHeadroom(channel.ChannelInfo.GetKeyLimit(idx), state) <= 0 {
+			continue
+		}
+		available = append(available, idx)
+	}
+	return available
+}
+
+// selectLeastUsedKey 选择限额余量最多的 key，余量相同时选择当前分钟请求数最少的，仍相同时随机选择
+func (channel *Channel) selectLeastUsedKey(enabledIdx []int, states map[int]channelKeyUsageState) int {
+	var candidates []int
+	bestHeadroom := 0.0
+	var bestRequests int64
+	for _, idx := range enabledIdx {
+		state := states[idx]
+		headroom := keyHeadroom(channel.ChannelInfo.GetKeyLimit(idx), state)
+		switch {
+		case candidates == nil || headroom > bestHeadroom || (headroom == bestHeadroom && state.Requests < bestRequests):
+			candidates = []int{idx}
+			bestHeadroom = headroom
+			bestRequests = state.Requests
+		case headroom == bestHeadroom && state.Requests == bestRequests:
+			candidates = append(candidates, idx)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// ChannelKeyUsageSnapshot 一次读取的多密钥渠道 key 实时状态，选路判断后交给选 key 复用，避免重复读取 Redis 与数据库
+type ChannelKeyUsageSnapshot struct {
+	ChannelId int
+	states    map[int]channelKeyUsageState
+}
+
+// enabledKeyIndexes 返回启用的 key 下标，需持有渠道轮询锁
+func (channel *Channel) enabledKeyIndexes(keys []string) []int {
+	enabledIdx := make([]int, 0, len(keys))
+	for i := range keys {
+		if status, ok := channel.ChannelInfo.MultiKeyStatusList[i]; !ok || status == common.ChannelStatusEnabled {
+			enabledIdx = append(enabledIdx, i)
+		}
+	}
+	return enabledIdx
+}
+
+// LoadKeyUsageSnapshot 在渠道轮询锁外读取启用 key 的实时状态，非多密钥渠道返回 nil
+func (channel *Channel) LoadKeyUsageSnapshot() *ChannelKeyUsageSnapshot {
+	if !channel.ChannelInfo.IsMultiKey {
+		return nil
+	}
+	keys := channel.GetKeys()
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	enabledIdx := channel.enabledKeyIndexes(keys)
+	lock.Unlock()
+	return &ChannelKeyUsageSnapshot{
+		ChannelId: channel.Id,
+		states:    channel.getKeyUsageStates(keys, enabledIdx),
+	}
+}
+
+// HasAvailableKey 多密钥渠道是否存在启用且未冷却、未触及限额的 key，用于选路时跳过已耗尽的渠道；
+// snapshot 为空时现场读取
+func (channel *Channel) HasAvailableKey(snapshot *ChannelKeyUsageSnapshot) bool {
+	if !channel.ChannelInfo.IsMultiKey {
+		return true
+	}
+	if snapshot == nil || snapshot.ChannelId != channel.Id {
+		snapshot = channel.LoadKeyUsageSnapshot()
+	}
+	enabledIdx := make([]int, 0, len(snapshot.states))
+	for idx := range snapshot.states {
+		enabledIdx = append(enabledIdx, idx)
+	}
+	return len(channel.filterAvailableKeys(enabledIdx, snapshot.states)) > 0
+}
+
+// ChannelKeyUsageDetail 管理端展示的 key 实时状态与用量
+type ChannelKeyUsageDetail struct {
+	Index         int           `json:"index"`
+	KeyHash       string        `json:"key_hash"`
+	Limit         MultiKeyLimit `json:"limit"`
+	CurrentRPM    int64         `json:"current_rpm"`
+	CurrentTPM    int64         `json:"current_tpm"`
+	PeriodQuota   int64         `json:"period_quota"`
+	CooldownUntil int64         `json:"cooldown_until,omitempty"`
+	Headroom      float64       `json:"headroom"`
+	ChannelKeyUsageSummary
+}
+
+// GetChannelKeyUsageDetails 返回多密钥渠道各 key 的限额、实时窗口与累计用量
+func GetChannelKeyUsageDetails(channel *Channel) ([]ChannelKeyUsageDetail, error) {
+	keys := channel.GetKeys()
+	allIdx := make([]int, len(keys))
+	for i := range keys {
+		allIdx[i] = i
+	}
+	states := channel.getKeyUsageStates(keys, allIdx)
+
+	var rows []ChannelKeyUsage
+	if err := DB.Where("channel_id = ?", channel.Id).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	today := channelKeyDay(time.Now())
+	summaries := make(map[string]*ChannelKeyUsageSummary)
+	for _, row := range rows {
+		summary, ok := summaries[row.KeyHash]
+		if !ok {
+			summary = &ChannelKeyUsageSummary{}
+			summaries[row.KeyHash] = summary
+		}
+		summary.TotalRequests += row.RequestCount
+		summary.TotalTokens += row.TokenCount
+		summary.TotalQuota += row.UsedQuota
+		summary.TotalRateLimited += row.RateLimitedCount
+		if row.Day == today {
+			summary.TodayRequests += row.RequestCount
+			summary.TodayTokens += row.TokenCount
+			summary.TodayQuota += row.UsedQuota
+		}
+	}
+
+	now := time.Now().Unix()
+	details := make([]ChannelKeyUsageDetail, len(keys))
+	for i, key := range keys {
+		keyHash := ChannelKeyHash(key)
+		limit := channel.ChannelInfo.GetKeyLimit(i)
+		state := states[i]
+		detail := ChannelKeyUsageDetail{
+			Index:       i,
+			KeyHash:     keyHash,
+			Limit:       limit,
+			CurrentRPM:  state.Requests,
+			CurrentTPM:  state.Tokens,
+			PeriodQuota: state.PeriodQuota,
+			Headroom:    keyHeadroom(limit, state),
+		}
+		if state.CooldownUntil > now {
+			detail.CooldownUntil = state.CooldownUntil
+		}
+		if summary, ok := summaries[keyHash]; ok {
+			detail.ChannelKeyUsageSummary = *summary
+		}
+		details[i] = detail
+	}
+	return details, nil
+}
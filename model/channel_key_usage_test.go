@@ -0,0 +1,159 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetNextEnabledKeySkipsLimitedAndCoolingKeys(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:channel-key-usage-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&ChannelKeyUsage{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldRedisEnabled := DB, common.RedisEnabled
+	DB = db
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		DB = oldDB
+		common.RedisEnabled = oldRedisEnabled
+	})
+
+	channel := &Channel{
+		Id:  9001,
+		Key: "key-a\nkey-b\nkey-c",
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:   true,
+			MultiKeySize: 3,
+			MultiKeyMode: constant.MultiKeyModeLeastUsed,
+			MultiKeyLimits: map[int]MultiKeyLimit{
+				0: {RPM: 2},
+			},
+			MultiKeyDefaultLimit: &MultiKeyLimit{RPM: 10},
+		},
+	}
+
+	// key-a 触及 RPM 上限，key-b 处于冷却中，只剩 key-c 可用
+	RecordChannelKeyRequest(channel.Id, "key-a")
+	RecordChannelKeyRequest(channel.Id, "key-a")
+	CooldownChannelKey(channel.Id, "key-b", time.Minute)
+	key, index, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if key != "key-c" || index != 2 {
+		t.Fatalf("expected key-c, got %s (%d)", key, index)
+	}
+	if !channel.HasAvailableKey(nil) {
+		t.Fatal("expected channel to have an available key")
+	}
+
+	// 选 key 复用选路时读取的状态，不再重新读取
+	snapshot := channel.LoadKeyUsageSnapshot()
+	CooldownChannelKey(channel.Id, "key-c", time.Minute)
+	if key, _, _ = channel.GetNextEnabledKeyWithSnapshot(snapshot); key != "key-c" {
+		t.Fatalf("expected key-c from snapshot, got %s", key)
+	}
+	if err = ClearChannelKeyCooldown(channel.Id, "key-c"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 解除冷却后，key-b 的余量（10/10）高于 key-c（9/10）
+	RecordChannelKeyRequest(channel.Id, "key-c")
+	if err = ClearChannelKeyCooldown(channel.Id, "key-b"); err != nil {
+		t.Fatal(err)
+	}
+	if key, _, _ = channel.GetNextEnabledKey(); key != "key-b" {
+		t.Fatalf("expected key-b with most headroom, got %s", key)
+	}
+
+	// 全部 key 不可用时退回到所有启用的 key
+	CooldownChannelKey(channel.Id, "key-b", time.Minute)
+	CooldownChannelKey(channel.Id, "key-c", time.Minute)
+	if channel.HasAvailableKey(nil) {
+		t.Fatal("expected no available key")
+	}
+	if _, _, apiErr = channel.GetNextEnabledKey(); apiErr != nil {
+		t.Fatalf("expected fallback to enabled keys, got %v", apiErr)
+	}
+
+	// 用量异步写入数据库，等待写入完成后再检查并恢复数据库
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		details, err := GetChannelKeyUsageDetails(channel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if details[0].TotalRequests == 2 && details[1].TotalRateLimited == 2 && details[2].TotalRequests == 1 && details[2].TotalRateLimited == 2 {
+			if details[0].Limit.RPM != 2 || details[1].Limit.RPM != 10 || details[0].Headroom != 0 {
+				t.Fatalf("unexpected key limits: %+v", details)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected key usage: %+v", details)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPruneChannelKeyUsageCaches(t *testing.T) {
+	channelKeyWindowsLock.Lock()
+	channelKeyQuotaCachesLock.Lock()
+	originalWindows, originalQuotaCaches := channelKeyWindows, channelKeyQuotaCaches
+	channelKeyWindows = make(map[string]*channelKeyWindow)
+	channelKeyQuotaCaches = make(map[string]*channelKeyQuotaCache)
+	channelKeyWindowsPrunedMin, channelKeyQuotaCachesPrunedMin = 0, 0
+	channelKeyQuotaCachesLock.Unlock()
+	channelKeyWindowsLock.Unlock()
+	t.Cleanup(func() {
+		channelKeyWindowsLock.Lock()
+		channelKeyWindows = originalWindows
+		channelKeyWindowsLock.Unlock()
+		channelKeyQuotaCachesLock.Lock()
+		channelKeyQuotaCaches = originalQuotaCaches
+		channelKeyQuotaCachesLock.Unlock()
+	})
+
+	now := time.Now()
+	minute := now.Unix() / 60
+	channelKeyWindows["1:current"] = &channelKeyWindow{minute: minute, requests: 3}
+	channelKeyWindows["1:stale"] = &channelKeyWindow{minute: minute - 5, requests: 3}
+	channelKeyWindows["1:cooling"] = &channelKeyWindow{minute: minute - 5, cooldownUntil: now.Unix() + 60}
+	channelKeyQuotaCaches["1:fresh:day:1"] = &channelKeyQuotaCache{quota: 1, loadedAt: now}
+	channelKeyQuotaCaches["1:old:day:0"] = &channelKeyQuotaCache{quota: 1, loadedAt: now.Add(-time.Hour)}
+
+	channelKeyWindowsLock.Lock()
+	pruneChannelKeyWindows(now)
+	channelKeyWindowsLock.Unlock()
+	channelKeyQuotaCachesLock.Lock()
+	pruneChannelKeyQuotaCaches(now)
+	channelKeyQuotaCachesLock.Unlock()
+
+	// 过期窗口被删除，当前分钟与冷却中的窗口保留
+	if _, ok := channelKeyWindows["1:stale"]; ok {
+		t.Fatal("stale window should be pruned")
+	}
+	if len(channelKeyWindows) != 2 || channelKeyWindows["1:current"].requests != 3 || channelKeyWindows["1:cooling"] == nil {
+		t.Fatalf("unexpected windows after prune: %v", channelKeyWindows)
+	}
+	if _, ok := channelKeyQuotaCaches["1:old:day:0"]; ok || len(channelKeyQuotaCaches) != 1 {
+		t.Fatalf("expired quota caches should be pruned: %v", channelKeyQuotaCaches)
+	}
+
+	// 同一分钟内不重复清理
+	channelKeyWindows["1:stale"] = &channelKeyWindow{minute: minute - 5}
+	channelKeyWindowsLock.Lock()
+	pruneChannelKeyWindows(now)
+	channelKeyWindowsLock.Unlock()
+	if _, ok := channelKeyWindows["1:stale"]; !ok {
+		t.Fatal("prune should run at most once per minute")
+	}
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"gorm.io/gorm"
+)
+
+const channelNameSettingsMigrationKey = "ChannelNameConventionsMigratedToSettings"
+
+// 旧版本通过渠道名称约定开启的行为，迁移后改由渠道设置显式配置
+const (
+	legacyAutoOneChannelKeyword       = "auto-1"
+	legacyAutoOneLoadKeyword          = "负载"
+	legacyCacheCreationSkipNamePrefix = "cache-creation-skip_"
+)
+
+// parseLegacyCacheCreationSkipThreshold 解析渠道名称中 "cache-creation-skip_数字" 格式的阈值
+// 例如：渠道名称 "my-channel-cache-creation-skip_1024" 返回 (1024, true)
+func parseLegacyCacheCreationSkipThreshold(channelName string) (int, bool) {
+	idx := strings.Index(channelName, legacyCacheCreationSkipNamePrefix)
+	if idx == -1 {
+		return 0, false
+	}
+	start := idx + len(legacyCacheCreationSkipNamePrefix)
+	end := start
+	for end < len(channelName) && channelName[end] >= '0' && channelName[end] <= '9' {
+		end++
+	}
+	if end == start {
+		return 0, false
+	}
+	threshold, err := strconv.Atoi(channelName[start:end])
+	if err != nil || threshold <= 0 {
+		return 0, false
+	}
+	return threshold, true
+}
+
+// applyLegacyChannelNameConventions 将渠道名称中的约定写入渠道设置，已显式配置的字段保持不变，返回是否有修改
+func applyLegacyChannelNameConventions(name string, settings *dto.ChannelOtherSettings) bool {
+	changed := false
+	if strings.Contains(strings.ToLower(name), legacyAutoOneChannelKeyword) && len(settings.TempDisableKeywords) == 0 {
+		settings.TempDisableKeywords = []string{legacyAutoOneLoadKeyword}
+		settings.TempDisableMinutes = dto.DefaultTempDisableMinutes
+		changed = true
+	}
+	if threshold, ok := parseLegacyCacheCreationSkipThreshold(name); ok && settings.CacheCreationSkipThreshold == 0 {
+		settings.CacheCreationSkipThreshold = threshold
+		changed = true
+	}
+	return changed
+}
+
+// migrateChannelNameConventions 一次性将依赖渠道名称的约定（auto-1、cache-creation-skip_N）迁移为渠道设置
+func migrateChannelNameConventions(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrated, err := optionIsTrueTx(tx, channelNameSettingsMigrationKey)
+		if err != nil || migrated {
+			return err
+		}
+
+		var channels []*Channel
+		err = tx.Select("id", "name", "settings").
+			Where("LOWER(name) LIKE ? OR name LIKE ?", "%"+legacyAutoOneChannelKeyword+"%", "%"+legacyCacheCreationSkipNamePrefix+"%").
+			Find(&channels).Error
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, channel := range channels {
+			settings := dto.ChannelOtherSettings{}
+			if channel.OtherSettings != "" {
+				if err := common.UnmarshalJsonStr(channel.OtherSettings, &settings); err != nil {
+					common.SysLog(fmt.Sprintf("skip channel name convention migration: channel_id=%d, error=%v", channel.Id, err))
+					continue
+				}
+			}
+			if !applyLegacyChannelNameConventions(channel.Name, &settings) {
+				continue
+			}
+			settingsBytes, err := common.Marshal(settings)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&Channel{}).Where("id = ?", channel.Id).Update("settings", string(settingsBytes)).Error; err != nil {
+				return err
+			}
+			count++
+		}
+
+		if err := upsertOptionTx(tx, channelNameSettingsMigrationKey, "true"); err != nil {
+			return err
+		}
+		if count > 0 {
+			common.SysLog(fmt.Sprintf("migrated channel name conventions to settings for %d channels", count))
+		}
+		return nil
+	})
+}
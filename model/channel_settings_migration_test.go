@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateChannelNameConventions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:channel-name-conventions-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Channel{}, &Option{}); err != nil {
+		t.Fatal(err)
+	}
+	channels := []*Channel{
+		{Id: 1, Name: "Claude-AUTO-1", Key: "k1"},
+		{Id: 2, Name: "claude-cache-creation-skip_2048", Key: "k2", OtherSettings: `{"allow_service_tier":true}`},
+		{Id: 3, Name: "auto-1-manual", Key: "k3", OtherSettings: `{"temp_disable_keywords":["overloaded"],"temp_disable_minutes":10}`},
+		{Id: 4, Name: "plain", Key: "k4"},
+	}
+	if err = db.Create(&channels).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err = migrateChannelNameConventions(db); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(id int) *Channel {
+		channel := &Channel{}
+		if err := db.First(channel, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return channel
+	}
+	autoOne := load(1).GetOtherSettings()
+	if len(autoOne.TempDisableKeywords) != 1 || autoOne.TempDisableKeywords[0] != "负载" || autoOne.TempDisableMinutes != 5 {
+		t.Fatalf("unexpected auto-1 settings: %+v", autoOne)
+	}
+	cacheSkip := load(2).GetOtherSettings()
+	if cacheSkip.CacheCreationSkipThreshold != 2048 || !cacheSkip.AllowServiceTier {
+		t.Fatalf("unexpected cache skip settings: %+v", cacheSkip)
+	}
+	// 已显式配置的渠道保持不变
+	manual := load(3).GetOtherSettings()
+	if len(manual.TempDisableKeywords) != 1 || manual.TempDisableKeywords[0] != "overloaded" || manual.TempDisableMinutes != 10 {
+		t.Fatalf("explicit settings should be kept: %+v", manual)
+	}
+	if load(4).OtherSettings != "" {
+		t.Fatal("unrelated channel should not be modified")
+	}
+
+	// 迁移只执行一次
+	if err = db.Model(&Channel{}).Where("id = ?", 1).Update("settings", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = migrateChannelNameConventions(db); err != nil {
+		t.Fatal(err)
+	}
+	if load(1).OtherSettings != "" {
+		t.Fatal("migration should run only once")
+	}
+}
+
+func TestValidateChannelOtherSettings(t *testing.T) {
+	cases := map[string]bool{
+		`{"temp_disable_keywords":["负载"],"temp_disable_minutes":3}`: true,
+		`{"temp_disable_keywords":[" "]}`:                           false,
+		`{"temp_disable_minutes":-1}`:                               false,
+		`{"cache_creation_skip_threshold":-5}`:                      false,
+		`{"cache_creation_skip_threshold":1024}`:                    true,
+	}
+	for raw, valid := range cases {
+		channel := &Channel{OtherSettings: raw}
+		if err := channel.ValidateSettings(); (err == nil) != valid {
+			t.Fatalf("settings %s: expected valid=%v, got err=%v", raw, valid, err)
+		}
+	}
+}
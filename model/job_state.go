@@ -0,0 +1,104 @@
+package model
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobState 后台任务在集群中的租约与运行状态，每个任务一行
+// 未启用 Redis 时租约也保存在这里（Holder / LeaseExpiresAt），启用 Redis 时租约保存在 Redis 中，这里只记录运行状态
+type JobState struct {
+	Name             string `json:"name" gorm:"primaryKey;type:varchar(64)"`
+	Holder           string `json:"holder" gorm:"type:varchar(128);default:''"`
+	LeaseExpiresAt   int64  `json:"lease_expires_at" gorm:"bigint;default:0"`
+	LastRunAt        int64  `json:"last_run_at" gorm:"bigint;default:0"`
+	LastRunBy        string `json:"last_run_by" gorm:"type:varchar(128);default:''"`
+	LastDurationMs   int64  `json:"last_duration_ms" gorm:"bigint;default:0"`
+	LastError        string `json:"last_error" gorm:"type:text"`
+	NextRunAt        int64  `json:"next_run_at" gorm:"bigint;default:0"`
+	RunCount         int64  `json:"run_count" gorm:"bigint;default:0"`
+	TriggerRequested bool   `json:"trigger_requested" gorm:"default:false"`
+	UpdatedAt        int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func ensureJobState(name string) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&JobState{Name: name, UpdatedAt: common.GetTimestamp()}).Error
+}
+
+// TryAcquireJobLease 尝试获取或续期任务租约：租约空闲、已过期或本来就由 holder 持有时成功
+func TryAcquireJobLease(name string, holder string, ttl time.Duration) (bool, error) {
+	if err := ensureJobState(name); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	result := DB.Model(&JobState{}).
+		Where("name = ? AND (holder = ? OR holder = '' OR lease_expires_at < ?)", name, holder, now.Unix()).
+		Updates(map[string]interface{}{
+			"holder":           holder,
+			"lease_expires_at": now.Add(ttl).Unix(),
+			"updated_at":       now.Unix(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReleaseJobLease 释放 holder 持有的租约，用于节点关闭时让其他节点尽快接管
+func ReleaseJobLease(name string, holder string) error {
+	return DB.Model(&JobState{}).
+		Where("name = ? AND holder = ?", name, holder).
+		Updates(map[string]interface{}{
+			"holder":           "",
+			"lease_expires_at": 0,
+			"updated_at":       common.GetTimestamp(),
+		}).Error
+}
+
+// SaveJobRunResult 记录一次运行结果，并清除手动触发标记
+func SaveJobRunResult(name string, holder string, startedAt time.Time, duration time.Duration, runErr error, nextRunAt time.Time) error {
+	if err := ensureJobState(name); err != nil {
+		return err
+	}
+	lastError := ""
+	if runErr != nil {
+		lastError = runErr.Error()
+	}
+	return DB.Model(&JobState{}).Where("name = ?", name).Updates(map[string]interface{}{
+		"last_run_at":       startedAt.Unix(),
+		"last_run_by":       holder,
+		"last_duration_ms":  duration.Milliseconds(),
+		"last_error":        lastError,
+		"next_run_at":       nextRunAt.Unix(),
+		"run_count":         gorm.Expr("run_count + ?", 1),
+		"trigger_requested": false,
+		"updated_at":        common.GetTimestamp(),
+	}).Error
+}
+
+// RequestJobTrigger 标记任务需要立即运行，由持有租约的节点在下一次调度检查时执行
+func RequestJobTrigger(name string) error {
+	if err := ensureJobState(name); err != nil {
+		return err
+	}
+	return DB.Model(&JobState{}).Where("name = ?", name).Updates(map[string]interface{}{
+		"trigger_requested": true,
+		"updated_at":        common.GetTimestamp(),
+	}).Error
+}
+
+func GetJobStates() (map[string]*JobState, error) {
+	var states []*JobState
+	if err := DB.Find(&states).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*JobState, len(states))
+	for _, state := range states {
+		result[state.Name] = state
+	}
+	return result, nil
+}
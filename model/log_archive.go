@@ -0,0 +1,189 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// LogArchive 日志归档清单：每条记录对应对象存储中的一个压缩归档文件
+type LogArchive struct {
+	Id           int    `json:"id"`
+	ObjectKey    string `json:"object_key" gorm:"type:varchar(512);uniqueIndex"`
+	PartitionDay string `json:"partition_day" gorm:"type:varchar(16);index"` // 按天分区，YYYY-MM-DD
+	StartTime    int64  `json:"start_time" gorm:"bigint;index"`              // 文件内最早日志的 created_at
+	EndTime      int64  `json:"end_time" gorm:"bigint;index"`                // 文件内最晚日志的 created_at
+	MinLogId     int    `json:"min_log_id"`
+	MaxLogId     int    `json:"max_log_id" gorm:"index"`
+	RowCount     int    `json:"row_count"`
+	TypeCounts   string `json:"type_counts" gorm:"type:text"` // 按日志类型统计的行数 JSON，如 {"2":100,"5":3}
+	SizeBytes    int64  `json:"size_bytes"`
+	Checksum     string `json:"checksum" gorm:"type:varchar(64)"` // 压缩文件 sha256
+	CreatedAt    int64  `json:"created_at" gorm:"bigint"`
+}
+
+// SetTypeCounts 按日志类型统计归档内的行数
+func (a *LogArchive) SetTypeCounts(logs []*Log) error {
+	counts := make(map[string]int)
+	for _, log := range logs {
+		counts[strconv.Itoa(log.Type)]++
+	}
+	data, err := common.Marshal(counts)
+	if err != nil {
+		return err
+	}
+	a.TypeCounts = string(data)
+	return nil
+}
+
+// MatchedCount 不读取归档文件直接得出满足过滤条件的行数：仅当过滤条件只有日志类型且时间范围完整覆盖归档时可得，否则返回 false
+func (a *LogArchive) MatchedCount(filter *ArchivedLogFilter) (int64, bool) {
+	if filter.ModelName != "" || filter.Username != "" || filter.TokenName != "" || filter.Channel != 0 || filter.Group != "" {
+		return 0, false
+	}
+	if (filter.StartTimestamp != 0 && filter.StartTimestamp > a.StartTime) || (filter.EndTimestamp != 0 && filter.EndTimestamp < a.EndTime) {
+		return 0, false
+	}
+	if filter.LogType == LogTypeUnknown {
+		return int64(a.RowCount), true
+	}
+	// 早期归档没有按类型统计
+	if a.TypeCounts == "" {
+		return 0, false
+	}
+	counts := make(map[string]int64)
+	if err := common.UnmarshalJsonStr(a.TypeCounts, &counts); err != nil {
+		return 0, false
+	}
+	return counts[strconv.Itoa(filter.LogType)], true
+}
+
+// GetArchivableLogs 返回 created_at 早于 cutoff 的最早一批日志（按 id 升序）
+func GetArchivableLogs(cutoff int64, limit int) (logs []*Log, err error) {
+	err = LOG_DB.Where("created_at < ?", cutoff).Order("id asc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// DeleteArchivedLogs 删除已归档的日志；由于归档批次按 id 升序选取，id 区间内早于 cutoff 的日志即为整批
+func DeleteArchivedLogs(minId int, maxId int, cutoff int64) (int64, error) {
+	result := LOG_DB.Where("id >= ? and id <= ? and created_at < ?", minId, maxId, cutoff).Delete(&Log{})
+	return result.RowsAffected, result.Error
+}
+
+// SaveLogArchive 写入归档清单，同一对象重复归档时覆盖原清单
+func SaveLogArchive(archive *LogArchive) error {
+	return LOG_DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_key"}},
+		UpdateAll: true,
+	}).Create(archive).Error
+}
+
+// GetLogArchivesInRange 返回与时间范围有交集的归档清单，按最大日志 id 降序；endTime 为 0 表示不限
+func GetLogArchivesInRange(startTime int64, endTime int64) (archives []*LogArchive, err error) {
+	tx := LOG_DB.Model(&LogArchive{})
+	if startTime != 0 {
+		tx = tx.Where("end_time >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("start_time <= ?", endTime)
+	}
+	err = tx.Order("max_log_id desc").Find(&archives).Error
+	return archives, err
+}
+
+// HasLogArchivesInRange 判断时间范围内是否存在归档日志
+func HasLogArchivesInRange(startTime int64, endTime int64) bool {
+	tx := LOG_DB.Model(&LogArchive{})
+	if startTime != 0 {
+		tx = tx.Where("end_time >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("start_time <= ?", endTime)
+	}
+	var count int64
+	if err := tx.Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+func GetAllLogArchives(startIdx int, num int) (archives []*LogArchive, total int64, err error) {
+	if err = LOG_DB.Model(&LogArchive{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = LOG_DB.Order("max_log_id desc").Limit(num).Offset(startIdx).Find(&archives).Error
+	return archives, total, err
+}
+
+// ArchivedLogFilter 在内存中对归档日志套用与 GetAllLogs 相同的过滤条件
+type ArchivedLogFilter struct {
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+	modelMatcher   *regexp.Regexp
+}
+
+// likePatternToRegexp 将 SQL LIKE 模式（% 与 _）转换为正则
+func likePatternToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func (f *ArchivedLogFilter) Match(log *Log) bool {
+	if f.LogType != LogTypeUnknown && log.Type != f.LogType {
+		return false
+	}
+	if f.StartTimestamp != 0 && log.CreatedAt < f.StartTimestamp {
+		return false
+	}
+	if f.EndTimestamp != 0 && log.CreatedAt > f.EndTimestamp {
+		return false
+	}
+	if f.ModelName != "" {
+		if f.modelMatcher == nil {
+			f.modelMatcher = likePatternToRegexp(f.ModelName)
+		}
+		if !f.modelMatcher.MatchString(log.ModelName) {
+			return false
+		}
+	}
+	if f.Username != "" && log.Username != f.Username {
+		return false
+	}
+	if f.TokenName != "" && log.TokenName != f.TokenName {
+		return false
+	}
+	if f.Channel != 0 && log.ChannelId != f.Channel {
+		return false
+	}
+	if f.Group != "" && log.Group != f.Group {
+		return false
+	}
+	return true
+}
+
+// FillLogChannelNames 为归档查询结果补充渠道名称
+func FillLogChannelNames(logs []*Log) error {
+	return fillLogChannelNames(logs)
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// LogExportFilter 日志导出过滤条件，零值字段表示不过滤
+type LogExportFilter struct {
+	UserId         int
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+}
+
+func (f LogExportFilter) apply(tx *gorm.DB) *gorm.DB {
+	if f.UserId != 0 {
+		tx = tx.Where("logs.user_id = ?", f.UserId)
+	}
+	if f.LogType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", f.LogType)
+	}
+	if f.ModelName != "" {
+		tx = tx.Where("logs.model_name like ?", f.ModelName)
+	}
+	if f.Username != "" {
+		tx = tx.Where("logs.username = ?", f.Username)
+	}
+	if f.TokenName != "" {
+		tx = tx.Where("logs.token_name = ?", f.TokenName)
+	}
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", f.EndTimestamp)
+	}
+	if f.Channel != 0 {
+		tx = tx.Where("logs.channel_id = ?", f.Channel)
+	}
+	if f.Group != "" {
+		tx = tx.Where("logs."+logGroupCol+" = ?", f.Group)
+	}
+	return tx
+}
+
+// StreamLogs 按 id 升序分批读取满足条件的日志并交给 fn 处理，避免一次性加载全部日志。
+// forUser 为 true 时按用户视角脱敏（移除渠道名称与管理员信息），否则填充渠道名称。
+func StreamLogs(filter LogExportFilter, batchSize int, forUser bool, fn func(logs []*Log) error) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	lastId := 0
+	for {
+		var logs []*Log
+		tx := filter.apply(LOG_DB.Model(&Log{}))
+		err := tx.Where("logs.id > ?", lastId).Order("logs.id asc").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+		if forUser {
+			formatUserLogs(logs)
+		} else if err = fillLogChannelNames(logs); err != nil {
+			return err
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 用量聚合支持的分组维度
+const (
+	LogUsageGroupByModel = "model"
+	LogUsageGroupByToken = "token"
+	LogUsageGroupByUser  = "user"
+	LogUsageGroupByGroup = "group"
+)
+
+// LogUsageQuery 按时间桶聚合消费日志的查询条件，时间范围为 [StartTime, EndTime)
+type LogUsageQuery struct {
+	StartTime   int64
+	EndTime     int64
+	BucketWidth int64 // 秒
+	UserIds     []int
+	TokenIds    []int
+	ModelNames  []string
+	Groups      []string
+	GroupBy     []string
+}
+
+// LogUsageRow 单个时间桶内某一分组维度组合的用量汇总
+type LogUsageRow struct {
+	BucketStart      int64  `gorm:"column:bucket_start"`
+	ModelName        string `gorm:"column:model_name"`
+	TokenId          int    `gorm:"column:token_id"`
+	TokenName        string `gorm:"column:token_name"`
+	UserId           int    `gorm:"column:user_id"`
+	Group            string `gorm:"column:log_group"`
+	NumRequests      int64  `gorm:"column:num_requests"`
+	PromptTokens     int64  `gorm:"column:prompt_tokens"`
+	CompletionTokens int64  `gorm:"column:completion_tokens"`
+	Quota            int64  `gorm:"column:quota"`
+}
+
+// GetLogUsageBuckets 以消费日志为数据源，按时间桶与分组维度聚合请求数、token 与额度
+func GetLogUsageBuckets(query LogUsageQuery) (rows []*LogUsageRow, err error) {
+	if query.BucketWidth <= 0 {
+		return nil, fmt.Errorf("invalid bucket width %d", query.BucketWidth)
+	}
+	bucketExpr := fmt.Sprintf("logs.created_at - (logs.created_at %% %d)", query.BucketWidth)
+	selects := []string{
+		bucketExpr + " as bucket_start",
+		"count(*) as num_requests",
+		"sum(logs.prompt_tokens) as prompt_tokens",
+		"sum(logs.completion_tokens) as completion_tokens",
+		"sum(logs.quota) as quota",
+	}
+	groups := []string{"bucket_start"}
+	for _, dimension := range query.GroupBy {
+		switch dimension {
+		case LogUsageGroupByModel:
+			selects = append(selects, "logs.model_name as model_name")
+			groups = append(groups, "logs.model_name")
+		case LogUsageGroupByToken:
+			selects = append(selects, "logs.token_id as token_id", "max(logs.token_name) as token_name")
+			groups = append(groups, "logs.token_id")
+		case LogUsageGroupByUser:
+			selects = append(selects, "logs.user_id as user_id")
+			groups = append(groups, "logs.user_id")
+		case LogUsageGroupByGroup:
+			selects = append(selects, "logs."+logGroupCol+" as log_group")
+			groups = append(groups, "logs."+logGroupCol)
+		default:
+			return nil, fmt.Errorf("unsupported group by %s", dimension)
+		}
+	}
+
+	tx := LOG_DB.Table("logs").Select(strings.Join(selects, ", ")).
+		Where("logs.type = ? and logs.created_at >= ? and logs.created_at < ?", LogTypeConsume, query.StartTime, query.EndTime)
+	if len(query.UserIds) > 0 {
+		tx = tx.Where("logs.user_id IN ?", query.UserIds)
+	}
+	if len(query.TokenIds) > 0 {
+		tx = tx.Where("logs.token_id IN ?", query.TokenIds)
+	}
+	if len(query.ModelNames) > 0 {
+		tx = tx.Where("logs.model_name IN ?", query.ModelNames)
+	}
+	if len(query.Groups) > 0 {
+		tx = tx.Where("logs."+logGroupCol+" IN ?", query.Groups)
+	}
+	err = tx.Group(strings.Join(groups, ", ")).Order("bucket_start asc").Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetLogUsageBucketsGroupsByBucketAndDimensions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:log-usage-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldLogDB, oldLogGroupCol := LOG_DB, logGroupCol
+	LOG_DB = db
+	logGroupCol = "`group`"
+	t.Cleanup(func() {
+		LOG_DB = oldLogDB
+		logGroupCol = oldLogGroupCol
+	})
+	if err := db.AutoMigrate(&Log{}); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := []Log{
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: 3600, ModelName: "gpt-4.1", TokenId: 7, TokenName: "a", Group: "default", PromptTokens: 10, CompletionTokens: 5, Quota: 100},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: 3700, ModelName: "gpt-4.1", TokenId: 7, TokenName: "a", Group: "default", PromptTokens: 20, CompletionTokens: 5, Quota: 200},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: 3800, ModelName: "claude", TokenId: 8, TokenName: "b", Group: "vip", PromptTokens: 1, CompletionTokens: 1, Quota: 10},
+		{UserId: 2, Type: LogTypeConsume, CreatedAt: 7300, ModelName: "gpt-4.1", TokenId: 9, TokenName: "c", Group: "default", PromptTokens: 3, CompletionTokens: 3, Quota: 30},
+		{UserId: 1, Type: LogTypeError, CreatedAt: 3900, ModelName: "gpt-4.1", TokenId: 7, Group: "default"},
+	}
+	if err := db.Create(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := GetLogUsageBuckets(LogUsageQuery{
+		StartTime:   0,
+		EndTime:     10800,
+		BucketWidth: 3600,
+		UserIds:     []int{1},
+		GroupBy:     []string{LogUsageGroupByModel, LogUsageGroupByGroup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	for _, row := range rows {
+		if row.BucketStart != 3600 {
+			t.Fatalf("unexpected bucket start %d", row.BucketStart)
+		}
+		if row.ModelName == "gpt-4.1" && (row.NumRequests != 2 || row.PromptTokens != 30 || row.Quota != 300 || row.Group != "default") {
+			t.Fatalf("unexpected gpt-4.1 row: %+v", row)
+		}
+	}
+
+	rows, err = GetLogUsageBuckets(LogUsageQuery{StartTime: 0, EndTime: 10800, BucketWidth: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].NumRequests != 3 || rows[1].BucketStart != 7200 || rows[1].Quota != 30 {
+		t.Fatalf("unexpected ungrouped rows: %+v %+v", rows[0], rows[1])
+	}
+}
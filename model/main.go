@@ -285,6 +285,16 @@ func migrateDB() error {
 		&TwoFABackupCode{},
 		&Message{},
 		&UserMessage{},
+		&PriceBookVersion{},
+		&StoredResponse{},
+		&ChannelKeyUsage{},
+		&QuotaLedger{},
+		&JobState{},
+		&CacheChangeEvent{},
+		&TaskCallbackDelivery{},
+		&TaskArtifact{},
+		&TaskArtifactCharge{},
+		&TaskRefund{},
 	)
 	if err != nil {
 		return err
@@ -292,6 +302,15 @@ func migrateDB() error {
 	if err = migrateLegacyDefaultQuotaPerUnitData(DB); err != nil {
 		return err
 	}
+	if err = migrateChannelNameConventions(DB); err != nil {
+		return err
+	}
+	if err = migrateQuotaLedgerOpeningBalances(DB); err != nil {
+		return err
+	}
+	if err = migrateTaskRefundLegacyTasks(DB); err != nil {
+		return err
+	}
 	if err = BackfillUserCAHIDs(); err != nil {
 		return err
 	}
@@ -342,6 +361,16 @@ func migrateDBFast() error {
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
 		{&Message{}, "Message"},
 		{&UserMessage{}, "UserMessage"},
+		{&PriceBookVersion{}, "PriceBookVersion"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&ChannelKeyUsage{}, "ChannelKeyUsage"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&JobState{}, "JobState"},
+		{&CacheChangeEvent{}, "CacheChangeEvent"},
+		{&TaskCallbackDelivery{}, "TaskCallbackDelivery"},
+		{&TaskArtifact{}, "TaskArtifact"},
+		{&TaskArtifactCharge{}, "TaskArtifactCharge"},
+		{&TaskRefund{}, "TaskRefund"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -372,7 +401,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}, &AdminAuditLog{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &AdminAuditLog{}, &LogArchive{}); err != nil {
 		return err
 	}
 	if err = migrateLegacyDefaultQuotaPerUnitLogData(LOG_DB); err != nil {
@@ -1,5 +1,16 @@
 package model
 
+import (
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
 type Midjourney struct {
 	Id          int    `json:"id"`
 	Code        int    `json:"code"`
@@ -23,6 +34,9 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	// 任务状态回调，提交时解析，不对外返回
+	CallbackUrl    string `json:"-" gorm:"type:varchar(512);default:''"`
+	CallbackSecret string `json:"-" gorm:"type:varchar(255);default:''"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -121,6 +135,89 @@ func GetByMJId(userId int, mjId string) *Midjourney {
 	return mj
 }
 
+// GetMidjourneyTask 按任务 ID 查找 Midjourney 异步图像任务，先查 tasks 表，再查 /mj 接口使用的 midjourneys 表。
+// /mj 提交的任务结束后补写一条 tasks 记录，之后的变换、放大与查询统一使用该记录；未结束的任务仍由 /mj 轮询更新，
+// 只返回转换后的记录而不写入，避免两套轮询重复处理。补写的记录不含额度，费用仍以 midjourneys 表为准
+func GetMidjourneyTask(userId int, taskId string) (*Task, bool, error) {
+	task, exist, err := GetByTaskId(userId, taskId)
+	if err != nil || exist {
+		return task, exist, err
+	}
+	mj := GetByMJId(userId, taskId)
+	if mj == nil {
+		return nil, false, nil
+	}
+	task = mj.toTask()
+	if task.Status != TaskStatusSuccess && task.Status != TaskStatusFailure {
+		return task, true, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Task{}).Where("user_id = ? and task_id = ?", userId, taskId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		return tx.Create(task).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return task, true, nil
+}
+
+// toTask 将 /mj 任务转换为 tasks 记录，结果地址按异步图像任务的约定保存在 FailReason 中
+func (midjourney *Midjourney) toTask() *Task {
+	task := &Task{
+		CreatedAt:  midjourney.SubmitTime / 1000,
+		UpdatedAt:  time.Now().Unix(),
+		TaskID:     midjourney.MjId,
+		Platform:   constant.TaskPlatformMidjourney,
+		UserId:     midjourney.UserId,
+		ChannelId:  midjourney.ChannelId,
+		Action:     midjourney.Action,
+		FailReason: midjourney.FailReason,
+		SubmitTime: midjourney.SubmitTime / 1000,
+		StartTime:  midjourney.StartTime / 1000,
+		FinishTime: midjourney.FinishTime / 1000,
+		Progress:   midjourney.Progress,
+		Properties: Properties{
+			Input:           midjourney.Prompt,
+			OriginModelName: strings.ToLower(string(constant.TaskPlatformMidjourney)) + "_" + strings.ToLower(midjourney.Action),
+		},
+	}
+	switch midjourney.Status {
+	case "SUCCESS":
+		task.Status = TaskStatusSuccess
+		task.FailReason = midjourney.ImageUrl
+	case "FAILURE":
+		task.Status = TaskStatusFailure
+	case "IN_PROGRESS", "MODAL":
+		task.Status = TaskStatusInProgress
+	default:
+		task.Status = TaskStatusSubmitted
+	}
+	data := dto.MidjourneyDto{
+		MjId:       midjourney.MjId,
+		Action:     midjourney.Action,
+		Prompt:     midjourney.Prompt,
+		PromptEn:   midjourney.PromptEn,
+		ImageUrl:   midjourney.ImageUrl,
+		Status:     midjourney.Status,
+		Progress:   midjourney.Progress,
+		FailReason: midjourney.FailReason,
+	}
+	if midjourney.Buttons != "" {
+		var buttons any
+		if err := common.UnmarshalJsonStr(midjourney.Buttons, &buttons); err == nil {
+			data.Buttons = buttons
+		}
+	}
+	task.SetData(data)
+	return task
+}
+
 func GetByMJIds(userId int, mjIds []string) []*Midjourney {
 	var mj []*Midjourney
 	var err error
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetMidjourneyTaskBackfill(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:midjourney-task-backfill-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Midjourney{}, &Task{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = oldDB
+	})
+
+	mjs := []*Midjourney{
+		{MjId: "mj_done", UserId: 1, ChannelId: 3, Action: constant.MjActionImagine, Status: "SUCCESS", Progress: "100%",
+			ImageUrl: "https://cdn/1.png", SubmitTime: 1700000000000, Quota: 50, Buttons: `[{"customId":"MJ::JOB::upsample::1"}]`},
+		{MjId: "mj_running", UserId: 1, ChannelId: 3, Action: constant.MjActionImagine, Status: "IN_PROGRESS", Progress: "40%"},
+	}
+	if err = db.Create(&mjs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	task, exist, err := GetMidjourneyTask(1, "mj_done")
+	if err != nil || !exist {
+		t.Fatalf("expected task from midjourneys table: %v, %v", exist, err)
+	}
+	if task.Platform != constant.TaskPlatformMidjourney || task.Status != TaskStatusSuccess || task.ChannelId != 3 ||
+		task.FailReason != "https://cdn/1.png" || task.SubmitTime != 1700000000 || task.Quota != 0 {
+		t.Fatalf("unexpected converted task %+v", task)
+	}
+	// 已结束的 /mj 任务补写到 tasks 表，重复查找不会重复写入
+	if _, _, err = GetMidjourneyTask(1, "mj_done"); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&Task{}).Where("task_id = ?", "mj_done").Count(&count)
+	if count != 1 {
+		t.Fatalf("expected 1 backfilled task, got %d", count)
+	}
+	if task, exist, err = GetByTaskId(1, "mj_done"); err != nil || !exist || task.Properties.OriginModelName != "mj_imagine" {
+		t.Fatalf("expected backfilled task to be found in tasks table: %+v, %v, %v", task, exist, err)
+	}
+
+	// 未结束的任务只返回转换结果，由 /mj 轮询继续更新
+	task, exist, err = GetMidjourneyTask(1, "mj_running")
+	if err != nil || !exist || task.Status != TaskStatusInProgress {
+		t.Fatalf("unexpected running task %+v, %v, %v", task, exist, err)
+	}
+	db.Model(&Task{}).Where("task_id = ?", "mj_running").Count(&count)
+	if count != 0 {
+		t.Fatalf("running task should not be backfilled, got %d", count)
+	}
+
+	if _, exist, err = GetMidjourneyTask(2, "mj_done"); err != nil || exist {
+		t.Fatalf("other users should not see the task: %v, %v", exist, err)
+	}
+}
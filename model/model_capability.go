@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+var (
+	modelCapabilityExact = make(map[string]*Model)
+	modelCapabilityRules = make([]*Model, 0)
+	modelCapabilityLock  sync.RWMutex
+)
+
+func splitModalities(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	result := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// NormalizeModalities 规范化以逗号分隔的模态列表（小写、去空、去重）
+func NormalizeModalities(s string) string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, m := range splitModalities(s) {
+		if !seen[m] {
+			seen[m] = true
+			result = append(result, m)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+func (mi *Model) HasCapabilityMetadata() bool {
+	return mi.ContextLength > 0 || mi.MaxOutputTokens > 0 ||
+		strings.TrimSpace(mi.InputModalities) != "" || strings.TrimSpace(mi.OutputModalities) != "" ||
+		mi.SupportsTools != nil || mi.SupportsReasoning != nil
+}
+
+func (mi *Model) Capability() types.ModelCapability {
+	return types.ModelCapability{
+		ContextLength:     mi.ContextLength,
+		MaxOutputTokens:   mi.MaxOutputTokens,
+		InputModalities:   splitModalities(mi.InputModalities),
+		OutputModalities:  splitModalities(mi.OutputModalities),
+		SupportsTools:     mi.SupportsTools,
+		SupportsReasoning: mi.SupportsReasoning,
+	}
+}
+
+// ValidateCapability 校验能力字段取值
+func (mi *Model) ValidateCapability() error {
+	if mi.ContextLength < 0 {
+		return fmt.Errorf("context_length 不能为负数")
+	}
+	if mi.MaxOutputTokens < 0 {
+		return fmt.Errorf("max_output_tokens 不能为负数")
+	}
+	if mi.ContextLength > 0 && mi.MaxOutputTokens > mi.ContextLength {
+		return fmt.Errorf("max_output_tokens 不能大于 context_length")
+	}
+	mi.InputModalities = NormalizeModalities(mi.InputModalities)
+	mi.OutputModalities = NormalizeModalities(mi.OutputModalities)
+	return nil
+}
+
+// refreshModelCapabilities 重建能力元数据缓存，由 updatePricing 调用
+func refreshModelCapabilities(allMeta []Model) {
+	exact := make(map[string]*Model)
+	rules := make([]*Model, 0)
+	for i := range allMeta {
+		m := &allMeta[i]
+		if !m.HasCapabilityMetadata() {
+			continue
+		}
+		if m.NameRule == NameRuleExact {
+			exact[m.ModelName] = m
+		} else {
+			rules = append(rules, m)
+		}
+	}
+	modelCapabilityLock.Lock()
+	modelCapabilityExact = exact
+	modelCapabilityRules = rules
+	modelCapabilityLock.Unlock()
+}
+
+// HasModelCapabilityMetadata 是否存在任何配置了能力元数据的模型
+func HasModelCapabilityMetadata() bool {
+	GetPricing()
+
+	modelCapabilityLock.RLock()
+	defer modelCapabilityLock.RUnlock()
+	return len(modelCapabilityExact) > 0 || len(modelCapabilityRules) > 0
+}
+
+func matchModelNameRule(m *Model, name string) bool {
+	switch m.NameRule {
+	case NameRulePrefix:
+		return strings.HasPrefix(name, m.ModelName)
+	case NameRuleSuffix:
+		return strings.HasSuffix(name, m.ModelName)
+	case NameRuleContains:
+		return strings.Contains(name, m.ModelName)
+	default:
+		return m.ModelName == name
+	}
+}
+
+// GetModelCapability 返回模型的能力元数据（来自缓存），匹配顺序：精确 -> 归一化名称 -> 前缀 -> 后缀 -> 包含
+func GetModelCapability(modelName string) (types.ModelCapability, bool) {
+	if modelName == "" {
+		return types.ModelCapability{}, false
+	}
+	GetPricing()
+
+	modelCapabilityLock.RLock()
+	defer modelCapabilityLock.RUnlock()
+	if m, ok := modelCapabilityExact[modelName]; ok {
+		return m.Capability(), true
+	}
+	if normalized := ratio_setting.FormatMatchingModelName(modelName); normalized != modelName {
+		if m, ok := modelCapabilityExact[normalized]; ok {
+			return m.Capability(), true
+		}
+	}
+	for _, rule := range []int{NameRulePrefix, NameRuleSuffix, NameRuleContains} {
+		for _, m := range modelCapabilityRules {
+			if m.NameRule == rule && matchModelNameRule(m, modelName) {
+				return m.Capability(), true
+			}
+		}
+	}
+	return types.ModelCapability{}, false
+}
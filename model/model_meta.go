@@ -34,6 +34,14 @@ type Model struct {
 	UpdatedTime  int64          `json:"updated_time" gorm:"bigint"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index;uniqueIndex:uk_model_name_delete_at,priority:2"`
 
+	// 能力元数据：0 / 空 / nil 表示未知，未知能力不参与请求校验与渠道筛选
+	ContextLength     int    `json:"context_length,omitempty" gorm:"default:0"`
+	MaxOutputTokens   int    `json:"max_output_tokens,omitempty" gorm:"default:0"`
+	InputModalities   string `json:"input_modalities,omitempty" gorm:"type:varchar(255)"`
+	OutputModalities  string `json:"output_modalities,omitempty" gorm:"type:varchar(255)"`
+	SupportsTools     *bool  `json:"supports_tools,omitempty"`
+	SupportsReasoning *bool  `json:"supports_reasoning,omitempty"`
+
 	BoundChannels []BoundChannel `json:"bound_channels,omitempty" gorm:"-"`
 	EnableGroups  []string       `json:"enable_groups,omitempty" gorm:"-"`
 	QuotaTypes    []int          `json:"quota_types,omitempty" gorm:"-"`
@@ -152,9 +152,13 @@ func InitOptionMap() {
 	common.OptionMap["ModelRatio"] = ratio_setting.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = ratio_setting.ModelPrice2JSONString()
 	common.OptionMap["CacheRatio"] = ratio_setting.CacheRatio2JSONString()
+	common.OptionMap["CreateCacheRatio"] = ratio_setting.CreateCacheRatio2JSONString()
+	common.OptionMap["ModelContextTiers"] = ratio_setting.ModelContextTiers2JSONString()
+	common.OptionMap[PriceBookVersionOptionKey] = strconv.Itoa(ratio_setting.GetActivePriceBookVersion())
 	common.OptionMap["GroupRatio"] = ratio_setting.GroupRatio2JSONString()
 	common.OptionMap["GroupCaptureRate"] = ratio_setting.GroupCaptureRate2JSONString()
 	common.OptionMap["GroupGroupRatio"] = ratio_setting.GroupGroupRatio2JSONString()
+	common.OptionMap["GroupPricingSchedules"] = ratio_setting.GroupPricingSchedules2JSONString()
 	common.OptionMap["UserUsableGroups"] = setting.UserUsableGroups2JSONString()
 	common.OptionMap["CompletionRatio"] = ratio_setting.CompletionRatio2JSONString()
 	common.OptionMap["ImageRatio"] = ratio_setting.ImageRatio2JSONString()
@@ -250,10 +254,26 @@ func UpdateOption(key string, value string) error {
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
+	PublishCacheInvalidation(CacheTopicOption, key)
 	// Update OptionMap
 	return updateOptionMap(key, value)
 }
 
+// reloadOptionFromDatabase 其他节点修改配置后重新读取单个配置项
+func reloadOptionFromDatabase(key string) {
+	value, found, err := getOptionValueTx(DB, key)
+	if err != nil {
+		common.SysLog("failed to reload option " + key + ": " + err.Error())
+		return
+	}
+	if !found {
+		return
+	}
+	if err := updateOptionMap(key, value); err != nil {
+		common.SysLog("failed to update option map: " + err.Error())
+	}
+}
+
 func updateOptionMap(key string, value string) (err error) {
 	key = normalizeOptionKey(key)
 	value = normalizeOptionValue(key, value)
@@ -494,6 +514,15 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateModelPriceByJSONString(value)
 	case "CacheRatio":
 		err = ratio_setting.UpdateCacheRatioByJSONString(value)
+	case "CreateCacheRatio":
+		err = ratio_setting.UpdateCreateCacheRatioByJSONString(value)
+	case "ModelContextTiers":
+		err = ratio_setting.UpdateModelContextTiersByJSONString(value)
+	case "GroupPricingSchedules":
+		err = ratio_setting.UpdateGroupPricingSchedulesByJSONString(value)
+	case PriceBookVersionOptionKey:
+		version, _ := strconv.Atoi(value)
+		ratio_setting.SetActivePriceBookVersion(version)
 	case "ImageRatio":
 		err = ratio_setting.UpdateImageRatioByJSONString(value)
 	case "AudioRatio":
@@ -543,6 +572,9 @@ func handleConfigUpdate(key, value string) bool {
 		configKey: value,
 	}
 	config.UpdateConfigFromMap(cfg, configMap)
+	if configName == "capture_setting" {
+		operation_setting.CaptureSettingUpdated()
+	}
 
 	return true // 已处理
 }
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PriceBookStatusScheduled  = "scheduled"
+	PriceBookStatusActive     = "active"
+	PriceBookStatusSuperseded = "superseded"
+	PriceBookStatusCancelled  = "cancelled"
+
+	// PriceBookVersionOptionKey 记录当前生效价格簿版本的全局选项，随选项同步到所有节点
+	PriceBookVersionOptionKey = "PriceBookVersion"
+)
+
+// PriceBookVersion 价格簿版本：保存一份完整的价格配置快照，在 EffectiveFrom 到达后整体生效
+type PriceBookVersion struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name" gorm:"size:128"`
+	Description   string `json:"description" gorm:"type:text"`
+	Status        string `json:"status" gorm:"size:16;index"`
+	EffectiveFrom int64  `json:"effective_from" gorm:"bigint;index"`
+	Snapshot      string `json:"-" gorm:"type:text"`
+	NotifyUsers   bool   `json:"notify_users"`
+	NotifiedAt    int64  `json:"notified_at" gorm:"bigint"`
+	ActivatedAt   int64  `json:"activated_at" gorm:"bigint"`
+	CreatedBy     int    `json:"created_by"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (version *PriceBookVersion) GetSnapshot() (ratio_setting.PriceBookSnapshot, error) {
+	var snapshot ratio_setting.PriceBookSnapshot
+	if version.Snapshot == "" {
+		return snapshot, nil
+	}
+	err := common.Unmarshal([]byte(version.Snapshot), &snapshot)
+	return snapshot, err
+}
+
+func (version *PriceBookVersion) SetSnapshot(snapshot ratio_setting.PriceBookSnapshot) error {
+	jsonBytes, err := common.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	version.Snapshot = string(jsonBytes)
+	return nil
+}
+
+func CreatePriceBookVersion(version *PriceBookVersion) error {
+	now := common.GetTimestamp()
+	version.CreatedAt = now
+	version.UpdatedAt = now
+	if version.Status == "" {
+		version.Status = PriceBookStatusScheduled
+	}
+	return DB.Create(version).Error
+}
+
+func SavePriceBookVersion(version *PriceBookVersion) error {
+	version.UpdatedAt = common.GetTimestamp()
+	return DB.Save(version).Error
+}
+
+func GetPriceBookVersionById(id int) (*PriceBookVersion, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var version PriceBookVersion
+	err := DB.First(&version, "id = ?", id).Error
+	return &version, err
+}
+
+func GetPriceBookVersions(startIdx int, num int) (versions []*PriceBookVersion, total int64, err error) {
+	if err = DB.Model(&PriceBookVersion{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Omit("snapshot").Order("effective_from desc, id desc").Limit(num).Offset(startIdx).Find(&versions).Error
+	return versions, total, err
+}
+
+// GetDuePriceBookVersion 返回 now 时刻应当生效的版本（已到生效时间的最新一个已排期或已生效版本）
+func GetDuePriceBookVersion(now int64) (*PriceBookVersion, error) {
+	var version PriceBookVersion
+	err := DB.Where("status IN ? AND effective_from <= ?", []string{PriceBookStatusScheduled, PriceBookStatusActive}, now).
+		Order("effective_from desc, id desc").First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetPriceBookVersionsToNotify 返回将在 until 之前生效、需要通知且尚未通知的版本
+func GetPriceBookVersionsToNotify(now int64, until int64) (versions []*PriceBookVersion, err error) {
+	err = DB.Where("status = ? AND notify_users = ? AND notified_at = 0 AND effective_from > ? AND effective_from <= ?",
+		PriceBookStatusScheduled, true, now, until).Order("effective_from asc").Find(&versions).Error
+	return versions, err
+}
+
+func MarkPriceBookVersionNotified(id int, notifiedAt int64) error {
+	return DB.Model(&PriceBookVersion{}).Where("id = ?", id).Update("notified_at", notifiedAt).Error
+}
+
+// ActivatePriceBookVersion 将版本标记为生效并持久化其价格配置，其余已生效或更早排期的版本标记为已替代
+func ActivatePriceBookVersion(version *PriceBookVersion) error {
+	snapshot, err := version.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	values, err := snapshot.OptionValues()
+	if err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PriceBookVersion{}).
+			Where("id <> ? AND (status = ? OR (status = ? AND effective_from <= ?))", version.Id,
+				PriceBookStatusActive, PriceBookStatusScheduled, max(version.EffectiveFrom, now)).
+			Updates(map[string]interface{}{"status": PriceBookStatusSuperseded, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		version.Status = PriceBookStatusActive
+		version.ActivatedAt = now
+		version.UpdatedAt = now
+		return tx.Model(&PriceBookVersion{}).Where("id = ?", version.Id).
+			Updates(map[string]interface{}{"status": version.Status, "activated_at": now, "updated_at": now}).Error
+	})
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if err = UpdateOption(key, value); err != nil {
+			return err
+		}
+	}
+	return UpdateOption(PriceBookVersionOptionKey, strconv.Itoa(version.Id))
+}
+
+// ApplyPriceBookVersionLocally 仅在本节点内存中应用版本，用于从节点在生效时间准时切换，持久化由主节点完成
+func ApplyPriceBookVersionLocally(version *PriceBookVersion) error {
+	snapshot, err := version.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	values, err := snapshot.OptionValues()
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if err = updateOptionMap(key, value); err != nil {
+			return err
+		}
+	}
+	return updateOptionMap(PriceBookVersionOptionKey, strconv.Itoa(version.Id))
+}
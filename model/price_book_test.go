@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestActivatePriceBookVersionAppliesSnapshotAndSupersedes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:price-book-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Option{}, &PriceBookVersion{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldOptionMap := DB, common.OptionMap
+	oldModelRatio := ratio_setting.ModelRatio2JSONString()
+	oldVersion := ratio_setting.GetActivePriceBookVersion()
+	DB = db
+	common.OptionMap = make(map[string]string)
+	t.Cleanup(func() {
+		DB = oldDB
+		common.OptionMap = oldOptionMap
+		_ = ratio_setting.UpdateModelRatioByJSONString(oldModelRatio)
+		ratio_setting.SetActivePriceBookVersion(oldVersion)
+	})
+
+	base := ratio_setting.CurrentPriceBookSnapshot()
+	newVersion := func(effectiveFrom int64, ratio float64) *PriceBookVersion {
+		snapshot := ratio_setting.PriceBookSnapshot{ModelRatio: map[string]float64{"price-book-model": ratio}}
+		snapshot.FillMissing(base)
+		version := &PriceBookVersion{EffectiveFrom: effectiveFrom}
+		if err := version.SetSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreatePriceBookVersion(version); err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+	past := newVersion(100, 2)
+	current := newVersion(200, 3)
+	future := newVersion(common.GetTimestamp()+3600, 4)
+
+	due, err := GetDuePriceBookVersion(common.GetTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due == nil || due.Id != current.Id {
+		t.Fatalf("expected latest due version %d, got %+v", current.Id, due)
+	}
+	if err = ActivatePriceBookVersion(due); err != nil {
+		t.Fatal(err)
+	}
+
+	if ratio, _, _ := ratio_setting.GetModelRatio("price-book-model"); ratio != 3 {
+		t.Fatalf("expected activated model ratio 3, got %v", ratio)
+	}
+	if ratio_setting.GetActivePriceBookVersion() != current.Id {
+		t.Fatalf("expected active version %d, got %d", current.Id, ratio_setting.GetActivePriceBookVersion())
+	}
+	for id, status := range map[int]string{past.Id: PriceBookStatusSuperseded, current.Id: PriceBookStatusActive, future.Id: PriceBookStatusScheduled} {
+		version, err := GetPriceBookVersionById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version.Status != status {
+			t.Fatalf("expected version %d status %s, got %s", id, status, version.Status)
+		}
+	}
+}
@@ -15,18 +15,19 @@ import (
 )
 
 type Pricing struct {
-	ModelName              string                  `json:"model_name"`
-	Description            string                  `json:"description,omitempty"`
-	Icon                   string                  `json:"icon,omitempty"`
-	Tags                   string                  `json:"tags,omitempty"`
-	VendorID               int                     `json:"vendor_id,omitempty"`
-	QuotaType              int                     `json:"quota_type"`
-	ModelRatio             float64                 `json:"model_ratio"`
-	ModelPrice             float64                 `json:"model_price"`
-	OwnerBy                string                  `json:"owner_by"`
-	CompletionRatio        float64                 `json:"completion_ratio"`
-	EnableGroup            []string                `json:"enable_groups"`
-	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
+	ModelName              string                      `json:"model_name"`
+	Description            string                      `json:"description,omitempty"`
+	Icon                   string                      `json:"icon,omitempty"`
+	Tags                   string                      `json:"tags,omitempty"`
+	VendorID               int                         `json:"vendor_id,omitempty"`
+	QuotaType              int                         `json:"quota_type"`
+	ModelRatio             float64                     `json:"model_ratio"`
+	ModelPrice             float64                     `json:"model_price"`
+	OwnerBy                string                      `json:"owner_by"`
+	CompletionRatio        float64                     `json:"completion_ratio"`
+	ContextTiers           []ratio_setting.ContextTier `json:"context_tiers,omitempty"`
+	EnableGroup            []string                    `json:"enable_groups"`
+	SupportedEndpointTypes []constant.EndpointType     `json:"supported_endpoint_types"`
 }
 
 type PricingVendor struct {
@@ -148,6 +149,8 @@ func updatePricing() {
 		}
 	}
 
+	refreshModelCapabilities(allMeta)
+
 	// 预加载供应商
 	var vendors []Vendor
 	_ = DB.Find(&vendors).Error
@@ -289,6 +292,7 @@ func updatePricing() {
 			modelRatio, _, _ := ratio_setting.GetModelRatio(model)
 			pricing.ModelRatio = modelRatio
 			pricing.CompletionRatio = ratio_setting.GetCompletionRatio(model)
+			pricing.ContextTiers = ratio_setting.GetModelContextTiers(model)
 			pricing.QuotaType = 0
 		}
 		pricingMap = append(pricingMap, pricing)
@@ -0,0 +1,381 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaLedgerTypeOpening     = "opening" // 启用账本时用户已有的余额与已用额度
+	QuotaLedgerTypeSignup      = "signup"
+	QuotaLedgerTypeInvite      = "invite"
+	QuotaLedgerTypeConsume     = "consume"
+	QuotaLedgerTypeUsage       = "usage" // 已用额度累计
+	QuotaLedgerTypeRefund      = "refund"
+	QuotaLedgerTypeTopUp       = "topup"
+	QuotaLedgerTypeRedemption  = "redemption"
+	QuotaLedgerTypeAdminAdjust = "admin_adjust"
+	QuotaLedgerTypeAffTransfer = "aff_transfer"
+	QuotaLedgerTypeSelfDeduct  = "self_deduct" // 用户主动扣除额度
+	QuotaLedgerTypeCompacted   = "compacted"   // 超过保留天数的流水按用户合并后的汇总
+
+	QuotaLedgerTypeToken        = "token"         // 令牌剩余额度与已用额度增量，仅批量更新时写入
+	QuotaLedgerTypeChannelUsage = "channel_usage" // 渠道已用额度增量，仅批量更新时写入
+)
+
+const (
+	quotaLedgerOpeningMigrationKey = "QuotaLedgerOpeningBalancesCreated"
+	quotaLedgerApplyBatchSize      = 1000
+
+	QuotaLedgerReconcileInterval = time.Hour
+	QuotaLedgerCompactInterval   = 24 * time.Hour
+)
+
+// QuotaLedger 额度流水，只追加不修改；users.quota / users.used_quota 应始终等于该用户已生效流水之和
+// 直接写库时与余额更新处于同一事务（Applied 为 true）；开启批量更新时额度变化发生时即写入未生效流水，
+// 再由批量更新器合并后应用到余额。
+// 批量更新时令牌与渠道的额度增量也以流水形式写入，此时 UserId 为 0，由 TokenId 或 ChannelId 指明对象
+type QuotaLedger struct {
+	Id             int64  `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index:idx_quota_ledger_user"`
+	TokenId        int    `json:"token_id,omitempty" gorm:"default:0"`
+	ChannelId      int    `json:"channel_id,omitempty" gorm:"default:0"`
+	Type           string `json:"type" gorm:"type:varchar(32);index"`
+	QuotaDelta     int64  `json:"quota_delta" gorm:"bigint;default:0"`
+	UsedQuotaDelta int64  `json:"used_quota_delta" gorm:"bigint;default:0"`
+	Applied        bool   `json:"applied" gorm:"index"`
+	Remark         string `json:"remark" gorm:"type:varchar(255);default:''"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// RecordQuotaLedgerTx 在调用方的事务中记录一条已生效的额度流水，需与对应的余额更新处于同一事务
+func RecordQuotaLedgerTx(tx *gorm.DB, userId int, ledgerType string, quotaDelta int64, usedQuotaDelta int64, remark string) error {
+	if quotaDelta == 0 && usedQuotaDelta == 0 {
+		return nil
+	}
+	return tx.Create(&QuotaLedger{
+		UserId:         userId,
+		Type:           ledgerType,
+		QuotaDelta:     quotaDelta,
+		UsedQuotaDelta: usedQuotaDelta,
+		Applied:        true,
+		Remark:         remark,
+		CreatedAt:      common.GetTimestamp(),
+	}).Error
+}
+
+// appendPendingQuotaLedgers 在额度变化时立即写入尚未应用到余额的流水，多条流水使用一次多行插入；
+// 批量更新只负责合并与应用，进程崩溃不会丢失已发生的额度变化
+func appendPendingQuotaLedgers(entries ...*QuotaLedger) error {
+	pending := make([]*QuotaLedger, 0, len(entries))
+	now := common.GetTimestamp()
+	for _, entry := range entries {
+		if entry.QuotaDelta == 0 && entry.UsedQuotaDelta == 0 {
+			continue
+		}
+		entry.Applied = false
+		entry.CreatedAt = now
+		pending = append(pending, entry)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return DB.Create(pending).Error
+}
+
+// applyUserQuotaDeltaTx 在事务内更新用户余额/已用额度并写入对应流水
+func applyUserQuotaDeltaTx(tx *gorm.DB, userId int, ledgerType string, quotaDelta int64, usedQuotaDelta int64, remark string) error {
+	updates := map[string]interface{}{}
+	if quotaDelta != 0 {
+		updates["quota"] = gorm.Expr("quota + ?", quotaDelta)
+	}
+	if usedQuotaDelta != 0 {
+		updates["used_quota"] = gorm.Expr("used_quota + ?", usedQuotaDelta)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).Updates(updates).Error; err != nil {
+		return err
+	}
+	return RecordQuotaLedgerTx(tx, userId, ledgerType, quotaDelta, usedQuotaDelta, remark)
+}
+
+// quotaLedgerTarget 流水作用的对象，用户、令牌、渠道三者只有一个非零
+type quotaLedgerTarget struct {
+	userId    int
+	tokenId   int
+	channelId int
+}
+
+// applyQuotaLedgerDeltaTx 将合并后的增量应用到流水对象
+func applyQuotaLedgerDeltaTx(tx *gorm.DB, target quotaLedgerTarget, quotaDelta int64, usedQuotaDelta int64) error {
+	switch {
+	case target.tokenId != 0:
+		return tx.Model(&Token{}).Where("id = ?", target.tokenId).Updates(map[string]interface{}{
+			"remain_quota":  gorm.Expr("remain_quota + ?", quotaDelta),
+			"used_quota":    gorm.Expr("used_quota + ?", usedQuotaDelta),
+			"accessed_time": common.GetTimestamp(),
+		}).Error
+	case target.channelId != 0:
+		if usedQuotaDelta == 0 {
+			return nil
+		}
+		return tx.Model(&Channel{}).Where("id = ?", target.channelId).Update("used_quota", gorm.Expr("used_quota + ?", usedQuotaDelta)).Error
+	}
+	updates := map[string]interface{}{}
+	if quotaDelta != 0 {
+		updates["quota"] = gorm.Expr("quota + ?", quotaDelta)
+	}
+	if usedQuotaDelta != 0 {
+		updates["used_quota"] = gorm.Expr("used_quota + ?", usedQuotaDelta)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&User{}).Where("id = ?", target.userId).Updates(updates).Error
+}
+
+// applyPendingQuotaLedgers 将未生效流水按对象合并后应用到余额；流水状态的更新与余额更新在同一事务中，
+// 多个节点同时应用时只有成功把流水标记为已生效的一方会更新余额
+func applyPendingQuotaLedgers() {
+	for {
+		var entries []QuotaLedger
+		err := DB.Select("id", "user_id", "token_id", "channel_id", "quota_delta", "used_quota_delta").
+			Where("applied = ?", false).
+			Order("id asc").
+			Limit(quotaLedgerApplyBatchSize).
+			Find(&entries).Error
+		if err != nil {
+			common.SysLog("failed to load pending quota ledgers: " + err.Error())
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		type targetDelta struct {
+			ids            []int64
+			quotaDelta     int64
+			usedQuotaDelta int64
+		}
+		deltas := make(map[quotaLedgerTarget]*targetDelta)
+		for _, entry := range entries {
+			target := quotaLedgerTarget{userId: entry.UserId, tokenId: entry.TokenId, channelId: entry.ChannelId}
+			delta, ok := deltas[target]
+			if !ok {
+				delta = &targetDelta{}
+				deltas[target] = delta
+			}
+			delta.ids = append(delta.ids, entry.Id)
+			delta.quotaDelta += entry.QuotaDelta
+			delta.usedQuotaDelta += entry.UsedQuotaDelta
+		}
+
+		for target, delta := range deltas {
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				result := tx.Model(&QuotaLedger{}).Where("id IN ? AND applied = ?", delta.ids, false).Update("applied", true)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected != int64(len(delta.ids)) {
+					return fmt.Errorf("pending quota ledgers of %+v were applied concurrently", target)
+				}
+				return applyQuotaLedgerDeltaTx(tx, target, delta.quotaDelta, delta.usedQuotaDelta)
+			})
+			if err != nil {
+				common.SysLog("failed to apply pending quota ledgers: " + err.Error())
+			}
+		}
+
+		if len(entries) < quotaLedgerApplyBatchSize {
+			return
+		}
+	}
+}
+
+// migrateQuotaLedgerOpeningBalances 首次启用账本时为每个用户写入一条期初流水，使已有余额与账本一致
+func migrateQuotaLedgerOpeningBalances(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrated, err := optionIsTrueTx(tx, quotaLedgerOpeningMigrationKey)
+		if err != nil || migrated {
+			return err
+		}
+		result := tx.Exec("INSERT INTO quota_ledgers (user_id, type, quota_delta, used_quota_delta, applied, remark, created_at) "+
+			"SELECT id, ?, quota, used_quota, ?, ?, ? FROM users WHERE quota <> 0 OR used_quota <> 0",
+			QuotaLedgerTypeOpening, true, "", common.GetTimestamp())
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := upsertOptionTx(tx, quotaLedgerOpeningMigrationKey, "true"); err != nil {
+			return err
+		}
+		common.SysLog(fmt.Sprintf("created opening quota ledger entries for %d users", result.RowsAffected))
+		return nil
+	})
+}
+
+// QuotaReconciliationItem 余额与账本不一致的用户
+type QuotaReconciliationItem struct {
+	UserId          int    `json:"user_id"`
+	Username        string `json:"username"`
+	Quota           int64  `json:"quota"`
+	LedgerQuota     int64  `json:"ledger_quota"`
+	QuotaDiff       int64  `json:"quota_diff"`
+	UsedQuota       int64  `json:"used_quota"`
+	LedgerUsedQuota int64  `json:"ledger_used_quota"`
+	UsedQuotaDiff   int64  `json:"used_quota_diff"`
+}
+
+func quotaReconciliationQuery() *gorm.DB {
+	ledgerSums := DB.Model(&QuotaLedger{}).
+		Select("user_id, SUM(quota_delta) AS ledger_quota, SUM(used_quota_delta) AS ledger_used_quota").
+		Where("applied = ? AND user_id <> 0", true).
+		Group("user_id")
+	return DB.Table("users").
+		Joins("LEFT JOIN (?) AS l ON l.user_id = users.id", ledgerSums).
+		Where("users.deleted_at IS NULL").
+		Where("users.quota <> COALESCE(l.ledger_quota, 0) OR users.used_quota <> COALESCE(l.ledger_used_quota, 0)")
+}
+
+// GetQuotaReconciliationReport 返回 Quota/UsedQuota 与已生效流水之和不一致的用户
+func GetQuotaReconciliationReport(startIdx int, num int) ([]*QuotaReconciliationItem, int64, error) {
+	var total int64
+	if err := quotaReconciliationQuery().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var items []*QuotaReconciliationItem
+	err := quotaReconciliationQuery().
+		Select("users.id AS user_id, users.username, users.quota, users.used_quota, " +
+			"COALESCE(l.ledger_quota, 0) AS ledger_quota, COALESCE(l.ledger_used_quota, 0) AS ledger_used_quota").
+		Order("users.id asc").
+		Offset(startIdx).
+		Limit(num).
+		Scan(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, item := range items {
+		item.QuotaDiff = item.Quota - item.LedgerQuota
+		item.UsedQuotaDiff = item.UsedQuota - item.LedgerUsedQuota
+	}
+	return items, total, nil
+}
+
+// GetUserQuotaLedgers 按时间倒序返回用户的额度流水
+func GetUserQuotaLedgers(userId int, ledgerType string, startIdx int, num int) ([]*QuotaLedger, int64, error) {
+	query := DB.Model(&QuotaLedger{}).Where("user_id = ?", userId)
+	if ledgerType != "" {
+		query = query.Where("type = ?", ledgerType)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var ledgers []*QuotaLedger
+	err := query.Order("id desc").Offset(startIdx).Limit(num).Find(&ledgers).Error
+	return ledgers, total, err
+}
+
+// ReconcileQuotaLedgers 对账，发现余额与账本不一致的用户时写入系统日志，由后台任务调度器定期调用
+func ReconcileQuotaLedgers() error {
+	// 先应用未生效流水，避免把批量更新的延迟误判为不一致
+	applyPendingQuotaLedgers()
+	var total int64
+	if err := quotaReconciliationQuery().Count(&total).Error; err != nil {
+		return err
+	}
+	if total > 0 {
+		common.SysLog(fmt.Sprintf("quota reconciliation found %d users whose balance disagrees with the ledger", total))
+	}
+	return nil
+}
+
+// CompactQuotaLedgers 将超过保留天数的已生效流水按用户合并为一条汇总流水，令牌与渠道流水直接删除，
+// 合并前后各用户的流水之和不变，由后台任务调度器定期调用
+func CompactQuotaLedgers() error {
+	retentionDays := operation_setting.GetQuotaSetting().LedgerRetentionDays
+	if retentionDays <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).Unix()
+
+	for {
+		result := DB.Where("applied = ? AND user_id = 0 AND created_at < ?", true, cutoff).
+			Limit(quotaLedgerApplyBatchSize).
+			Delete(&QuotaLedger{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < quotaLedgerApplyBatchSize {
+			break
+		}
+	}
+
+	type compactGroup struct {
+		UserId         int
+		Count          int64
+		MaxId          int64
+		MaxCreatedAt   int64
+		QuotaDelta     int64
+		UsedQuotaDelta int64
+	}
+	lastUserId := 0
+	compacted := 0
+	for {
+		var groups []compactGroup
+		err := DB.Model(&QuotaLedger{}).
+			Select("user_id, COUNT(*) AS count, MAX(id) AS max_id, MAX(created_at) AS max_created_at, "+
+				"SUM(quota_delta) AS quota_delta, SUM(used_quota_delta) AS used_quota_delta").
+			Where("applied = ? AND user_id > ? AND created_at < ?", true, lastUserId, cutoff).
+			Group("user_id").
+			Having("COUNT(*) > 1").
+			Order("user_id asc").
+			Limit(quotaLedgerApplyBatchSize).
+			Scan(&groups).Error
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				result := tx.Where("applied = ? AND user_id = ? AND created_at < ? AND id <= ?", true, group.UserId, cutoff, group.MaxId).
+					Delete(&QuotaLedger{})
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected != group.Count {
+					return fmt.Errorf("quota ledgers of user %d changed during compaction", group.UserId)
+				}
+				return tx.Create(&QuotaLedger{
+					UserId:         group.UserId,
+					Type:           QuotaLedgerTypeCompacted,
+					QuotaDelta:     group.QuotaDelta,
+					UsedQuotaDelta: group.UsedQuotaDelta,
+					Applied:        true,
+					Remark:         fmt.Sprintf("合并 %d 条流水", group.Count),
+					CreatedAt:      group.MaxCreatedAt,
+				}).Error
+			})
+			if err != nil {
+				return err
+			}
+			compacted++
+		}
+		if len(groups) < quotaLedgerApplyBatchSize {
+			break
+		}
+		lastUserId = groups[len(groups)-1].UserId
+	}
+	if compacted > 0 {
+		common.SysLog(fmt.Sprintf("compacted quota ledgers of %d users", compacted))
+	}
+	return nil
+}
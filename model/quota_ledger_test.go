@@ -0,0 +1,135 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQuotaLedgerReconciliation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:quota-ledger-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&User{}, &Option{}, &QuotaLedger{}, &Token{}, &Channel{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldRedisEnabled, oldBatchUpdateEnabled := DB, common.RedisEnabled, common.BatchUpdateEnabled
+	DB = db
+	common.RedisEnabled = false
+	common.BatchUpdateEnabled = false
+	t.Cleanup(func() {
+		DB = oldDB
+		common.RedisEnabled = oldRedisEnabled
+		common.BatchUpdateEnabled = oldBatchUpdateEnabled
+	})
+
+	users := []*User{
+		{Id: 1, Username: "ledger-a", AffCode: "la01", Quota: 1000, UsedQuota: 200},
+		{Id: 2, Username: "ledger-b", AffCode: "lb01", Quota: 500},
+	}
+	if err = db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = migrateQuotaLedgerOpeningBalances(db); err != nil {
+		t.Fatal(err)
+	}
+	// 期初流水只写入一次
+	if err = migrateQuotaLedgerOpeningBalances(db); err != nil {
+		t.Fatal(err)
+	}
+
+	assertReport := func(expected int) []*QuotaReconciliationItem {
+		t.Helper()
+		items, total, err := GetQuotaReconciliationReport(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(total) != expected || len(items) != expected {
+			t.Fatalf("expected %d mismatched users, got %d: %+v", expected, total, items)
+		}
+		return items
+	}
+	assertReport(0)
+
+	// 直接写库：余额与流水在同一事务中更新
+	if err = DecreaseUserQuota(1, 300, QuotaLedgerTypeConsume); err != nil {
+		t.Fatal(err)
+	}
+	UpdateUserUsedQuotaAndRequestCount(1, 300)
+	if err = IncreaseUserQuota(1, 100, false, QuotaLedgerTypeRefund); err != nil {
+		t.Fatal(err)
+	}
+	assertReport(0)
+
+	// 批量更新：额度变化时即写入未生效流水，批量更新时合并应用，余额变化后仍与账本一致
+	if err = db.Create(&Token{Id: 1, UserId: 2, Key: "ledger-token", RemainQuota: 100}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&Channel{Id: 1, Name: "ledger-channel"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	common.BatchUpdateEnabled = true
+	if err = DecreaseUserQuota(2, 50, QuotaLedgerTypeConsume); err != nil {
+		t.Fatal(err)
+	}
+	if err = DecreaseTokenQuota(1, "ledger-token", 50); err != nil {
+		t.Fatal(err)
+	}
+	UpdateChannelUsedQuota(1, 50)
+	var pending int64
+	db.Model(&QuotaLedger{}).Where("applied = ?", false).Count(&pending)
+	if quota, _ := GetUserQuota(2, true); quota != 500 || pending != 3 {
+		t.Fatalf("expected pending ledgers written before flush, got quota %d and %d pending rows", quota, pending)
+	}
+	FlushBatchUpdates()
+	if quota, _ := GetUserQuota(2, true); quota != 450 {
+		t.Fatalf("expected quota 450 after applying pending ledger, got %d", quota)
+	}
+	var token Token
+	var channel Channel
+	db.First(&token, 1)
+	db.First(&channel, 1)
+	if token.RemainQuota != 50 || token.UsedQuota != 50 || channel.UsedQuota != 50 {
+		t.Fatalf("unexpected token %+v or channel used quota %d", token, channel.UsedQuota)
+	}
+	assertReport(0)
+
+	// 绕过账本修改余额会被对账报告发现
+	if err = db.Model(&User{}).Where("id = ?", 1).Update("quota", gorm.Expr("quota + ?", 7)).Error; err != nil {
+		t.Fatal(err)
+	}
+	items := assertReport(1)
+	if items[0].UserId != 1 || items[0].Quota != 807 || items[0].LedgerQuota != 800 || items[0].QuotaDiff != 7 || items[0].UsedQuotaDiff != 0 {
+		t.Fatalf("unexpected reconciliation item: %+v", items[0])
+	}
+
+	ledgers, total, err := GetUserQuotaLedgers(1, QuotaLedgerTypeConsume, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || ledgers[0].QuotaDelta != -300 {
+		t.Fatalf("unexpected consume ledgers: %+v", ledgers)
+	}
+
+	// 超过保留天数的流水按用户合并，对账结果不变
+	if err = db.Model(&User{}).Where("id = ?", 1).Update("quota", gorm.Expr("quota - ?", 7)).Error; err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().AddDate(0, 0, -100).Unix()
+	if err = db.Model(&QuotaLedger{}).Where("1 = 1").Update("created_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = CompactQuotaLedgers(); err != nil {
+		t.Fatal(err)
+	}
+	assertReport(0)
+	var remaining []QuotaLedger
+	db.Order("user_id asc").Find(&remaining)
+	if len(remaining) != 2 || remaining[0].Type != QuotaLedgerTypeCompacted || remaining[0].QuotaDelta != 800 || remaining[0].UsedQuotaDelta != 500 {
+		t.Fatalf("unexpected ledgers after compaction: %+v", remaining)
+	}
+}
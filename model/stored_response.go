@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StoredResponseStatusCompleted = "completed"
+	StoredResponseStatusCancelled = "cancelled"
+
+	StoredResponseCleanupInterval = time.Hour
+	storedResponseCleanupBatch    = 1000
+)
+
+// StoredResponse 记录 Responses API 生成的 response 由哪个渠道提供，
+// 开启本地保存时同时记录本轮的输入与输出，用于跨渠道还原 previous_response_id 的上下文
+type StoredResponse struct {
+	Id                 int    `json:"id"`
+	ResponseId         string `json:"response_id" gorm:"size:128;uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id"`
+	ChannelId          int    `json:"channel_id" gorm:"index"`
+	Model              string `json:"model" gorm:"size:128"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"size:128"`
+	Status             string `json:"status" gorm:"size:32"`
+	Input              string `json:"-" gorm:"type:text"`
+	Output             string `json:"-" gorm:"type:text"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// HasLocalContent 是否保存了本轮的输入输出
+func (response *StoredResponse) HasLocalContent() bool {
+	return response.Input != "" || response.Output != ""
+}
+
+// SaveStoredResponse 保存 response 记录，同一 response id 重复写入时以最新内容为准
+func SaveStoredResponse(response *StoredResponse) error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "response_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channel_id", "model", "status", "input", "output"}),
+	}).Create(response).Error
+}
+
+// GetStoredResponse 查询用户的 response 记录，不存在时返回 nil
+func GetStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, nil
+	}
+	var response StoredResponse
+	err := DB.Where("response_id = ? AND user_id = ?", responseId, userId).First(&response).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetStoredResponseChain 从指定 response 开始沿 previous_response_id 向前追溯，按时间正序返回，最多 limit 条
+func GetStoredResponseChain(userId int, responseId string, limit int) ([]*StoredResponse, error) {
+	chain := make([]*StoredResponse, 0)
+	for responseId != "" && len(chain) < limit {
+		response, err := GetStoredResponse(userId, responseId)
+		if err != nil {
+			return nil, err
+		}
+		if response == nil {
+			break
+		}
+		chain = append([]*StoredResponse{response}, chain...)
+		responseId = response.PreviousResponseId
+	}
+	return chain, nil
+}
+
+func UpdateStoredResponseStatus(userId int, responseId string, status string) error {
+	return DB.Model(&StoredResponse{}).
+		Where("response_id = ? AND user_id = ?", responseId, userId).
+		Update("status", status).Error
+}
+
+func DeleteStoredResponse(userId int, responseId string) error {
+	return DB.Where("response_id = ? AND user_id = ?", responseId, userId).Delete(&StoredResponse{}).Error
+}
+
+func DeleteStoredResponsesBefore(targetTimestamp int64) (int64, error) {
+	var total int64
+	for {
+		result := DB.Where("created_at < ?", targetTimestamp).Limit(storedResponseCleanupBatch).Delete(&StoredResponse{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < storedResponseCleanupBatch {
+			return total, nil
+		}
+	}
+}
+
+// CleanupStoredResponses 按保留天数清理过期的 response 记录，由后台任务调度器定期调用
+func CleanupStoredResponses() error {
+	retentionDays := model_setting.GetResponsesSettings().RetentionDays
+	if retentionDays <= 0 {
+		return nil
+	}
+	target := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	_, err := DeleteStoredResponsesBefore(target)
+	return err
+}
@@ -1,29 +1,12 @@
 package model
 
 import (
-	"sync"
 	"time"
-
-	"github.com/QuantumNous/new-api/common"
 )
 
-const subscriptionQuotaResetInterval = 5 * time.Minute
-
-var subscriptionQuotaResetOnce sync.Once
+const SubscriptionQuotaResetInterval = 5 * time.Minute
 
-func StartSubscriptionQuotaResetLoop() {
-	subscriptionQuotaResetOnce.Do(func() {
-		ticker := time.NewTicker(subscriptionQuotaResetInterval)
-		go func() {
-			if err := ResetSubscriptionQuotaForAllUsers(time.Now().Unix()); err != nil {
-				common.SysLog("failed to reset subscription quota: " + err.Error())
-			}
-			for range ticker.C {
-				err := ResetSubscriptionQuotaForAllUsers(time.Now().Unix())
-				if err != nil {
-					common.SysLog("failed to reset subscription quota: " + err.Error())
-				}
-			}
-		}()
-	})
+// RunSubscriptionQuotaReset 重置所有到期的订阅额度，由后台任务调度器定期调用
+func RunSubscriptionQuotaReset() error {
+	return ResetSubscriptionQuotaForAllUsers(time.Now().Unix())
 }
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TaskArtifactKindVideo = "video"
+	TaskArtifactKindImage = "image"
+	TaskArtifactKindAudio = "audio"
+)
+
+// TaskArtifact 归档保存的任务生成结果，Platform + TaskId 对应 tasks 表或 midjourneys 表中的任务
+type TaskArtifact struct {
+	Id          int64  `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Platform    string `json:"platform" gorm:"type:varchar(30);index:idx_task_artifact_task"`
+	TaskId      string `json:"task_id" gorm:"type:varchar(191);index:idx_task_artifact_task"`
+	Kind        string `json:"kind" gorm:"type:varchar(16)"`
+	SourceUrl   string `json:"source_url" gorm:"type:text"`
+	Backend     string `json:"backend" gorm:"type:varchar(16)"`
+	ObjectKey   string `json:"-" gorm:"type:varchar(512)"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	SizeBytes   int64  `json:"size_bytes" gorm:"bigint;default:0"`
+	Quota       int    `json:"quota" gorm:"default:0"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"`
+	// BilledUntil 已计费到的时间点，到达后按天续费；0 表示归档时已一次性扣除全部保留期费用，不再续费
+	BilledUntil int64  `json:"billed_until" gorm:"bigint;default:0;index"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	Url         string `json:"url" gorm:"-"` // 签名网关地址，查询时生成
+}
+
+// TaskArtifactCharge 归档文件按天计费记录；每个归档文件每天最多一条，与额度扣除处于同一事务，用于防止重复扣费
+type TaskArtifactCharge struct {
+	Id         int64 `json:"id"`
+	ArtifactId int64 `json:"artifact_id" gorm:"uniqueIndex:idx_task_artifact_charge_day"`
+	Day        int   `json:"day" gorm:"uniqueIndex:idx_task_artifact_charge_day"` // 自归档起的第几天，从 0 开始
+	UserId     int   `json:"user_id" gorm:"index"`
+	Quota      int   `json:"quota"`
+	CreatedAt  int64 `json:"created_at" gorm:"bigint;index"`
+}
+
+var ErrTaskArtifactQuotaInsufficient = errors.New("用户额度不足，无法支付归档存储费用")
+
+// TaskArtifactUsage 用户归档存储占用
+type TaskArtifactUsage struct {
+	UserId    int   `json:"user_id"`
+	Count     int64 `json:"count"`
+	SizeBytes int64 `json:"size_bytes"`
+	Quota     int64 `json:"quota"`
+}
+
+func CreateTaskArtifact(artifact *TaskArtifact) error {
+	artifact.CreatedAt = common.GetTimestamp()
+	return DB.Create(artifact).Error
+}
+
+func GetTaskArtifactById(id int64) (*TaskArtifact, error) {
+	artifact := &TaskArtifact{}
+	err := DB.Where("id = ?", id).First(artifact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("归档文件不存在")
+	}
+	return artifact, err
+}
+
+// GetTaskArtifacts 返回任务未过期的归档文件
+func GetTaskArtifacts(platform string, taskId string) ([]*TaskArtifact, error) {
+	var artifacts []*TaskArtifact
+	err := DB.Where("platform = ? AND task_id = ? AND expires_at > ?", platform, taskId, common.GetTimestamp()).
+		Order("id asc").
+		Find(&artifacts).Error
+	return artifacts, err
+}
+
+func GetUserTaskArtifacts(userId int, taskId string, startIdx int, num int) ([]*TaskArtifact, int64, error) {
+	query := DB.Model(&TaskArtifact{}).Where("user_id = ?", userId)
+	if taskId != "" {
+		query = query.Where("task_id = ?", taskId)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var artifacts []*TaskArtifact
+	err := query.Order("id desc").Offset(startIdx).Limit(num).Find(&artifacts).Error
+	return artifacts, total, err
+}
+
+func GetUserTaskArtifactUsage(userId int) (*TaskArtifactUsage, error) {
+	usage := &TaskArtifactUsage{UserId: userId}
+	err := DB.Model(&TaskArtifact{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS size_bytes, COALESCE(SUM(quota), 0) AS quota").
+		Where("user_id = ?", userId).
+		Scan(usage).Error
+	return usage, err
+}
+
+// GetTaskArtifactUsages 按存储占用从大到小返回各用户的归档用量
+func GetTaskArtifactUsages(startIdx int, num int) ([]*TaskArtifactUsage, int64, error) {
+	var total int64
+	if err := DB.Model(&TaskArtifact{}).Distinct("user_id").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var usages []*TaskArtifactUsage
+	err := DB.Model(&TaskArtifact{}).
+		Select("user_id, COUNT(*) AS count, COALESCE(SUM(size_bytes), 0) AS size_bytes, COALESCE(SUM(quota), 0) AS quota").
+		Group("user_id").
+		Order("size_bytes desc").
+		Offset(startIdx).
+		Limit(num).
+		Scan(&usages).Error
+	return usages, total, err
+}
+
+func GetExpiredTaskArtifacts(now int64, limit int) ([]*TaskArtifact, error) {
+	var artifacts []*TaskArtifact
+	err := DB.Where("expires_at <= ?", now).Order("id asc").Limit(limit).Find(&artifacts).Error
+	return artifacts, err
+}
+
+// GetTaskArtifactsToBill 返回未过期且已到续费时间的归档文件
+func GetTaskArtifactsToBill(now int64, limit int) ([]*TaskArtifact, error) {
+	var artifacts []*TaskArtifact
+	err := DB.Where("billed_until > 0 AND billed_until <= ? AND expires_at > ?", now, now).Order("id asc").Limit(limit).Find(&artifacts).Error
+	return artifacts, err
+}
+
+// ChargeTaskArtifactDay 写入计费记录、按消费扣除用户额度并推进归档文件的计费时间点；
+// 该天已有计费记录时不做任何修改，余额不足时返回 ErrTaskArtifactQuotaInsufficient，返回是否由本次调用完成扣费
+func ChargeTaskArtifactDay(artifact *TaskArtifact, day int, quota int, billedUntil int64) (bool, error) {
+	charge := &TaskArtifactCharge{
+		ArtifactId: artifact.Id,
+		Day:        day,
+		UserId:     artifact.UserId,
+		Quota:      quota,
+		CreatedAt:  common.GetTimestamp(),
+	}
+	charged := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(charge)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if quota > 0 {
+			var userQuota int
+			if err := tx.Model(&User{}).Where("id = ?", artifact.UserId).Select("quota").Scan(&userQuota).Error; err != nil {
+				return err
+			}
+			if userQuota < quota {
+				return ErrTaskArtifactQuotaInsufficient
+			}
+		}
+		err := tx.Model(&TaskArtifact{}).Where("id = ?", artifact.Id).Updates(map[string]interface{}{
+			"billed_until": billedUntil,
+			"quota":        gorm.Expr("quota + ?", quota),
+		}).Error
+		if err != nil {
+			return err
+		}
+		charged = true
+		if quota <= 0 {
+			return nil
+		}
+		remark := fmt.Sprintf("media artifact %d day %d", artifact.Id, day)
+		return applyUserQuotaDeltaTx(tx, artifact.UserId, QuotaLedgerTypeConsume, -int64(quota), int64(quota), remark)
+	})
+	if err != nil || !charged {
+		return false, err
+	}
+	artifact.BilledUntil = billedUntil
+	artifact.Quota += quota
+	if quota > 0 {
+		gopool.Go(func() {
+			if err := cacheDecrUserQuota(artifact.UserId, int64(quota)); err != nil {
+				common.SysLog("failed to decrease user quota: " + err.Error())
+			}
+		})
+	}
+	return true, nil
+}
+
+// RecordTaskArtifactChargeLog 记录归档存储费用的消费日志，other 中包含任务与归档文件 ID 便于对账
+func RecordTaskArtifactChargeLog(artifact *TaskArtifact, day int, quota int, group string, content string) {
+	if !common.LogConsumeEnabled {
+		return
+	}
+	username, _ := GetUsernameById(artifact.UserId, false)
+	log := &Log{
+		UserId:    artifact.UserId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeConsume,
+		Content:   content,
+		ModelName: "media_archive",
+		Quota:     quota,
+		Group:     group,
+		Other: common.MapToJsonStr(map[string]interface{}{
+			"task_id":     artifact.TaskId,
+			"platform":    artifact.Platform,
+			"artifact_id": artifact.Id,
+			"size_bytes":  artifact.SizeBytes,
+			"billing_day": day,
+		}),
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysLog("failed to record log: " + err.Error())
+	}
+}
+
+// ExpireTaskArtifact 立即过期归档文件，由清理任务删除
+func ExpireTaskArtifact(id int64) error {
+	return DB.Model(&TaskArtifact{}).Where("id = ?", id).Update("expires_at", common.GetTimestamp()).Error
+}
+
+func DeleteTaskArtifact(id int64) error {
+	return DB.Where("id = ?", id).Delete(&TaskArtifact{}).Error
+}
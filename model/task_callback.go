@@ -0,0 +1,111 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TaskCallbackStatusPending = "pending"
+	TaskCallbackStatusSuccess = "success"
+	TaskCallbackStatusFailed  = "failed"
+)
+
+// TaskCallbackDelivery 异步任务状态回调的投递记录，每次状态变化或手动重放生成一条
+// 签名密钥不在这里保存，投递时从任务的 PrivateData 中读取
+type TaskCallbackDelivery struct {
+	Id             int64  `json:"id"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	TaskId         string `json:"task_id" gorm:"type:varchar(191);index"`
+	Event          string `json:"event" gorm:"type:varchar(32)"`
+	Url            string `json:"url" gorm:"type:varchar(512)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	Attempts       int    `json:"attempts" gorm:"default:0"`
+	LastStatusCode int    `json:"last_status_code" gorm:"default:0"`
+	LastError      string `json:"last_error" gorm:"type:varchar(512);default:''"`
+	NextRetryAt    int64  `json:"next_retry_at" gorm:"bigint;index"`
+	ReplayOf       int64  `json:"replay_of" gorm:"default:0"` // 手动重放时指向原投递记录
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func CreateTaskCallbackDelivery(delivery *TaskCallbackDelivery) error {
+	now := common.GetTimestamp()
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	if delivery.Status == "" {
+		delivery.Status = TaskCallbackStatusPending
+	}
+	return DB.Create(delivery).Error
+}
+
+// ClaimTaskCallbackDelivery 以尝试次数作为乐观锁认领一次投递，并把下次重试时间推迟到 leaseUntil，
+// 避免提交时的即时投递与重试任务重复发送
+func ClaimTaskCallbackDelivery(id int64, attempts int, leaseUntil int64) (bool, error) {
+	result := DB.Model(&TaskCallbackDelivery{}).
+		Where("id = ? AND attempts = ? AND status = ?", id, attempts, TaskCallbackStatusPending).
+		Updates(map[string]interface{}{
+			"attempts":      gorm.Expr("attempts + ?", 1),
+			"next_retry_at": leaseUntil,
+			"updated_at":    common.GetTimestamp(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FinishTaskCallbackAttempt 记录一次投递结果；status 仍为 pending 时在 nextRetryAt 重试
+func FinishTaskCallbackAttempt(id int64, status string, statusCode int, lastError string, nextRetryAt int64) error {
+	if len(lastError) > 512 {
+		lastError = lastError[:512]
+	}
+	return DB.Model(&TaskCallbackDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":           status,
+		"last_status_code": statusCode,
+		"last_error":       lastError,
+		"next_retry_at":    nextRetryAt,
+		"updated_at":       common.GetTimestamp(),
+	}).Error
+}
+
+func GetDueTaskCallbackDeliveries(now int64, limit int) ([]*TaskCallbackDelivery, error) {
+	var deliveries []*TaskCallbackDelivery
+	err := DB.Where("status = ? AND next_retry_at <= ?", TaskCallbackStatusPending, now).
+		Order("next_retry_at asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func GetUserTaskCallbackDeliveries(userId int, taskId string, startIdx int, num int) ([]*TaskCallbackDelivery, int64, error) {
+	query := DB.Model(&TaskCallbackDelivery{}).Where("user_id = ?", userId)
+	if taskId != "" {
+		query = query.Where("task_id = ?", taskId)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var deliveries []*TaskCallbackDelivery
+	err := query.Order("id desc").Offset(startIdx).Limit(num).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+func GetUserTaskCallbackDelivery(id int64, userId int) (*TaskCallbackDelivery, error) {
+	delivery := &TaskCallbackDelivery{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("回调记录不存在")
+	}
+	return delivery, err
+}
+
+// DeleteTaskCallbackDeliveriesBefore 删除创建时间早于 timestamp 的已结束投递记录
+func DeleteTaskCallbackDeliveriesBefore(timestamp int64) error {
+	return DB.Where("created_at < ? AND status <> ?", timestamp, TaskCallbackStatusPending).Delete(&TaskCallbackDelivery{}).Error
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// TaskBacklog 按平台统计的未完成任务积压
+type TaskBacklog struct {
+	Platform         string `json:"platform"`
+	Unfinished       int64  `json:"unfinished"`
+	Due              int64  `json:"due"`
+	OldestSubmitTime int64  `json:"oldest_submit_time"`
+}
+
+func unfinishedTaskQuery() *gorm.DB {
+	return DB.Model(&Task{}).
+		Where("progress != ?", "100%").
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess})
+}
+
+// GetDueTaskPlatforms 返回有到达下次拉取时间的未完成任务的平台
+func GetDueTaskPlatforms(now int64) ([]string, error) {
+	var platforms []string
+	err := unfinishedTaskQuery().
+		Where("next_poll_at <= ?", now).
+		Distinct("platform").
+		Order("platform").
+		Pluck("platform", &platforms).Error
+	return platforms, err
+}
+
+// GetDueUnfinishedTasks 返回平台到达下次拉取时间的未完成任务，最早到期的优先；按平台分别取出，
+// 积压多的平台不会占满其他平台的名额
+func GetDueUnfinishedTasks(platform string, now int64, limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := unfinishedTaskQuery().
+		Where("platform = ?", platform).
+		Where("next_poll_at <= ?", now).
+		Order("next_poll_at asc, id asc").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+func UpdateTaskNextPollAt(id int64, nextPollAt int64) error {
+	return DB.Model(&Task{}).Where("id = ?", id).UpdateColumn("next_poll_at", nextPollAt).Error
+}
+
+// FailUnfinishedTask 仅在任务仍未完成时标记为失败，返回是否由本次调用完成更新，调用方据此决定是否退还额度
+func FailUnfinishedTask(id int64, reason string, finishTime int64) (bool, error) {
+	result := unfinishedTaskQuery().
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":      TaskStatusFailure,
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": finishTime,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetTaskBacklog 按平台统计未完成任务数、已到期待拉取的任务数与最早的提交时间
+func GetTaskBacklog(now int64) ([]*TaskBacklog, error) {
+	var backlog []*TaskBacklog
+	err := unfinishedTaskQuery().
+		Select("platform, COUNT(*) AS unfinished, SUM(CASE WHEN next_poll_at <= ? THEN 1 ELSE 0 END) AS due, MIN(submit_time) AS oldest_submit_time", now).
+		Group("platform").
+		Order("platform").
+		Scan(&backlog).Error
+	return backlog, err
+}
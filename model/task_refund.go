@@ -0,0 +1,147 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	TaskRefundReasonFailed  = "failed"  // 上游返回失败或渠道不可用
+	TaskRefundReasonTimeout = "timeout" // 超过轮询超时时长仍未完成
+	TaskRefundReasonPartial = "partial" // 多输出任务部分输出失败
+	TaskRefundReasonLegacy  = "legacy"  // 启用退款记录前已结束的任务，仅用于防止重复退款，不退还额度
+
+	taskRefundBackfillMigrationKey = "TaskRefundLegacyTasksBackfilled"
+)
+
+// TaskRefund 异步任务退款记录；每个任务最多一条，与额度退还处于同一事务，用于防止重复退款
+type TaskRefund struct {
+	Id            int64  `json:"id"`
+	TaskRecordId  int64  `json:"task_record_id" gorm:"uniqueIndex"` // tasks 表主键
+	TaskId        string `json:"task_id" gorm:"type:varchar(191);index"`
+	Platform      string `json:"platform" gorm:"type:varchar(30);index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	ChannelId     int    `json:"channel_id" gorm:"index"`
+	Reason        string `json:"reason" gorm:"type:varchar(20)"`
+	Policy        string `json:"policy" gorm:"type:varchar(20)"`
+	ChargedQuota  int    `json:"charged_quota"` // 任务预扣额度
+	Quota         int    `json:"quota"`         // 退还额度
+	TotalOutputs  int    `json:"total_outputs"`
+	FailedOutputs int    `json:"failed_outputs"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// RefundTaskQuota 写入退款记录并退还额度；任务已有退款记录时不做任何修改，返回是否由本次调用完成退款
+func RefundTaskQuota(refund *TaskRefund) (bool, error) {
+	if refund.Quota <= 0 {
+		return false, nil
+	}
+	refund.CreatedAt = common.GetTimestamp()
+	refunded := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(refund)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		refunded = true
+		remark := fmt.Sprintf("task %s %s", refund.Platform, refund.TaskId)
+		return applyUserQuotaDeltaTx(tx, refund.UserId, QuotaLedgerTypeRefund, int64(refund.Quota), 0, remark)
+	})
+	if err != nil || !refunded {
+		return false, err
+	}
+	gopool.Go(func() {
+		if err := cacheIncrUserQuota(refund.UserId, int64(refund.Quota)); err != nil {
+			common.SysLog("failed to increase user quota: " + err.Error())
+		}
+	})
+	return true, nil
+}
+
+// RecordTaskRefundLog 记录退款类型的日志，other 中包含任务 ID 便于与任务对应
+func RecordTaskRefundLog(refund *TaskRefund, group string, modelName string, content string) {
+	username, _ := GetUsernameById(refund.UserId, false)
+	log := &Log{
+		UserId:    refund.UserId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeRefund,
+		Content:   content,
+		ModelName: modelName,
+		Quota:     refund.Quota,
+		ChannelId: refund.ChannelId,
+		Group:     group,
+		Other: common.MapToJsonStr(map[string]interface{}{
+			"task_id":        refund.TaskId,
+			"platform":       refund.Platform,
+			"refund_reason":  refund.Reason,
+			"refund_policy":  refund.Policy,
+			"charged_quota":  refund.ChargedQuota,
+			"total_outputs":  refund.TotalOutputs,
+			"failed_outputs": refund.FailedOutputs,
+		}),
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysLog("failed to record log: " + err.Error())
+	}
+}
+
+// migrateTaskRefundLegacyTasks 为启用退款记录前已成功或失败的任务补写退款记录，
+// 这些任务此前已按旧逻辑结算，补写后重复查询或同步状态不会再次退款
+func migrateTaskRefundLegacyTasks(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrated, err := optionIsTrueTx(tx, taskRefundBackfillMigrationKey)
+		if err != nil || migrated {
+			return err
+		}
+		result := tx.Exec("INSERT INTO task_refunds (task_record_id, task_id, platform, user_id, channel_id, reason, policy, charged_quota, quota, total_outputs, failed_outputs, created_at) "+
+			"SELECT id, task_id, platform, user_id, channel_id, ?, ?, quota, 0, 0, 0, ? FROM tasks "+
+			"WHERE status IN (?, ?) AND id NOT IN (SELECT task_record_id FROM task_refunds)",
+			TaskRefundReasonLegacy, "", common.GetTimestamp(), TaskStatusSuccess, TaskStatusFailure)
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := upsertOptionTx(tx, taskRefundBackfillMigrationKey, "true"); err != nil {
+			return err
+		}
+		common.SysLog(fmt.Sprintf("created legacy task refund records for %d finished tasks", result.RowsAffected))
+		return nil
+	})
+}
+
+func GetUserTaskRefunds(userId int, taskId string, startIdx int, num int) ([]*TaskRefund, int64, error) {
+	return getTaskRefunds(DB.Model(&TaskRefund{}).Where("user_id = ?", userId), taskId, startIdx, num)
+}
+
+func GetTaskRefunds(userId int, taskId string, startIdx int, num int) ([]*TaskRefund, int64, error) {
+	query := DB.Model(&TaskRefund{})
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	return getTaskRefunds(query, taskId, startIdx, num)
+}
+
+func getTaskRefunds(query *gorm.DB, taskId string, startIdx int, num int) ([]*TaskRefund, int64, error) {
+	query = query.Where("reason <> ?", TaskRefundReasonLegacy)
+	if taskId != "" {
+		query = query.Where("task_id = ?", taskId)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var refunds []*TaskRefund
+	err := query.Order("id desc").Offset(startIdx).Limit(num).Find(&refunds).Error
+	return refunds, total, err
+}
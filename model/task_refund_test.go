@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTaskRefundLegacyTasksBackfill(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:task-refund-backfill-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&User{}, &Option{}, &QuotaLedger{}, &Task{}, &TaskRefund{}); err != nil {
+		t.Fatal(err)
+	}
+	oldDB, oldRedisEnabled := DB, common.RedisEnabled
+	DB = db
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		DB = oldDB
+		common.RedisEnabled = oldRedisEnabled
+	})
+
+	user := &User{Id: 1, Username: "refund-a", AffCode: "ra01", Quota: 100}
+	if err = db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	tasks := []*Task{
+		{TaskID: "task_failed", UserId: 1, Quota: 50, Status: TaskStatusFailure},
+		{TaskID: "task_success", UserId: 1, Quota: 50, Status: TaskStatusSuccess},
+		{TaskID: "task_running", UserId: 1, Quota: 50, Status: TaskStatusInProgress},
+	}
+	if err = db.Create(&tasks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = migrateTaskRefundLegacyTasks(db); err != nil {
+		t.Fatal(err)
+	}
+	// 只执行一次，之后结束的任务不会被补写
+	if err = db.Model(&Task{}).Where("id = ?", tasks[2].ID).Update("status", TaskStatusFailure).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = migrateTaskRefundLegacyTasks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	db.Model(&TaskRefund{}).Where("reason = ?", TaskRefundReasonLegacy).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected legacy refund records for 2 finished tasks, got %d", count)
+	}
+	// 迁移前已失败的任务不再退款，迁移后失败的任务正常退款
+	refunded, err := RefundTaskQuota(&TaskRefund{TaskRecordId: tasks[0].ID, TaskId: "task_failed", UserId: 1, Reason: TaskRefundReasonFailed, Quota: 50})
+	if err != nil || refunded {
+		t.Fatalf("legacy failed task should not be refunded again: %v, %v", refunded, err)
+	}
+	refunded, err = RefundTaskQuota(&TaskRefund{TaskRecordId: tasks[2].ID, TaskId: "task_running", UserId: 1, Reason: TaskRefundReasonFailed, Quota: 50})
+	if err != nil || !refunded {
+		t.Fatalf("task failed after migration should be refunded: %v, %v", refunded, err)
+	}
+	refunds, total, err := GetUserTaskRefunds(1, "", 0, 10)
+	if err != nil || total != 1 || len(refunds) != 1 || refunds[0].TaskId != "task_running" {
+		t.Fatalf("legacy records should be hidden from refund list: %d, %+v, %v", total, refunds, err)
+	}
+}
@@ -28,6 +28,9 @@ type Token struct {
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
 	Groups             TokenGroups    `json:"groups,omitempty" gorm:"type:json"`
+	ModelFallbacks     string         `json:"model_fallbacks" gorm:"type:text"`                      // JSON: 模型 -> 有序回退模型列表，优先于管理员配置
+	TaskCallbackUrl    string         `json:"task_callback_url" gorm:"type:varchar(512);default:''"` // 异步任务状态回调地址，提交任务时未指定 callback_url 时使用
+	TaskCallbackSecret string         `json:"task_callback_secret" gorm:"type:varchar(128);default:''"`
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -186,7 +189,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "groups").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "groups", "model_fallbacks",
+		"task_callback_url", "task_callback_secret").Updates(token).Error
 	return err
 }
 
@@ -240,6 +244,37 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+// GetModelFallbacks 解析令牌级模型回退链，格式错误时视为未配置
+func (token *Token) GetModelFallbacks() map[string][]string {
+	fallbacks, err := ParseTokenModelFallbacks(token.ModelFallbacks)
+	if err != nil {
+		return nil
+	}
+	return fallbacks
+}
+
+// ParseTokenModelFallbacks 解析并校验令牌级模型回退链 JSON
+func ParseTokenModelFallbacks(raw string) (map[string][]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	fallbacks := make(map[string][]string)
+	if err := common.UnmarshalJsonStr(raw, &fallbacks); err != nil {
+		return nil, fmt.Errorf("模型回退链格式错误，应为 {\"模型\": [\"回退模型\"]}: %w", err)
+	}
+	for modelName, chain := range fallbacks {
+		if strings.TrimSpace(modelName) == "" {
+			return nil, errors.New("模型回退链中的模型名称不能为空")
+		}
+		for _, fallback := range chain {
+			if strings.TrimSpace(fallback) == "" {
+				return nil, fmt.Errorf("模型 %s 的回退链中存在空模型名称", modelName)
+			}
+		}
+	}
+	return fallbacks, nil
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
@@ -276,8 +311,7 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
-		return nil
+		return appendPendingQuotaLedgers(&QuotaLedger{TokenId: id, Type: QuotaLedgerTypeToken, QuotaDelta: int64(quota), UsedQuotaDelta: -int64(quota)})
 	}
 	return increaseTokenQuota(id, quota)
 }
@@ -306,8 +340,7 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
-		return nil
+		return appendPendingQuotaLedgers(&QuotaLedger{TokenId: id, Type: QuotaLedgerTypeToken, QuotaDelta: -int64(quota), UsedQuotaDelta: int64(quota)})
 	}
 	return decreaseTokenQuota(id, quota)
 }
@@ -132,6 +132,9 @@ func Recharge(referenceId string, customerId string) (err error) {
 		if err != nil {
 			return err
 		}
+		if err = RecordQuotaLedgerTx(tx, topUp.UserId, QuotaLedgerTypeTopUp, int64(math.Round(quota)), 0, topUp.TradeNo); err != nil {
+			return err
+		}
 
 		var rebateErr error
 		rebateResult, rebateErr = ApplyAffRebateTx(tx, topUp.UserId, topUp.Id, int64(quota), topUp.Money)
@@ -356,6 +359,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := RecordQuotaLedgerTx(tx, topUp.UserId, QuotaLedgerTypeTopUp, int64(quotaToAdd), 0, topUp.TradeNo); err != nil {
+			return err
+		}
 
 		var rebateErr error
 		rebateResult, rebateErr = ApplyAffRebateTx(tx, topUp.UserId, topUp.Id, int64(quotaToAdd), topUp.Money)
@@ -453,6 +459,9 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 		if err != nil {
 			return err
 		}
+		if err = RecordQuotaLedgerTx(tx, topUp.UserId, QuotaLedgerTypeTopUp, quota, 0, topUp.TradeNo); err != nil {
+			return err
+		}
 
 		if quota > 0 {
 			var rebateErr error
@@ -1,34 +1,21 @@
 package model
 
 import (
-	"sync"
+	"errors"
+	"fmt"
 	"time"
-
-	"github.com/QuantumNous/new-api/common"
 )
 
-const topUpCouponCleanupInterval = 5 * time.Minute
-
-var topUpCouponCleanupOnce sync.Once
+const TopUpCouponCleanupInterval = 5 * time.Minute
 
-func StartTopUpCouponCleanupLoop() {
-	topUpCouponCleanupOnce.Do(func() {
-		ticker := time.NewTicker(topUpCouponCleanupInterval)
-		go func() {
-			if err := CleanupTopUpCouponStates(); err != nil {
-				common.SysLog("failed to cleanup topup coupon states: " + err.Error())
-			}
-			if err := CleanupTopUpPromotionStates(); err != nil {
-				common.SysLog("failed to cleanup topup promotion states: " + err.Error())
-			}
-			for range ticker.C {
-				if err := CleanupTopUpCouponStates(); err != nil {
-					common.SysLog("failed to cleanup topup coupon states: " + err.Error())
-				}
-				if err := CleanupTopUpPromotionStates(); err != nil {
-					common.SysLog("failed to cleanup topup promotion states: " + err.Error())
-				}
-			}
-		}()
-	})
+// RunTopUpCouponCleanup 清理过期的充值优惠券与促销活动状态，由后台任务调度器定期调用
+func RunTopUpCouponCleanup() error {
+	var errs []error
+	if err := CleanupTopUpCouponStates(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to cleanup topup coupon states: %w", err))
+	}
+	if err := CleanupTopUpPromotionStates(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to cleanup topup promotion states: %w", err))
+	}
+	return errors.Join(errs...)
 }
@@ -115,6 +115,12 @@ func GetQuotaDataByUserId(userId int, startTime int64, endTime int64) (quotaData
 	return quotaDatas, err
 }
 
+// GetQuotaDataUserIds 返回时间范围内有用量记录的用户 ID
+func GetQuotaDataUserIds(startTime int64, endTime int64) (userIds []int, err error) {
+	err = DB.Table("quota_data").Where("created_at >= ? and created_at <= ?", startTime, endTime).Distinct().Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
 func GetAllQuotaDates(startTime int64, endTime int64, username string) (quotaData []*QuotaData, err error) {
 	if username != "" {
 		return GetQuotaDataByUsername(username, startTime, endTime)
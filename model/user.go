@@ -690,6 +690,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := RecordQuotaLedgerTx(tx, user.Id, QuotaLedgerTypeAffTransfer, int64(quota), 0, ""); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -714,9 +717,14 @@ func (user *User) Insert(inviterId int) error {
 		user.SetSetting(defaultSetting)
 	}
 
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return RecordQuotaLedgerTx(tx, user.Id, QuotaLedgerTypeSignup, int64(user.Quota), 0, "")
+	})
+	if err != nil {
+		return err
 	}
 
 	// 用户创建成功后，根据角色初始化边栏配置
@@ -739,7 +747,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, QuotaLedgerTypeInvite)
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(int64(common.QuotaForInvitee))))
 		}
 		if common.QuotaForInviter > 0 {
@@ -809,8 +817,17 @@ func (user *User) Edit(updatePassword bool) error {
 		updates["password"] = newUser.Password
 	}
 
-	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, user.Id).Error; err != nil {
+			return err
+		}
+		quotaDelta := int64(newUser.Quota) - int64(user.Quota)
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return RecordQuotaLedgerTx(tx, user.Id, QuotaLedgerTypeAdminAdjust, quotaDelta, 0, "")
+	})
+	if err != nil {
 		return err
 	}
 
@@ -1132,7 +1149,8 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
-func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+// IncreaseUserQuota 增加用户额度并记录 ledgerType 类型的额度流水；开启批量更新且 db 为 false 时先写入未生效流水
+func IncreaseUserQuota(id int, quota int, db bool, ledgerType string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -1143,21 +1161,15 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 		}
 	})
 	if !db && common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
-		return nil
-	}
-	return increaseUserQuota(id, quota)
-}
-
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	if err != nil {
-		return err
+		return appendPendingQuotaLedgers(&QuotaLedger{UserId: id, Type: ledgerType, QuotaDelta: int64(quota)})
 	}
-	return err
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return applyUserQuotaDeltaTx(tx, id, ledgerType, int64(quota), 0, "")
+	})
 }
 
-func DecreaseUserQuota(id int, quota int) (err error) {
+// DecreaseUserQuota 扣减用户额度并记录 ledgerType 类型的额度流水
+func DecreaseUserQuota(id int, quota int, ledgerType string) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -1168,28 +1180,21 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 		}
 	})
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
-		return nil
-	}
-	return decreaseUserQuota(id, quota)
-}
-
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	if err != nil {
-		return err
+		return appendPendingQuotaLedgers(&QuotaLedger{UserId: id, Type: ledgerType, QuotaDelta: -int64(quota)})
 	}
-	return err
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return applyUserQuotaDeltaTx(tx, id, ledgerType, -int64(quota), 0, "")
+	})
 }
 
-func DeltaUpdateUserQuota(id int, delta int) (err error) {
+func DeltaUpdateUserQuota(id int, delta int, ledgerType string) (err error) {
 	if delta == 0 {
 		return nil
 	}
 	if delta > 0 {
-		return IncreaseUserQuota(id, delta, false)
+		return IncreaseUserQuota(id, delta, false, ledgerType)
 	} else {
-		return DecreaseUserQuota(id, -delta)
+		return DecreaseUserQuota(id, -delta, ledgerType)
 	}
 }
 
@@ -1205,7 +1210,9 @@ func GetRootUser() (user *User) {
 
 func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
+		if err := appendPendingQuotaLedgers(&QuotaLedger{UserId: id, Type: QuotaLedgerTypeUsage, UsedQuotaDelta: int64(quota)}); err != nil {
+			common.SysLog("failed to record user used quota: " + err.Error())
+		}
 		addNewRecord(BatchUpdateTypeRequestCount, id, 1)
 		return
 	}
@@ -1213,12 +1220,18 @@ func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
 }
 
 func updateUserUsedQuotaAndRequestCount(id int, quota int, count int) {
-	err := DB.Model(&User{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"used_quota":    gorm.Expr("used_quota + ?", quota),
-			"request_count": gorm.Expr("request_count + ?", count),
-		},
-	).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", id).Updates(
+			map[string]interface{}{
+				"used_quota":    gorm.Expr("used_quota + ?", quota),
+				"request_count": gorm.Expr("request_count + ?", count),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return RecordQuotaLedgerTx(tx, id, QuotaLedgerTypeUsage, 0, int64(quota), "")
+	})
 	if err != nil {
 		common.SysLog("failed to update user used quota and request count: " + err.Error())
 		return
@@ -1230,17 +1243,6 @@ func updateUserUsedQuotaAndRequestCount(id int, quota int, count int) {
 	//}
 }
 
-func updateUserUsedQuota(id int, quota int) {
-	err := DB.Model(&User{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"used_quota": gorm.Expr("used_quota + ?", quota),
-		},
-	).Error
-	if err != nil {
-		common.SysLog("failed to update user used quota: " + err.Error())
-	}
-}
-
 func updateUserRequestCount(id int, count int) {
 	err := DB.Model(&User{}).Where("id = ?", id).Update("request_count", gorm.Expr("request_count + ?", count)).Error
 	if err != nil {
@@ -11,13 +11,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// 用户、令牌、渠道的额度增量以额度流水形式批量写入，这里只缓冲请求次数等非额度数据
 const (
-	BatchUpdateTypeUserQuota = iota
-	BatchUpdateTypeTokenQuota
-	BatchUpdateTypeUsedQuota
-	BatchUpdateTypeChannelUsedQuota
-	BatchUpdateTypeRequestCount
-	BatchUpdateTypeCount // if you add a new type, you need to add a new map and a new lock
+	BatchUpdateTypeRequestCount = iota
+	BatchUpdateTypeCount        // if you add a new type, you need to add a new map and a new lock
 )
 
 var batchUpdateStores []map[int]int
@@ -39,6 +36,11 @@ func InitBatchUpdater() {
 	})
 }
 
+// FlushBatchUpdates 立即写入批量更新缓冲区中尚未落库的数据，用于服务关闭前
+func FlushBatchUpdates() {
+	batchUpdate()
+}
+
 func addNewRecord(type_ int, id int, value int) {
 	batchUpdateLocks[type_].Lock()
 	defer batchUpdateLocks[type_].Unlock()
@@ -50,6 +52,9 @@ func addNewRecord(type_ int, id int, value int) {
 }
 
 func batchUpdate() {
+	// 额度增量在发生时已写入未生效流水，这里合并后应用到余额
+	applyPendingQuotaLedgers()
+
 	// check if there's any data to update
 	hasData := false
 	for i := 0; i < BatchUpdateTypeCount; i++ {
@@ -75,22 +80,8 @@ func batchUpdate() {
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
-			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
-				if err != nil {
-					common.SysLog("failed to batch update user quota: " + err.Error())
-				}
-			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
-				if err != nil {
-					common.SysLog("failed to batch update token quota: " + err.Error())
-				}
-			case BatchUpdateTypeUsedQuota:
-				updateUserUsedQuota(key, value)
 			case BatchUpdateTypeRequestCount:
 				updateUserRequestCount(key, value)
-			case BatchUpdateTypeChannelUsedQuota:
-				updateChannelUsedQuota(key, value)
 			}
 		}
 	}
@@ -55,3 +55,7 @@ type TaskAdaptor interface {
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
+
+type OpenAIImageJobConverter interface {
+	ConvertToOpenAIImageJob(originTask *model.Task) ([]byte, error)
+}
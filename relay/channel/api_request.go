@@ -503,6 +503,7 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	service.HandleChannelKeyResponse(info, resp)
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
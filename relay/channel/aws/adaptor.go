@@ -30,15 +30,30 @@ type Adaptor struct {
 	AwsClient  *bedrockruntime.Client
 	AwsModelId string
 	AwsReq     any
-	IsNova     bool
+	// IsConverse 非 Claude 模型及 Gemini 格式请求走 Converse / ConverseStream，请求体保持 OpenAI 格式，发送前再转换
+	IsConverse bool
+	// IsEmbedding 嵌入请求（Titan / Cohere Embed），同样保持 OpenAI 格式请求体
+	IsEmbedding bool
 }
 
-func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	openaiRequest, err := service.GeminiToOpenAIRequest(request, info)
+	if err != nil {
+		return nil, err
+	}
+	a.IsConverse = true
+	return openaiRequest, nil
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if !isClaudeModel(info.UpstreamModelName) {
+		openaiRequest, err := service.ClaudeToOpenAIRequest(*request, info)
+		if err != nil {
+			return nil, err
+		}
+		a.IsConverse = true
+		return openaiRequest, nil
+	}
 	for i, message := range request.Messages {
 		updated := false
 		if !message.IsStringContent() {
@@ -113,14 +128,12 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	// 非 Claude 模型（Nova、Llama、Mistral、DeepSeek、Cohere 等）统一使用 Converse API
+	if !isClaudeModel(info.UpstreamModelName) {
+		a.IsConverse = true
+		return request, nil
 	}
 
-	// 原有的Claude模型处理逻辑
 	claudeReq, err := claude.RequestOpenAI2ClaudeMessage(c, *request)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert openai request to claude request")
@@ -134,8 +147,11 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if len(request.ParseInput()) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	a.IsEmbedding = true
+	return request, nil
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -144,7 +160,8 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
-	if a.ClientMode == ClientModeApiKey {
+	// Converse 与嵌入请求通过 SDK 调用，API Key 模式使用 Bearer Token 认证
+	if a.ClientMode == ClientModeApiKey && !a.IsConverse && !a.IsEmbedding {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
 		return doAwsClientRequest(c, info, a, requestBody)
@@ -152,18 +169,22 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if a.ClientMode == ClientModeApiKey {
+	if a.IsEmbedding {
+		err, usage = awsEmbeddingHandler(c, info, a)
+	} else if a.IsConverse {
+		if info.IsStream {
+			err, usage = converseStreamHandler(c, info, a)
+		} else {
+			err, usage = converseHandler(c, info, a)
+		}
+	} else if a.ClientMode == ClientModeApiKey {
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
 	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+		if info.IsStream {
+			err, usage = awsStreamHandler(c, info, a)
 		} else {
-			if info.IsStream {
-				err, usage = awsStreamHandler(c, info, a)
-			} else {
-				err, usage = awsHandler(c, info, a)
-			}
+			err, usage = awsHandler(c, info, a)
 		}
 	}
 	return
@@ -28,6 +28,24 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Converse models
+	"llama3-1-8b-instruct-v1:0":         "meta.llama3-1-8b-instruct-v1:0",
+	"llama3-1-70b-instruct-v1:0":        "meta.llama3-1-70b-instruct-v1:0",
+	"llama3-3-70b-instruct-v1:0":        "meta.llama3-3-70b-instruct-v1:0",
+	"llama4-scout-17b-instruct-v1:0":    "meta.llama4-scout-17b-instruct-v1:0",
+	"llama4-maverick-17b-instruct-v1:0": "meta.llama4-maverick-17b-instruct-v1:0",
+	"mistral-large-2402-v1:0":           "mistral.mistral-large-2402-v1:0",
+	"mistral-large-2407-v1:0":           "mistral.mistral-large-2407-v1:0",
+	"pixtral-large-2502-v1:0":           "mistral.pixtral-large-2502-v1:0",
+	"deepseek-r1-v1:0":                  "deepseek.r1-v1:0",
+	"command-r-v1:0":                    "cohere.command-r-v1:0",
+	"command-r-plus-v1:0":               "cohere.command-r-plus-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	"cohere-embed-v4:0":            "cohere.embed-v4:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -124,6 +142,29 @@ var awsModelCanCrossRegionMap = map[string]map[string]bool{
 		"eu":   true,
 		"apac": true,
 	},
+	// Converse models
+	"meta.llama3-1-8b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-1-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama3-3-70b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-scout-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"meta.llama4-maverick-17b-instruct-v1:0": {
+		"us": true,
+	},
+	"mistral.pixtral-large-2502-v1:0": {
+		"us": true,
+		"eu": true,
+	},
+	"deepseek.r1-v1:0": {
+		"us": true,
+	},
 }
 
 var awsRegionCrossModelPrefixMap = map[string]string{
@@ -134,7 +175,8 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 
 var ChannelName = "aws"
 
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
+// 判断是否为Claude模型，Claude 使用 InvokeModel，其余模型使用 Converse
+// 跨区域推理配置文件（如 us.anthropic.xxx）同样按模型 ID 判断，应用推理配置文件 ARN 按 Converse 处理
+func isClaudeModel(model string) bool {
+	return strings.HasPrefix(model, "claude") || strings.Contains(getAwsModelID(model), "anthropic.")
 }
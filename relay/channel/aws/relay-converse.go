@@ -0,0 +1,517 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// converseParams Converse 与 ConverseStream 共用的请求参数
+type converseParams struct {
+	System                       []bedrockruntimeTypes.SystemContentBlock
+	Messages                     []bedrockruntimeTypes.Message
+	InferenceConfig              *bedrockruntimeTypes.InferenceConfiguration
+	ToolConfig                   *bedrockruntimeTypes.ToolConfiguration
+	Guardrail                    *converseGuardrailConfig
+	AdditionalModelRequestFields document.Interface
+}
+
+func (p *converseParams) appendBlocks(role bedrockruntimeTypes.ConversationRole, blocks ...bedrockruntimeTypes.ContentBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	// Converse 要求 user / assistant 交替出现，相邻的同角色消息合并
+	if n := len(p.Messages); n > 0 && p.Messages[n-1].Role == role {
+		p.Messages[n-1].Content = append(p.Messages[n-1].Content, blocks...)
+		return
+	}
+	p.Messages = append(p.Messages, bedrockruntimeTypes.Message{Role: role, Content: blocks})
+}
+
+func (p *converseParams) toConverseInput(modelId string) *bedrockruntime.ConverseInput {
+	input := &bedrockruntime.ConverseInput{
+		ModelId:                      aws.String(modelId),
+		System:                       p.System,
+		Messages:                     p.Messages,
+		InferenceConfig:              p.InferenceConfig,
+		ToolConfig:                   p.ToolConfig,
+		AdditionalModelRequestFields: p.AdditionalModelRequestFields,
+	}
+	if p.Guardrail != nil {
+		input.GuardrailConfig = &bedrockruntimeTypes.GuardrailConfiguration{
+			GuardrailIdentifier: aws.String(p.Guardrail.GuardrailIdentifier),
+			GuardrailVersion:    aws.String(p.Guardrail.GuardrailVersion),
+			Trace:               bedrockruntimeTypes.GuardrailTrace(p.Guardrail.Trace),
+		}
+	}
+	return input
+}
+
+func (p *converseParams) toConverseStreamInput(modelId string) *bedrockruntime.ConverseStreamInput {
+	input := &bedrockruntime.ConverseStreamInput{
+		ModelId:                      aws.String(modelId),
+		System:                       p.System,
+		Messages:                     p.Messages,
+		InferenceConfig:              p.InferenceConfig,
+		ToolConfig:                   p.ToolConfig,
+		AdditionalModelRequestFields: p.AdditionalModelRequestFields,
+	}
+	if p.Guardrail != nil {
+		input.GuardrailConfig = &bedrockruntimeTypes.GuardrailStreamConfiguration{
+			GuardrailIdentifier:  aws.String(p.Guardrail.GuardrailIdentifier),
+			GuardrailVersion:     aws.String(p.Guardrail.GuardrailVersion),
+			Trace:                bedrockruntimeTypes.GuardrailTrace(p.Guardrail.Trace),
+			StreamProcessingMode: bedrockruntimeTypes.GuardrailStreamProcessingMode(p.Guardrail.StreamProcessingMode),
+		}
+	}
+	return input
+}
+
+// convertOpenAI2Converse 将 OpenAI 格式请求转换为 Converse 请求参数，Claude / Gemini 格式请求在此之前已转换为 OpenAI 格式
+func convertOpenAI2Converse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) (*converseParams, error) {
+	params := &converseParams{}
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			if text := message.StringContent(); text != "" {
+				params.System = append(params.System, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: text})
+			}
+		case "tool":
+			params.appendBlocks(bedrockruntimeTypes.ConversationRoleUser, &bedrockruntimeTypes.ContentBlockMemberToolResult{
+				Value: bedrockruntimeTypes.ToolResultBlock{
+					ToolUseId: aws.String(message.ToolCallId),
+					Content: []bedrockruntimeTypes.ToolResultContentBlock{
+						&bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: message.StringContent()},
+					},
+				},
+			})
+		case "assistant":
+			blocks, err := convertConverseContent(c, message)
+			if err != nil {
+				return nil, err
+			}
+			for _, toolCall := range message.ParseToolCalls() {
+				input := make(map[string]any)
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &input); err != nil {
+						common.SysLog("tool call function arguments is not a map[string]any: " + toolCall.Function.Arguments)
+					}
+				}
+				blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberToolUse{
+					Value: bedrockruntimeTypes.ToolUseBlock{
+						ToolUseId: aws.String(toolCall.ID),
+						Name:      aws.String(toolCall.Function.Name),
+						Input:     document.NewLazyDocument(input),
+					},
+				})
+			}
+			params.appendBlocks(bedrockruntimeTypes.ConversationRoleAssistant, blocks...)
+		default:
+			blocks, err := convertConverseContent(c, message)
+			if err != nil {
+				return nil, err
+			}
+			params.appendBlocks(bedrockruntimeTypes.ConversationRoleUser, blocks...)
+		}
+	}
+
+	inferenceConfig := &bedrockruntimeTypes.InferenceConfiguration{}
+	if maxTokens := request.GetMaxTokens(); maxTokens != 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		inferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != 0 {
+		inferenceConfig.TopP = aws.Float32(float32(request.TopP))
+	}
+	inferenceConfig.StopSequences = parseStopSequences(request.Stop)
+	params.InferenceConfig = inferenceConfig
+
+	params.ToolConfig = convertConverseTools(request)
+
+	var extraBody converseExtraBody
+	if len(request.ExtraBody) > 0 {
+		if err := common.Unmarshal(request.ExtraBody, &extraBody); err != nil {
+			return nil, errors.Wrap(err, "invalid extra_body")
+		}
+	}
+	params.Guardrail = extraBody.GuardrailConfig
+	if params.Guardrail == nil && info.ChannelOtherSettings.AwsGuardrailId != "" {
+		params.Guardrail = &converseGuardrailConfig{
+			GuardrailIdentifier: info.ChannelOtherSettings.AwsGuardrailId,
+			GuardrailVersion:    info.ChannelOtherSettings.AwsGuardrailVersion,
+		}
+		if info.ChannelOtherSettings.AwsGuardrailTrace {
+			params.Guardrail.Trace = string(bedrockruntimeTypes.GuardrailTraceEnabled)
+		}
+	}
+	if params.Guardrail != nil && params.Guardrail.GuardrailVersion == "" {
+		params.Guardrail.GuardrailVersion = "DRAFT"
+	}
+	if len(extraBody.AdditionalModelRequestFields) > 0 {
+		params.AdditionalModelRequestFields = document.NewLazyDocument(extraBody.AdditionalModelRequestFields)
+	}
+	return params, nil
+}
+
+func convertConverseContent(c *gin.Context, message dto.Message) ([]bedrockruntimeTypes.ContentBlock, error) {
+	var blocks []bedrockruntimeTypes.ContentBlock
+	if message.IsStringContent() {
+		if text := message.StringContent(); text != "" {
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: text})
+		}
+		return blocks, nil
+	}
+	for _, mediaMessage := range message.ParseContent() {
+		switch mediaMessage.Type {
+		case dto.ContentTypeText:
+			if mediaMessage.Text != "" {
+				blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: mediaMessage.Text})
+			}
+		case dto.ContentTypeImageURL:
+			imageUrl := mediaMessage.GetImageMedia()
+			if imageUrl == nil {
+				continue
+			}
+			imageBlock, err := convertConverseImage(c, imageUrl.Url)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, imageBlock)
+		}
+	}
+	return blocks, nil
+}
+
+func convertConverseImage(c *gin.Context, url string) (bedrockruntimeTypes.ContentBlock, error) {
+	var mimeType, base64Data string
+	if strings.HasPrefix(url, "http") {
+		fileData, err := service.GetFileBase64FromUrl(c, url, "formatting image for Bedrock Converse")
+		if err != nil {
+			return nil, fmt.Errorf("get file base64 from url failed: %s", err.Error())
+		}
+		mimeType = fileData.MimeType
+		base64Data = fileData.Base64Data
+	} else {
+		_, format, data, err := service.DecodeBase64ImageData(url)
+		if err != nil {
+			return nil, err
+		}
+		mimeType = "image/" + format
+		base64Data = data
+	}
+	format := bedrockruntimeTypes.ImageFormat(strings.TrimPrefix(strings.ToLower(mimeType), "image/"))
+	if format == "jpg" {
+		format = bedrockruntimeTypes.ImageFormatJpeg
+	}
+	switch format {
+	case bedrockruntimeTypes.ImageFormatPng, bedrockruntimeTypes.ImageFormatJpeg, bedrockruntimeTypes.ImageFormatGif, bedrockruntimeTypes.ImageFormatWebp:
+	default:
+		return nil, fmt.Errorf("unsupported image format for bedrock converse: %s", mimeType)
+	}
+	imageBytes, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode image base64 failed")
+	}
+	return &bedrockruntimeTypes.ContentBlockMemberImage{
+		Value: bedrockruntimeTypes.ImageBlock{
+			Format: format,
+			Source: &bedrockruntimeTypes.ImageSourceMemberBytes{Value: imageBytes},
+		},
+	}, nil
+}
+
+func convertConverseTools(request *dto.GeneralOpenAIRequest) *bedrockruntimeTypes.ToolConfiguration {
+	var tools []bedrockruntimeTypes.Tool
+	for _, tool := range request.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		spec := bedrockruntimeTypes.ToolSpecification{
+			Name:        aws.String(tool.Function.Name),
+			InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+		}
+		if tool.Function.Description != "" {
+			spec.Description = aws.String(tool.Function.Description)
+		}
+		tools = append(tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+	}
+	if len(tools) == 0 {
+		return nil
+	}
+	toolConfig := &bedrockruntimeTypes.ToolConfiguration{Tools: tools}
+	// Converse 没有 none 选项，tool_choice=none 时沿用模型默认行为
+	switch choice := request.ToolChoice.(type) {
+	case string:
+		switch choice {
+		case "auto":
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAuto{}
+		case "required":
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAny{}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name := common.Interface2String(function["name"]); name != "" {
+				toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberTool{
+					Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(name)},
+				}
+			}
+		}
+	}
+	return toolConfig
+}
+
+func converseStopReason2OpenAI(reason bedrockruntimeTypes.StopReason) string {
+	switch reason {
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return "tool_calls"
+	case bedrockruntimeTypes.StopReasonMaxTokens:
+		return "length"
+	case bedrockruntimeTypes.StopReasonGuardrailIntervened, bedrockruntimeTypes.StopReasonContentFiltered:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// converseUsage Converse 的 inputTokens 不含缓存读写：Claude 格式请求沿用 Claude 口径，其余格式将缓存计入 prompt_tokens
+func converseUsage(info *relaycommon.RelayInfo, tokenUsage *bedrockruntimeTypes.TokenUsage) *dto.Usage {
+	inputTokens := int(aws.ToInt32(tokenUsage.InputTokens))
+	outputTokens := int(aws.ToInt32(tokenUsage.OutputTokens))
+	cacheReadTokens := int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	cacheWriteTokens := int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+
+	usage := &dto.Usage{
+		PromptTokens:     inputTokens,
+		CompletionTokens: outputTokens,
+		TotalTokens:      inputTokens + cacheReadTokens + cacheWriteTokens + outputTokens,
+	}
+	usage.PromptTokensDetails.CachedTokens = cacheReadTokens
+	usage.PromptTokensDetails.CachedCreationTokens = cacheWriteTokens
+	if info.RelayFormat != types.RelayFormatClaude {
+		usage.PromptTokens += cacheReadTokens + cacheWriteTokens
+	}
+	return usage
+}
+
+func converseToolArguments(input document.Interface) string {
+	if input == nil {
+		return "{}"
+	}
+	var value any
+	if err := input.UnmarshalSmithyDocument(&value); err != nil {
+		return "{}"
+	}
+	arguments, err := common.Marshal(value)
+	if err != nil {
+		return "{}"
+	}
+	return string(arguments)
+}
+
+func converseResponse2OpenAI(c *gin.Context, info *relaycommon.RelayInfo, awsResp *bedrockruntime.ConverseOutput) *dto.OpenAITextResponse {
+	var text, reasoning strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				text.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberReasoningContent:
+				if reasoningText, ok := v.Value.(*bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText); ok {
+					reasoning.WriteString(aws.ToString(reasoningText.Value.Text))
+				}
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: converseToolArguments(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+
+	message := dto.Message{
+		Role:             "assistant",
+		ReasoningContent: reasoning.String(),
+	}
+	message.SetStringContent(text.String())
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+
+	response := &dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseStopReason2OpenAI(awsResp.StopReason),
+		}},
+	}
+	if awsResp.Usage != nil {
+		response.Usage = *converseUsage(info, awsResp.Usage)
+	} else {
+		response.Usage = *service.ResponseText2Usage(c, text.String()+reasoning.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	return response
+}
+
+func converseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.Converse(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "Converse"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+	}
+
+	response := converseResponse2OpenAI(c, info, awsResp)
+	var responseBody any = response
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		responseBody = service.ResponseOpenAI2Claude(response, info)
+	case types.RelayFormatGemini:
+		responseBody = service.ResponseOpenAI2Gemini(response, info)
+	}
+	c.JSON(http.StatusOK, responseBody)
+	return nil, &response.Usage
+}
+
+func converseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.ConverseStream(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+
+	responseId := helper.GetResponseID(c)
+	createAt := common.GetTimestamp()
+	model := info.UpstreamModelName
+	var usage *dto.Usage
+	var responseText strings.Builder
+	// 流中的 contentBlockIndex -> OpenAI tool_calls 序号
+	toolCallIndexes := make(map[int32]int)
+
+	// 与 OaiStreamHandler 一致，最后一个分片留给 HandleFinalResponse 处理
+	var lastStreamData string
+	sendChunk := func(chunk *dto.ChatCompletionsStreamResponse) {
+		data, err := common.Marshal(chunk)
+		if err != nil {
+			common.SysLog("error marshalling converse stream chunk: " + err.Error())
+			return
+		}
+		if lastStreamData != "" {
+			if err := openai.HandleStreamFormat(c, info, lastStreamData, info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent); err != nil {
+				common.SysLog("error handling stream format: " + err.Error())
+			}
+		}
+		lastStreamData = string(data)
+	}
+	newChunk := func(delta dto.ChatCompletionsStreamResponseChoiceDelta) *dto.ChatCompletionsStreamResponse {
+		return &dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createAt,
+			Model:   model,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: delta}},
+		}
+	}
+
+	for event := range stream.Events() {
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStart:
+			info.SetFirstResponseTime()
+			sendChunk(helper.GenerateStartEmptyResponse(responseId, createAt, model, nil))
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			index := len(toolCallIndexes)
+			toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = index
+			toolCall := dto.ToolCallResponse{
+				ID:   aws.ToString(toolUse.Value.ToolUseId),
+				Type: "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(toolUse.Value.Name),
+				},
+			}
+			toolCall.SetIndex(index)
+			responseText.WriteString(toolCall.Function.Name)
+			sendChunk(newChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}}))
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			info.SetFirstResponseTime()
+			switch delta := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				responseText.WriteString(delta.Value)
+				chunkDelta := dto.ChatCompletionsStreamResponseChoiceDelta{}
+				chunkDelta.SetContentString(delta.Value)
+				sendChunk(newChunk(chunkDelta))
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				if reasoningText, ok := delta.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText); ok {
+					responseText.WriteString(reasoningText.Value)
+					sendChunk(newChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ReasoningContent: common.GetPointer(reasoningText.Value)}))
+				}
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				arguments := aws.ToString(delta.Value.Input)
+				responseText.WriteString(arguments)
+				toolCall := dto.ToolCallResponse{
+					Function: dto.FunctionResponse{Arguments: arguments},
+				}
+				toolCall.SetIndex(toolCallIndexes[aws.ToInt32(v.Value.ContentBlockIndex)])
+				sendChunk(newChunk(dto.ChatCompletionsStreamResponseChoiceDelta{ToolCalls: []dto.ToolCallResponse{toolCall}}))
+			}
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStop:
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			sendChunk(helper.GenerateStopResponse(responseId, createAt, model, converseStopReason2OpenAI(v.Value.StopReason)))
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			if v.Value.Usage != nil {
+				usage = converseUsage(info, v.Value.Usage)
+			}
+		case *bedrockruntimeTypes.UnknownUnionMember:
+			common.SysLog("unknown converse stream event: " + v.Tag)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return types.NewOpenAIError(errors.Wrap(err, "ConverseStream"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+	}
+
+	if usage == nil {
+		usage = service.ResponseText2Usage(c, responseText.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+	if info.RelayFormat == types.RelayFormatOpenAI && lastStreamData != "" {
+		if err := openai.HandleStreamFormat(c, info, lastStreamData, info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent); err != nil {
+			common.SysLog("error handling stream format: " + err.Error())
+		}
+	}
+	openai.HandleFinalResponse(c, info, lastStreamData, responseId, createAt, model, "", usage, false)
+	return nil, usage
+}
@@ -0,0 +1,157 @@
+package aws
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Cohere Embed 单次请求最多 96 条文本
+const cohereEmbeddingBatchSize = 96
+
+type AwsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions int    `json:"dimensions,omitempty"` // 仅 Titan Text Embeddings V2 支持 256 / 512 / 1024
+	Normalize  bool   `json:"normalize,omitempty"`
+}
+
+type AwsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type AwsCohereEmbeddingRequest struct {
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	Truncate        string   `json:"truncate,omitempty"`
+	EmbeddingTypes  []string `json:"embedding_types,omitempty"`
+	OutputDimension int      `json:"output_dimension,omitempty"` // 仅 Embed v4 支持
+}
+
+type AwsCohereEmbeddingResponse struct {
+	Embeddings struct {
+		Float [][]float64 `json:"float"`
+	} `json:"embeddings"`
+}
+
+func isTitanEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.titan-embed-text")
+}
+
+func isCohereEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.embed")
+}
+
+// buildEmbeddingRequests 按模型族将 OpenAI 嵌入请求拆分为一次或多次 InvokeModel 调用
+func buildEmbeddingRequests(awsModelId string, request *dto.EmbeddingRequest) ([]*bedrockruntime.InvokeModelInput, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	var bodies []any
+	switch {
+	case isTitanEmbeddingModel(awsModelId):
+		// Titan 每次只能嵌入一条文本
+		for _, input := range inputs {
+			titanReq := AwsTitanEmbeddingRequest{InputText: input}
+			if strings.Contains(awsModelId, "titan-embed-text-v2") {
+				titanReq.Dimensions = request.Dimensions
+				titanReq.Normalize = true
+			}
+			bodies = append(bodies, titanReq)
+		}
+	case isCohereEmbeddingModel(awsModelId):
+		for start := 0; start < len(inputs); start += cohereEmbeddingBatchSize {
+			end := min(start+cohereEmbeddingBatchSize, len(inputs))
+			cohereReq := AwsCohereEmbeddingRequest{
+				Texts:          inputs[start:end],
+				InputType:      "search_document",
+				Truncate:       "END",
+				EmbeddingTypes: []string{"float"},
+			}
+			if strings.Contains(awsModelId, "embed-v4") {
+				cohereReq.OutputDimension = request.Dimensions
+			}
+			bodies = append(bodies, cohereReq)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bedrock embedding model: %s", awsModelId)
+	}
+
+	awsReqs := make([]*bedrockruntime.InvokeModelInput, 0, len(bodies))
+	for _, body := range bodies {
+		reqBody, err := common.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		awsReqs = append(awsReqs, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(awsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
+			Body:        reqBody,
+		})
+	}
+	return awsReqs, nil
+}
+
+// getInvokeInputTokenCount 读取 Bedrock 在响应头中返回的输入 token 数
+func getInvokeInputTokenCount(awsResp *bedrockruntime.InvokeModelOutput) int {
+	rawResp, ok := awsmiddleware.GetRawResponse(awsResp.ResultMetadata).(*smithyhttp.Response)
+	if !ok || rawResp == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(rawResp.Header.Get("X-Amzn-Bedrock-Input-Token-Count"))
+	return count
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReqs := a.AwsReq.([]*bedrockruntime.InvokeModelInput)
+	var embeddings [][]float64
+	promptTokens := 0
+	for _, awsReq := range awsReqs {
+		awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), awsReq)
+		if err != nil {
+			return types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, http.StatusInternalServerError), nil
+		}
+		if isTitanEmbeddingModel(aws.ToString(awsReq.ModelId)) {
+			var titanResp AwsTitanEmbeddingResponse
+			if err := common.Unmarshal(awsResp.Body, &titanResp); err != nil {
+				return types.NewOpenAIError(errors.Wrap(err, "unmarshal titan embedding response"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+			}
+			embeddings = append(embeddings, titanResp.Embedding)
+			promptTokens += titanResp.InputTextTokenCount
+		} else {
+			var cohereResp AwsCohereEmbeddingResponse
+			if err := common.Unmarshal(awsResp.Body, &cohereResp); err != nil {
+				return types.NewOpenAIError(errors.Wrap(err, "unmarshal cohere embedding response"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+			}
+			embeddings = append(embeddings, cohereResp.Embeddings.Float...)
+			promptTokens += getInvokeInputTokenCount(awsResp)
+		}
+	}
+	// 上游未返回 token 数时按本地计数计费
+	if promptTokens == 0 {
+		promptTokens = info.PromptTokens
+	}
+	usage := &dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	c.JSON(http.StatusOK, helper.BuildEmbeddingResponse(info.UpstreamModelName, embeddings, helper.GetEmbeddingEncodingFormat(info), *usage))
+	return nil, usage
+}
@@ -0,0 +1,108 @@
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertOpenAI2ConverseMergesMessagesAndTools(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	var request dto.GeneralOpenAIRequest
+	err := common.UnmarshalJsonStr(`{
+		"model": "llama3-3-70b-instruct-v1:0",
+		"max_tokens": 256,
+		"temperature": 0.2,
+		"stop": ["END"],
+		"messages": [
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": "weather?"},
+			{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "sunny"},
+			{"role": "user", "content": "thanks"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": "required",
+		"extra_body": {"guardrailConfig": {"guardrailIdentifier": "gr-1"}}
+	}`, &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{}}
+
+	params, err := convertOpenAI2Converse(ctx, info, &request)
+	if err != nil {
+		t.Fatalf("convertOpenAI2Converse returned error: %v", err)
+	}
+	if len(params.System) != 1 {
+		t.Fatalf("expected 1 system block, got %d", len(params.System))
+	}
+	// tool 结果与随后的 user 消息合并为同一条 user 消息
+	if len(params.Messages) != 3 {
+		t.Fatalf("expected 3 alternating messages, got %d", len(params.Messages))
+	}
+	if params.Messages[2].Role != bedrockruntimeTypes.ConversationRoleUser || len(params.Messages[2].Content) != 2 {
+		t.Fatalf("expected tool result merged into user message, got %+v", params.Messages[2])
+	}
+	if _, ok := params.Messages[1].Content[0].(*bedrockruntimeTypes.ContentBlockMemberToolUse); !ok {
+		t.Fatalf("expected assistant tool use block, got %T", params.Messages[1].Content[0])
+	}
+	if aws.ToInt32(params.InferenceConfig.MaxTokens) != 256 || len(params.InferenceConfig.StopSequences) != 1 {
+		t.Fatalf("unexpected inference config: %+v", params.InferenceConfig)
+	}
+	if params.ToolConfig == nil || len(params.ToolConfig.Tools) != 1 {
+		t.Fatalf("expected 1 tool, got %+v", params.ToolConfig)
+	}
+	if _, ok := params.ToolConfig.ToolChoice.(*bedrockruntimeTypes.ToolChoiceMemberAny); !ok {
+		t.Fatalf("expected tool choice any, got %T", params.ToolConfig.ToolChoice)
+	}
+	if params.Guardrail == nil || params.Guardrail.GuardrailIdentifier != "gr-1" || params.Guardrail.GuardrailVersion != "DRAFT" {
+		t.Fatalf("unexpected guardrail config: %+v", params.Guardrail)
+	}
+}
+
+func TestConverseUsageFollowsRelayFormat(t *testing.T) {
+	tokenUsage := &bedrockruntimeTypes.TokenUsage{
+		InputTokens:           aws.Int32(100),
+		OutputTokens:          aws.Int32(20),
+		CacheReadInputTokens:  aws.Int32(30),
+		CacheWriteInputTokens: aws.Int32(10),
+	}
+
+	usage := converseUsage(&relaycommon.RelayInfo{RelayFormat: types.RelayFormatOpenAI}, tokenUsage)
+	if usage.PromptTokens != 140 || usage.PromptTokensDetails.CachedTokens != 30 || usage.PromptTokensDetails.CachedCreationTokens != 10 {
+		t.Fatalf("unexpected openai usage: %+v", usage)
+	}
+
+	usage = converseUsage(&relaycommon.RelayInfo{RelayFormat: types.RelayFormatClaude}, tokenUsage)
+	if usage.PromptTokens != 100 || usage.TotalTokens != 160 {
+		t.Fatalf("unexpected claude usage: %+v", usage)
+	}
+}
+
+func TestIsClaudeModel(t *testing.T) {
+	cases := map[string]bool{
+		"claude-sonnet-4-20250514":                     true,
+		"us.anthropic.claude-3-7-sonnet-20250219-v1:0": true,
+		"nova-pro-v1:0":                                false,
+		"meta.llama3-3-70b-instruct-v1:0":              false,
+		"arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/abc": false,
+	}
+	for model, expected := range cases {
+		if isClaudeModel(model) != expected {
+			t.Fatalf("isClaudeModel(%s) expected %v", model, expected)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package aws
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+func TestBuildEmbeddingRequestsSplitsByModelFamily(t *testing.T) {
+	inputs := make([]any, 0, 100)
+	for i := 0; i < 100; i++ {
+		inputs = append(inputs, fmt.Sprintf("text %d", i))
+	}
+	request := &dto.EmbeddingRequest{Input: inputs, Dimensions: 512}
+
+	// Titan 每条文本单独请求
+	titanReqs, err := buildEmbeddingRequests("amazon.titan-embed-text-v2:0", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titanReqs) != 100 {
+		t.Fatalf("expected 100 titan requests, got %d", len(titanReqs))
+	}
+	var titanBody AwsTitanEmbeddingRequest
+	if err = common.Unmarshal(titanReqs[0].Body, &titanBody); err != nil {
+		t.Fatal(err)
+	}
+	if titanBody.InputText != "text 0" || titanBody.Dimensions != 512 || !titanBody.Normalize {
+		t.Fatalf("unexpected titan body: %+v", titanBody)
+	}
+
+	// Cohere 按 96 条分批
+	cohereReqs, err := buildEmbeddingRequests("cohere.embed-multilingual-v3", request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cohereReqs) != 2 {
+		t.Fatalf("expected 2 cohere batches, got %d", len(cohereReqs))
+	}
+	var cohereBody AwsCohereEmbeddingRequest
+	if err = common.Unmarshal(cohereReqs[1].Body, &cohereBody); err != nil {
+		t.Fatal(err)
+	}
+	if len(cohereBody.Texts) != 4 || cohereBody.OutputDimension != 0 {
+		t.Fatalf("unexpected cohere body: %+v", cohereBody)
+	}
+
+	if _, err = buildEmbeddingRequests("amazon.nova-pro-v1:0", request); err == nil {
+		t.Fatal("expected error for unsupported embedding model")
+	}
+}
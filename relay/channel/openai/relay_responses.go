@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
@@ -43,6 +45,12 @@ func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	// 写入新的 response body
 	service.IOCopyBytesGracefully(c, resp, responseBody)
 
+	if info != nil && info.ResponsesUsageInfo != nil {
+		info.ResponsesUsageInfo.ResponseId = responsesResponse.ID
+		info.ResponsesUsageInfo.ResponseStatus = responsesResponse.Status
+		info.ResponsesUsageInfo.Output = json.RawMessage(gjson.GetBytes(responseBody, "output").Raw)
+	}
+
 	// compute usage
 	usage := dto.Usage{}
 	if responsesResponse.Usage != nil {
@@ -85,6 +93,14 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 		var streamResponse dto.ResponsesStreamResponse
 		if err := common.UnmarshalJsonStr(data, &streamResponse); err == nil {
 			sendResponsesStreamData(c, streamResponse, data)
+			if streamResponse.Response != nil && info != nil && info.ResponsesUsageInfo != nil {
+				// response.created 即可拿到 id，流中断时也能记录所在渠道
+				info.ResponsesUsageInfo.ResponseId = streamResponse.Response.ID
+				info.ResponsesUsageInfo.ResponseStatus = streamResponse.Response.Status
+				if streamResponse.Type == "response.completed" {
+					info.ResponsesUsageInfo.Output = json.RawMessage(gjson.Get(data, "response.output").Raw)
+				}
+			}
 			switch streamResponse.Type {
 			case "response.completed":
 				if streamResponse.Response != nil {
@@ -75,6 +75,7 @@ type operationResponse struct {
 					URI string `json:"uri"`
 				} `json:"video"`
 			} `json:"generatedSamples"`
+			RaiMediaFilteredCount int `json:"raiMediaFilteredCount"`
 		} `json:"generateVideoResponse"`
 	} `json:"response"`
 	Error struct {
@@ -254,6 +255,13 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	ti.TaskID = taskID
 	ti.Url = fmt.Sprintf("%s/v1/videos/%s/content", system_setting.ServerAddress, taskID)
 
+	// 被安全策略过滤的视频计为失败输出，按比例退款
+	generated := op.Response.GenerateVideoResponse
+	if filtered := max(generated.RaiMediaFilteredCount, op.Response.RaiMediaFilteredCount); filtered > 0 {
+		ti.TotalOutputs = len(generated.GeneratedSamples) + filtered
+		ti.FailedOutputs = filtered
+	}
+
 	// Extract URL from generateVideoResponse if available
 	if len(op.Response.GenerateVideoResponse.GeneratedSamples) > 0 {
 		if uri := op.Response.GenerateVideoResponse.GeneratedSamples[0].Video.URI; uri != "" {
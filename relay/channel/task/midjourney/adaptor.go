@@ -0,0 +1,253 @@
+package midjourney
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaskAdaptor 通过 midjourney-proxy 提交 OpenAI 风格的异步图像任务，任务记录保存在 tasks 表中；
+// /mj 接口提交的任务保存在 midjourneys 表中，由 model.GetMidjourneyTask 统一查找
+type TaskAdaptor struct {
+	ChannelType int
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.RelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.TaskError) {
+	var req dto.ImageJobRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	action, ok := modelActions[req.Model]
+	if !ok {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("unsupported model: %s", req.Model), "invalid_model", http.StatusBadRequest)
+	}
+	if action == constant.MjActionImagine {
+		if strings.TrimSpace(req.Prompt) == "" {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("prompt is required"), "invalid_request", http.StatusBadRequest)
+		}
+	} else {
+		// 变换、放大基于已完成的图像任务，需使用原任务的渠道提交
+		if req.TaskId == "" {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("task_id is required"), "invalid_request", http.StatusBadRequest)
+		}
+		if req.Index < 1 || req.Index > 4 {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("index must be between 1 and 4"), "invalid_request", http.StatusBadRequest)
+		}
+		// 通过 /mj 接口提交的任务也可以变换、放大
+		originTask, exist, err := model.GetMidjourneyTask(info.UserId, req.TaskId)
+		if err != nil {
+			return service.TaskErrorWrapper(err, "get_origin_task_failed", http.StatusInternalServerError)
+		}
+		if !exist || originTask.Platform != constant.TaskPlatformMidjourney {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("task_origin_not_exist"), "task_not_exist", http.StatusBadRequest)
+		}
+		if setting.MjActionCheckSuccessEnabled && originTask.Status != model.TaskStatusSuccess {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("task_status_not_success"), "task_status_not_success", http.StatusBadRequest)
+		}
+		info.OriginTaskID = req.TaskId
+	}
+	info.Action = action
+	c.Set("task_request", &req)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.Action == constant.MjActionImagine {
+		return fmt.Sprintf("%s/mj/submit/imagine", info.ChannelBaseUrl), nil
+	}
+	return fmt.Sprintf("%s/mj/submit/change", info.ChannelBaseUrl), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("mj-api-secret", info.ApiKey)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
+	req, ok := c.MustGet("task_request").(*dto.ImageJobRequest)
+	if !ok {
+		return nil, fmt.Errorf("invalid task request")
+	}
+	body := map[string]any{}
+	if info.Action == constant.MjActionImagine {
+		prompt := req.Prompt
+		if setting.MjModeClearEnabled {
+			for _, mode := range []string{"--fast", "--relax", "--turbo"} {
+				prompt = strings.ReplaceAll(prompt, mode, "")
+			}
+		}
+		body["prompt"] = prompt
+		if len(req.Images) > 0 {
+			body["base64Array"] = req.Images
+		}
+	} else {
+		body["taskId"] = req.TaskId
+		body["action"] = info.Action
+		body["index"] = req.Index
+	}
+	data, err := common.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	_ = resp.Body.Close()
+
+	var mjResponse dto.MidjourneyResponse
+	if err := common.Unmarshal(responseBody, &mjResponse); err != nil {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%w, body: %s", err, responseBody), "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	// 1-提交成功，21-任务已存在，22-排队中；23-队列已满、3-无可用账号时换渠道重试
+	switch mjResponse.Code {
+	case 1, 21, 22:
+	case 3:
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%s", mjResponse.Description), "mj_no_available_instance", http.StatusServiceUnavailable)
+		return
+	case 23:
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%s", mjResponse.Description), "mj_queue_full", http.StatusTooManyRequests)
+		return
+	default:
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%s", mjResponse.Description), "mj_submit_failed", http.StatusBadRequest)
+		return
+	}
+	if mjResponse.Result == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("task_id is empty"), "invalid_response", http.StatusInternalServerError)
+		return
+	}
+
+	job := dto.NewOpenAIImageJob()
+	job.ID = mjResponse.Result
+	job.Model = info.OriginModelName
+	job.Status = dto.VideoStatusQueued
+	job.CreatedAt = time.Now().Unix()
+	c.JSON(http.StatusOK, job)
+	return mjResponse.Result, nil, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+// FetchTask 查询单个任务，由任务轮询调度逐个调用
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id")
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/mj/task/%s/fetch", baseUrl, taskID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("mj-api-secret", key)
+	return service.GetHttpClient().Do(req)
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var mjTask dto.MidjourneyDto
+	if err := common.Unmarshal(respBody, &mjTask); err != nil {
+		return nil, fmt.Errorf("unmarshal task result failed: %w", err)
+	}
+	taskResult := &relaycommon.TaskInfo{
+		TaskID:   mjTask.MjId,
+		Progress: mjTask.Progress,
+	}
+	switch mjTask.Status {
+	case "SUCCESS":
+		taskResult.Status = model.TaskStatusSuccess
+		taskResult.Url = mjTask.ImageUrl
+		taskResult.Progress = "100%"
+	case "FAILURE":
+		taskResult.Status = model.TaskStatusFailure
+		taskResult.Reason = mjTask.FailReason
+		if taskResult.Reason == "" {
+			taskResult.Reason = "task failed"
+		}
+	case "IN_PROGRESS", "MODAL":
+		taskResult.Status = model.TaskStatusInProgress
+	default:
+		taskResult.Status = model.TaskStatusSubmitted
+	}
+	return taskResult, nil
+}
+
+// ConvertToOpenAIImageJob 将任务记录转换为异步图像任务对象，结果地址替换为归档地址或 /mj/image 转发地址
+func (a *TaskAdaptor) ConvertToOpenAIImageJob(task *model.Task) ([]byte, error) {
+	job := dto.NewOpenAIImageJob()
+	job.ID = task.TaskID
+	job.Model = task.Properties.OriginModelName
+	job.Status = task.Status.ToVideoStatus()
+	if task.Status == model.TaskStatusNotStart {
+		job.Status = dto.VideoStatusQueued
+	}
+	job.SetProgressStr(task.Progress)
+	job.CreatedAt = task.CreatedAt
+	job.CompletedAt = task.FinishTime
+	job.SetMetadata("action", task.Action)
+
+	resultUrl := task.FailReason
+	service.RewriteTaskMediaURLs(task)
+	var mjTask dto.MidjourneyDto
+	if len(task.Data) > 0 {
+		_ = common.Unmarshal(task.Data, &mjTask)
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		imageUrl := task.FailReason
+		// 未归档的结果按 /mj 接口的设置经由本站转发
+		if setting.MjForwardUrlEnabled && imageUrl != "" && imageUrl == resultUrl {
+			imageUrl = system_setting.ServerAddress + "/mj/image/" + task.TaskID
+		}
+		if imageUrl != "" {
+			job.Data = []dto.OpenAIImageJobData{{Url: imageUrl}}
+		}
+	case model.TaskStatusFailure:
+		job.Error = &dto.OpenAIVideoError{
+			Message: task.FailReason,
+			Code:    "task_failed",
+		}
+	}
+	if mjTask.PromptEn != "" {
+		job.SetMetadata("prompt_en", mjTask.PromptEn)
+	}
+	if mjTask.Buttons != nil {
+		job.SetMetadata("buttons", mjTask.Buttons)
+	}
+	return common.Marshal(job)
+}
@@ -0,0 +1,85 @@
+package midjourney
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+func TestParseTaskResult(t *testing.T) {
+	a := &TaskAdaptor{}
+	cases := []struct {
+		body     string
+		status   string
+		url      string
+		progress string
+	}{
+		{`{"id":"1","status":"NOT_START","progress":"0%"}`, model.TaskStatusSubmitted, "", "0%"},
+		{`{"id":"1","status":"IN_PROGRESS","progress":"40%","imageUrl":"https://cdn/preview.png"}`, model.TaskStatusInProgress, "", "40%"},
+		{`{"id":"1","status":"SUCCESS","progress":"100%","imageUrl":"https://cdn/1.png"}`, model.TaskStatusSuccess, "https://cdn/1.png", "100%"},
+		{`{"id":"1","status":"FAILURE","failReason":"banned prompt"}`, model.TaskStatusFailure, "", ""},
+	}
+	for _, tc := range cases {
+		info, err := a.ParseTaskResult([]byte(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Status != tc.status || info.Url != tc.url || info.Progress != tc.progress {
+			t.Errorf("%s: unexpected task info %+v", tc.body, info)
+		}
+	}
+	if info, _ := a.ParseTaskResult([]byte(cases[3].body)); info.Reason != "banned prompt" {
+		t.Errorf("expected fail reason, got %q", info.Reason)
+	}
+}
+
+func TestConvertToOpenAIImageJob(t *testing.T) {
+	originalForward, originalAddress := setting.MjForwardUrlEnabled, system_setting.ServerAddress
+	t.Cleanup(func() {
+		setting.MjForwardUrlEnabled = originalForward
+		system_setting.ServerAddress = originalAddress
+	})
+	setting.MjForwardUrlEnabled = true
+	system_setting.ServerAddress = "https://api.example.com"
+
+	task := &model.Task{
+		TaskID:     "mj_1",
+		Platform:   "mj",
+		Action:     "IMAGINE",
+		Status:     model.TaskStatusSuccess,
+		Progress:   "100%",
+		FailReason: "https://cdn/1.png",
+		Data:       []byte(`{"id":"mj_1","imageUrl":"https://cdn/1.png","promptEn":"a cat","buttons":[{"customId":"MJ::JOB::upsample::1"}]}`),
+	}
+	task.Properties.OriginModelName = "mj_imagine"
+	body, err := (&TaskAdaptor{}).ConvertToOpenAIImageJob(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job dto.OpenAIImageJob
+	if err := common.Unmarshal(body, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "mj_1" || job.Object != "image.job" || job.Model != "mj_imagine" || job.Status != dto.VideoStatusCompleted || job.Progress != 100 {
+		t.Fatalf("unexpected job: %s", body)
+	}
+	// 未归档的结果经由 /mj/image 转发
+	if len(job.Data) != 1 || job.Data[0].Url != "https://api.example.com/mj/image/mj_1" {
+		t.Fatalf("unexpected job data: %+v", job.Data)
+	}
+	if job.Metadata["prompt_en"] != "a cat" || job.Metadata["buttons"] == nil {
+		t.Fatalf("unexpected metadata: %+v", job.Metadata)
+	}
+
+	task.Status, task.FailReason = model.TaskStatusFailure, "banned prompt"
+	body, _ = (&TaskAdaptor{}).ConvertToOpenAIImageJob(task)
+	job = dto.OpenAIImageJob{}
+	_ = common.Unmarshal(body, &job)
+	if job.Status != dto.VideoStatusFailed || job.Error == nil || job.Error.Message != "banned prompt" || len(job.Data) != 0 {
+		t.Fatalf("unexpected failed job: %s", body)
+	}
+}
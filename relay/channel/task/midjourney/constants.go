@@ -0,0 +1,18 @@
+package midjourney
+
+import "github.com/QuantumNous/new-api/constant"
+
+var ModelList = []string{
+	"mj_imagine",
+	"mj_variation",
+	"mj_upscale",
+}
+
+var ChannelName = "midjourney"
+
+// modelActions 异步图像任务的模型对应的 Midjourney 操作
+var modelActions = map[string]string{
+	"mj_imagine":   constant.MjActionImagine,
+	"mj_variation": constant.MjActionVariation,
+	"mj_upscale":   constant.MjActionUpscale,
+}
@@ -257,6 +257,11 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	}
 	ti.Status = model.TaskStatusSuccess
 	ti.Progress = "100%"
+	// 被安全策略过滤的视频计为失败输出，按比例退款
+	if filtered := op.Response.RaiMediaFilteredCount; filtered > 0 {
+		ti.TotalOutputs = len(op.Response.Videos) + filtered
+		ti.FailedOutputs = filtered
+	}
 	if len(op.Response.Videos) > 0 {
 		v0 := op.Response.Videos[0]
 		if v0.BytesBase64Encoded != "" {
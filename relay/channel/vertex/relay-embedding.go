@@ -0,0 +1,130 @@
+package vertex
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isSingleInstanceEmbeddingModel gemini-embedding 系列在 Vertex 上每次请求只接受一条文本
+func isSingleInstanceEmbeddingModel(modelName string) bool {
+	return strings.HasPrefix(modelName, "gemini-embedding")
+}
+
+func convertEmbeddingRequest(request dto.EmbeddingRequest) (*VertexEmbeddingRequest, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	vertexRequest := &VertexEmbeddingRequest{
+		Instances: make([]VertexEmbeddingInstance, 0, len(inputs)),
+		Parameters: VertexEmbeddingParameters{
+			AutoTruncate:         true,
+			OutputDimensionality: request.Dimensions,
+		},
+	}
+	for _, input := range inputs {
+		vertexRequest.Instances = append(vertexRequest.Instances, VertexEmbeddingInstance{
+			Content:  input,
+			TaskType: "RETRIEVAL_DOCUMENT",
+		})
+	}
+	return vertexRequest, nil
+}
+
+// doEmbeddingRequest 对只接受单条文本的模型逐条请求，并将结果合并为一个响应
+func doEmbeddingRequest(a *Adaptor, c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	if !isSingleInstanceEmbeddingModel(info.UpstreamModelName) {
+		return channel.DoApiRequest(a, c, info, requestBody)
+	}
+	var vertexRequest VertexEmbeddingRequest
+	if err := common.DecodeJson(requestBody, &vertexRequest); err != nil {
+		return nil, err
+	}
+	merged := VertexEmbeddingResponse{Predictions: make([]VertexEmbeddingPrediction, 0, len(vertexRequest.Instances))}
+	var header http.Header
+	for _, instance := range vertexRequest.Instances {
+		body, err := common.Marshal(VertexEmbeddingRequest{
+			Instances:  []VertexEmbeddingInstance{instance},
+			Parameters: vertexRequest.Parameters,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := channel.DoApiRequest(a, c, info, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		// 上游报错时直接返回该响应，由调用方统一处理错误
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		service.CloseResponseBodyGracefully(resp)
+		if err != nil {
+			return nil, err
+		}
+		var vertexResponse VertexEmbeddingResponse
+		if err = common.Unmarshal(responseBody, &vertexResponse); err != nil {
+			return nil, err
+		}
+		merged.Predictions = append(merged.Predictions, vertexResponse.Predictions...)
+		header = resp.Header
+	}
+	mergedBody, err := common.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(mergedBody)),
+	}, nil
+}
+
+func vertexEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	var vertexResponse VertexEmbeddingResponse
+	if err = common.Unmarshal(responseBody, &vertexResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	embeddings := make([][]float64, 0, len(vertexResponse.Predictions))
+	promptTokens := 0
+	for _, prediction := range vertexResponse.Predictions {
+		embeddings = append(embeddings, prediction.Embeddings.Values)
+		promptTokens += int(prediction.Embeddings.Statistics.TokenCount)
+	}
+	// 上游未返回 token 数时按本地计数计费
+	if promptTokens == 0 {
+		promptTokens = info.PromptTokens
+	}
+	usage := &dto.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+
+	jsonResponse, err := common.Marshal(helper.BuildEmbeddingResponse(info.UpstreamModelName, embeddings, helper.GetEmbeddingEncodingFormat(info), *usage))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, resp, jsonResponse)
+	return usage, nil
+}
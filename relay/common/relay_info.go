@@ -51,6 +51,10 @@ type BuildInToolInfo struct {
 
 type ResponsesUsageInfo struct {
 	BuiltInTools map[string]*BuildInToolInfo
+	// 上游返回的 response id、状态与输出项，用于记录 response 所在渠道及本地保存
+	ResponseId     string
+	ResponseStatus string
+	Output         json.RawMessage
 }
 
 type ChannelMeta struct {
@@ -91,6 +95,7 @@ type RelayInfo struct {
 	UsePrice               bool
 	RelayMode              int
 	OriginModelName        string
+	FallbackFromModel      string // 触发模型回退时记录客户端请求的原模型，OriginModelName 为实际服务的模型
 	RequestURLPath         string
 	PromptTokens           int
 	ShouldIncludeUsage     bool
@@ -100,6 +105,8 @@ type RelayInfo struct {
 	InputAudioFormat       string
 	OutputAudioFormat      string
 	RealtimeTools          []dto.RealTimeTool
+	RealtimeQuota          int // 实时会话中各次响应按长上下文分档实际扣除的额度合计
+	RealtimeMaxInputTokens int // 实时会话中单次响应的最大输入 token 数，用于记录命中的最高分档
 	IsFirstRequest         bool
 	AudioUsage             bool
 	ReasoningEffort        string
@@ -566,6 +573,8 @@ type TaskInfo struct {
 	Progress         string `json:"progress,omitempty"`
 	CompletionTokens int    `json:"completion_tokens,omitempty"` // 用于按倍率计费
 	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	TotalOutputs     int    `json:"total_outputs,omitempty"`     // 多输出任务的输出总数，用于部分退款
+	FailedOutputs    int    `json:"failed_outputs,omitempty"`    // 多输出任务中失败（如被安全策略过滤）的输出数
 }
 
 func FailTaskInfo(reason string) *TaskInfo {
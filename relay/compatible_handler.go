@@ -198,6 +198,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		extraContent += "（可能是请求出错）"
 	}
+	service.ApplyContextTierPricing(relayInfo, usage.PromptTokens)
 	useSubscriptionQuota := service.ShouldUseSubscriptionQuota(relayInfo)
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
@@ -410,6 +411,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 	}
 
+	service.RecordChannelKeyConsume(relayInfo, promptTokens+completionTokens, quota)
+
 	logModel := modelName
 	if strings.HasPrefix(logModel, "gpt-4-gizmo") {
 		logModel = "gpt-4-gizmo-*"
@@ -479,6 +482,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		Group:            relayInfo.UsingGroup,
 		Other:            other,
 	})
+	service.RecordChannelCacheUsage(relayInfo.ChannelId, promptTokens, cacheTokens)
 	if err := service.SettleUsageReservation(relayInfo, totalTokens, quota); err != nil {
 		logger.LogError(ctx, "settle usage reservation failed: "+err.Error())
 	}
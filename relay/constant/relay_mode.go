@@ -50,6 +50,9 @@ const (
 	RelayModeRealtime
 
 	RelayModeGemini
+
+	RelayModeImageJobFetchByID
+	RelayModeImageJobSubmit
 )
 
 func Path2RelayMode(path string) int {
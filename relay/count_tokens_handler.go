@@ -0,0 +1,129 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// fixedURLAdaptor 复用渠道适配器的鉴权请求头，仅将请求地址替换为指定的上游接口
+type fixedURLAdaptor struct {
+	channel.Adaptor
+	requestURL string
+}
+
+func (a *fixedURLAdaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return a.requestURL, nil
+}
+
+// getUpstreamCountTokensURL 仅原生渠道（格式与请求一致）支持转发计数请求，其余返回空字符串
+func getUpstreamCountTokensURL(info *relaycommon.RelayInfo) string {
+	switch {
+	case info.RelayFormat == types.RelayFormatClaude && info.ChannelType == constant.ChannelTypeAnthropic:
+		return fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl)
+	case info.RelayFormat == types.RelayFormatGemini && info.ChannelType == constant.ChannelTypeGemini:
+		version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+		return fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName)
+	case info.RelayFormat == types.RelayFormatOpenAIResponses && info.ChannelType == constant.ChannelTypeOpenAI:
+		return fmt.Sprintf("%s/v1/responses/input_tokens", info.ChannelBaseUrl)
+	default:
+		return ""
+	}
+}
+
+// CountTokensHelper 处理 token 计数请求：渠道支持时转发上游，否则本地计算；计数请求不扣费
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	info.InitChannelMeta(c)
+
+	// 计数请求不会重试或回退，可直接在原请求上替换模型
+	request := info.Request
+	err := helper.ModelMappedHelper(c, info, request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	if requestURL := getUpstreamCountTokensURL(info); requestURL != "" {
+		err = forwardCountTokensRequest(c, info, requestURL)
+		if err == nil {
+			return nil
+		}
+		logger.LogWarn(c, fmt.Sprintf("upstream count tokens failed, fallback to local count: %s", err.Error()))
+	}
+
+	tokens, err := countTokensLocally(c, info, request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeCountTokenFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	case types.RelayFormatGemini:
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	default:
+		c.JSON(http.StatusOK, dto.OpenAIResponsesInputTokensResponse{
+			Object:      "response.input_tokens",
+			InputTokens: tokens,
+		})
+	}
+	return nil
+}
+
+// forwardCountTokensRequest 将计数请求转发到上游，成功时原样返回上游响应；返回错误时由调用方改为本地计算
+func forwardCountTokensRequest(c *gin.Context, info *relaycommon.RelayInfo, requestURL string) error {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	// Gemini 的模型在路径中，其余格式需要将请求体中的模型替换为映射后的模型
+	if info.IsModelMapped && info.RelayFormat != types.RelayFormatGemini {
+		requestBody, err = sjson.SetBytes(requestBody, "model", info.UpstreamModelName)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := channel.DoApiRequest(&fixedURLAdaptor{Adaptor: adaptor, requestURL: requestURL}, c, info, bytes.NewReader(requestBody))
+	if err != nil {
+		return err
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, string(responseBody))
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return nil
+}
+
+func countTokensLocally(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	if claudeRequest, ok := request.(*dto.ClaudeRequest); ok {
+		return service.CountTokenClaudeRequest(*claudeRequest, info.UpstreamModelName)
+	}
+	return service.CountRequestToken(c, request.GetTokenCountMeta(), info)
+}
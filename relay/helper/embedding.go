@@ -0,0 +1,51 @@
+package helper
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+const embeddingEncodingFormatBase64 = "base64"
+
+// GetEmbeddingEncodingFormat 返回嵌入请求的 encoding_format，未指定时为 float
+func GetEmbeddingEncodingFormat(info *relaycommon.RelayInfo) string {
+	if request, ok := info.Request.(*dto.EmbeddingRequest); ok && request.EncodingFormat != "" {
+		return request.EncodingFormat
+	}
+	return "float"
+}
+
+// EncodeEmbeddingBase64 按 OpenAI 的约定将向量编码为小端 float32 序列的 base64
+func EncodeEmbeddingBase64(embedding []float64) string {
+	buf := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// BuildEmbeddingResponse 将上游返回的向量组装为 OpenAI 格式的嵌入响应
+func BuildEmbeddingResponse(model string, embeddings [][]float64, encodingFormat string, usage dto.Usage) *dto.FlexibleEmbeddingResponse {
+	response := &dto.FlexibleEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.FlexibleEmbeddingResponseItem, 0, len(embeddings)),
+		Model:  model,
+		Usage:  usage,
+	}
+	for i, embedding := range embeddings {
+		var value any = embedding
+		if encodingFormat == embeddingEncodingFormatBase64 {
+			value = EncodeEmbeddingBase64(embedding)
+		}
+		response.Data = append(response.Data, dto.FlexibleEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: value,
+		})
+	}
+	return response
+}
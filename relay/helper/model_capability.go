@@ -0,0 +1,86 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestWantsReasoning 判断请求是否显式要求推理/思考能力
+func requestWantsReasoning(request dto.Request) bool {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		return r.ReasoningEffort != "" && r.ReasoningEffort != "none"
+	case *dto.OpenAIResponsesRequest:
+		return r.Reasoning != nil && r.Reasoning.Effort != "" && r.Reasoning.Effort != "none"
+	case *dto.ClaudeRequest:
+		return r.Thinking != nil && r.Thinking.Type == "enabled"
+	case *dto.GeminiChatRequest:
+		tc := r.GenerationConfig.ThinkingConfig
+		return tc != nil && (tc.IncludeThoughts || (tc.ThinkingBudget != nil && *tc.ThinkingBudget > 0))
+	}
+	return false
+}
+
+func newCapabilityError(err error, code types.ErrorCode) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(err, code, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// validateModelCapability 根据模型能力元数据校验请求，并记录请求的能力要求供渠道选择使用
+func validateModelCapability(c *gin.Context, request dto.Request) error {
+	if request == nil || !model.HasModelCapabilityMetadata() {
+		return nil
+	}
+	meta := request.GetTokenCountMeta()
+	requirement := types.NewModelCapabilityRequirement(meta, requestWantsReasoning(request))
+	if !requirement.IsEmpty() {
+		common.SetContextKey(c, constant.ContextKeyModelCapabilityRequirement, requirement)
+	}
+
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	capability, ok := model.GetModelCapability(modelName)
+	if !ok {
+		return nil
+	}
+	if missing := capability.Unsatisfied(requirement); missing != "" {
+		return newCapabilityError(fmt.Errorf("model %s does not support %s", modelName, missing), types.ErrorCodeModelCapabilityUnsupported)
+	}
+	if meta != nil && capability.MaxOutputTokens > 0 && meta.MaxTokens > capability.MaxOutputTokens {
+		return newCapabilityError(fmt.Errorf("max_tokens is too large: %d. This model supports at most %d completion tokens", meta.MaxTokens, capability.MaxOutputTokens), types.ErrorCodeContextLengthExceeded)
+	}
+	return nil
+}
+
+// ValidateContextWindow 在预扣费之前校验提示词长度是否超出模型上下文窗口
+func ValidateContextWindow(info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) *types.NewAPIError {
+	if promptTokens <= 0 {
+		return nil
+	}
+	capability, ok := model.GetModelCapability(info.OriginModelName)
+	if !ok || capability.ContextLength <= 0 {
+		return nil
+	}
+	requested := promptTokens
+	if meta != nil && meta.MaxTokens > 0 {
+		requested += meta.MaxTokens
+	}
+	if requested <= capability.ContextLength {
+		return nil
+	}
+	var detail strings.Builder
+	detail.WriteString(fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages", capability.ContextLength, requested, promptTokens))
+	if meta != nil && meta.MaxTokens > 0 {
+		detail.WriteString(fmt.Sprintf(", %d in the completion", meta.MaxTokens))
+	}
+	detail.WriteString("). Please reduce the length of the messages or completion.")
+	return newCapabilityError(fmt.Errorf("%s", detail.String()), types.ErrorCodeContextLengthExceeded)
+}
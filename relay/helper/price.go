@@ -2,6 +2,7 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -44,6 +45,13 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// apply time-of-day pricing window of the using group
+	if multiplier, window := ratio_setting.GetGroupPricingMultiplier(relayInfo.UsingGroup, time.Now()); window != nil {
+		groupRatioInfo.GroupRatio *= multiplier
+		groupRatioInfo.TimeMultiplier = multiplier
+		groupRatioInfo.TimeWindow = window.Name
+	}
+
 	return groupRatioInfo
 }
 
@@ -63,6 +71,9 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var audioRatio float64
 	var audioCompletionRatio float64
 	var freeModel bool
+	var contextTier int
+	var contextTierThreshold int
+	var baseTierRatios *types.ContextTierRatios
 	if !usePrice {
 		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
 		if meta.MaxTokens != 0 {
@@ -89,6 +100,23 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
+		// 长上下文分档：预扣阶段按估算的提示 token 选档，结算时按实际用量重新选档
+		baseTierRatios = &types.ContextTierRatios{
+			ModelRatio:           modelRatio,
+			CompletionRatio:      completionRatio,
+			CacheRatio:           cacheRatio,
+			CacheCreationRatio:   cacheCreationRatio,
+			CacheCreation5mRatio: cacheCreationRatio5m,
+			CacheCreation1hRatio: cacheCreationRatio1h,
+		}
+		var tierRatios types.ContextTierRatios
+		tierRatios, contextTier, contextTierThreshold = ratio_setting.SelectContextTier(info.OriginModelName, promptTokens, *baseTierRatios)
+		modelRatio = tierRatios.ModelRatio
+		completionRatio = tierRatios.CompletionRatio
+		cacheRatio = tierRatios.CacheRatio
+		cacheCreationRatio = tierRatios.CacheCreationRatio
+		cacheCreationRatio5m = tierRatios.CacheCreation5mRatio
+		cacheCreationRatio1h = tierRatios.CacheCreation1hRatio
 		ratio := types.ModelRatioTokenQuotaRatio(
 			modelRatio,
 			common.QuotaPerUnit,
@@ -132,6 +160,10 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
+		ContextTier:          contextTier,
+		ContextTierThreshold: contextTierThreshold,
+		BaseTierRatios:       baseTierRatios,
+		PriceBookVersion:     ratio_setting.GetActivePriceBookVersion(),
 	}
 
 	if common.DebugEnabled {
@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetAndValidateGeminiCountTokensRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		body     string
+		contents int
+		wantErr  bool
+	}{
+		{name: "contents", body: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`, contents: 1},
+		{name: "generate content request", body: `{"generateContentRequest":{"model":"models/gemini-2.5-flash","contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"hello"}]}]}}`, contents: 2},
+		{name: "empty", body: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.5-flash:countTokens", strings.NewReader(tt.body))
+			ctx.Request.Header.Set("Content-Type", "application/json")
+
+			request, err := GetAndValidateGeminiCountTokensRequest(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(request.Contents) != tt.contents {
+				t.Fatalf("expected %d contents, got %d", tt.contents, len(request.Contents))
+			}
+		})
+	}
+}
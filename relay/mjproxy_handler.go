@@ -27,15 +27,22 @@ import (
 
 func RelayMidjourneyImage(c *gin.Context) {
 	taskId := c.Param("id")
-	midjourneyTask := model.GetByOnlyMJId(taskId)
-	if midjourneyTask == nil {
+	var imageUrl string
+	var channelId int
+	if midjourneyTask := model.GetByOnlyMJId(taskId); midjourneyTask != nil {
+		imageUrl, channelId = midjourneyTask.ImageUrl, midjourneyTask.ChannelId
+	} else if task, exist, _ := model.GetByOnlyTaskId(taskId); exist && task.Platform == constant.TaskPlatformMidjourney {
+		// 通过 /v1/images/jobs 提交的任务，结果地址保存在 FailReason 中
+		imageUrl, channelId = task.FailReason, task.ChannelId
+	}
+	if imageUrl == "" {
 		c.JSON(400, gin.H{
 			"error": "midjourney_task_not_found",
 		})
 		return
 	}
 	var httpClient *http.Client
-	if channel, err := model.CacheGetChannel(midjourneyTask.ChannelId); err == nil {
+	if channel, err := model.CacheGetChannel(channelId); err == nil {
 		proxy := channel.GetSetting().Proxy
 		if proxy != "" {
 			if httpClient, err = service.NewProxyHttpClient(proxy); err != nil {
@@ -49,7 +56,7 @@ func RelayMidjourneyImage(c *gin.Context) {
 	if httpClient == nil {
 		httpClient = service.GetHttpClient()
 	}
-	resp, err := httpClient.Get(midjourneyTask.ImageUrl)
+	resp, err := httpClient.Get(imageUrl)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "http_get_image_failed",
@@ -132,7 +139,9 @@ func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjo
 	midjourneyTask.StartTime = originTask.StartTime
 	midjourneyTask.FinishTime = originTask.FinishTime
 	midjourneyTask.ImageUrl = ""
-	if originTask.ImageUrl != "" && setting.MjForwardUrlEnabled {
+	// 已归档的结果直接使用签名网关地址，不再经过 /mj/image 转发
+	imageArchived := service.RewriteMidjourneyMediaURLs(originTask)
+	if originTask.ImageUrl != "" && setting.MjForwardUrlEnabled && !imageArchived {
 		midjourneyTask.ImageUrl = system_setting.ServerAddress + "/mj/image/" + originTask.MjId
 		if originTask.Status != "SUCCESS" {
 			midjourneyTask.ImageUrl += "?rand=" + strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -173,8 +182,13 @@ func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjo
 }
 
 func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyResponse {
+	// 任务状态回调，需在读取请求体之前解析并移除回调字段
+	callbackUrl, callbackSecret, err := service.ResolveTaskCallback(c)
+	if err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "invalid_callback: "+err.Error())
+	}
 	var swapFaceRequest dto.SwapFaceRequest
-	err := common.UnmarshalBodyReusable(c, &swapFaceRequest)
+	err = common.UnmarshalBodyReusable(c, &swapFaceRequest)
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
 	}
@@ -215,6 +229,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 			if err != nil {
 				common.SysLog("error consuming token remain quota: " + err.Error())
 			}
+			service.RecordChannelKeyConsume(info, 0, priceData.Quota)
 
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionSwapFace)
@@ -253,6 +268,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
 	}
+	midjourneyTask.CallbackUrl, midjourneyTask.CallbackSecret = callbackUrl, callbackSecret
 	err = midjourneyTask.Insert()
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
@@ -369,8 +385,13 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 
 func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.MidjourneyResponse {
 	consumeQuota := true
+	// 任务状态回调，需在读取请求体之前解析并移除回调字段
+	callbackUrl, callbackSecret, err := service.ResolveTaskCallback(c)
+	if err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "invalid_callback: "+err.Error())
+	}
 	var midjRequest dto.MidjourneyRequest
-	err := common.UnmarshalBodyReusable(c, &midjRequest)
+	err = common.UnmarshalBodyReusable(c, &midjRequest)
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
 	}
@@ -516,6 +537,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			if err != nil {
 				common.SysLog("error consuming token remain quota: " + err.Error())
 			}
+			service.RecordChannelKeyConsume(relayInfo, 0, priceData.Quota)
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
 			other := service.GenerateMjOtherInfo(relayInfo, priceData)
@@ -560,6 +582,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
 	}
+	midjourneyTask.CallbackUrl, midjourneyTask.CallbackSecret = callbackUrl, callbackSecret
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
 		channel, err := model.GetChannelById(midjourneyTask.ChannelId, true)
@@ -610,6 +633,10 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			Description: "insert_midjourney_task_failed",
 		}
 	}
+	// 提交时即已完成的任务（上传、已有结果）不会再被轮询，在此发送状态回调
+	if midjourneyTask.Status == "SUCCESS" {
+		service.NotifyMidjourneyTaskStatusChanged(midjourneyTask)
+	}
 
 	if midjResponse.Code == 22 { //22-排队中，说明任务已存在
 		//修改返回值
@@ -35,6 +35,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/task/hailuo"
 	taskjimeng "github.com/QuantumNous/new-api/relay/channel/task/jimeng"
 	"github.com/QuantumNous/new-api/relay/channel/task/kling"
+	taskmidjourney "github.com/QuantumNous/new-api/relay/channel/task/midjourney"
 	tasksora "github.com/QuantumNous/new-api/relay/channel/task/sora"
 	"github.com/QuantumNous/new-api/relay/channel/task/suno"
 	taskvertex "github.com/QuantumNous/new-api/relay/channel/task/vertex"
@@ -123,6 +124,10 @@ func GetAdaptor(apiType int) channel.Adaptor {
 
 func GetTaskPlatform(c *gin.Context) constant.TaskPlatform {
 	channelType := c.GetInt("channel_type")
+	// Midjourney 渠道的异步图像任务单独归为 mj 平台，由任务轮询逐个拉取
+	if channelType == constant.ChannelTypeMidjourney || channelType == constant.ChannelTypeMidjourneyPlus {
+		return constant.TaskPlatformMidjourney
+	}
 	if channelType > 0 {
 		return constant.TaskPlatform(strconv.Itoa(channelType))
 	}
@@ -135,6 +140,8 @@ func GetTaskAdaptor(platform constant.TaskPlatform) channel.TaskAdaptor {
 	//	return &aiproxy.Adaptor{}
 	case constant.TaskPlatformSuno:
 		return &suno.TaskAdaptor{}
+	case constant.TaskPlatformMidjourney:
+		return &taskmidjourney.TaskAdaptor{}
 	}
 	if channelType, err := strconv.ParseInt(string(platform), 10, 64); err == nil {
 		switch channelType {
@@ -13,10 +13,12 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
@@ -43,6 +45,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid api platform: %s", platform), "invalid_api_platform", http.StatusBadRequest)
 	}
 	adaptor.Init(info)
+	// 任务状态回调，需在适配器读取请求体之前解析并移除回调字段
+	callbackUrl, callbackSecret, err := service.ResolveTaskCallback(c)
+	if err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_callback", http.StatusBadRequest)
+	}
 	// get & validate taskRequest 获取并验证文本请求
 	taskErr = adaptor.ValidateRequestAndSetAction(c, info)
 	if taskErr != nil {
@@ -64,14 +71,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	}
 
 	// 预扣
-	groupRatio := ratio_setting.GetGroupRatio(info.UsingGroup)
-	var ratio float64
-	userGroupRatio, hasUserGroupRatio := ratio_setting.GetGroupGroupRatio(info.UserGroup, info.UsingGroup)
-	if hasUserGroupRatio {
-		ratio = modelPrice * userGroupRatio
-	} else {
-		ratio = modelPrice * groupRatio
-	}
+	// 分组倍率已包含分组分时倍率
+	groupRatioInfo := helper.HandleGroupRatio(c, info)
+	info.PriceData.GroupRatioInfo = groupRatioInfo
+	ratio := modelPrice * groupRatioInfo.GroupRatio
 	// FIXME: 临时修补，支持任务仅按次计费
 	if !common.StringsContains(constant.TaskPricePatches, modelName) {
 		if len(info.PriceData.OtherRatios) > 0 {
@@ -82,7 +85,8 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			}
 		}
 	}
-	println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
+	logger.LogDebug(c, fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, time_window: %s, time_multiplier: %.4f, final_ratio: %.4f",
+		modelName, modelPrice, info.UsingGroup, groupRatioInfo.GroupRatio, groupRatioInfo.TimeWindow, groupRatioInfo.TimeMultiplier, ratio))
 	userQuota, err := model.GetUserQuota(info.UserId, false)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -95,7 +99,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	}
 
 	if info.OriginTaskID != "" {
-		originTask, exist, err := model.GetByTaskId(info.UserId, info.OriginTaskID)
+		getOriginTask := model.GetByTaskId
+		if platform == constant.TaskPlatformMidjourney {
+			getOriginTask = model.GetMidjourneyTask
+		}
+		originTask, exist, err := getOriginTask(info.UserId, info.OriginTaskID)
 		if err != nil {
 			taskErr = service.TaskErrorWrapper(err, "get_origin_task_failed", http.StatusInternalServerError)
 			return
@@ -119,6 +127,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 
 			info.ChannelBaseUrl = channel.GetBaseURL()
 			info.ChannelId = originTask.ChannelId
+			info.ApiKey = channel.Key
 		}
 	}
 
@@ -149,6 +158,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			if err != nil {
 				common.SysLog("error consuming token remain quota: " + err.Error())
 			}
+			service.RecordChannelKeyConsume(info, 0, quota)
 			if quota != 0 {
 				tokenName := c.GetString("token_name")
 				//gRatio := groupRatio
@@ -177,10 +187,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 					other["request_path"] = c.Request.URL.Path
 				}
 				other["model_price"] = modelPrice
-				other["group_ratio"] = groupRatio
-				if hasUserGroupRatio {
-					other["user_group_ratio"] = userGroupRatio
+				other["group_ratio"] = groupRatioInfo.GroupRatio
+				if groupRatioInfo.HasSpecialRatio {
+					other["user_group_ratio"] = groupRatioInfo.GroupSpecialRatio
 				}
+				service.AppendGroupTimeWindow(groupRatioInfo, other)
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
 					ChannelId: info.ChannelId,
 					ModelName: modelName,
@@ -208,6 +219,8 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	task.Quota = quota
 	task.Data = taskData
 	task.Action = info.Action
+	task.PrivateData.CallbackUrl = callbackUrl
+	task.PrivateData.CallbackSecret = callbackSecret
 	err = task.Insert()
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
@@ -217,9 +230,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 }
 
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
-	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
-	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
-	relayconstant.RelayModeVideoFetchByID: videoFetchByIDRespBodyBuilder,
+	relayconstant.RelayModeSunoFetchByID:     sunoFetchByIDRespBodyBuilder,
+	relayconstant.RelayModeSunoFetch:         sunoFetchRespBodyBuilder,
+	relayconstant.RelayModeVideoFetchByID:    videoFetchByIDRespBodyBuilder,
+	relayconstant.RelayModeImageJobFetchByID: imageJobFetchByIDRespBodyBuilder,
 }
 
 func RelayTaskFetch(c *gin.Context, relayMode int) (taskResp *dto.TaskError) {
@@ -264,6 +278,7 @@ func sunoFetchRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dto.Ta
 			return
 		}
 		for _, task := range taskModels {
+			service.RewriteTaskMediaURLs(task)
 			tasks = append(tasks, TaskModel2Dto(task))
 		}
 	} else {
@@ -289,6 +304,7 @@ func sunoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dt
 		taskResp = service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusBadRequest)
 		return
 	}
+	service.RewriteTaskMediaURLs(originTask)
 
 	respBody, err = json.Marshal(dto.TaskResponse[any]{
 		Code: "success",
@@ -297,6 +313,10 @@ func sunoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dt
 	return
 }
 
+func isTaskFinished(status model.TaskStatus) bool {
+	return status == model.TaskStatusSuccess || status == model.TaskStatusFailure
+}
+
 func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dto.TaskError) {
 	taskId := c.Param("task_id")
 	if taskId == "" {
@@ -344,19 +364,26 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		}
 		ti, err2 := adaptor.ParseTaskResult(body)
 		if err2 == nil && ti != nil {
-			if ti.Status != "" {
-				originTask.Status = model.TaskStatus(ti.Status)
-			}
-			if ti.Progress != "" {
-				originTask.Progress = ti.Progress
-			}
-			if ti.Url != "" {
-				if strings.HasPrefix(ti.Url, "data:") {
-				} else {
-					originTask.FailReason = ti.Url
+			// 已结束的任务保持原状；未结束的任务进入成功或失败时只返回最新状态，
+			// 落库与结算、归档、回调由轮询任务在状态变化时完成，避免重复查询时重复结算
+			if !isTaskFinished(originTask.Status) {
+				if ti.Status != "" {
+					originTask.Status = model.TaskStatus(ti.Status)
+				}
+				if ti.Progress != "" {
+					originTask.Progress = ti.Progress
+				}
+				if ti.Url != "" {
+					if strings.HasPrefix(ti.Url, "data:") {
+					} else {
+						originTask.FailReason = ti.Url
+					}
+				}
+				if !isTaskFinished(originTask.Status) {
+					_ = originTask.Update()
 				}
 			}
-			_ = originTask.Update()
+			service.RewriteTaskMediaURLs(originTask)
 			var raw map[string]any
 			_ = json.Unmarshal(body, &raw)
 			format := "mp4"
@@ -402,6 +429,7 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 	if len(respBody) != 0 {
 		return
 	}
+	service.RewriteTaskMediaURLs(originTask)
 
 	if strings.HasPrefix(c.Request.RequestURI, "/v1/videos/") {
 		adaptor := GetTaskAdaptor(originTask.Platform)
@@ -431,6 +459,33 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 	return
 }
 
+func imageJobFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *dto.TaskError) {
+	taskId := c.Param("task_id")
+	userId := c.GetInt("id")
+
+	originTask, exist, err := model.GetMidjourneyTask(userId, taskId)
+	if err != nil {
+		taskResp = service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+		return
+	}
+	if !exist {
+		taskResp = service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusBadRequest)
+		return
+	}
+
+	// 归档地址的替换由转换器处理，未归档的结果可能需要经由本站转发
+	adaptor := GetTaskAdaptor(originTask.Platform)
+	if converter, ok := adaptor.(channel.OpenAIImageJobConverter); ok {
+		respBody, err = converter.ConvertToOpenAIImageJob(originTask)
+		if err != nil {
+			taskResp = service.TaskErrorWrapper(err, "convert_to_openai_image_job_failed", http.StatusInternalServerError)
+		}
+		return
+	}
+	taskResp = service.TaskErrorWrapperLocal(fmt.Errorf("not_implemented:%s", originTask.Platform), "not_implemented", http.StatusNotImplemented)
+	return
+}
+
 func TaskModel2Dto(task *model.Task) *dto.TaskDto {
 	return &dto.TaskDto{
 		TaskID:     task.TaskID,
@@ -0,0 +1,59 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SupportsStoredResponses 渠道是否提供 OpenAI 兼容的 /v1/responses/{id} 系列接口
+func SupportsStoredResponses(info *relaycommon.RelayInfo) bool {
+	return info.ApiType == constant.APITypeOpenAI && info.ChannelType != constant.ChannelTypeAzure
+}
+
+// StoredResponseHelper 将 response 的查询、取消、删除与输入项列表请求原样转发到生成该 response 的渠道
+func StoredResponseHelper(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+
+	var requestBody io.Reader
+	if c.Request.Method == http.MethodPost {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
+		}
+		requestBody = bytes.NewReader(body)
+	}
+
+	requestURL := relaycommon.GetFullRequestURL(info.ChannelBaseUrl, c.Request.URL.String(), info.ChannelType)
+	resp, err := channel.DoApiRequest(&fixedURLAdaptor{Adaptor: adaptor, requestURL: requestURL}, c, info, requestBody)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), resp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return newAPIError
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return nil
+}
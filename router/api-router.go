@@ -16,6 +16,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/setup", controller.GetSetup)
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
+		apiRouter.GET("/ready", controller.GetReadiness)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
 		apiRouter.GET("/status/test", middleware.AdminAuth(), middleware.AdminAudit(), controller.TestStatus)
@@ -140,6 +141,8 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.DELETE("/:id", controller.DeleteUser)
 				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
+				adminRoute.GET("/quota_ledger/reconciliation", controller.GetQuotaReconciliationReport)
+				adminRoute.GET("/:id/quota_ledger", controller.GetUserQuotaLedgers)
 				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
 			}
 		}
@@ -150,6 +153,7 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.PUT("/", controller.UpdateOption)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
+			optionRoute.GET("/capture_sinks", controller.GetCaptureSinkStatus)
 		}
 		messageRoute := apiRouter.Group("/message")
 		{
@@ -181,6 +185,23 @@ func SetApiRouter(router *gin.Engine) {
 				adminMessageRoute.DELETE("/:id", controller.DeleteMessage)
 			}
 		}
+		priceBookRoute := apiRouter.Group("/price_book")
+		priceBookRoute.Use(middleware.RootAuth(), middleware.AdminAudit())
+		{
+			priceBookRoute.GET("/", controller.GetPriceBookVersions)
+			priceBookRoute.POST("/", controller.CreatePriceBookVersion)
+			priceBookRoute.POST("/preview", controller.PreviewPriceBookVersion)
+			priceBookRoute.GET("/:id", controller.GetPriceBookVersion)
+			priceBookRoute.PUT("/:id", controller.UpdatePriceBookVersion)
+			priceBookRoute.DELETE("/:id", controller.CancelPriceBookVersion)
+			priceBookRoute.POST("/:id/activate", controller.ActivatePriceBookVersion)
+		}
+		jobRoute := apiRouter.Group("/job")
+		jobRoute.Use(middleware.RootAuth(), middleware.AdminAudit())
+		{
+			jobRoute.GET("/", controller.GetBackgroundJobs)
+			jobRoute.POST("/:name/run", controller.RunBackgroundJob)
+		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
 		ratioSyncRoute.Use(middleware.RootAuth(), middleware.AdminAudit())
 		{
@@ -194,6 +215,8 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/affinity_stats", controller.GetChannelAffinityStats)
+			channelRoute.DELETE("/affinity_stats", controller.ResetChannelAffinityStats)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
@@ -319,6 +342,11 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.SupportAuth(), middleware.AdminAudit(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/export", middleware.AdminAuth(), middleware.AdminAudit(), controller.ExportAllLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), controller.ExportUserLogs)
+		logRoute.POST("/report", middleware.RootAuth(), middleware.AdminAudit(), controller.RunUsageReports)
+		logRoute.GET("/archive", middleware.RootAuth(), controller.GetLogArchives)
+		logRoute.POST("/archive/run", middleware.RootAuth(), middleware.AdminAudit(), controller.RunLogArchive)
 
 		dataRoute := apiRouter.Group("/data")
 		dataRoute.GET("/", middleware.SupportAuth(), middleware.AdminAudit(), controller.GetAllQuotaDates)
@@ -354,6 +382,14 @@ func SetApiRouter(router *gin.Engine) {
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
+			taskRoute.GET("/callbacks/self", middleware.UserAuth(), controller.GetUserTaskCallbacks)
+			taskRoute.POST("/callbacks/:id/replay", middleware.UserAuth(), controller.ReplayUserTaskCallback)
+			taskRoute.GET("/artifacts/self", middleware.UserAuth(), controller.GetUserTaskArtifacts)
+			taskRoute.GET("/artifacts/self/usage", middleware.UserAuth(), controller.GetUserTaskArtifactUsage)
+			taskRoute.GET("/artifacts/usage", middleware.AdminAuth(), middleware.AdminAudit(), controller.GetTaskArtifactUsages)
+			taskRoute.GET("/poll", middleware.AdminAuth(), middleware.AdminAudit(), controller.GetTaskPollStatus)
+			taskRoute.GET("/refunds/self", middleware.UserAuth(), controller.GetUserTaskRefunds)
+			taskRoute.GET("/refunds", middleware.AdminAuth(), middleware.AdminAudit(), controller.GetTaskRefunds)
 			taskRoute.GET("/", middleware.SupportAuth(), middleware.AdminAudit(), controller.GetAllTask)
 		}
 
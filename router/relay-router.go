@@ -1,6 +1,8 @@
 package router
 
 import (
+	"strings"
+
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
@@ -56,7 +58,7 @@ func SetRelayRouter(router *gin.Engine) {
 	}
 
 	playgroundRouter := router.Group("/pg")
-	playgroundRouter.Use(middleware.UserAuth(), middleware.Distribute(), middleware.LangfuseCapture())
+	playgroundRouter.Use(middleware.UserAuth(), middleware.ShutdownGuard(), middleware.Distribute(), middleware.TrainingDataCapture())
 	{
 		playgroundRouter.POST("/chat/completions", controller.Playground)
 	}
@@ -66,20 +68,31 @@ func SetRelayRouter(router *gin.Engine) {
 	{
 		// WebSocket 路由（统一到 Relay）
 		wsRouter := relayV1Router.Group("")
-		wsRouter.Use(middleware.Distribute())
+		wsRouter.Use(middleware.ShutdownGuard(), middleware.Distribute())
 		wsRouter.GET("/realtime", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// stored responses 按记录的渠道转发，不经过分发
+		storedResponsesRouter := relayV1Router.Group("/responses")
+		storedResponsesRouter.GET("/:id", controller.RelayStoredResponse)
+		storedResponsesRouter.DELETE("/:id", controller.RelayStoredResponse)
+		storedResponsesRouter.POST("/:id/cancel", controller.RelayStoredResponse)
+		storedResponsesRouter.GET("/:id/input_items", controller.RelayStoredResponse)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
-		httpRouter.Use(middleware.Distribute(), middleware.LangfuseCapture())
+		httpRouter.Use(middleware.ShutdownGuard(), middleware.Distribute(), middleware.TrainingDataCapture())
 
 		// claude related routes
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		httpRouter.POST("/messages/count_tokens", func(c *gin.Context) {
+			controller.RelayCountTokens(c, types.RelayFormatClaude)
+		})
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -93,6 +106,9 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/responses", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIResponses)
 		})
+		httpRouter.POST("/responses/input_tokens", func(c *gin.Context) {
+			controller.RelayCountTokens(c, types.RelayFormatOpenAIResponses)
+		})
 
 		// image related routes
 		httpRouter.POST("/edits", func(c *gin.Context) {
@@ -104,6 +120,9 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/images/edits", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatOpenAIImage)
 		})
+		// 异步图像任务（Midjourney 绘图、变换、放大）
+		httpRouter.POST("/images/jobs", controller.RelayTask)
+		httpRouter.GET("/images/jobs/:task_id", controller.RelayTask)
 
 		// embedding related routes
 		httpRouter.POST("/embeddings", func(c *gin.Context) {
@@ -130,9 +149,7 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/engines/:model/embeddings", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
-		httpRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		httpRouter.POST("/models/*path", relayGemini)
 
 		// other relay routes
 		httpRouter.POST("/moderations", func(c *gin.Context) {
@@ -162,7 +179,7 @@ func SetRelayRouter(router *gin.Engine) {
 	//relayMjRouter.Use()
 
 	relaySunoRouter := router.Group("/suno")
-	relaySunoRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.LangfuseCapture())
+	relaySunoRouter.Use(middleware.TokenAuth(), middleware.ShutdownGuard(), middleware.Distribute(), middleware.TrainingDataCapture())
 	{
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTask)
@@ -172,18 +189,25 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter := router.Group("/v1beta")
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
-	relayGeminiRouter.Use(middleware.Distribute(), middleware.LangfuseCapture())
+	relayGeminiRouter.Use(middleware.ShutdownGuard(), middleware.Distribute(), middleware.TrainingDataCapture())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
-		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		relayGeminiRouter.POST("/models/*path", relayGemini)
+	}
+}
+
+// relayGemini Gemini API 的 countTokens 与其他动作共用同一路径，按动作分流
+func relayGemini(c *gin.Context) {
+	if strings.HasSuffix(c.Param("path"), ":countTokens") {
+		controller.RelayCountTokens(c, types.RelayFormatGemini)
+		return
 	}
+	controller.Relay(c, types.RelayFormatGemini)
 }
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
 	relayMjRouter.GET("/image/:id", relay.RelayMidjourneyImage)
-	relayMjRouter.Use(middleware.TokenAuth(), middleware.Distribute(), middleware.LangfuseCapture())
+	relayMjRouter.Use(middleware.TokenAuth(), middleware.ShutdownGuard(), middleware.Distribute(), middleware.TrainingDataCapture())
 	{
 		relayMjRouter.POST("/submit/action", controller.RelayMidjourney)
 		relayMjRouter.POST("/submit/shorten", controller.RelayMidjourney)
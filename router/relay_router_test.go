@@ -0,0 +1,75 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRelayGeminiDispatchesCountTokens(t *testing.T) {
+	originalDB, originalCountToken := model.DB, constant.CountToken
+	t.Cleanup(func() {
+		model.DB = originalDB
+		constant.CountToken = originalCountToken
+	})
+	db, err := gorm.Open(sqlite.Open("file:relay-router-count-tokens-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.Model{}, &model.Vendor{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	model.DB = db
+	constant.CountToken = true
+	service.InitHttpClient()
+	service.InitTokenEncoders()
+
+	var upstreamPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"totalTokens":7}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// 模拟分发中间件选出的 Gemini 渠道，请求体已缓存
+	router.POST("/v1beta/models/*path", func(c *gin.Context) {
+		var request map[string]any
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			t.Fatal(err)
+		}
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+		common.SetContextKey(c, constant.ContextKeyOriginalModel, "gemini-test")
+		common.SetContextKey(c, constant.ContextKeyChannelId, 1)
+		common.SetContextKey(c, constant.ContextKeyChannelType, constant.ChannelTypeGemini)
+		common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, upstream.URL)
+		common.SetContextKey(c, constant.ContextKeyChannelKey, "test-key")
+	}, relayGemini)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-test:countTokens",
+		strings.NewReader(`{"contents":[{"role":"user","parts":[{"text":"hello"}]}]}`))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	if upstreamPath != "/v1beta/models/gemini-test:countTokens" {
+		t.Fatalf("upstream path = %q, want the countTokens endpoint", upstreamPath)
+	}
+	if got := strings.TrimSpace(recorder.Body.String()); got != `{"totalTokens":7}` {
+		t.Fatalf("body = %s, want upstream count response", got)
+	}
+}
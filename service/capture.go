@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// CaptureRequest 中继请求结束后交给训练数据采集的原始请求与响应
+type CaptureRequest struct {
+	UserID              int
+	TokenID             int
+	TokenName           string
+	Group               string
+	Model               string
+	Method              string
+	Path                string
+	RequestID           string
+	CaptureRate         float64
+	StatusCode          int
+	StartedAt           time.Time
+	EndedAt             time.Time
+	RequestBody         []byte
+	ResponseBody        []byte
+	RequestContentType  string
+	ResponseContentType string
+}
+
+// CaptureRecord 抽取并脱敏后的一条采集记录，同一条记录会写入多个目标，目标不得修改
+type CaptureRecord struct {
+	ID          string             `json:"id"`
+	RequestID   string             `json:"request_id"`
+	UserID      int                `json:"user_id"`
+	TokenID     int                `json:"token_id"`
+	TokenName   string             `json:"token_name"`
+	Group       string             `json:"group"`
+	Model       string             `json:"model"`
+	Method      string             `json:"method"`
+	Path        string             `json:"path"`
+	StatusCode  int                `json:"status_code"`
+	CaptureRate float64            `json:"capture_rate"`
+	StartedAt   time.Time          `json:"started_at"`
+	EndedAt     time.Time          `json:"ended_at"`
+	Input       any                `json:"input"`
+	Output      any                `json:"output"`
+	Usage       map[string]float64 `json:"usage,omitempty"`
+}
+
+// CaptureSink 采集记录的写入目标，由所属队列的单个协程按批调用
+type CaptureSink interface {
+	Write(ctx context.Context, records []*CaptureRecord) error
+	Close() error
+}
+
+// CaptureSinkStatus 写入目标在当前节点上的队列与写入情况
+type CaptureSinkStatus struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Enabled       bool   `json:"enabled"`
+	Running       bool   `json:"running"`
+	QueueLength   int    `json:"queue_length"`
+	QueueCapacity int    `json:"queue_capacity"`
+	Written       int64  `json:"written"`
+	Dropped       int64  `json:"dropped"`
+	Failed        int64  `json:"failed"`
+	LastFlushAt   int64  `json:"last_flush_at"`
+	LastError     string `json:"last_error"`
+}
+
+// captureItem 一次采样的原始请求，由最先处理它的写入目标抽取并脱敏，结果在各目标之间共享
+type captureItem struct {
+	request CaptureRequest
+	once    sync.Once
+	record  *CaptureRecord
+}
+
+func (item *captureItem) build() *CaptureRecord {
+	item.once.Do(func() {
+		item.record = buildCaptureRecord(item.request)
+		if setting := operation_setting.GetCaptureSetting(); setting.RedactEnabled {
+			redactCaptureRecord(item.record, setting)
+		}
+		item.request = CaptureRequest{}
+	})
+	return item.record
+}
+
+type captureSinkWorker struct {
+	name          string
+	sinkType      string
+	signature     string
+	sink          CaptureSink
+	queue         chan *captureItem
+	batchSize     int
+	flushInterval time.Duration
+	writeTimeout  time.Duration
+	done          chan struct{}
+
+	// queueLock 保护队列的关闭，入队持读锁，关闭后不再接收记录
+	queueLock sync.RWMutex
+	closed    bool
+
+	written     atomic.Int64
+	dropped     atomic.Int64
+	failed      atomic.Int64
+	lastFlushAt atomic.Int64
+	lastError   atomic.Value
+}
+
+// captureSinkSet 某一配置版本下各写入目标的队列
+type captureSinkSet struct {
+	version int64
+	workers map[string]*captureSinkWorker
+}
+
+var (
+	// captureSinkLock 只在配置版本变化、关闭与查询状态时持有，采集请求只读取 captureSinks
+	captureSinkLock sync.Mutex
+	captureSinks    atomic.Pointer[captureSinkSet]
+	// captureSinkErrors 创建失败的目标配置，同一配置只记录一次日志
+	captureSinkErrors = make(map[string]string)
+)
+
+// CaptureRelay 按采集率抽样成功的中继请求，将原始请求放入分组选择的各写入目标队列，抽取与脱敏在队列协程中完成；
+// 队列满时丢弃，不阻塞请求
+func CaptureRelay(capture CaptureRequest) {
+	if capture.CaptureRate <= 0 || capture.StatusCode >= http.StatusBadRequest {
+		return
+	}
+	if !shouldSampleCapture(capture.CaptureRate) {
+		return
+	}
+	sinks := currentCaptureSinks()
+	var item *captureItem
+	for _, name := range operation_setting.GetCaptureSetting().GetGroupSinks(capture.Group) {
+		worker := sinks.workers[name]
+		if worker == nil {
+			continue
+		}
+		if item == nil {
+			item = &captureItem{request: capture}
+		}
+		if !worker.enqueue(item) {
+			// 队列已随配置变化关闭，改投新配置下的队列
+			if worker = currentCaptureSinks().workers[name]; worker != nil {
+				worker.enqueue(item)
+			}
+		}
+	}
+}
+
+func buildCaptureRecord(capture CaptureRequest) *CaptureRecord {
+	now := time.Now().UTC()
+	startedAt := capture.StartedAt.UTC()
+	if startedAt.IsZero() {
+		startedAt = now
+	}
+	endedAt := capture.EndedAt.UTC()
+	if endedAt.IsZero() {
+		endedAt = now
+	}
+	return &CaptureRecord{
+		ID:          common.GetUUID(),
+		RequestID:   capture.RequestID,
+		UserID:      capture.UserID,
+		TokenID:     capture.TokenID,
+		TokenName:   capture.TokenName,
+		Group:       capture.Group,
+		Model:       capture.Model,
+		Method:      capture.Method,
+		Path:        capture.Path,
+		StatusCode:  capture.StatusCode,
+		CaptureRate: capture.CaptureRate,
+		StartedAt:   startedAt,
+		EndedAt:     endedAt,
+		Input:       extractLangfuseInput(capture.RequestBody, capture.RequestContentType),
+		Output:      extractLangfuseOutput(capture.ResponseBody, capture.ResponseContentType),
+		Usage:       extractUsageDetails(capture.ResponseBody),
+	}
+}
+
+// currentCaptureSinks 返回当前配置版本的写入目标，版本未变化时不加锁
+func currentCaptureSinks() *captureSinkSet {
+	version := operation_setting.GetCaptureSettingVersion()
+	if sinks := captureSinks.Load(); sinks != nil && sinks.version == version {
+		return sinks
+	}
+	captureSinkLock.Lock()
+	defer captureSinkLock.Unlock()
+	if sinks := captureSinks.Load(); sinks != nil && sinks.version == version {
+		return sinks
+	}
+	sinks := refreshCaptureSinks(version)
+	captureSinks.Store(sinks)
+	return sinks
+}
+
+// refreshCaptureSinks 按当前配置重建被分组引用的写入目标，配置未变化的目标沿用原队列，
+// 其余旧队列写完剩余记录后关闭；调用方需持有 captureSinkLock
+func refreshCaptureSinks(version int64) *captureSinkSet {
+	setting := operation_setting.GetCaptureSetting()
+	existing := make(map[string]*captureSinkWorker)
+	if previous := captureSinks.Load(); previous != nil {
+		existing = previous.workers
+	}
+	referenced := make(map[string]bool, len(setting.DefaultSinks))
+	for _, name := range setting.DefaultSinks {
+		referenced[name] = true
+	}
+	for _, names := range setting.GroupSinks {
+		for _, name := range names {
+			referenced[name] = true
+		}
+	}
+	sinks := &captureSinkSet{version: version, workers: make(map[string]*captureSinkWorker)}
+	for name := range referenced {
+		cfg, ok := setting.GetSink(name)
+		if !ok || !cfg.Enabled {
+			continue
+		}
+		signature := captureSinkSignature(setting, cfg)
+		if worker := existing[name]; worker != nil && worker.signature == signature {
+			sinks.workers[name] = worker
+			continue
+		}
+		if captureSinkErrors[name] == signature {
+			continue
+		}
+		sink, err := newCaptureSink(cfg)
+		if err != nil {
+			captureSinkErrors[name] = signature
+			common.SysLog(fmt.Sprintf("capture sink %s disabled: %s", name, err.Error()))
+			continue
+		}
+		delete(captureSinkErrors, name)
+		worker := &captureSinkWorker{
+			name:          name,
+			sinkType:      cfg.Type,
+			signature:     signature,
+			sink:          sink,
+			queue:         make(chan *captureItem, max(setting.QueueSize, 1)),
+			batchSize:     max(setting.BatchSize, 1),
+			flushInterval: time.Duration(max(setting.FlushIntervalSeconds, 1)) * time.Second,
+			writeTimeout:  time.Duration(max(setting.WriteTimeoutSeconds, 1)) * time.Second,
+			done:          make(chan struct{}),
+		}
+		sinks.workers[name] = worker
+		go worker.run()
+	}
+	for name, worker := range existing {
+		if sinks.workers[name] != worker {
+			worker.shutdown()
+		}
+	}
+	return sinks
+}
+
+func captureSinkSignature(setting *operation_setting.CaptureSetting, cfg operation_setting.CaptureSinkConfig) string {
+	data, _ := common.Marshal(cfg)
+	return fmt.Sprintf("%s|%d|%d|%d|%d", data, setting.QueueSize, setting.BatchSize, setting.FlushIntervalSeconds, setting.WriteTimeoutSeconds)
+}
+
+// enqueue 放入队列，队列满时丢弃；队列已关闭时返回 false，由调用方改投新队列
+func (w *captureSinkWorker) enqueue(item *captureItem) bool {
+	w.queueLock.RLock()
+	defer w.queueLock.RUnlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.queue <- item:
+	default:
+		w.dropped.Add(1)
+	}
+	return true
+}
+
+func (w *captureSinkWorker) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	batch := make([]*CaptureRecord, 0, w.batchSize)
+	for {
+		select {
+		case item, ok := <-w.queue:
+			if !ok {
+				// 队列关闭前的记录均已取出，写完后关闭目标
+				if len(batch) > 0 {
+					w.flush(batch)
+				}
+				if err := w.sink.Close(); err != nil {
+					common.SysLog(fmt.Sprintf("failed to close capture sink %s: %s", w.name, err.Error()))
+				}
+				return
+			}
+			batch = append(batch, item.build())
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = make([]*CaptureRecord, 0, w.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = make([]*CaptureRecord, 0, w.batchSize)
+			}
+		}
+	}
+}
+
+func (w *captureSinkWorker) flush(batch []*CaptureRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.writeTimeout)
+	defer cancel()
+	w.lastFlushAt.Store(time.Now().Unix())
+	if err := w.sink.Write(ctx, batch); err != nil {
+		w.failed.Add(int64(len(batch)))
+		w.lastError.Store(err.Error())
+		common.SysLog(fmt.Sprintf("capture sink %s failed to write %d records: %s", w.name, len(batch), err.Error()))
+		return
+	}
+	w.written.Add(int64(len(batch)))
+	w.lastError.Store("")
+}
+
+// shutdown 关闭队列，之后的入队被拒绝，队列协程写完已入队的记录后关闭目标
+func (w *captureSinkWorker) shutdown() {
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+}
+
+// FlushCaptureSinks 关闭所有写入目标，等待队列中剩余的记录写完，用于优雅关闭
+func FlushCaptureSinks(ctx context.Context) {
+	captureSinkLock.Lock()
+	sinks := captureSinks.Swap(nil)
+	captureSinkLock.Unlock()
+	if sinks == nil {
+		return
+	}
+	for _, worker := range sinks.workers {
+		worker.shutdown()
+	}
+	for _, worker := range sinks.workers {
+		select {
+		case <-worker.done:
+		case <-ctx.Done():
+			common.SysLog(fmt.Sprintf("capture sink %s did not finish before shutdown, %d records lost", worker.name, len(worker.queue)))
+		}
+	}
+}
+
+// GetCaptureSinkStatus 已配置的写入目标及其在当前节点上的队列情况，目标在配置变化后的首次采集时创建
+func GetCaptureSinkStatus() []*CaptureSinkStatus {
+	setting := operation_setting.GetCaptureSetting()
+	captureSinkLock.Lock()
+	defer captureSinkLock.Unlock()
+	workers := make(map[string]*captureSinkWorker)
+	if sinks := captureSinks.Load(); sinks != nil {
+		workers = sinks.workers
+	}
+	statuses := make([]*CaptureSinkStatus, 0, len(setting.Sinks))
+	for _, cfg := range setting.Sinks {
+		status := &CaptureSinkStatus{Name: cfg.Name, Type: cfg.Type, Enabled: cfg.Enabled}
+		if worker := workers[cfg.Name]; worker != nil {
+			status.Running = true
+			status.QueueLength = len(worker.queue)
+			status.QueueCapacity = cap(worker.queue)
+			status.Written = worker.written.Load()
+			status.Dropped = worker.dropped.Load()
+			status.Failed = worker.failed.Load()
+			status.LastFlushAt = worker.lastFlushAt.Load()
+			status.LastError, _ = worker.lastError.Load().(string)
+		} else if _, ok := captureSinkErrors[cfg.Name]; ok {
+			status.LastError = "sink is not available, check its configuration"
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+type captureRedactRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	// match 可选，进一步校验匹配到的内容，返回 false 时保留原文
+	match func(string) bool
+}
+
+// captureBuiltinRedactRules 内置脱敏规则，按此顺序执行：身份证先于银行卡，手机号要求前后为边界，不会命中卡号中间的数字
+var captureBuiltinRedactRules = []captureRedactRule{
+	{name: "api_key", pattern: regexp.MustCompile(`\b(?:sk|pk|rk|ak)-[A-Za-z0-9_-]{16,}`), replacement: "[API_KEY]"},
+	{name: "email", pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), replacement: "[EMAIL]"},
+	{name: "id_card", pattern: regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`), replacement: "[ID_CARD]"},
+	{name: "phone", pattern: regexp.MustCompile(`(?:\+86[- ]?|\b86[- ]?|\b)1[3-9]\d{9}\b`), replacement: "[PHONE]"},
+	{name: "bank_card", pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), replacement: "[BANK_CARD]", match: luhnValid},
+	{name: "ip", pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), replacement: "[IP]"},
+}
+
+var (
+	captureRedactRuleLock  sync.Mutex
+	captureRedactRuleCache = make(map[string]*regexp.Regexp)
+	// captureInvalidRedactRules 无法编译的自定义规则，只记录一次日志
+	captureInvalidRedactRules = make(map[string]bool)
+)
+
+// captureRedactRules 按配置返回启用的内置规则与自定义规则，自定义规则在内置规则之后执行
+func captureRedactRules(setting *operation_setting.CaptureSetting) []captureRedactRule {
+	enabled := make(map[string]bool, len(setting.BuiltinRedactRules))
+	for _, name := range setting.BuiltinRedactRules {
+		enabled[name] = true
+	}
+	rules := make([]captureRedactRule, 0, len(captureBuiltinRedactRules)+len(setting.RedactRules))
+	for _, rule := range captureBuiltinRedactRules {
+		if enabled[rule.name] {
+			rules = append(rules, rule)
+		}
+	}
+	captureRedactRuleLock.Lock()
+	defer captureRedactRuleLock.Unlock()
+	for _, rule := range setting.RedactRules {
+		if rule.Pattern == "" {
+			continue
+		}
+		pattern, ok := captureRedactRuleCache[rule.Pattern]
+		if !ok {
+			var err error
+			if pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				if !captureInvalidRedactRules[rule.Pattern] {
+					captureInvalidRedactRules[rule.Pattern] = true
+					common.SysLog(fmt.Sprintf("invalid capture redact rule %s: %s", rule.Name, err.Error()))
+				}
+				continue
+			}
+			captureRedactRuleCache[rule.Pattern] = pattern
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		rules = append(rules, captureRedactRule{name: rule.Name, pattern: pattern, replacement: replacement})
+	}
+	return rules
+}
+
+// redactCaptureRecord 对请求输入与响应输出中的所有字符串执行脱敏
+func redactCaptureRecord(record *CaptureRecord, setting *operation_setting.CaptureSetting) {
+	rules := captureRedactRules(setting)
+	if len(rules) == 0 {
+		return
+	}
+	record.Input = redactCaptureValue(record.Input, rules)
+	record.Output = redactCaptureValue(record.Output, rules)
+}
+
+func redactCaptureValue(value any, rules []captureRedactRule) any {
+	switch v := value.(type) {
+	case string:
+		for _, rule := range rules {
+			if rule.match == nil {
+				v = rule.pattern.ReplaceAllString(v, rule.replacement)
+				continue
+			}
+			v = rule.pattern.ReplaceAllStringFunc(v, func(matched string) string {
+				if rule.match(matched) {
+					return rule.replacement
+				}
+				return matched
+			})
+		}
+		return v
+	case map[string]any:
+		for key, child := range v {
+			v[key] = redactCaptureValue(child, rules)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = redactCaptureValue(child, rules)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// luhnValid 银行卡号的 Luhn 校验，避免把时间戳、订单号等长数字误判为卡号
+func luhnValid(value string) bool {
+	sum, digits := 0, 0
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 0 && sum%10 == 0
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func newCaptureSink(cfg operation_setting.CaptureSinkConfig) (CaptureSink, error) {
+	switch cfg.Type {
+	case operation_setting.CaptureSinkTypeLangfuse:
+		return newLangfuseCaptureSink()
+	case operation_setting.CaptureSinkTypeJSONL:
+		return newJSONLCaptureSink(cfg)
+	case operation_setting.CaptureSinkTypeS3:
+		return newS3CaptureSink(cfg)
+	case operation_setting.CaptureSinkTypeKafka:
+		return newKafkaCaptureSink(cfg)
+	case operation_setting.CaptureSinkTypeOTLP:
+		return newOTLPCaptureSink(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported capture sink type: %s", cfg.Type)
+	}
+}
+
+// encodeCaptureRecords 将记录编码为 JSON Lines
+func encodeCaptureRecords(records []*CaptureRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := common.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func postCaptureJSON(ctx context.Context, endpoint string, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// jsonlCaptureSink 写入本地 JSON Lines 文件，文件名为 capture-YYYY-MM-DD[.N].jsonl，跨天或超过大小后切分
+type jsonlCaptureSink struct {
+	dir     string
+	maxSize int64
+	file    *os.File
+	day     string
+	index   int
+	size    int64
+}
+
+func newJSONLCaptureSink(cfg operation_setting.CaptureSinkConfig) (*jsonlCaptureSink, error) {
+	dir := strings.TrimSpace(cfg.Dir)
+	if dir == "" {
+		dir = "./data/capture"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	maxSizeMB := cfg.MaxFileSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	return &jsonlCaptureSink{dir: dir, maxSize: int64(maxSizeMB) << 20}, nil
+}
+
+func (s *jsonlCaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	for _, record := range records {
+		line, err := common.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if err := s.rotate(int64(len(line))); err != nil {
+			return err
+		}
+		n, err := s.file.Write(line)
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotate 在写入前按日期与文件大小切换文件，单条记录超过大小上限时仍写入一个新文件
+func (s *jsonlCaptureSink) rotate(next int64) error {
+	day := time.Now().Format("2006-01-02")
+	if s.file != nil && s.day == day && s.size+next <= s.maxSize {
+		return nil
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+		if s.day == day {
+			s.index++
+		}
+	}
+	if s.day != day {
+		s.day, s.index = day, 0
+	}
+	for {
+		path := s.filePath()
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 0 && info.Size()+next > s.maxSize {
+			s.index++
+			continue
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file, s.size = file, 0
+		if info != nil {
+			s.size = info.Size()
+		}
+		return nil
+	}
+}
+
+func (s *jsonlCaptureSink) filePath() string {
+	name := "capture-" + s.day + ".jsonl"
+	if s.index > 0 {
+		name = "capture-" + s.day + "." + strconv.Itoa(s.index) + ".jsonl"
+	}
+	return filepath.Join(s.dir, name)
+}
+
+func (s *jsonlCaptureSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// s3CaptureSink 每批记录写入对象存储中的一个 JSON Lines 对象：{prefix}/YYYY-MM-DD/HHMMSS-{随机串}.jsonl
+type s3CaptureSink struct {
+	storage *ObjectStorage
+	prefix  string
+}
+
+func newS3CaptureSink(cfg operation_setting.CaptureSinkConfig) (*s3CaptureSink, error) {
+	storage, err := GetObjectStorage()
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix == "" {
+		prefix = "capture"
+	}
+	return &s3CaptureSink{storage: storage, prefix: prefix}, nil
+}
+
+func (s *s3CaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	body, err := encodeCaptureRecords(records)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s/%s/%s-%s.jsonl", s.prefix, now.Format("2006-01-02"), now.Format("150405"), common.GetRandomString(12))
+	return s.storage.PutObject(ctx, key, body, "application/x-ndjson")
+}
+
+func (s *s3CaptureSink) Close() error {
+	return nil
+}
+
+// kafkaCaptureSink 通过 Kafka REST Proxy（Confluent REST Proxy v2 及兼容实现，如 Redpanda）写入主题，消息键为请求 ID
+type kafkaCaptureSink struct {
+	endpoint string
+	headers  map[string]string
+}
+
+func newKafkaCaptureSink(cfg operation_setting.CaptureSinkConfig) (*kafkaCaptureSink, error) {
+	endpoint := strings.TrimRight(strings.TrimSpace(cfg.Endpoint), "/")
+	topic := strings.TrimSpace(cfg.Topic)
+	if endpoint == "" || topic == "" {
+		return nil, errors.New("kafka sink requires endpoint and topic")
+	}
+	return &kafkaCaptureSink{
+		endpoint: endpoint + "/topics/" + url.PathEscape(topic),
+		headers:  cfg.Headers,
+	}, nil
+}
+
+func (s *kafkaCaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	messages := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		key := record.RequestID
+		if key == "" {
+			key = record.ID
+		}
+		messages = append(messages, map[string]any{"key": key, "value": record})
+	}
+	body, err := common.Marshal(map[string]any{"records": messages})
+	if err != nil {
+		return err
+	}
+	return postCaptureJSON(ctx, s.endpoint, "application/vnd.kafka.json.v2+json", s.headers, body)
+}
+
+func (s *kafkaCaptureSink) Close() error {
+	return nil
+}
+
+// otlpCaptureSink 以 OTLP/HTTP JSON 格式导出日志，每条记录一条日志，正文为记录 JSON
+type otlpCaptureSink struct {
+	endpoint string
+	headers  map[string]string
+}
+
+func newOTLPCaptureSink(cfg operation_setting.CaptureSinkConfig) (*otlpCaptureSink, error) {
+	endpoint := strings.TrimRight(strings.TrimSpace(cfg.Endpoint), "/")
+	if endpoint == "" {
+		return nil, errors.New("otlp sink requires endpoint")
+	}
+	if !strings.HasSuffix(endpoint, "/v1/logs") {
+		endpoint += "/v1/logs"
+	}
+	return &otlpCaptureSink{endpoint: endpoint, headers: cfg.Headers}, nil
+}
+
+func (s *otlpCaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	body, err := buildOTLPCaptureLogs(records)
+	if err != nil {
+		return err
+	}
+	return postCaptureJSON(ctx, s.endpoint, "application/json", s.headers, body)
+}
+
+func (s *otlpCaptureSink) Close() error {
+	return nil
+}
+
+func buildOTLPCaptureLogs(records []*CaptureRecord) ([]byte, error) {
+	observedAt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	logRecords := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		data, err := common.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		logRecords = append(logRecords, map[string]any{
+			"timeUnixNano":         strconv.FormatInt(record.EndedAt.UnixNano(), 10),
+			"observedTimeUnixNano": observedAt,
+			"severityNumber":       9,
+			"severityText":         "INFO",
+			"body":                 map[string]any{"stringValue": string(data)},
+			"attributes": []map[string]any{
+				otlpStringAttribute("capture.id", record.ID),
+				otlpStringAttribute("request.id", record.RequestID),
+				otlpStringAttribute("user.id", strconv.Itoa(record.UserID)),
+				otlpStringAttribute("group", record.Group),
+				otlpStringAttribute("model", record.Model),
+				otlpStringAttribute("http.path", record.Path),
+			},
+		})
+	}
+	return common.Marshal(map[string]any{
+		"resourceLogs": []map[string]any{
+			{
+				"resource": map[string]any{
+					"attributes": []map[string]any{otlpStringAttribute("service.name", "new-api")},
+				},
+				"scopeLogs": []map[string]any{
+					{
+						"scope":      map[string]any{"name": "training-data-capture"},
+						"logRecords": logRecords,
+					},
+				},
+			},
+		},
+	})
+}
+
+func otlpStringAttribute(key string, value string) map[string]any {
+	return map[string]any{"key": key, "value": map[string]any{"stringValue": value}}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func TestRedactCaptureValue(t *testing.T) {
+	setting := &operation_setting.CaptureSetting{
+		BuiltinRedactRules: []string{"api_key", "email", "id_card", "bank_card", "phone"},
+		RedactRules:        []operation_setting.CaptureRedactRule{{Name: "order", Pattern: `ORD-\d+`}},
+	}
+	value := map[string]any{
+		"messages": []any{
+			map[string]any{"content": "mail me at alice@example.com or call +86 13812345678, key sk-abcdefghijklmnop1234"},
+			map[string]any{"content": "card 4111 1111 1111 1111, id 110101199003071234, order ORD-42, ts 1700000000000"},
+		},
+	}
+	redacted := redactCaptureValue(value, captureRedactRules(setting)).(map[string]any)
+	messages := redacted["messages"].([]any)
+	first := messages[0].(map[string]any)["content"].(string)
+	second := messages[1].(map[string]any)["content"].(string)
+	if first != "mail me at [EMAIL] or call [PHONE], key [API_KEY]" {
+		t.Fatalf("unexpected redaction: %s", first)
+	}
+	// 时间戳不满足 Luhn 校验，不视为银行卡号
+	if second != "card [BANK_CARD], id [ID_CARD], order [REDACTED], ts 1700000000000" {
+		t.Fatalf("unexpected redaction: %s", second)
+	}
+}
+
+func TestCaptureRelayJSONLSink(t *testing.T) {
+	setting := operation_setting.GetCaptureSetting()
+	originalSetting := *setting
+	t.Cleanup(func() {
+		*setting = originalSetting
+		operation_setting.CaptureSettingUpdated()
+	})
+	dir := t.TempDir()
+	setting.Sinks = []operation_setting.CaptureSinkConfig{
+		{Name: "file", Type: operation_setting.CaptureSinkTypeJSONL, Enabled: true, Dir: dir},
+	}
+	setting.DefaultSinks = []string{"file"}
+	setting.GroupSinks = map[string][]string{"free": {}}
+	setting.RedactEnabled = true
+	setting.BuiltinRedactRules = []string{"email"}
+	setting.RedactRules = nil
+	operation_setting.CaptureSettingUpdated()
+
+	for _, group := range []string{"vip", "free"} {
+		CaptureRelay(CaptureRequest{
+			UserID:              1,
+			Group:               group,
+			Model:               "gpt-4o",
+			Path:                "/v1/chat/completions",
+			RequestID:           "req-" + group,
+			CaptureRate:         1,
+			StatusCode:          200,
+			RequestBody:         []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"I am bob@example.com"}]}`),
+			ResponseBody:        []byte(`{"choices":[{"message":{"content":"hello"}}],"usage":{"total_tokens":3}}`),
+			RequestContentType:  "application/json",
+			ResponseContentType: "application/json",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	FlushCaptureSinks(ctx)
+
+	content, err := os.ReadFile(filepath.Join(dir, "capture-"+time.Now().Format("2006-01-02")+".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"request_id":"req-vip"`) {
+		t.Fatalf("expected only the vip group to be captured, got: %s", content)
+	}
+	if strings.Contains(lines[0], "bob@example.com") || !strings.Contains(lines[0], "[EMAIL]") || !strings.Contains(lines[0], `"output":"hello"`) {
+		t.Fatalf("unexpected captured record: %s", lines[0])
+	}
+}
+
+func TestJSONLCaptureSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newJSONLCaptureSink(operation_setting.CaptureSinkConfig{Dir: dir, MaxFileSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.maxSize = 300
+	records := []*CaptureRecord{{ID: "1", Output: strings.Repeat("a", 100)}, {ID: "2", Output: strings.Repeat("b", 100)}}
+	if err := sink.Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Now().Format("2006-01-02")
+	for _, name := range []string{"capture-" + day + ".jsonl", "capture-" + day + ".1.jsonl"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || strings.Count(string(content), "\n") != 1 {
+			t.Fatalf("expected one record in %s: %q, %v", name, content, err)
+		}
+	}
+}
+
+type blockingCaptureSink struct {
+	release chan struct{}
+	written int
+}
+
+func (s *blockingCaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	<-s.release
+	s.written += len(records)
+	return nil
+}
+
+func (s *blockingCaptureSink) Close() error {
+	return nil
+}
+
+func TestCaptureSinkBackpressure(t *testing.T) {
+	sink := &blockingCaptureSink{release: make(chan struct{})}
+	worker := &captureSinkWorker{
+		name:          "slow",
+		sink:          sink,
+		queue:         make(chan *captureItem, 2),
+		batchSize:     1,
+		flushInterval: time.Second,
+		writeTimeout:  time.Second,
+		done:          make(chan struct{}),
+	}
+	go worker.run()
+
+	// 目标阻塞时入队不等待，超出队列长度的记录被丢弃
+	finished := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			worker.enqueue(&captureItem{request: CaptureRequest{RequestID: "r"}})
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue should not block on a slow sink")
+	}
+	if dropped := worker.dropped.Load(); dropped < 7 {
+		t.Fatalf("expected records to be dropped, got %d", dropped)
+	}
+
+	close(sink.release)
+	worker.shutdown()
+	<-worker.done
+	if int64(sink.written)+worker.dropped.Load() != 10 || worker.written.Load() != int64(sink.written) {
+		t.Fatalf("unexpected counts: written %d, dropped %d", sink.written, worker.dropped.Load())
+	}
+	// 关闭后的入队被拒绝，由调用方改投新队列
+	if worker.enqueue(&captureItem{}) {
+		t.Fatal("enqueue should be rejected after shutdown")
+	}
+}
+
+func TestCaptureSinksRefreshOnSettingChange(t *testing.T) {
+	setting := operation_setting.GetCaptureSetting()
+	originalSetting := *setting
+	t.Cleanup(func() {
+		*setting = originalSetting
+		operation_setting.CaptureSettingUpdated()
+	})
+	firstDir, secondDir := t.TempDir(), t.TempDir()
+	setting.Sinks = []operation_setting.CaptureSinkConfig{
+		{Name: "file", Type: operation_setting.CaptureSinkTypeJSONL, Enabled: true, Dir: firstDir},
+	}
+	setting.DefaultSinks = []string{"file"}
+	setting.GroupSinks = map[string][]string{}
+	setting.RedactEnabled = false
+	operation_setting.CaptureSettingUpdated()
+
+	capture := CaptureRequest{Group: "default", CaptureRate: 1, StatusCode: 200, RequestBody: []byte(`{"messages":[]}`)}
+	capture.RequestID = "req-1"
+	CaptureRelay(capture)
+	first := currentCaptureSinks().workers["file"]
+	// 配置未变化时沿用同一队列
+	if currentCaptureSinks().workers["file"] != first {
+		t.Fatal("sink worker should be cached until the setting changes")
+	}
+
+	setting.Sinks[0].Dir = secondDir
+	operation_setting.CaptureSettingUpdated()
+	capture.RequestID = "req-2"
+	CaptureRelay(capture)
+	second := currentCaptureSinks().workers["file"]
+	if second == first {
+		t.Fatal("sink worker should be replaced after the setting changes")
+	}
+	<-first.done
+	// 旧队列关闭后入队的记录改投新队列
+	if first.enqueue(&captureItem{}) {
+		t.Fatal("replaced worker should reject records")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	FlushCaptureSinks(ctx)
+	day := time.Now().Format("2006-01-02")
+	for dir, requestID := range map[string]string{firstDir: "req-1", secondDir: "req-2"} {
+		content, err := os.ReadFile(filepath.Join(dir, "capture-"+day+".jsonl"))
+		if err != nil || strings.Count(string(content), "\n") != 1 || !strings.Contains(string(content), requestID) {
+			t.Fatalf("expected %s in %s: %q, %v", requestID, dir, content, err)
+		}
+	}
+}
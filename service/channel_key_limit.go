@@ -0,0 +1,81 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+const (
+	defaultChannelKeyCooldown = time.Minute
+	maxChannelKeyCooldown     = time.Hour
+)
+
+// 上游返回的限流重置时间请求头：OpenAI 为时长（如 6m0s、20ms），Anthropic 为 RFC3339 时间
+var rateLimitResetHeaders = []string{
+	"x-ratelimit-reset-requests",
+	"x-ratelimit-reset-tokens",
+	"anthropic-ratelimit-requests-reset",
+	"anthropic-ratelimit-tokens-reset",
+	"anthropic-ratelimit-input-tokens-reset",
+	"anthropic-ratelimit-output-tokens-reset",
+}
+
+// parseRateLimitResetDuration 从 retry-after 或限流重置请求头中解析需要等待的时长，均缺失时返回 0
+func parseRateLimitResetDuration(header http.Header, now time.Time) time.Duration {
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			return at.Sub(now)
+		}
+	}
+	if value := strings.TrimSpace(header.Get("retry-after-ms")); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	// 多个维度同时限流时以最晚恢复的为准
+	var wait time.Duration
+	for _, name := range rateLimitResetHeaders {
+		value := strings.TrimSpace(header.Get(name))
+		if value == "" {
+			continue
+		}
+		var d time.Duration
+		if parsed, err := time.ParseDuration(value); err == nil {
+			d = parsed
+		} else if at, err := time.Parse(time.RFC3339, value); err == nil {
+			d = at.Sub(now)
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// HandleChannelKeyResponse 记录多密钥渠道中 key 的请求数；上游返回 429 时按限流请求头让该 key 进入冷却
+func HandleChannelKeyResponse(info *relaycommon.RelayInfo, resp *http.Response) {
+	if info.ChannelMeta == nil || !info.ChannelIsMultiKey || info.ApiKey == "" {
+		return
+	}
+	model.RecordChannelKeyRequest(info.ChannelId, info.ApiKey)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	cooldown := parseRateLimitResetDuration(resp.Header, time.Now())
+	if cooldown <= 0 {
+		cooldown = defaultChannelKeyCooldown
+	}
+	if cooldown > maxChannelKeyCooldown {
+		cooldown = maxChannelKeyCooldown
+	}
+	model.CooldownChannelKey(info.ChannelId, info.ApiKey, cooldown)
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitResetDuration(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"retry-after seconds", http.Header{"Retry-After": {"30"}}, 30 * time.Second},
+		{"retry-after date", http.Header{"Retry-After": {now.Add(2 * time.Minute).Format(http.TimeFormat)}}, 2 * time.Minute},
+		{"retry-after-ms", http.Header{"Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond},
+		{"openai reset", http.Header{"X-Ratelimit-Reset-Requests": {"6m0s"}, "X-Ratelimit-Reset-Tokens": {"20ms"}}, 6 * time.Minute},
+		{"anthropic reset", http.Header{"Anthropic-Ratelimit-Tokens-Reset": {now.Add(45 * time.Second).Format(time.RFC3339)}}, 45 * time.Second},
+		{"missing", http.Header{}, 0},
+	}
+	for _, tc := range cases {
+		if got := parseRateLimitResetDuration(tc.header, now); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -10,12 +11,96 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
 )
 
 const maxTemporaryDisableSelectionAttempts = 8
 
 var errAllCandidateChannelsTemporarilyDisabled = errors.New("all candidate channels are temporarily disabled")
+var errAllCandidateChannelsLackCapability = errors.New("no candidate channel supports the required model capabilities")
+
+func getCapabilityRequirement(c *gin.Context) *types.ModelCapabilityRequirement {
+	requirement, _ := common.GetContextKeyType[*types.ModelCapabilityRequirement](c, constant.ContextKeyModelCapabilityRequirement)
+	return requirement
+}
+
+// HasCapabilityRequirement 当前请求是否带有模型能力要求（由请求校验阶段写入）
+func HasCapabilityRequirement(c *gin.Context) bool {
+	return !getCapabilityRequirement(c).IsEmpty()
+}
+
+// resolveMappedModelName 按渠道模型重定向（支持链式）解析实际请求上游的模型名
+func resolveMappedModelName(modelMapping string, modelName string) string {
+	if modelMapping == "" || modelMapping == "{}" {
+		return modelName
+	}
+	modelMap := make(map[string]string)
+	if err := common.Unmarshal([]byte(modelMapping), &modelMap); err != nil {
+		return modelName
+	}
+	current := modelName
+	visited := map[string]bool{current: true}
+	for {
+		mapped, ok := modelMap[current]
+		if !ok || mapped == "" || visited[mapped] {
+			return current
+		}
+		visited[mapped] = true
+		current = mapped
+	}
+}
+
+// ChannelUnsatisfiedCapability 返回渠道映射后的模型未满足的能力要求，满足或能力未知时返回空字符串
+func ChannelUnsatisfiedCapability(c *gin.Context, channel *model.Channel, modelName string) string {
+	requirement := getCapabilityRequirement(c)
+	if requirement.IsEmpty() || channel == nil {
+		return ""
+	}
+	capability, ok := model.GetModelCapability(resolveMappedModelName(channel.GetModelMapping(), modelName))
+	if !ok {
+		return ""
+	}
+	return capability.Unsatisfied(requirement)
+}
+
+// getUsablePinnedChannel 校验固定路由的目标渠道仍可用于本次请求：渠道启用、未被临时禁用、支持该模型且属于用户可用分组，
+// 不满足时返回 nil，由调用方回退到常规选路
+func getUsablePinnedChannel(c *gin.Context, channelId int, modelName string) *model.Channel {
+	channel, err := model.CacheGetChannel(channelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled || IsChannelTemporarilyDisabled(channel.Id) {
+		return nil
+	}
+	if !slices.Contains(channel.GetModels(), modelName) {
+		return nil
+	}
+
+	// 与常规选路一致：按候选分组顺序匹配，并写入实际使用的分组以便按该分组计费
+	channelGroups := channel.GetGroups()
+	usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	candidates := common.GetContextKeyStringSlice(c, constant.ContextKeyUsingGroups)
+	if len(candidates) == 0 {
+		candidates = []string{usingGroup}
+	}
+	for _, candidate := range candidates {
+		if candidate == "auto" {
+			for _, autoGroup := range GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup)) {
+				if slices.Contains(channelGroups, autoGroup) {
+					c.Set("auto_group", autoGroup)
+					return channel
+				}
+			}
+			continue
+		}
+		if slices.Contains(channelGroups, candidate) {
+			if candidate != usingGroup {
+				common.SetContextKey(c, constant.ContextKeyUsingGroup, candidate)
+			}
+			return channel
+		}
+	}
+	return nil
+}
 
 func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName string, retry int) (*model.Channel, string, error) {
 	var channel *model.Channel
@@ -31,7 +116,7 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 			logger.LogDebug(c, "Auto selecting group:", autoGroup)
 			channel, err = selectChannelWithTemporarySkip(c, autoGroup, modelName, retry)
 			if err != nil {
-				if errors.Is(err, errAllCandidateChannelsTemporarilyDisabled) {
+				if errors.Is(err, errAllCandidateChannelsTemporarilyDisabled) || errors.Is(err, errAllCandidateChannelsLackCapability) {
 					lastErr = err
 					continue
 				}
@@ -59,30 +144,48 @@ func CacheGetRandomSatisfiedChannel(c *gin.Context, group string, modelName stri
 
 func selectChannelWithTemporarySkip(c *gin.Context, group string, modelName string, retry int) (*model.Channel, error) {
 	attempts := 0
+	lackCapability := false
 	var excluded map[int]struct{}
+	skipErr := func() error {
+		if lackCapability {
+			return fmt.Errorf("%w: group=%s, model=%s", errAllCandidateChannelsLackCapability, group, modelName)
+		}
+		return fmt.Errorf("%w: group=%s, model=%s", errAllCandidateChannelsTemporarilyDisabled, group, modelName)
+	}
 	for {
 		channel, err := model.GetRandomSatisfiedChannel(group, modelName, retry, excluded)
 		if err != nil {
 			if errors.Is(err, model.ErrAllCandidateChannelsFiltered) {
-				return nil, fmt.Errorf("%w: group=%s, model=%s", errAllCandidateChannelsTemporarilyDisabled, group, modelName)
+				return nil, skipErr()
 			}
 			return channel, err
 		}
 		if channel == nil {
 			return nil, nil
 		}
-		expireAt, reason, ok := GetTemporaryDisabledChannelInfo(channel.Id)
-		if !ok {
-			return channel, nil
-		}
 		if excluded == nil {
 			excluded = make(map[int]struct{})
 		}
-		excluded[channel.Id] = struct{}{}
-		logger.LogWarn(c, fmt.Sprintf("channel #%d is temporarily disabled until %s: %s", channel.Id, expireAt.Format(time.RFC3339), reason))
+		if expireAt, reason, ok := GetTemporaryDisabledChannelInfo(channel.Id); ok {
+			excluded[channel.Id] = struct{}{}
+			logger.LogWarn(c, fmt.Sprintf("channel #%d is temporarily disabled until %s: %s", channel.Id, expireAt.Format(time.RFC3339), reason))
+		} else if snapshot := channel.LoadKeyUsageSnapshot(); !channel.HasAvailableKey(snapshot) {
+			excluded[channel.Id] = struct{}{}
+			logger.LogDebug(c, fmt.Sprintf("channel #%d skipped: all keys are cooling down or over limits", channel.Id))
+		} else if missing := ChannelUnsatisfiedCapability(c, channel, modelName); missing != "" {
+			excluded[channel.Id] = struct{}{}
+			lackCapability = true
+			logger.LogDebug(c, fmt.Sprintf("channel #%d skipped: mapped model does not support %s", channel.Id, missing))
+		} else {
+			// 选 key 时复用本次读取的 key 实时状态
+			if snapshot != nil {
+				common.SetContextKey(c, constant.ContextKeyChannelKeyUsageSnapshot, snapshot)
+			}
+			return channel, nil
+		}
 		attempts++
 		if attempts >= maxTemporaryDisableSelectionAttempts {
-			return nil, fmt.Errorf("%w: group=%s, model=%s", errAllCandidateChannelsTemporarilyDisabled, group, modelName)
+			return nil, skipErr()
 		}
 	}
 }
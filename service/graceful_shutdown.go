@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const shutdownWaitPollInterval = 100 * time.Millisecond
+
+var (
+	shuttingDown atomic.Bool
+
+	// 进行中的中继请求数；与 shuttingDown 的检查在同一把锁内完成，避免开始排空后仍有新请求计入
+	relayInflightLock  sync.Mutex
+	relayInflightCount int64
+
+	// 进行中的异步结算任务数（返还预扣费等）
+	pendingSettlementCount atomic.Int64
+)
+
+// IsShuttingDown 返回服务是否已开始优雅关闭，关闭期间就绪检查失败且不再接受新的中继请求
+func IsShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// BeginShutdown 标记服务进入优雅关闭阶段
+func BeginShutdown() {
+	relayInflightLock.Lock()
+	defer relayInflightLock.Unlock()
+	shuttingDown.Store(true)
+}
+
+// AcquireRelayRequest 登记一个进行中的中继请求，服务关闭中时返回 false
+func AcquireRelayRequest() bool {
+	relayInflightLock.Lock()
+	defer relayInflightLock.Unlock()
+	if shuttingDown.Load() {
+		return false
+	}
+	relayInflightCount++
+	return true
+}
+
+func ReleaseRelayRequest() {
+	relayInflightLock.Lock()
+	defer relayInflightLock.Unlock()
+	relayInflightCount--
+}
+
+func GetRelayInflightCount() int64 {
+	relayInflightLock.Lock()
+	defer relayInflightLock.Unlock()
+	return relayInflightCount
+}
+
+// GoSettlement 异步执行结算任务，优雅关闭时会等待这些任务完成后再关闭数据库
+func GoSettlement(task func()) {
+	pendingSettlementCount.Add(1)
+	gopool.Go(func() {
+		defer pendingSettlementCount.Add(-1)
+		task()
+	})
+}
+
+// WaitRelayRequests 等待进行中的中继请求全部结束，超时返回 false
+func WaitRelayRequests(ctx context.Context) bool {
+	return waitUntilZero(ctx, GetRelayInflightCount)
+}
+
+// WaitPendingSettlements 等待异步结算任务全部完成，超时返回 false
+func WaitPendingSettlements(ctx context.Context) bool {
+	return waitUntilZero(ctx, pendingSettlementCount.Load)
+}
+
+func waitUntilZero(ctx context.Context, count func() int64) bool {
+	ticker := time.NewTicker(shutdownWaitPollInterval)
+	defer ticker.Stop()
+	for {
+		if count() <= 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			common.SysLog(fmt.Sprintf("graceful shutdown wait timed out with %d tasks remaining", count()))
+			return false
+		case <-ticker.C:
+		}
+	}
+}
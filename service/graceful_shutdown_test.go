@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsRelayRequests(t *testing.T) {
+	t.Cleanup(func() {
+		shuttingDown.Store(false)
+	})
+
+	if !AcquireRelayRequest() {
+		t.Fatal("expected relay request to be accepted before shutdown")
+	}
+	BeginShutdown()
+	if AcquireRelayRequest() {
+		t.Fatal("expected relay request to be rejected during shutdown")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if WaitRelayRequests(ctx) {
+		t.Fatal("expected wait to time out with an in-flight request")
+	}
+
+	done := make(chan struct{})
+	GoSettlement(func() {
+		<-done
+	})
+	time.AfterFunc(20*time.Millisecond, func() {
+		ReleaseRelayRequest()
+		close(done)
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !WaitRelayRequests(ctx) || !WaitPendingSettlements(ctx) {
+		t.Fatal("expected in-flight request and settlement to finish")
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	jobDispatchInterval = 5 * time.Second
+	// jobLeaseTTL 租约有效期，持有者每 jobLeaseRenewInterval 续期一次；节点宕机后其他节点最多等待一个 TTL 接管
+	jobLeaseTTL           = 30 * time.Second
+	jobLeaseRenewInterval = 10 * time.Second
+	jobLeaseRedisKey      = "job_lease:"
+)
+
+// 获取或续期租约：租约不存在或本来就由当前节点持有时写入并设置过期时间
+var jobLeaseAcquireScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == false or holder == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var jobLeaseReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// BackgroundJob 集群内同一时刻只在一个节点运行的后台任务
+type BackgroundJob struct {
+	Name        string
+	Description string
+	// Interval 两次运行之间的间隔，每次运行结束后重新读取，可随设置变化
+	Interval func() time.Duration
+	// Enabled 为 nil 时始终启用；未启用时不会按计划运行，但仍可手动触发
+	Enabled func() bool
+	Run     func() error
+}
+
+type jobRuntime struct {
+	job     *BackgroundJob
+	running atomic.Bool
+	// 以下字段只在调度协程中访问
+	leaseHeld    bool
+	leaseRenewAt time.Time
+}
+
+// JobStatus 任务注册信息与集群中的运行状态
+type JobStatus struct {
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	IntervalSeconds  int64  `json:"interval_seconds"`
+	Enabled          bool   `json:"enabled"`
+	Holder           string `json:"holder"`
+	LeaseExpiresAt   int64  `json:"lease_expires_at"`
+	RunningLocally   bool   `json:"running_locally"`
+	LastRunAt        int64  `json:"last_run_at"`
+	LastRunBy        string `json:"last_run_by"`
+	LastDurationMs   int64  `json:"last_duration_ms"`
+	LastError        string `json:"last_error"`
+	NextRunAt        int64  `json:"next_run_at"`
+	RunCount         int64  `json:"run_count"`
+	TriggerRequested bool   `json:"trigger_requested"`
+}
+
+var (
+	jobRegistryLock sync.RWMutex
+	jobRegistry     []*jobRuntime
+
+	jobSchedulerOnce   sync.Once
+	jobSchedulerStop   = make(chan struct{})
+	jobSchedulerDone   = make(chan struct{})
+	jobSchedulerActive atomic.Bool
+	// jobRunningGroup 跟踪当前节点运行中的任务，关闭时等待其结束
+	jobRunningGroup sync.WaitGroup
+
+	jobNodeId = common.GetNodeId()
+)
+
+// RegisterBackgroundJob 注册后台任务，需在 StartJobScheduler 之前调用
+func RegisterBackgroundJob(job *BackgroundJob) {
+	jobRegistryLock.Lock()
+	defer jobRegistryLock.Unlock()
+	for _, runtime := range jobRegistry {
+		if runtime.job.Name == job.Name {
+			common.SysError("background job registered twice: " + job.Name)
+			return
+		}
+	}
+	jobRegistry = append(jobRegistry, &jobRuntime{job: job})
+}
+
+func getJobRuntimes() []*jobRuntime {
+	jobRegistryLock.RLock()
+	defer jobRegistryLock.RUnlock()
+	return append([]*jobRuntime(nil), jobRegistry...)
+}
+
+func findJobRuntime(name string) *jobRuntime {
+	for _, runtime := range getJobRuntimes() {
+		if runtime.job.Name == name {
+			return runtime
+		}
+	}
+	return nil
+}
+
+func (j *BackgroundJob) isEnabled() bool {
+	return j.Enabled == nil || j.Enabled()
+}
+
+// StartJobScheduler 启动任务调度；所有节点都参与租约竞争，每个任务的租约相互独立，不同任务可以运行在不同节点上
+// 设置 JOB_SCHEDULER_ENABLED=false 的节点不运行任何后台任务
+func StartJobScheduler() {
+	if !common.GetEnvOrDefaultBool("JOB_SCHEDULER_ENABLED", true) {
+		common.SysLog("job scheduler disabled on this node")
+		return
+	}
+	jobSchedulerOnce.Do(func() {
+		jobSchedulerActive.Store(true)
+		common.SysLog(fmt.Sprintf("job scheduler started, node id: %s, lease backend: %s", jobNodeId, jobLeaseBackend()))
+		go func() {
+			defer close(jobSchedulerDone)
+			ticker := time.NewTicker(jobDispatchInterval)
+			defer ticker.Stop()
+			for {
+				dispatchJobs(time.Now())
+				select {
+				case <-jobSchedulerStop:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// StopJobScheduler 停止调度，不再启动新的任务；运行中的任务由 WaitBackgroundJobs 等待
+func StopJobScheduler() {
+	if !jobSchedulerActive.Load() {
+		return
+	}
+	close(jobSchedulerStop)
+	<-jobSchedulerDone
+}
+
+// WaitBackgroundJobs 在 StopJobScheduler 之后调用，等待当前节点运行中的任务结束，超时返回 false；
+// 随后释放空闲任务的租约，让其他节点尽快接管，仍在运行的任务租约等待自然过期
+func WaitBackgroundJobs(ctx context.Context) bool {
+	if !jobSchedulerActive.Load() {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		jobRunningGroup.Wait()
+		close(done)
+	}()
+	finished := true
+	select {
+	case <-done:
+	case <-ctx.Done():
+		finished = false
+	}
+	for _, runtime := range getJobRuntimes() {
+		if runtime.running.Load() {
+			common.SysLog(fmt.Sprintf("background job %s still running at shutdown", runtime.job.Name))
+			continue
+		}
+		if !runtime.leaseHeld {
+			continue
+		}
+		if err := releaseJobLease(runtime.job.Name); err != nil {
+			common.SysLog(fmt.Sprintf("failed to release lease of job %s: %s", runtime.job.Name, err.Error()))
+		}
+	}
+	return finished
+}
+
+func dispatchJobs(now time.Time) {
+	states, err := model.GetJobStates()
+	if err != nil {
+		common.SysLog("failed to load job states: " + err.Error())
+		return
+	}
+	for _, runtime := range getJobRuntimes() {
+		state := states[runtime.job.Name]
+		if !maintainJobLease(runtime, state, now) {
+			continue
+		}
+		if runtime.running.Load() {
+			continue
+		}
+		triggered := state != nil && state.TriggerRequested
+		due := state == nil || state.NextRunAt <= now.Unix()
+		if triggered || (due && runtime.job.isEnabled()) {
+			runtime.running.Store(true)
+			jobRunningGroup.Add(1)
+			gopool.Go(func() {
+				runJob(runtime)
+			})
+		}
+	}
+}
+
+// maintainJobLease 获取或续期任务租约，返回当前节点是否持有租约
+func maintainJobLease(runtime *jobRuntime, state *model.JobState, now time.Time) bool {
+	if runtime.leaseHeld && now.Before(runtime.leaseRenewAt) {
+		return true
+	}
+	// 数据库租约仍由其他节点持有时不必尝试
+	if !common.RedisEnabled && !runtime.leaseHeld && state != nil &&
+		state.Holder != "" && state.Holder != jobNodeId && state.LeaseExpiresAt >= now.Unix() {
+		return false
+	}
+	held, err := acquireJobLease(runtime.job.Name)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to acquire lease of job %s: %s", runtime.job.Name, err.Error()))
+		held = false
+	}
+	if runtime.leaseHeld && !held {
+		common.SysLog(fmt.Sprintf("lost lease of job %s", runtime.job.Name))
+	} else if !runtime.leaseHeld && held {
+		common.SysLog(fmt.Sprintf("acquired lease of job %s", runtime.job.Name))
+	}
+	runtime.leaseHeld = held
+	runtime.leaseRenewAt = now.Add(jobLeaseRenewInterval)
+	return held
+}
+
+func runJob(runtime *jobRuntime) {
+	defer jobRunningGroup.Done()
+	defer runtime.running.Store(false)
+	job := runtime.job
+	startedAt := time.Now()
+	err := runJobSafely(job)
+	duration := time.Since(startedAt)
+	if err != nil {
+		common.SysError(fmt.Sprintf("background job %s failed: %s", job.Name, err.Error()))
+	}
+	nextRunAt := time.Now().Add(job.Interval())
+	if saveErr := model.SaveJobRunResult(job.Name, jobNodeId, startedAt, duration, err, nextRunAt); saveErr != nil {
+		common.SysLog(fmt.Sprintf("failed to save result of job %s: %s", job.Name, saveErr.Error()))
+	}
+}
+
+func runJobSafely(job *BackgroundJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("background job %s panic: %v\n%s", job.Name, r, string(debug.Stack())))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run()
+}
+
+// TriggerBackgroundJob 请求立即运行任务，由持有租约的节点在下一次调度检查时执行
+func TriggerBackgroundJob(name string) error {
+	if findJobRuntime(name) == nil {
+		return errors.New("任务不存在")
+	}
+	return model.RequestJobTrigger(name)
+}
+
+// GetBackgroundJobStatuses 按注册顺序返回所有任务的状态
+func GetBackgroundJobStatuses() ([]*JobStatus, error) {
+	states, err := model.GetJobStates()
+	if err != nil {
+		return nil, err
+	}
+	runtimes := getJobRuntimes()
+	statuses := make([]*JobStatus, 0, len(runtimes))
+	for _, runtime := range runtimes {
+		job := runtime.job
+		status := &JobStatus{
+			Name:            job.Name,
+			Description:     job.Description,
+			IntervalSeconds: int64(job.Interval() / time.Second),
+			Enabled:         job.isEnabled(),
+			RunningLocally:  runtime.running.Load(),
+		}
+		if state := states[job.Name]; state != nil {
+			status.Holder = state.Holder
+			status.LeaseExpiresAt = state.LeaseExpiresAt
+			status.LastRunAt = state.LastRunAt
+			status.LastRunBy = state.LastRunBy
+			status.LastDurationMs = state.LastDurationMs
+			status.LastError = state.LastError
+			status.NextRunAt = state.NextRunAt
+			status.RunCount = state.RunCount
+			status.TriggerRequested = state.TriggerRequested
+		}
+		if common.RedisEnabled {
+			status.Holder, status.LeaseExpiresAt = getRedisJobLease(job.Name)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func jobLeaseBackend() string {
+	if common.RedisEnabled {
+		return "redis"
+	}
+	return "database"
+}
+
+func acquireJobLease(name string) (bool, error) {
+	if !common.RedisEnabled {
+		return model.TryAcquireJobLease(name, jobNodeId, jobLeaseTTL)
+	}
+	result, err := jobLeaseAcquireScript.Run(context.Background(), common.RDB,
+		[]string{jobLeaseRedisKey + name}, jobNodeId, jobLeaseTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func releaseJobLease(name string) error {
+	if !common.RedisEnabled {
+		return model.ReleaseJobLease(name, jobNodeId)
+	}
+	return jobLeaseReleaseScript.Run(context.Background(), common.RDB,
+		[]string{jobLeaseRedisKey + name}, jobNodeId).Err()
+}
+
+func getRedisJobLease(name string) (string, int64) {
+	ctx := context.Background()
+	key := jobLeaseRedisKey + name
+	holder, err := common.RDB.Get(ctx, key).Result()
+	if err != nil {
+		return "", 0
+	}
+	ttl, err := common.RDB.PTTL(ctx, key).Result()
+	if err != nil || ttl < 0 {
+		return holder, 0
+	}
+	return holder, time.Now().Add(ttl).Unix()
+}
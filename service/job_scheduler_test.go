@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestJobSchedulerLeaseAndTrigger(t *testing.T) {
+	originalDB, originalRedisEnabled := model.DB, common.RedisEnabled
+	jobRegistryLock.Lock()
+	originalRegistry := jobRegistry
+	jobRegistry = nil
+	jobRegistryLock.Unlock()
+	t.Cleanup(func() {
+		model.DB = originalDB
+		common.RedisEnabled = originalRedisEnabled
+		jobRegistryLock.Lock()
+		jobRegistry = originalRegistry
+		jobRegistryLock.Unlock()
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:job-scheduler-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.JobState{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	common.RedisEnabled = false
+
+	runs := make(chan struct{}, 4)
+	RegisterBackgroundJob(&BackgroundJob{
+		Name:     "test_job",
+		Interval: func() time.Duration { return time.Hour },
+		Enabled:  func() bool { return true },
+		Run: func() error {
+			runs <- struct{}{}
+			return errors.New("boom")
+		},
+	})
+	runtime := findJobRuntime("test_job")
+	waitRun := func() {
+		t.Helper()
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("job did not run")
+		}
+		for runtime.running.Load() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// 其他节点持有租约时不运行
+	if ok, err := model.TryAcquireJobLease("test_job", "other-node", time.Minute); err != nil || !ok {
+		t.Fatalf("other node should acquire lease: ok=%v err=%v", ok, err)
+	}
+	dispatchJobs(time.Now())
+	if runtime.leaseHeld || len(runs) != 0 {
+		t.Fatal("job should not run while another node holds the lease")
+	}
+
+	// 租约过期后接管并运行
+	if err := db.Model(&model.JobState{}).Where("name = ?", "test_job").Update("lease_expires_at", time.Now().Add(-time.Second).Unix()).Error; err != nil {
+		t.Fatal(err)
+	}
+	dispatchJobs(time.Now())
+	waitRun()
+	if ok, _ := model.TryAcquireJobLease("test_job", "other-node", time.Minute); ok {
+		t.Fatal("other node should not acquire a lease held by this node")
+	}
+	states, err := model.GetJobStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := states["test_job"]
+	if state.RunCount != 1 || state.LastRunBy != jobNodeId || state.LastError != "boom" || state.NextRunAt <= time.Now().Unix() {
+		t.Fatalf("unexpected job state after run: %+v", state)
+	}
+
+	// 未到下次运行时间不重复运行，手动触发后立即运行
+	dispatchJobs(time.Now())
+	if len(runs) != 0 {
+		t.Fatal("job should not run before next run time")
+	}
+	if err := TriggerBackgroundJob("test_job"); err != nil {
+		t.Fatal(err)
+	}
+	dispatchJobs(time.Now())
+	waitRun()
+	statuses, err := GetBackgroundJobStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].RunCount != 2 || statuses[0].TriggerRequested || statuses[0].Holder != jobNodeId {
+		t.Fatalf("unexpected job status after trigger: %+v", statuses)
+	}
+
+	if err := TriggerBackgroundJob("missing_job"); err == nil {
+		t.Fatal("triggering an unknown job should fail")
+	}
+}
+
+func TestWaitBackgroundJobs(t *testing.T) {
+	originalDB, originalRedisEnabled, originalActive := model.DB, common.RedisEnabled, jobSchedulerActive.Load()
+	jobRegistryLock.Lock()
+	originalRegistry := jobRegistry
+	jobRegistry = nil
+	jobRegistryLock.Unlock()
+	t.Cleanup(func() {
+		model.DB = originalDB
+		common.RedisEnabled = originalRedisEnabled
+		jobSchedulerActive.Store(originalActive)
+		jobRegistryLock.Lock()
+		jobRegistry = originalRegistry
+		jobRegistryLock.Unlock()
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:job-scheduler-wait-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.JobState{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	common.RedisEnabled = false
+	jobSchedulerActive.Store(true)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	RegisterBackgroundJob(&BackgroundJob{
+		Name:     "slow_job",
+		Interval: func() time.Duration { return time.Hour },
+		Run: func() error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	dispatchJobs(time.Now())
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+
+	// 超时返回时不释放运行中任务的租约
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if WaitBackgroundJobs(ctx) {
+		t.Fatal("wait should time out while the job is running")
+	}
+	states, err := model.GetJobStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if states["slow_job"].Holder != jobNodeId {
+		t.Fatalf("lease of a running job should be kept, got holder %q", states["slow_job"].Holder)
+	}
+
+	// 任务结束后等待返回，运行结果已保存且租约已释放
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !WaitBackgroundJobs(ctx) {
+		t.Fatal("wait should return after the job finished")
+	}
+	states, err = model.GetJobStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := states["slow_job"]; state.RunCount != 1 || state.Holder != "" {
+		t.Fatalf("unexpected job state after wait: %+v", state)
+	}
+}
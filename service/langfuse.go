@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -13,12 +14,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
-
-	"github.com/bytedance/gopkg/util/gopool"
 )
 
 const (
@@ -26,27 +24,6 @@ const (
 	langfuseMaxStringChars = 32768
 )
 
-var langfuseMissingConfigOnce sync.Once
-
-type LangfuseCaptureRequest struct {
-	UserID              int
-	TokenID             int
-	TokenName           string
-	Group               string
-	Model               string
-	Method              string
-	Path                string
-	RequestID           string
-	CaptureRate         float64
-	StatusCode          int
-	StartedAt           time.Time
-	EndedAt             time.Time
-	RequestBody         []byte
-	ResponseBody        []byte
-	RequestContentType  string
-	ResponseContentType string
-}
-
 type langfuseConfig struct {
 	PublicKey   string
 	SecretKey   string
@@ -84,7 +61,7 @@ func (cfg langfuseConfig) ingestionURL() string {
 	return baseURL + "/api/public/ingestion"
 }
 
-func shouldSampleLangfuseCapture(rate float64) bool {
+func shouldSampleCapture(rate float64) bool {
 	if rate <= 0 {
 		return false
 	}
@@ -98,121 +75,104 @@ func shouldSampleLangfuseCapture(rate float64) bool {
 	return float64(n.Int64())/1_000_000 < rate
 }
 
-func CaptureRelayToLangfuse(capture LangfuseCaptureRequest) {
-	if capture.CaptureRate <= 0 || capture.StatusCode >= http.StatusBadRequest {
-		return
-	}
-	if !shouldSampleLangfuseCapture(capture.CaptureRate) {
-		return
-	}
+// langfuseCaptureSink 将采集记录作为 trace 与 generation 写入 Langfuse 的 ingestion 接口，配置来自环境变量
+type langfuseCaptureSink struct {
+	cfg langfuseConfig
+}
+
+func newLangfuseCaptureSink() (*langfuseCaptureSink, error) {
 	cfg, ok := loadLangfuseConfig()
 	if !ok {
-		langfuseMissingConfigOnce.Do(func() {
-			common.SysLog("Langfuse capture skipped: LANGFUSE_PUBLIC_KEY or LANGFUSE_SECRET_KEY is not configured")
-		})
-		return
+		return nil, errors.New("LANGFUSE_PUBLIC_KEY or LANGFUSE_SECRET_KEY is not configured")
 	}
+	return &langfuseCaptureSink{cfg: cfg}, nil
+}
 
-	payload, err := buildLangfusePayload(cfg, capture)
-	if err != nil {
-		common.SysLog("Langfuse capture skipped: " + err.Error())
-		return
-	}
+func (s *langfuseCaptureSink) Write(ctx context.Context, records []*CaptureRecord) error {
+	return sendLangfusePayload(ctx, s.cfg, buildLangfusePayload(s.cfg, records))
+}
 
-	gopool.Go(func() {
-		if err := sendLangfusePayload(cfg, payload); err != nil {
-			common.SysLog("Langfuse capture failed: " + err.Error())
-		}
-	})
+func (s *langfuseCaptureSink) Close() error {
+	return nil
 }
 
-func buildLangfusePayload(cfg langfuseConfig, capture LangfuseCaptureRequest) (map[string]any, error) {
-	traceID := common.GetUUID()
-	generationID := common.GetUUID()
+func buildLangfusePayload(cfg langfuseConfig, records []*CaptureRecord) map[string]any {
 	now := time.Now().UTC()
-	startedAt := capture.StartedAt.UTC()
-	if startedAt.IsZero() {
-		startedAt = now
-	}
-	endedAt := capture.EndedAt.UTC()
-	if endedAt.IsZero() {
-		endedAt = now
-	}
-	input := extractLangfuseInput(capture.RequestBody, capture.RequestContentType)
-	output := extractLangfuseOutput(capture.ResponseBody, capture.ResponseContentType)
-	usageDetails := extractUsageDetails(capture.ResponseBody)
-	metadata := map[string]any{
-		"request_id":   capture.RequestID,
-		"group":        capture.Group,
-		"capture_rate": capture.CaptureRate,
-		"token_id":     capture.TokenID,
-		"token_name":   capture.TokenName,
-		"method":       capture.Method,
-		"path":         capture.Path,
-		"status_code":  capture.StatusCode,
-		"source":       "privhub",
-	}
-	name := "PrivHub relay"
-	if capture.Model != "" {
-		name = "PrivHub relay " + capture.Model
-	}
-
-	traceBody := map[string]any{
-		"id":          traceID,
-		"timestamp":   startedAt.Format(time.RFC3339Nano),
-		"environment": cfg.Environment,
-		"name":        name,
-		"userId":      strconv.Itoa(capture.UserID),
-		"input":       input,
-		"output":      output,
-		"metadata":    metadata,
-		"tags":        []string{"privhub", "group:" + capture.Group},
-	}
-	generationBody := map[string]any{
-		"id":          generationID,
-		"traceId":     traceID,
-		"name":        name,
-		"startTime":   startedAt.Format(time.RFC3339Nano),
-		"endTime":     endedAt.Format(time.RFC3339Nano),
-		"model":       capture.Model,
-		"input":       input,
-		"output":      output,
-		"metadata":    metadata,
-		"environment": cfg.Environment,
-	}
-	if len(usageDetails) > 0 {
-		generationBody["usageDetails"] = usageDetails
-	}
+	batch := make([]map[string]any, 0, len(records)*2)
+	for _, record := range records {
+		traceID := common.GetUUID()
+		metadata := map[string]any{
+			"request_id":   record.RequestID,
+			"group":        record.Group,
+			"capture_rate": record.CaptureRate,
+			"token_id":     record.TokenID,
+			"token_name":   record.TokenName,
+			"method":       record.Method,
+			"path":         record.Path,
+			"status_code":  record.StatusCode,
+			"source":       "privhub",
+		}
+		name := "PrivHub relay"
+		if record.Model != "" {
+			name = "PrivHub relay " + record.Model
+		}
 
-	return map[string]any{
-		"batch": []map[string]any{
-			{
+		traceBody := map[string]any{
+			"id":          traceID,
+			"timestamp":   record.StartedAt.Format(time.RFC3339Nano),
+			"environment": cfg.Environment,
+			"name":        name,
+			"userId":      strconv.Itoa(record.UserID),
+			"input":       record.Input,
+			"output":      record.Output,
+			"metadata":    metadata,
+			"tags":        []string{"privhub", "group:" + record.Group},
+		}
+		generationBody := map[string]any{
+			"id":          common.GetUUID(),
+			"traceId":     traceID,
+			"name":        name,
+			"startTime":   record.StartedAt.Format(time.RFC3339Nano),
+			"endTime":     record.EndedAt.Format(time.RFC3339Nano),
+			"model":       record.Model,
+			"input":       record.Input,
+			"output":      record.Output,
+			"metadata":    metadata,
+			"environment": cfg.Environment,
+		}
+		if len(record.Usage) > 0 {
+			generationBody["usageDetails"] = record.Usage
+		}
+		batch = append(batch,
+			map[string]any{
 				"id":        common.GetUUID(),
 				"timestamp": now.Format(time.RFC3339Nano),
 				"type":      "trace-create",
 				"body":      traceBody,
 			},
-			{
+			map[string]any{
 				"id":        common.GetUUID(),
 				"timestamp": now.Format(time.RFC3339Nano),
 				"type":      "generation-create",
 				"body":      generationBody,
 			},
-		},
+		)
+	}
+
+	return map[string]any{
+		"batch": batch,
 		"metadata": map[string]any{
 			"sdk_name":        "privhub",
 			"sdk_integration": "privhub-langfuse-capture",
 		},
-	}, nil
+	}
 }
 
-func sendLangfusePayload(cfg langfuseConfig, payload map[string]any) error {
+func sendLangfusePayload(ctx context.Context, cfg langfuseConfig, payload map[string]any) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.ingestionURL(), bytes.NewReader(body))
 	if err != nil {
 		return err
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const (
+	logArchiveDayLayout       = "2006-01-02"
+	logArchiveContentType     = "application/gzip"
+	logArchiveManifestSuffix  = ".manifest.json"
+	logArchiveRequestTimeout  = 5 * time.Minute
+	logArchiveMinIntervalMins = 5
+)
+
+var (
+	logArchiveRunLock sync.Mutex
+)
+
+// LogArchiveManifest 与归档文件一同写入对象存储的清单，便于脱离数据库恢复归档索引
+type LogArchiveManifest struct {
+	ObjectKey    string `json:"object_key"`
+	PartitionDay string `json:"partition_day"`
+	StartTime    int64  `json:"start_time"`
+	EndTime      int64  `json:"end_time"`
+	MinLogId     int    `json:"min_log_id"`
+	MaxLogId     int    `json:"max_log_id"`
+	RowCount     int    `json:"row_count"`
+	TypeCounts   string `json:"type_counts"`
+	SizeBytes    int64  `json:"size_bytes"`
+	Checksum     string `json:"checksum"`
+	Format       string `json:"format"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// LogArchiveResult 单次归档任务的执行结果
+type LogArchiveResult struct {
+	Archives     int   `json:"archives"`
+	ArchivedRows int64 `json:"archived_rows"`
+	DeletedRows  int64 `json:"deleted_rows"`
+}
+
+// LogArchiveInterval 返回日志归档任务的运行间隔，不小于 logArchiveMinIntervalMins 分钟
+func LogArchiveInterval() time.Duration {
+	interval := max(operation_setting.GetLogArchiveSetting().IntervalMinutes, logArchiveMinIntervalMins)
+	return time.Duration(interval) * time.Minute
+}
+
+// RunScheduledLogArchive 执行一次日志归档，由后台任务调度器定期调用
+func RunScheduledLogArchive() error {
+	result, err := RunLogArchive(context.Background())
+	if err != nil {
+		return err
+	}
+	if result.ArchivedRows > 0 {
+		common.SysLog(fmt.Sprintf("archived %d logs into %d archives", result.ArchivedRows, result.Archives))
+	}
+	return nil
+}
+
+func logArchiveCutoff(setting *operation_setting.LogArchiveSetting, now time.Time) (int64, error) {
+	if setting.RetentionDays <= 0 {
+		return 0, errors.New("日志归档保留天数必须大于 0")
+	}
+	return now.AddDate(0, 0, -setting.RetentionDays).Unix(), nil
+}
+
+// LogArchiveObjectKey 归档对象键：{prefix}/dt=YYYY-MM-DD/logs-{min}-{max}.jsonl.gz，同一批次重复归档时键不变
+func LogArchiveObjectKey(prefix string, day string, minLogId int, maxLogId int) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = "logs"
+	}
+	return fmt.Sprintf("%s/dt=%s/logs-%d-%d.jsonl.gz", prefix, day, minLogId, maxLogId)
+}
+
+// RunLogArchive 将超过保留天数的日志按天压缩写入对象存储，写入成功后再从数据库删除
+func RunLogArchive(ctx context.Context) (*LogArchiveResult, error) {
+	if !logArchiveRunLock.TryLock() {
+		return nil, errors.New("日志归档正在进行中")
+	}
+	defer logArchiveRunLock.Unlock()
+
+	setting := operation_setting.GetLogArchiveSetting()
+	cutoff, err := logArchiveCutoff(setting, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	storage, err := GetObjectStorage()
+	if err != nil {
+		return nil, err
+	}
+	batchSize := setting.BatchSize
+	if batchSize <= 0 {
+		batchSize = 50000
+	}
+	maxBatches := max(setting.MaxBatchesPerRun, 1)
+
+	result := &LogArchiveResult{}
+	for i := 0; i < maxBatches; i++ {
+		logs, err := model.GetArchivableLogs(cutoff, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		archives, err := archiveLogBatch(ctx, storage, setting.Prefix, logs)
+		if err != nil {
+			return result, err
+		}
+		deleted, err := model.DeleteArchivedLogs(logs[0].Id, logs[len(logs)-1].Id, cutoff)
+		if err != nil {
+			return result, err
+		}
+		result.Archives += archives
+		result.ArchivedRows += int64(len(logs))
+		result.DeletedRows += deleted
+		if len(logs) < batchSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// archiveLogBatch 将一批按 id 升序的日志按自然日拆分为多个归档文件
+func archiveLogBatch(ctx context.Context, storage *ObjectStorage, prefix string, logs []*model.Log) (int, error) {
+	partitions := make(map[string][]*model.Log)
+	for _, log := range logs {
+		day := time.Unix(log.CreatedAt, 0).Format(logArchiveDayLayout)
+		partitions[day] = append(partitions[day], log)
+	}
+	days := make([]string, 0, len(partitions))
+	for day := range partitions {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		if err := writeLogArchive(ctx, storage, prefix, day, partitions[day]); err != nil {
+			return 0, err
+		}
+	}
+	return len(days), nil
+}
+
+func writeLogArchive(ctx context.Context, storage *ObjectStorage, prefix string, day string, logs []*model.Log) error {
+	body, err := EncodeLogArchive(logs)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	archive := &model.LogArchive{
+		ObjectKey:    LogArchiveObjectKey(prefix, day, logs[0].Id, logs[len(logs)-1].Id),
+		PartitionDay: day,
+		StartTime:    logs[0].CreatedAt,
+		EndTime:      logs[0].CreatedAt,
+		MinLogId:     logs[0].Id,
+		MaxLogId:     logs[len(logs)-1].Id,
+		RowCount:     len(logs),
+		SizeBytes:    int64(len(body)),
+		Checksum:     hex.EncodeToString(sum[:]),
+		CreatedAt:    common.GetTimestamp(),
+	}
+	for _, log := range logs {
+		archive.StartTime = min(archive.StartTime, log.CreatedAt)
+		archive.EndTime = max(archive.EndTime, log.CreatedAt)
+	}
+	if err = archive.SetTypeCounts(logs); err != nil {
+		return err
+	}
+
+	manifest, err := common.Marshal(LogArchiveManifest{
+		ObjectKey:    archive.ObjectKey,
+		PartitionDay: archive.PartitionDay,
+		StartTime:    archive.StartTime,
+		EndTime:      archive.EndTime,
+		MinLogId:     archive.MinLogId,
+		MaxLogId:     archive.MaxLogId,
+		RowCount:     archive.RowCount,
+		TypeCounts:   archive.TypeCounts,
+		SizeBytes:    archive.SizeBytes,
+		Checksum:     archive.Checksum,
+		Format:       "jsonl.gz",
+		CreatedAt:    archive.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, logArchiveRequestTimeout)
+	defer cancel()
+	if err = storage.PutObject(ctx, archive.ObjectKey, body, logArchiveContentType); err != nil {
+		return err
+	}
+	if err = storage.PutObject(ctx, archive.ObjectKey+logArchiveManifestSuffix, manifest, "application/json"); err != nil {
+		return err
+	}
+	return model.SaveLogArchive(archive)
+}
+
+// EncodeLogArchive 将日志编码为 gzip 压缩的 JSONL
+func EncodeLogArchive(logs []*model.Log) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, log := range logs {
+		line, err := common.Marshal(log)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = gz.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readLogArchive 读取归档文件并返回满足过滤条件的日志（按 id 升序）
+func readLogArchive(ctx context.Context, storage *ObjectStorage, key string, filter *model.ArchivedLogFilter) ([]*model.Log, error) {
+	ctx, cancel := context.WithTimeout(ctx, logArchiveRequestTimeout)
+	defer cancel()
+	body, err := storage.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return DecodeLogArchive(body, filter)
+}
+
+// DecodeLogArchive 解析 gzip JSONL 归档，filter 为空时返回全部日志
+func DecodeLogArchive(r io.Reader, filter *model.ArchivedLogFilter) ([]*model.Log, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var logs []*model.Log
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var log model.Log
+		if err = common.Unmarshal(line, &log); err != nil {
+			return nil, err
+		}
+		if filter == nil || filter.Match(&log) {
+			logs = append(logs, &log)
+		}
+	}
+	return logs, scanner.Err()
+}
+
+// ArchivedLogPage 拼接归档后的日志分页结果；Truncated 为 true 时 Total 只是下限：
+// 为凑满当前页而停止扫描、或达到单次扫描上限后，剩余归档中的匹配条数未计入
+type ArchivedLogPage struct {
+	Logs      []*model.Log
+	Total     int64
+	Truncated bool
+}
+
+// GetAllLogsWithArchive 在数据库日志之后拼接对象存储中的归档日志，对调用方透明
+// 排序与 GetAllLogs 一致（id 降序）：归档日志 id 总是小于库内日志，因此先取库内分页，不足部分由归档补齐。
+// 过滤条件只有日志类型且时间范围覆盖整个归档时，直接使用清单中的行数，不读取归档文件；
+// 其余归档只读取覆盖所需偏移的部分，当前页凑满后不再读取
+func GetAllLogsWithArchive(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string) (*ArchivedLogPage, error) {
+	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, startIdx, num, channel, group)
+	if err != nil {
+		return nil, err
+	}
+	page := &ArchivedLogPage{Logs: logs, Total: total}
+	if !system_setting.GetObjectStorageSettings().IsConfigured() || !model.HasLogArchivesInRange(startTimestamp, endTimestamp) {
+		return page, nil
+	}
+	archives, err := model.GetLogArchivesInRange(startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := GetObjectStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &model.ArchivedLogFilter{
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      modelName,
+		Username:       username,
+		TokenName:      tokenName,
+		Channel:        channel,
+		Group:          group,
+	}
+	// 归档部分在合并结果中的偏移与所需条数
+	skip := int64(max(startIdx-int(total), 0))
+	need := num - len(logs)
+	maxReads := operation_setting.GetLogArchiveSetting().MaxQueryArchives
+	reads := 0
+	var archived []*model.Log
+	var matched int64
+	for _, archive := range archives {
+		count, counted := archive.MatchedCount(filter)
+		if counted && (matched+count <= skip || len(archived) >= need) {
+			matched += count
+			continue
+		}
+		if len(archived) >= need || (maxReads > 0 && reads >= maxReads) {
+			page.Truncated = true
+			break
+		}
+		rows, err := readLogArchive(context.Background(), storage, archive.ObjectKey, filter)
+		if err != nil {
+			return nil, fmt.Errorf("读取归档 %s 失败: %w", archive.ObjectKey, err)
+		}
+		reads++
+		for i := len(rows) - 1; i >= 0; i-- {
+			if matched >= skip && len(archived) < need {
+				archived = append(archived, rows[i])
+			}
+			matched++
+		}
+	}
+	if len(archived) > 0 {
+		if err = model.FillLogChannelNames(archived); err != nil {
+			return nil, err
+		}
+		page.Logs = append(page.Logs, archived...)
+	}
+	page.Total += matched
+	return page, nil
+}
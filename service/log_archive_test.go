@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLogArchiveRoundTripAppliesFilter(t *testing.T) {
+	logs := []*model.Log{
+		{Id: 1, Type: model.LogTypeConsume, CreatedAt: 100, ModelName: "gpt-4o-mini", Username: "alice", Group: "default", Quota: 10},
+		{Id: 2, Type: model.LogTypeConsume, CreatedAt: 200, ModelName: "claude-3-haiku", Username: "alice", Group: "default", Quota: 20},
+		{Id: 3, Type: model.LogTypeError, CreatedAt: 300, ModelName: "gpt-4o", Username: "bob", Group: "vip"},
+		{Id: 4, Type: model.LogTypeConsume, CreatedAt: 400, ModelName: "gpt-4o", Username: "alice", Group: "vip", Quota: 40},
+	}
+	body, err := EncodeLogArchive(logs)
+	if err != nil {
+		t.Fatalf("encode archive: %v", err)
+	}
+
+	all, err := DecodeLogArchive(bytes.NewReader(body), nil)
+	if err != nil {
+		t.Fatalf("decode archive: %v", err)
+	}
+	if len(all) != len(logs) || all[3].Quota != 40 || all[2].Username != "bob" {
+		t.Fatalf("unexpected decoded logs: %+v", all)
+	}
+
+	filtered, err := DecodeLogArchive(bytes.NewReader(body), &model.ArchivedLogFilter{
+		LogType:        model.LogTypeConsume,
+		StartTimestamp: 150,
+		ModelName:      "gpt-4%",
+	})
+	if err != nil {
+		t.Fatalf("decode filtered archive: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Id != 4 {
+		t.Fatalf("unexpected filtered logs: %+v", filtered)
+	}
+}
+
+func TestLogArchiveObjectKeyIsDeterministic(t *testing.T) {
+	key := LogArchiveObjectKey("/archive/", "2025-01-02", 10, 20)
+	if key != "archive/dt=2025-01-02/logs-10-20.jsonl.gz" {
+		t.Fatalf("unexpected key %s", key)
+	}
+	if LogArchiveObjectKey("", "2025-01-02", 10, 20) != "logs/dt=2025-01-02/logs-10-20.jsonl.gz" {
+		t.Fatalf("expected default prefix")
+	}
+}
+
+func TestGetAllLogsWithArchiveReadsOnlyNeededArchives(t *testing.T) {
+	storageSetting := system_setting.GetObjectStorageSettings()
+	archiveSetting := operation_setting.GetLogArchiveSetting()
+	originalStorage, originalArchive := *storageSetting, *archiveSetting
+	originalDB, originalLogDB, originalClient := model.DB, model.LOG_DB, httpClient
+	t.Cleanup(func() {
+		*storageSetting = originalStorage
+		*archiveSetting = originalArchive
+		model.DB, model.LOG_DB, httpClient = originalDB, originalLogDB, originalClient
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:log-archive-query-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Log{}, &model.Channel{}, &model.LogArchive{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB, model.LOG_DB = db, db
+	for id := 101; id <= 102; id++ {
+		if err := db.Create(&model.Log{Id: id, Type: model.LogTypeConsume, ModelName: "gpt-4o", CreatedAt: int64(id)}).Error; err != nil {
+			t.Fatalf("create log: %v", err)
+		}
+	}
+
+	// 三个归档：ids 51-100 全为消费日志，ids 21-50 含 10 条错误日志，ids 1-20 为没有按类型统计的早期归档
+	bodies := make(map[string][]byte)
+	newArchive := func(minId int, maxId int, typeOf func(id int) int, legacy bool) {
+		logs := make([]*model.Log, 0, maxId-minId+1)
+		for id := minId; id <= maxId; id++ {
+			logs = append(logs, &model.Log{Id: id, Type: typeOf(id), ModelName: "gpt-4o", CreatedAt: int64(id)})
+		}
+		body, err := EncodeLogArchive(logs)
+		if err != nil {
+			t.Fatalf("encode archive: %v", err)
+		}
+		archive := &model.LogArchive{
+			ObjectKey: LogArchiveObjectKey("logs", "1970-01-01", minId, maxId),
+			StartTime: int64(minId),
+			EndTime:   int64(maxId),
+			MinLogId:  minId,
+			MaxLogId:  maxId,
+			RowCount:  len(logs),
+		}
+		if !legacy {
+			if err := archive.SetTypeCounts(logs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := model.SaveLogArchive(archive); err != nil {
+			t.Fatalf("save archive: %v", err)
+		}
+		bodies["/bucket/"+archive.ObjectKey] = body
+	}
+	consume := func(id int) int { return model.LogTypeConsume }
+	newArchive(51, 100, consume, false)
+	newArchive(21, 50, func(id int) int {
+		if id <= 30 {
+			return model.LogTypeError
+		}
+		return model.LogTypeConsume
+	}, false)
+	newArchive(1, 20, consume, true)
+
+	var reads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		reads = append(reads, r.URL.Path)
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	httpClient = http.DefaultClient
+	*storageSetting = system_setting.ObjectStorageSettings{Endpoint: server.URL, Region: "us-east-1", Bucket: "bucket", AccessKeyId: "ak", SecretAccessKey: "sk", UsePathStyle: true}
+	archiveSetting.MaxQueryArchives = 0
+
+	cases := []struct {
+		name          string
+		logType       int
+		modelName     string
+		startIdx      int
+		maxReads      int
+		wantFirstId   int
+		wantLen       int
+		wantTotal     int64
+		wantTruncated bool
+		wantReads     []string
+	}{
+		{
+			name:        "unfiltered totals come from archive row counts",
+			startIdx:    0,
+			wantFirstId: 102,
+			wantLen:     10,
+			wantTotal:   102,
+			wantReads:   []string{"/bucket/logs/dt=1970-01-01/logs-51-100.jsonl.gz"},
+		},
+		{
+			name:          "only the archive covering the offset is read",
+			logType:       model.LogTypeConsume,
+			startIdx:      60,
+			wantFirstId:   42,
+			wantLen:       10,
+			wantTotal:     72,
+			wantTruncated: true,
+			wantReads:     []string{"/bucket/logs/dt=1970-01-01/logs-21-50.jsonl.gz"},
+		},
+		{
+			name:          "filtered queries stop at the read limit",
+			modelName:     "gpt-4%",
+			startIdx:      60,
+			maxReads:      1,
+			wantLen:       0,
+			wantTotal:     52,
+			wantTruncated: true,
+			wantReads:     []string{"/bucket/logs/dt=1970-01-01/logs-51-100.jsonl.gz"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reads = nil
+			archiveSetting.MaxQueryArchives = tc.maxReads
+			page, err := GetAllLogsWithArchive(tc.logType, 0, 0, tc.modelName, "", "", tc.startIdx, 10, 0, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Logs) != tc.wantLen || (tc.wantLen > 0 && page.Logs[0].Id != tc.wantFirstId) {
+				t.Fatalf("unexpected logs: %d, %+v", len(page.Logs), page.Logs)
+			}
+			if page.Total != tc.wantTotal || page.Truncated != tc.wantTruncated {
+				t.Fatalf("expected total %d truncated %v, got %d %v", tc.wantTotal, tc.wantTruncated, page.Total, page.Truncated)
+			}
+			if strings.Join(reads, ",") != strings.Join(tc.wantReads, ",") {
+				t.Fatalf("expected reads %v, got %v", tc.wantReads, reads)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type LogExportFormat string
+
+const (
+	LogExportFormatCSV     LogExportFormat = "csv"
+	LogExportFormatJSONL   LogExportFormat = "jsonl"
+	LogExportFormatParquet LogExportFormat = "parquet"
+)
+
+const logExportBatchSize = 1000
+
+// logExportParquetRowGroupSize Parquet 每个行组的行数，写满即落盘，避免整个导出结果缓存在内存中直到关闭
+const logExportParquetRowGroupSize = 10000
+
+func ParseLogExportFormat(format string) (LogExportFormat, error) {
+	switch LogExportFormat(strings.ToLower(strings.TrimSpace(format))) {
+	case "", LogExportFormatCSV:
+		return LogExportFormatCSV, nil
+	case LogExportFormatJSONL:
+		return LogExportFormatJSONL, nil
+	case LogExportFormatParquet:
+		return LogExportFormatParquet, nil
+	default:
+		return "", fmt.Errorf("不支持的导出格式 %s，仅支持 csv、jsonl、parquet", format)
+	}
+}
+
+func (f LogExportFormat) ContentType() string {
+	switch f {
+	case LogExportFormatJSONL:
+		return "application/x-ndjson"
+	case LogExportFormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+func (f LogExportFormat) FileName(prefix string) string {
+	return fmt.Sprintf("%s-%s.%s", prefix, time.Now().Format("20060102150405"), f)
+}
+
+// LogExportRow 导出日志的一行，字段顺序即 CSV 列顺序
+type LogExportRow struct {
+	Id               int64  `json:"id" parquet:"id"`
+	CreatedAt        int64  `json:"created_at" parquet:"created_at"`
+	Type             int32  `json:"type" parquet:"type"`
+	UserId           int64  `json:"user_id" parquet:"user_id"`
+	Username         string `json:"username" parquet:"username"`
+	TokenId          int64  `json:"token_id" parquet:"token_id"`
+	TokenName        string `json:"token_name" parquet:"token_name"`
+	ModelName        string `json:"model_name" parquet:"model_name"`
+	Group            string `json:"group" parquet:"group"`
+	ChannelId        int64  `json:"channel" parquet:"channel"`
+	ChannelName      string `json:"channel_name" parquet:"channel_name"`
+	Quota            int64  `json:"quota" parquet:"quota"`
+	PromptTokens     int64  `json:"prompt_tokens" parquet:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens" parquet:"completion_tokens"`
+	UseTime          int64  `json:"use_time" parquet:"use_time"`
+	IsStream         bool   `json:"is_stream" parquet:"is_stream"`
+	Ip               string `json:"ip" parquet:"ip"`
+	Content          string `json:"content" parquet:"content"`
+	Other            string `json:"other" parquet:"other"`
+}
+
+var logExportCSVHeader = []string{
+	"id", "created_at", "type", "user_id", "username", "token_id", "token_name", "model_name", "group",
+	"channel", "channel_name", "quota", "prompt_tokens", "completion_tokens", "use_time", "is_stream", "ip", "content", "other",
+}
+
+func newLogExportRow(log *model.Log) LogExportRow {
+	return LogExportRow{
+		Id:               int64(log.Id),
+		CreatedAt:        log.CreatedAt,
+		Type:             int32(log.Type),
+		UserId:           int64(log.UserId),
+		Username:         log.Username,
+		TokenId:          int64(log.TokenId),
+		TokenName:        log.TokenName,
+		ModelName:        log.ModelName,
+		Group:            log.Group,
+		ChannelId:        int64(log.ChannelId),
+		ChannelName:      log.ChannelName,
+		Quota:            int64(log.Quota),
+		PromptTokens:     int64(log.PromptTokens),
+		CompletionTokens: int64(log.CompletionTokens),
+		UseTime:          int64(log.UseTime),
+		IsStream:         log.IsStream,
+		Ip:               log.Ip,
+		Content:          log.Content,
+		Other:            log.Other,
+	}
+}
+
+func (r LogExportRow) csvRecord() []string {
+	return []string{
+		strconv.FormatInt(r.Id, 10),
+		strconv.FormatInt(r.CreatedAt, 10),
+		strconv.Itoa(int(r.Type)),
+		strconv.FormatInt(r.UserId, 10),
+		r.Username,
+		strconv.FormatInt(r.TokenId, 10),
+		r.TokenName,
+		r.ModelName,
+		r.Group,
+		strconv.FormatInt(r.ChannelId, 10),
+		r.ChannelName,
+		strconv.FormatInt(r.Quota, 10),
+		strconv.FormatInt(r.PromptTokens, 10),
+		strconv.FormatInt(r.CompletionTokens, 10),
+		strconv.FormatInt(r.UseTime, 10),
+		strconv.FormatBool(r.IsStream),
+		r.Ip,
+		r.Content,
+		r.Other,
+	}
+}
+
+type logExportWriter interface {
+	WriteRows(rows []LogExportRow) error
+	Close() error
+}
+
+type csvLogExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvLogExportWriter) WriteRows(rows []LogExportRow) error {
+	for _, row := range rows {
+		if err := w.writer.Write(row.csvRecord()); err != nil {
+			return err
+		}
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvLogExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonlLogExportWriter struct {
+	writer io.Writer
+}
+
+func (w *jsonlLogExportWriter) WriteRows(rows []LogExportRow) error {
+	for _, row := range rows {
+		line, err := common.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if _, err = w.writer.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *jsonlLogExportWriter) Close() error {
+	return nil
+}
+
+type parquetLogExportWriter struct {
+	writer       *parquet.GenericWriter[LogExportRow]
+	rowGroupSize int
+	// pending 当前行组中尚未落盘的行数
+	pending int
+}
+
+func newParquetLogExportWriter(w io.Writer, rowGroupSize int) *parquetLogExportWriter {
+	return &parquetLogExportWriter{
+		writer:       parquet.NewGenericWriter[LogExportRow](w, parquet.MaxRowsPerRowGroup(int64(rowGroupSize))),
+		rowGroupSize: rowGroupSize,
+	}
+}
+
+// WriteRows 写入一批行，当前行组达到行数上限时立即 Flush 写出该行组
+func (w *parquetLogExportWriter) WriteRows(rows []LogExportRow) error {
+	for len(rows) > 0 {
+		n := min(len(rows), w.rowGroupSize-w.pending)
+		if _, err := w.writer.Write(rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+		w.pending += n
+		if w.pending >= w.rowGroupSize {
+			if err := w.writer.Flush(); err != nil {
+				return err
+			}
+			w.pending = 0
+		}
+	}
+	return nil
+}
+
+func (w *parquetLogExportWriter) Close() error {
+	return w.writer.Close()
+}
+
+func newLogExportWriter(w io.Writer, format LogExportFormat) (logExportWriter, error) {
+	switch format {
+	case LogExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(logExportCSVHeader); err != nil {
+			return nil, err
+		}
+		return &csvLogExportWriter{writer: writer}, nil
+	case LogExportFormatJSONL:
+		return &jsonlLogExportWriter{writer: w}, nil
+	case LogExportFormatParquet:
+		return newParquetLogExportWriter(w, logExportParquetRowGroupSize), nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式 %s", format)
+	}
+}
+
+// ExportLogs 按过滤条件分批读取日志并以指定格式流式写出，每批写完后尝试 Flush 以便边查边传
+func ExportLogs(w io.Writer, format LogExportFormat, filter model.LogExportFilter, forUser bool) error {
+	writer, err := newLogExportWriter(w, format)
+	if err != nil {
+		return err
+	}
+	flusher, _ := w.(interface{ Flush() })
+	rows := make([]LogExportRow, 0, logExportBatchSize)
+	err = model.StreamLogs(filter, logExportBatchSize, forUser, func(logs []*model.Log) error {
+		rows = rows[:0]
+		for _, log := range logs {
+			rows = append(rows, newLogExportRow(log))
+		}
+		if err := writer.WriteRows(rows); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/glebarez/sqlite"
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+func setupLogExportTestDB(t *testing.T) {
+	t.Helper()
+	originalDB, originalLogDB := model.DB, model.LOG_DB
+	t.Cleanup(func() {
+		model.DB = originalDB
+		model.LOG_DB = originalLogDB
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:log-export-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Log{}, &model.Channel{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	model.LOG_DB = db
+
+	for i := 1; i <= 2500; i++ {
+		userId := 1
+		if i%2 == 0 {
+			userId = 2
+		}
+		log := &model.Log{UserId: userId, Type: model.LogTypeConsume, ModelName: "gpt-4.1", Quota: i, CreatedAt: int64(i)}
+		if err := db.Create(log).Error; err != nil {
+			t.Fatalf("create log: %v", err)
+		}
+	}
+}
+
+func TestExportLogsStreamsAllBatches(t *testing.T) {
+	setupLogExportTestDB(t)
+	filter := model.LogExportFilter{UserId: 1, LogType: model.LogTypeConsume}
+
+	var csvBuf bytes.Buffer
+	if err := ExportLogs(&csvBuf, LogExportFormatCSV, filter, true); err != nil {
+		t.Fatalf("export csv: %v", err)
+	}
+	records, err := csv.NewReader(&csvBuf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(records) != 1251 {
+		t.Fatalf("expected header + 1250 rows, got %d", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(logExportCSVHeader, ",") {
+		t.Fatalf("unexpected csv header: %v", records[0])
+	}
+
+	var jsonlBuf bytes.Buffer
+	if err := ExportLogs(&jsonlBuf, LogExportFormatJSONL, filter, true); err != nil {
+		t.Fatalf("export jsonl: %v", err)
+	}
+	if lines := strings.Count(jsonlBuf.String(), "\n"); lines != 1250 {
+		t.Fatalf("expected 1250 jsonl lines, got %d", lines)
+	}
+
+	var parquetBuf bytes.Buffer
+	if err := ExportLogs(&parquetBuf, LogExportFormatParquet, filter, true); err != nil {
+		t.Fatalf("export parquet: %v", err)
+	}
+	rows, err := parquet.Read[LogExportRow](bytes.NewReader(parquetBuf.Bytes()), int64(parquetBuf.Len()))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	if len(rows) != 1250 || rows[0].UserId != 1 || rows[0].Quota != 1 {
+		t.Fatalf("unexpected parquet rows: %d, first=%+v", len(rows), rows[0])
+	}
+}
+
+func TestParquetLogExportWriterFlushesRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newParquetLogExportWriter(&buf, 500)
+	rows := make([]LogExportRow, 300)
+	for i := range rows {
+		rows[i] = LogExportRow{Id: int64(i + 1)}
+	}
+	for i := 0; i < 4; i++ {
+		if err := writer.WriteRows(rows); err != nil {
+			t.Fatalf("write rows: %v", err)
+		}
+	}
+	// 行组写满后立即写出，而不是等到关闭时
+	if buf.Len() == 0 {
+		t.Fatal("expected full row groups to be written before close")
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open parquet: %v", err)
+	}
+	groups := file.RowGroups()
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 row groups, got %d", len(groups))
+	}
+	for i, want := range []int64{500, 500, 200} {
+		if got := groups[i].NumRows(); got != want {
+			t.Fatalf("row group %d: expected %d rows, got %d", i, want, got)
+		}
+	}
+}
+
+func TestParseLogExportFormat(t *testing.T) {
+	if format, err := ParseLogExportFormat(""); err != nil || format != LogExportFormatCSV {
+		t.Fatalf("expected csv default, got %q, %v", format, err)
+	}
+	if _, err := ParseLogExportFormat("xlsx"); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
@@ -31,6 +31,17 @@ func appendRequestPath(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other
 	}
 }
 
+// AppendGroupTimeWindow 记录已乘入分组倍率的分时倍率，便于审计
+func AppendGroupTimeWindow(groupRatioInfo types.GroupRatioInfo, other map[string]interface{}) {
+	if groupRatioInfo.TimeMultiplier == 0 && groupRatioInfo.TimeWindow == "" {
+		return
+	}
+	other["group_time_multiplier"] = groupRatioInfo.TimeMultiplier
+	if groupRatioInfo.TimeWindow != "" {
+		other["group_time_window"] = groupRatioInfo.TimeWindow
+	}
+}
+
 func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, modelRatio, groupRatio, completionRatio float64,
 	cacheTokens int, cacheRatio float64, modelPrice float64, userGroupRatio float64) map[string]interface{} {
 	other := make(map[string]interface{})
@@ -49,6 +60,18 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if relayInfo.PriceData.PriceBookVersion != 0 {
+		other["price_book_version"] = relayInfo.PriceData.PriceBookVersion
+	}
+	AppendGroupTimeWindow(relayInfo.PriceData.GroupRatioInfo, other)
+	if relayInfo.PriceData.ContextTier != 0 {
+		other["context_tier"] = relayInfo.PriceData.ContextTier
+		other["context_tier_threshold"] = relayInfo.PriceData.ContextTierThreshold
+	}
+	if relayInfo.FallbackFromModel != "" {
+		other["fallback_from_model"] = relayInfo.FallbackFromModel
+		other["served_model"] = relayInfo.OriginModelName
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -128,6 +151,7 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	AppendGroupTimeWindow(priceData.GroupRatioInfo, other)
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
@@ -0,0 +1,544 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	mediaArchiveDownloadTimeout = 10 * time.Minute
+	mediaArchiveCleanupBatch    = 200
+	mediaArchiveBytesPerGB      = 1 << 30
+	mediaArchiveBillingDay      = int64(24 * time.Hour / time.Second)
+	MediaArchiveCleanupInterval = time.Hour
+	MediaArchiveBillingInterval = time.Hour
+)
+
+// MediaSource 待归档的上游生成结果，Headers 用于需要鉴权才能下载的上游（如 Sora、Gemini）
+type MediaSource struct {
+	Url     string
+	Kind    string
+	Headers map[string]string
+}
+
+// MediaArchiveOwner 归档文件所属的任务，Group 决定保留天数
+type MediaArchiveOwner struct {
+	UserId   int
+	Group    string
+	Platform string
+	TaskId   string
+}
+
+func IsMediaArchiveEnabled() bool {
+	return operation_setting.GetMediaArchiveSetting().Enabled
+}
+
+// ArchiveTaskMediaAndNotify 任务成功后异步归档生成结果，归档结束后再发送状态回调，使回调中的结果地址指向归档文件
+func ArchiveTaskMediaAndNotify(task *model.Task, sources []MediaSource) {
+	gopool.Go(func() {
+		owner := MediaArchiveOwner{UserId: task.UserId, Group: task.Group, Platform: string(task.Platform), TaskId: task.TaskID}
+		if _, err := ArchiveTaskMedia(context.Background(), owner, sources); err != nil {
+			common.SysLog(fmt.Sprintf("failed to archive media of task %s: %s", task.TaskID, err.Error()))
+		}
+		NotifyTaskStatusChanged(task)
+	})
+}
+
+// ArchiveMidjourneyMediaAndNotify 异步归档 Midjourney 任务的图片与视频，归档结束后再发送状态回调
+func ArchiveMidjourneyMediaAndNotify(task *model.Midjourney) {
+	sources := []MediaSource{
+		{Url: task.ImageUrl, Kind: model.TaskArtifactKindImage},
+		{Url: task.VideoUrl, Kind: model.TaskArtifactKindVideo},
+	}
+	if task.VideoUrls != "" {
+		var videoUrls []dto.ImgUrls
+		if err := common.UnmarshalJsonStr(task.VideoUrls, &videoUrls); err == nil {
+			for _, videoUrl := range videoUrls {
+				sources = append(sources, MediaSource{Url: videoUrl.Url, Kind: model.TaskArtifactKindVideo})
+			}
+		}
+	}
+	owner := MediaArchiveOwner{UserId: task.UserId, Platform: constant.TaskPlatformMidjourney, TaskId: task.MjId}
+	gopool.Go(func() {
+		defer NotifyMidjourneyTaskStatusChanged(task)
+		group, err := model.GetUserGroup(owner.UserId, false)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to archive media of midjourney task %s: %s", owner.TaskId, err.Error()))
+			return
+		}
+		owner.Group = group
+		if _, err := ArchiveTaskMedia(context.Background(), owner, sources); err != nil {
+			common.SysLog(fmt.Sprintf("failed to archive media of midjourney task %s: %s", owner.TaskId, err.Error()))
+		}
+	})
+}
+
+// SunoMediaSources 从 Suno 任务结果中提取音频、封面与视频地址
+func SunoMediaSources(data []byte) []MediaSource {
+	var songs []dto.SunoSong
+	if err := common.Unmarshal(data, &songs); err != nil {
+		return nil
+	}
+	sources := make([]MediaSource, 0, len(songs)*3)
+	for _, song := range songs {
+		sources = append(sources,
+			MediaSource{Url: song.AudioURL, Kind: model.TaskArtifactKindAudio},
+			MediaSource{Url: song.ImageURL, Kind: model.TaskArtifactKindImage},
+			MediaSource{Url: song.VideoURL, Kind: model.TaskArtifactKindVideo},
+		)
+	}
+	return sources
+}
+
+// ArchiveTaskMedia 下载并保存任务生成结果；已归档的地址会跳过，单个文件失败不影响其他文件
+func ArchiveTaskMedia(ctx context.Context, owner MediaArchiveOwner, sources []MediaSource) ([]*model.TaskArtifact, error) {
+	setting := operation_setting.GetMediaArchiveSetting()
+	if !setting.Enabled || len(sources) == 0 {
+		return nil, nil
+	}
+	retentionDays := setting.GetRetentionDays(owner.Group)
+	if retentionDays <= 0 {
+		return nil, nil
+	}
+	existing, err := model.GetTaskArtifacts(owner.Platform, owner.TaskId)
+	if err != nil {
+		return nil, err
+	}
+	archived := make(map[string]bool, len(existing))
+	for _, artifact := range existing {
+		archived[artifact.SourceUrl] = true
+	}
+	var storage *ObjectStorage
+	if setting.Backend != operation_setting.MediaArchiveBackendLocal {
+		if storage, err = GetObjectStorage(); err != nil {
+			return nil, err
+		}
+	}
+
+	var artifacts []*model.TaskArtifact
+	var errs []error
+	for _, source := range sources {
+		if source.Url == "" || archived[source.Url] || strings.HasPrefix(source.Url, "data:") {
+			continue
+		}
+		archived[source.Url] = true
+		artifact, err := archiveMediaSource(ctx, setting, storage, owner, source, retentionDays)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, errors.Join(errs...)
+}
+
+func archiveMediaSource(ctx context.Context, setting *operation_setting.MediaArchiveSetting, storage *ObjectStorage, owner MediaArchiveOwner, source MediaSource, retentionDays int) (*model.TaskArtifact, error) {
+	media, err := downloadMedia(ctx, source, int64(setting.MaxFileSizeMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+	defer media.Close()
+	// 第一天的存储费用在归档时扣除，余额不足时不归档
+	dayQuota := mediaArchiveQuota(media.size, 1, setting.QuotaPerGBDay)
+	if dayQuota > 0 {
+		userQuota, err := model.GetUserQuota(owner.UserId, false)
+		if err != nil {
+			return nil, err
+		}
+		if userQuota < dayQuota {
+			return nil, model.ErrTaskArtifactQuotaInsufficient
+		}
+	}
+	backend := operation_setting.MediaArchiveBackendS3
+	if storage == nil {
+		backend = operation_setting.MediaArchiveBackendLocal
+	}
+	now := time.Now()
+	artifact := &model.TaskArtifact{
+		UserId:      owner.UserId,
+		Platform:    owner.Platform,
+		TaskId:      owner.TaskId,
+		Kind:        source.Kind,
+		SourceUrl:   source.Url,
+		Backend:     backend,
+		ObjectKey:   mediaArchiveObjectKey(setting.Prefix, owner.Platform, source.Url, media.contentType),
+		ContentType: media.contentType,
+		SizeBytes:   media.size,
+		ExpiresAt:   now.AddDate(0, 0, retentionDays).Unix(),
+	}
+	if err := putMediaObject(ctx, storage, artifact.ObjectKey, media); err != nil {
+		return nil, err
+	}
+	if err := model.CreateTaskArtifact(artifact); err != nil {
+		_ = deleteMediaObject(ctx, artifact)
+		return nil, err
+	}
+	if err := chargeTaskArtifact(artifact, owner.Group, time.Now()); err != nil {
+		_ = deleteMediaObject(ctx, artifact)
+		_ = model.DeleteTaskArtifact(artifact.Id)
+		return nil, err
+	}
+	return artifact, nil
+}
+
+// chargeTaskArtifact 按消费扣除归档文件在 now 所在计费日的存储费用，计费日从归档时间起每 24 小时一天；
+// 同一计费日只扣除一次
+func chargeTaskArtifact(artifact *model.TaskArtifact, group string, now time.Time) error {
+	day := int((now.Unix() - artifact.CreatedAt) / mediaArchiveBillingDay)
+	quota := mediaArchiveQuota(artifact.SizeBytes, 1, operation_setting.GetMediaArchiveSetting().QuotaPerGBDay)
+	billedUntil := artifact.CreatedAt + int64(day+1)*mediaArchiveBillingDay
+	charged, err := model.ChargeTaskArtifactDay(artifact, day, quota, billedUntil)
+	if err != nil || !charged || quota <= 0 {
+		return err
+	}
+	model.RecordTaskArtifactChargeLog(artifact, day, quota, group, fmt.Sprintf("任务 %s 生成结果归档存储 %.2f MB，第 %d 天存储费用 %s",
+		artifact.TaskId, float64(artifact.SizeBytes)/(1<<20), day+1, logger.LogQuota(int64(quota))))
+	return nil
+}
+
+// BillTaskArtifacts 为已到续费时间的归档文件扣除当天的存储费用，由后台任务调度器定期调用；
+// 余额不足时归档文件立即过期，由清理任务删除
+func BillTaskArtifacts() error {
+	if operation_setting.GetMediaArchiveSetting().QuotaPerGBDay <= 0 {
+		return nil
+	}
+	now := time.Now()
+	artifacts, err := model.GetTaskArtifactsToBill(now.Unix(), mediaArchiveCleanupBatch)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, artifact := range artifacts {
+		group, err := model.GetUserGroup(artifact.UserId, false)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = chargeTaskArtifact(artifact, group, now)
+		if errors.Is(err, model.ErrTaskArtifactQuotaInsufficient) {
+			model.RecordLog(artifact.UserId, model.LogTypeSystem, fmt.Sprintf("额度不足，任务 %s 的归档文件已停止保留", artifact.TaskId))
+			err = model.ExpireTaskArtifact(artifact.Id)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// downloadedMedia 下载到临时文件的上游生成结果，使用后需调用 Close 删除临时文件
+type downloadedMedia struct {
+	file        *os.File
+	size        int64
+	sha256      string
+	contentType string
+}
+
+func (m *downloadedMedia) Close() {
+	_ = m.file.Close()
+	_ = os.Remove(m.file.Name())
+}
+
+// downloadMedia 将上游文件流式写入临时文件，同时计算大小与 SHA-256，避免大文件整体读入内存
+func downloadMedia(ctx context.Context, source MediaSource, maxSize int64) (*downloadedMedia, error) {
+	ctx, cancel := context.WithTimeout(ctx, mediaArchiveDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range source.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download media: upstream returned status %d", resp.StatusCode)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("media size %d exceeds limit %d", resp.ContentLength, maxSize)
+	}
+	reader := io.Reader(resp.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(resp.Body, maxSize+1)
+	}
+	file, err := os.CreateTemp("", "media-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	media := &downloadedMedia{file: file}
+	hash := sha256.New()
+	if media.size, err = io.Copy(io.MultiWriter(file, hash), reader); err != nil {
+		media.Close()
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	if maxSize > 0 && media.size > maxSize {
+		media.Close()
+		return nil, fmt.Errorf("media size exceeds limit %d", maxSize)
+	}
+	media.sha256 = hex.EncodeToString(hash.Sum(nil))
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "" || contentType == "application/octet-stream" {
+		if guessed := mime.TypeByExtension(mediaURLExtension(source.Url)); guessed != "" {
+			contentType = guessed
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	media.contentType = contentType
+	return media, nil
+}
+
+func mediaURLExtension(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(path.Ext(u.Path))
+}
+
+// mediaArchiveObjectKey 归档对象键：{prefix}/{platform}/YYYY-MM-DD/{随机串}{扩展名}
+func mediaArchiveObjectKey(prefix string, platform string, sourceUrl string, contentType string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		prefix = "media"
+	}
+	ext := mediaURLExtension(sourceUrl)
+	if ext == "" || len(ext) > 8 {
+		ext = ""
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fmt.Sprintf("%s/%s/%s/%s%s", prefix, platform, time.Now().Format("2006-01-02"), common.GetRandomString(24), ext)
+}
+
+// mediaArchiveQuota 按 文件大小 × 天数 计算存储费用，不足 1 时向上取整
+func mediaArchiveQuota(sizeBytes int64, retentionDays int, quotaPerGBDay int) int {
+	if quotaPerGBDay <= 0 || sizeBytes <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(sizeBytes) / mediaArchiveBytesPerGB * float64(retentionDays) * float64(quotaPerGBDay)))
+}
+
+func localMediaPath(key string) string {
+	return filepath.Join(operation_setting.GetMediaArchiveSetting().LocalDir, filepath.FromSlash(key))
+}
+
+func putMediaObject(ctx context.Context, storage *ObjectStorage, key string, media *downloadedMedia) error {
+	if _, err := media.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if storage != nil {
+		return storage.PutObjectStream(ctx, key, media.file, media.size, media.sha256, media.contentType)
+	}
+	filePath := localMediaPath(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, media.file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(filePath)
+		return err
+	}
+	return file.Close()
+}
+
+func deleteMediaObject(ctx context.Context, artifact *model.TaskArtifact) error {
+	if artifact.Backend == operation_setting.MediaArchiveBackendLocal {
+		if err := os.Remove(localMediaPath(artifact.ObjectKey)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	storage, err := GetObjectStorage()
+	if err != nil {
+		return err
+	}
+	return storage.DeleteObject(ctx, artifact.ObjectKey)
+}
+
+func mediaArchiveSignedURLTTL() time.Duration {
+	return time.Duration(max(operation_setting.GetMediaArchiveSetting().SignedUrlTTLMinutes, 1)) * time.Minute
+}
+
+func signMediaArtifact(id int64, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("media:%d:%d", id, expires))
+}
+
+// MediaArtifactURL 生成归档文件的签名网关地址，有效期不超过归档文件的保留时间
+func MediaArtifactURL(artifact *model.TaskArtifact) string {
+	expires := min(time.Now().Add(mediaArchiveSignedURLTTL()).Unix(), artifact.ExpiresAt)
+	return fmt.Sprintf("%s/v1/media/%d?expires=%d&signature=%s", system_setting.ServerAddress, artifact.Id, expires, signMediaArtifact(artifact.Id, expires))
+}
+
+func VerifyMediaArtifactSignature(id int64, expires int64, signature string) bool {
+	if expires < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(signMediaArtifact(id, expires)))
+}
+
+// ResolveMediaArtifact 返回归档文件的读取位置：对象存储返回预签名地址，本地磁盘返回文件路径
+func ResolveMediaArtifact(ctx context.Context, artifact *model.TaskArtifact) (string, string, error) {
+	if artifact.ExpiresAt <= time.Now().Unix() {
+		return "", "", errors.New("归档文件已过期")
+	}
+	if artifact.Backend == operation_setting.MediaArchiveBackendLocal {
+		return "", localMediaPath(artifact.ObjectKey), nil
+	}
+	storage, err := GetObjectStorage()
+	if err != nil {
+		return "", "", err
+	}
+	ttl := min(mediaArchiveSignedURLTTL(), time.Until(time.Unix(artifact.ExpiresAt, 0)))
+	presignedURL, err := storage.PresignGetObject(ctx, artifact.ObjectKey, ttl)
+	return presignedURL, "", err
+}
+
+// GetArchivedTaskMedia 返回任务已归档的文件，未启用归档时不查询
+func GetArchivedTaskMedia(platform string, taskId string) []*model.TaskArtifact {
+	if !IsMediaArchiveEnabled() || taskId == "" {
+		return nil
+	}
+	artifacts, err := model.GetTaskArtifacts(platform, taskId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load archived media of task %s: %s", taskId, err.Error()))
+		return nil
+	}
+	return artifacts
+}
+
+// archivedMediaURLs 返回上游地址到签名网关地址的映射，以及第一个归档视频的网关地址
+func archivedMediaURLs(platform string, taskId string) (map[string]string, string) {
+	artifacts := GetArchivedTaskMedia(platform, taskId)
+	if len(artifacts) == 0 {
+		return nil, ""
+	}
+	urls := make(map[string]string, len(artifacts))
+	videoURL := ""
+	for _, artifact := range artifacts {
+		urls[artifact.SourceUrl] = MediaArtifactURL(artifact)
+		if videoURL == "" && artifact.Kind == model.TaskArtifactKindVideo {
+			videoURL = urls[artifact.SourceUrl]
+		}
+	}
+	return urls, videoURL
+}
+
+// archivedTaskResultURL 任务结果地址（成功任务的 FailReason）对应的归档地址；
+// 视频下载地址与结果地址不同（如 Sora 的 content 接口）时使用归档的视频
+func archivedTaskResultURL(urls map[string]string, videoURL string, resultURL string) (string, bool) {
+	if archived, ok := urls[resultURL]; ok {
+		return archived, true
+	}
+	if videoURL != "" && strings.HasPrefix(resultURL, "http") {
+		return videoURL, true
+	}
+	return "", false
+}
+
+// RewriteTaskMediaURLs 将任务结果中已归档的上游地址替换为签名网关地址；只修改内存中的任务，调用方不应再保存该任务
+func RewriteTaskMediaURLs(task *model.Task) {
+	if task == nil || task.Status != model.TaskStatusSuccess {
+		return
+	}
+	urls, videoURL := archivedMediaURLs(string(task.Platform), task.TaskID)
+	if archived, ok := archivedTaskResultURL(urls, videoURL, task.FailReason); ok {
+		task.FailReason = archived
+	}
+	for source, archived := range urls {
+		task.Data = replaceJSONStringValue(task.Data, source, archived)
+	}
+}
+
+// RewriteMidjourneyMediaURLs 与 RewriteTaskMediaURLs 相同，用于 Midjourney 任务，返回是否替换了图片地址
+func RewriteMidjourneyMediaURLs(task *model.Midjourney) bool {
+	if task == nil {
+		return false
+	}
+	imageRewritten := false
+	urls, _ := archivedMediaURLs(constant.TaskPlatformMidjourney, task.MjId)
+	for source, archived := range urls {
+		if task.ImageUrl == source {
+			task.ImageUrl = archived
+			imageRewritten = true
+		}
+		if task.VideoUrl == source {
+			task.VideoUrl = archived
+		}
+		task.VideoUrls = string(replaceJSONStringValue([]byte(task.VideoUrls), source, archived))
+	}
+	return imageRewritten
+}
+
+// replaceJSONStringValue 替换 JSON 中的字符串值，同时处理原样写入与转义（如 & 被编码为 \u0026）两种形式
+func replaceJSONStringValue(data []byte, source string, target string) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	encodedTarget := jsonStringContent(target)
+	data = bytes.ReplaceAll(data, []byte(`"`+source+`"`), []byte(`"`+encodedTarget+`"`))
+	return bytes.ReplaceAll(data, []byte(`"`+jsonStringContent(source)+`"`), []byte(`"`+encodedTarget+`"`))
+}
+
+func jsonStringContent(value string) string {
+	encoded, err := common.Marshal(value)
+	if err != nil || len(encoded) < 2 {
+		return value
+	}
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// CleanupExpiredTaskArtifacts 删除超过保留时间的归档文件，由后台任务调度器定期调用；删除对象失败的记录保留到下次重试
+func CleanupExpiredTaskArtifacts() error {
+	ctx := context.Background()
+	artifacts, err := model.GetExpiredTaskArtifacts(time.Now().Unix(), mediaArchiveCleanupBatch)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, artifact := range artifacts {
+		if err := deleteMediaObject(ctx, artifact); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := model.DeleteTaskArtifact(artifact.Id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
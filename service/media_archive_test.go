@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestArchiveTaskMediaLocalBackend(t *testing.T) {
+	setting := operation_setting.GetMediaArchiveSetting()
+	originalSetting, originalDB, originalClient := *setting, model.DB, httpClient
+	t.Cleanup(func() {
+		*setting = originalSetting
+		model.DB = originalDB
+		httpClient = originalClient
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:media-archive-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.TaskArtifact{}, &model.TaskArtifactCharge{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	httpClient = http.DefaultClient
+	setting.Enabled = true
+	setting.Backend = operation_setting.MediaArchiveBackendLocal
+	setting.LocalDir = t.TempDir()
+	setting.RetentionDays = 3
+	setting.GroupRetentionDays = map[string]int{"free": 0}
+	setting.QuotaPerGBDay = 0
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", "video/mp4")
+		_, _ = w.Write([]byte("video-bytes"))
+	}))
+	defer server.Close()
+	videoURL := server.URL + "/result.mp4?a=1&b=2"
+
+	owner := MediaArchiveOwner{UserId: 1, Group: "default", Platform: "sora", TaskId: "task_1"}
+	sources := []MediaSource{
+		{Url: videoURL, Kind: model.TaskArtifactKindVideo},
+		{Url: videoURL, Kind: model.TaskArtifactKindVideo},
+		{Url: "data:video/mp4;base64,AAAA", Kind: model.TaskArtifactKindVideo},
+	}
+	artifacts, err := ArchiveTaskMedia(context.Background(), owner, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || downloads != 1 {
+		t.Fatalf("expected one archived file, got %d artifacts and %d downloads", len(artifacts), downloads)
+	}
+	artifact := artifacts[0]
+	content, err := os.ReadFile(localMediaPath(artifact.ObjectKey))
+	if err != nil || string(content) != "video-bytes" {
+		t.Fatalf("unexpected archived content: %q, %v", content, err)
+	}
+	if artifact.ContentType != "video/mp4" || artifact.SizeBytes != int64(len("video-bytes")) || !strings.HasSuffix(artifact.ObjectKey, ".mp4") {
+		t.Fatalf("unexpected artifact: %+v", artifact)
+	}
+
+	// 已归档的地址不重复下载，保留天数为 0 的分组不归档
+	if artifacts, err := ArchiveTaskMedia(context.Background(), owner, sources); err != nil || len(artifacts) != 0 || downloads != 1 {
+		t.Fatalf("archived media should be skipped: %d artifacts, %d downloads, %v", len(artifacts), downloads, err)
+	}
+	freeOwner := owner
+	freeOwner.Group, freeOwner.TaskId = "free", "task_2"
+	if artifacts, err := ArchiveTaskMedia(context.Background(), freeOwner, sources); err != nil || len(artifacts) != 0 {
+		t.Fatalf("group with zero retention should not be archived: %d artifacts, %v", len(artifacts), err)
+	}
+
+	// 任务结果中的上游地址替换为签名网关地址
+	task := &model.Task{TaskID: "task_1", Platform: "sora", Status: model.TaskStatusSuccess, FailReason: videoURL,
+		Data: []byte(`{"url":"` + strings.ReplaceAll(videoURL, "&", `\u0026`) + `"}`)}
+	RewriteTaskMediaURLs(task)
+	if !strings.Contains(task.FailReason, "/v1/media/") || strings.Contains(string(task.Data), server.URL) {
+		t.Fatalf("task media urls were not rewritten: %s, %s", task.FailReason, task.Data)
+	}
+	signedURL, err := url.Parse(task.FailReason)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, _ := strconv.ParseInt(signedURL.Query().Get("expires"), 10, 64)
+	if !VerifyMediaArtifactSignature(artifact.Id, expires, signedURL.Query().Get("signature")) {
+		t.Fatal("signed media url should be valid")
+	}
+	if VerifyMediaArtifactSignature(artifact.Id+1, expires, signedURL.Query().Get("signature")) {
+		t.Fatal("signature should not be valid for another artifact")
+	}
+
+	usage, err := model.GetUserTaskArtifactUsage(1)
+	if err != nil || usage.Count != 1 || usage.SizeBytes != artifact.SizeBytes {
+		t.Fatalf("unexpected usage: %+v, %v", usage, err)
+	}
+
+	// 过期后清理文件与记录
+	if err := db.Model(&model.TaskArtifact{}).Where("id = ?", artifact.Id).Update("expires_at", time.Now().Unix()-1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupExpiredTaskArtifacts(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(localMediaPath(artifact.ObjectKey)); !os.IsNotExist(err) {
+		t.Fatalf("expired media file should be removed: %v", err)
+	}
+	if _, err := model.GetTaskArtifactById(artifact.Id); err == nil {
+		t.Fatal("expired artifact record should be removed")
+	}
+}
+
+func TestMediaArchiveQuota(t *testing.T) {
+	if quota := mediaArchiveQuota(1<<30, 7, 100); quota != 700 {
+		t.Fatalf("unexpected quota for 1GB x 7 days: %d", quota)
+	}
+	if quota := mediaArchiveQuota(1, 1, 100); quota != 1 {
+		t.Fatalf("small files should round up to 1, got %d", quota)
+	}
+	if quota := mediaArchiveQuota(1<<30, 7, 0); quota != 0 {
+		t.Fatalf("billing disabled should cost nothing, got %d", quota)
+	}
+}
+
+func TestTaskArtifactDailyBilling(t *testing.T) {
+	setting := operation_setting.GetMediaArchiveSetting()
+	originalSetting, originalDB, originalLogDB, originalClient := *setting, model.DB, model.LOG_DB, httpClient
+	originalLogConsume := common.LogConsumeEnabled
+	t.Cleanup(func() {
+		*setting = originalSetting
+		model.DB, model.LOG_DB = originalDB, originalLogDB
+		httpClient = originalClient
+		common.LogConsumeEnabled = originalLogConsume
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:media-archive-billing-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Log{}, &model.QuotaLedger{}, &model.TaskArtifact{}, &model.TaskArtifactCharge{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB, model.LOG_DB = db, db
+	httpClient = http.DefaultClient
+	common.LogConsumeEnabled = true
+	setting.Enabled = true
+	setting.Backend = operation_setting.MediaArchiveBackendLocal
+	setting.LocalDir = t.TempDir()
+	setting.RetentionDays = 7
+	setting.GroupRetentionDays = map[string]int{}
+	setting.MaxFileSizeMB = 1
+	// 每 GB 每天 2^30 额度，即每字节每天 1 额度
+	setting.QuotaPerGBDay = 1 << 30
+
+	user := &model.User{Username: "archive_user", Password: "password", Group: "default", Quota: 25, Status: common.UserStatusEnabled}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		_, _ = w.Write([]byte("video-bytes"))
+	}))
+	defer server.Close()
+
+	userQuota := func() int {
+		var quota int
+		db.Model(&model.User{}).Where("id = ?", user.Id).Select("quota").Scan(&quota)
+		return quota
+	}
+	owner := MediaArchiveOwner{UserId: user.Id, Group: "default", Platform: "sora", TaskId: "task_billing"}
+	artifacts, err := ArchiveTaskMedia(context.Background(), owner, []MediaSource{{Url: server.URL + "/a.mp4", Kind: model.TaskArtifactKindVideo}})
+	if err != nil || len(artifacts) != 1 {
+		t.Fatalf("archive media: %d artifacts, %v", len(artifacts), err)
+	}
+	artifact := artifacts[0]
+	if artifact.Quota != 11 || userQuota() != 14 || artifact.BilledUntil != artifact.CreatedAt+mediaArchiveBillingDay {
+		t.Fatalf("first day should be charged on archive: artifact=%+v, user quota=%d", artifact, userQuota())
+	}
+
+	// 同一天内重复计费不扣费
+	if err := chargeTaskArtifact(artifact, owner.Group, time.Now()); err != nil || userQuota() != 14 {
+		t.Fatalf("same day should be charged once: user quota=%d, %v", userQuota(), err)
+	}
+	var consumeLogs int64
+	db.Model(&model.Log{}).Where("type = ? AND user_id = ?", model.LogTypeConsume, user.Id).Count(&consumeLogs)
+	if consumeLogs != 1 {
+		t.Fatalf("expected one consume log, got %d", consumeLogs)
+	}
+
+	// 进入第二天后续费
+	shiftDay := func() {
+		err := db.Model(&model.TaskArtifact{}).Where("id = ?", artifact.Id).Updates(map[string]interface{}{
+			"created_at":   gorm.Expr("created_at - ?", mediaArchiveBillingDay),
+			"billed_until": gorm.Expr("billed_until - ?", mediaArchiveBillingDay),
+		}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	shiftDay()
+	if err := BillTaskArtifacts(); err != nil {
+		t.Fatal(err)
+	}
+	if err := BillTaskArtifacts(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := model.GetTaskArtifactById(artifact.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Quota != 22 || userQuota() != 3 {
+		t.Fatalf("second day should be charged once: artifact quota=%d, user quota=%d", stored.Quota, userQuota())
+	}
+
+	// 余额不足时归档文件立即过期
+	shiftDay()
+	if err := BillTaskArtifacts(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = model.GetTaskArtifactById(artifact.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ExpiresAt > time.Now().Unix() || stored.Quota != 22 || userQuota() != 3 {
+		t.Fatalf("artifact should expire when quota is insufficient: %+v, user quota=%d", stored, userQuota())
+	}
+
+	// 余额不足时不归档
+	owner.TaskId = "task_billing_2"
+	if artifacts, err := ArchiveTaskMedia(context.Background(), owner, []MediaSource{{Url: server.URL + "/b.mp4", Kind: model.TaskArtifactKindVideo}}); !errors.Is(err, model.ErrTaskArtifactQuotaInsufficient) || len(artifacts) != 0 {
+		t.Fatalf("archive should be skipped when quota is insufficient: %d artifacts, %v", len(artifacts), err)
+	}
+}
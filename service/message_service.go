@@ -175,6 +175,33 @@ func DeliverSystemMessageToUser(userID int, cahID string, username string, displ
 	return nil
 }
 
+// PublishSystemMessageToAll 向所有启用用户发布系统消息，sendEmail 为 true 时同时发送邮件
+func PublishSystemMessageToAll(title string, content string, sendEmail bool) (*model.Message, error) {
+	recipients, err := model.ListEnabledUserRecipients()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	message := &model.Message{
+		Title:       strings.TrimSpace(title),
+		Content:     strings.TrimSpace(content),
+		Status:      model.MessageStatusOnline,
+		Source:      model.MessageSourceSystem,
+		TargetType:  model.MessageTargetAll,
+		PublishedAt: &now,
+	}
+	if err = model.CreateMessage(message); err != nil {
+		return nil, err
+	}
+	if err = model.CreateUserMessageDeliveries(message.Id, recipients); err != nil {
+		return nil, err
+	}
+	if sendEmail {
+		dispatchMessageEmailsAsync(*message, recipients, common.GenerateEmailIdempotencyKey("message-delivery-batch", fmt.Sprintf("%d", message.Id), now.Format(time.RFC3339Nano)))
+	}
+	return message, nil
+}
+
 func RetryFailedMessageEmailDelivery(messageID uint) (int, error) {
 	message, err := model.GetMessageByID(messageID)
 	if err != nil {
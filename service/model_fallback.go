@@ -0,0 +1,56 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelFallbackChain 返回模型的回退链：令牌级配置优先，其次为管理员按分组配置的回退链。
+// 结果已去除原模型、重复项以及令牌无权访问的模型。
+func GetModelFallbackChain(c *gin.Context, modelName string) []string {
+	var chain []string
+	if fallbacks, ok := common.GetContextKeyType[map[string][]string](c, constant.ContextKeyTokenModelFallbacks); ok {
+		chain = fallbacks[modelName]
+	}
+	if len(chain) == 0 {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		chain = model_setting.GetModelFallbackChain(modelName, group)
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	var tokenModelLimit map[string]bool
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ = common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+		if tokenModelLimit == nil {
+			return nil
+		}
+	}
+
+	seen := map[string]struct{}{modelName: {}}
+	result := make([]string, 0, len(chain))
+	for _, fallback := range chain {
+		fallback = strings.TrimSpace(fallback)
+		if fallback == "" {
+			continue
+		}
+		if _, ok := seen[fallback]; ok {
+			continue
+		}
+		seen[fallback] = struct{}{}
+		if tokenModelLimit != nil {
+			if _, ok := tokenModelLimit[ratio_setting.FormatMatchingModelName(fallback)]; !ok {
+				continue
+			}
+		}
+		result = append(result, fallback)
+	}
+	return result
+}
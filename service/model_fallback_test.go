@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newModelFallbackTestContext(t *testing.T, chains map[string]map[string][]string) *gin.Context {
+	t.Helper()
+	settings := model_setting.GetModelFallbackSettings()
+	original := *settings
+	t.Cleanup(func() {
+		*settings = original
+	})
+	settings.Enabled = true
+	settings.Chains = chains
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	return c
+}
+
+func TestGetModelFallbackChain(t *testing.T) {
+	chains := map[string]map[string][]string{
+		"gpt-4o": {
+			"default": {"gpt-4o-mini", "claude-3-5-sonnet"},
+			"*":       {"gpt-4.1"},
+		},
+		"claude-3-5-sonnet": {"*": {"gpt-4o"}},
+	}
+
+	t.Run("group chain", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		got := GetModelFallbackChain(c, "gpt-4o")
+		if want := []string{"gpt-4o-mini", "claude-3-5-sonnet"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("wildcard group", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, "vip")
+		got := GetModelFallbackChain(c, "gpt-4o")
+		if want := []string{"gpt-4.1"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("token chain overrides global chain", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		common.SetContextKey(c, constant.ContextKeyTokenModelFallbacks, map[string][]string{"gpt-4o": {"deepseek-chat"}})
+		got := GetModelFallbackChain(c, "gpt-4o")
+		if want := []string{"deepseek-chat"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		// 令牌未配置该模型时仍使用全局回退链
+		got = GetModelFallbackChain(c, "claude-3-5-sonnet")
+		if want := []string{"gpt-4o"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("self reference and cycles are removed", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		common.SetContextKey(c, constant.ContextKeyTokenModelFallbacks, map[string][]string{
+			"gpt-4o": {"gpt-4o", " claude-3-5-sonnet ", "", "claude-3-5-sonnet", "gpt-4o", "gpt-4o-mini"},
+		})
+		got := GetModelFallbackChain(c, "gpt-4o")
+		if want := []string{"claude-3-5-sonnet", "gpt-4o-mini"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("empty chain", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, map[string]map[string][]string{"gpt-4o": {"*": {}}})
+		if got := GetModelFallbackChain(c, "gpt-4o"); got != nil {
+			t.Fatalf("expected no fallback, got %v", got)
+		}
+		if got := GetModelFallbackChain(c, "unknown-model"); got != nil {
+			t.Fatalf("expected no fallback, got %v", got)
+		}
+		// 只包含模型自身的回退链等同于空链
+		common.SetContextKey(c, constant.ContextKeyTokenModelFallbacks, map[string][]string{"gpt-4o": {"gpt-4o"}})
+		if got := GetModelFallbackChain(c, "gpt-4o"); len(got) != 0 {
+			t.Fatalf("expected no fallback, got %v", got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		model_setting.GetModelFallbackSettings().Enabled = false
+		if got := GetModelFallbackChain(c, "gpt-4o"); got != nil {
+			t.Fatalf("expected no fallback when disabled, got %v", got)
+		}
+	})
+
+	t.Run("token model limit", func(t *testing.T) {
+		c := newModelFallbackTestContext(t, chains)
+		common.SetContextKey(c, constant.ContextKeyTokenModelLimitEnabled, true)
+		common.SetContextKey(c, constant.ContextKeyTokenModelLimit, map[string]bool{"gpt-4o": true, "claude-3-5-sonnet": true})
+		got := GetModelFallbackChain(c, "gpt-4o")
+		if want := []string{"claude-3-5-sonnet"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const objectStorageUnsignedPayload = "UNSIGNED-PAYLOAD"
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStorage 最小化的 S3 兼容对象存储客户端，使用 SigV4 签名
+type ObjectStorage struct {
+	endpoint    *url.URL
+	region      string
+	bucket      string
+	pathStyle   bool
+	credentials aws.Credentials
+	signer      *v4.Signer
+}
+
+func NewObjectStorage(settings system_setting.ObjectStorageSettings) (*ObjectStorage, error) {
+	if !settings.IsConfigured() {
+		return nil, errors.New("对象存储未配置")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(strings.TrimSpace(settings.Endpoint), "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("对象存储 endpoint 无效: %s", settings.Endpoint)
+	}
+	region := strings.TrimSpace(settings.Region)
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &ObjectStorage{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    strings.TrimSpace(settings.Bucket),
+		pathStyle: settings.UsePathStyle,
+		credentials: aws.Credentials{
+			AccessKeyID:     settings.AccessKeyId,
+			SecretAccessKey: settings.SecretAccessKey,
+		},
+		signer: v4.NewSigner(),
+	}, nil
+}
+
+// GetObjectStorage 按当前系统配置创建对象存储客户端
+func GetObjectStorage() (*ObjectStorage, error) {
+	return NewObjectStorage(*system_setting.GetObjectStorageSettings())
+}
+
+// S3 签名时对象路径只编码一次
+func disableS3PathEscaping(o *v4.SignerOptions) {
+	o.DisableURIPathEscaping = true
+}
+
+func (s *ObjectStorage) objectURL(key string) string {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.bucket + "/" + escapedKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + escapedKey
+	}
+	u.RawPath = u.Path
+	u.Path, _ = url.PathUnescape(u.Path)
+	return u.String()
+}
+
+func (s *ObjectStorage) do(ctx context.Context, method string, key string, body []byte, contentType string) (*http.Response, error) {
+	sum := sha256.Sum256(body)
+	return s.doStream(ctx, method, key, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(sum[:]), contentType)
+}
+
+// doStream 发送请求体为流的请求，payloadHash 为请求体的 SHA-256 十六进制摘要
+func (s *ObjectStorage) doStream(ctx context.Context, method string, key string, body io.Reader, size int64, payloadHash string, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if err = s.signer.SignHTTP(ctx, s.credentials, req, payloadHash, "s3", s.region, time.Now(), disableS3PathEscaping); err != nil {
+		return nil, err
+	}
+	return GetHttpClient().Do(req)
+}
+
+func objectStorageError(resp *http.Response, method string, key string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("object storage %s %s failed with status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func (s *ObjectStorage) PutObject(ctx context.Context, key string, body []byte, contentType string) error {
+	sum := sha256.Sum256(body)
+	return s.PutObjectStream(ctx, key, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(sum[:]), contentType)
+}
+
+// PutObjectStream 从流上传对象，不将内容读入内存；size 与 payloadHash 需与流内容一致
+func (s *ObjectStorage) PutObjectStream(ctx context.Context, key string, body io.Reader, size int64, payloadHash string, contentType string) error {
+	resp, err := s.doStream(ctx, http.MethodPut, key, body, size, payloadHash, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return objectStorageError(resp, http.MethodPut, key)
+	}
+	return nil
+}
+
+// GetObject 返回对象内容，调用方负责关闭
+func (s *ObjectStorage) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, objectStorageError(resp, http.MethodGet, key)
+	}
+	return resp.Body, nil
+}
+
+func (s *ObjectStorage) DeleteObject(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return objectStorageError(resp, http.MethodDelete, key)
+	}
+	return nil
+}
+
+// PresignGetObject 生成带有效期的对象下载地址
+func (s *ObjectStorage) PresignGetObject(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int64(expires.Seconds())))
+	req.URL.RawQuery = query.Encode()
+	signedURL, _, err := s.signer.PresignHTTP(ctx, s.credentials, req, objectStorageUnsignedPayload, "s3", s.region, time.Now(), disableS3PathEscaping)
+	if err != nil {
+		return "", err
+	}
+	return signedURL, nil
+}
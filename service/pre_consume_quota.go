@@ -12,7 +12,6 @@ import (
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/types"
 
-	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,7 +20,7 @@ func ReturnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还预扣费额度 %s", relayInfo.UserId, logger.FormatQuota(relayInfo.FinalPreConsumedQuota)))
 		if ShouldUseSubscriptionQuota(relayInfo) {
 			selectionToken := c.GetString(SubscriptionQuotaSelectionTokenKey)
-			gopool.Go(func() {
+			GoSettlement(func() {
 				err := model.AdjustUserSubscriptionQuotaBySelectionToken(relayInfo.UserId, selectionToken, -int64(relayInfo.FinalPreConsumedQuota))
 				if err != nil {
 					common.SysLog("error return pre-consumed subscription quota: " + err.Error())
@@ -30,7 +29,7 @@ func ReturnPreConsumedQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo) {
 			return
 		}
 
-		gopool.Go(func() {
+		GoSettlement(func() {
 			relayInfoCopy := *relayInfo
 
 			err := PostConsumeQuota(&relayInfoCopy, -relayInfoCopy.FinalPreConsumedQuota, 0, false)
@@ -97,7 +96,7 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		if err != nil {
 			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 		}
-		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
+		err = model.DecreaseUserQuota(relayInfo.UserId, preConsumedQuota, model.QuotaLedgerTypeConsume)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 		}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// PriceBookCheckInterval 价格簿到期检查间隔
+const PriceBookCheckInterval = 15 * time.Second
+
+var (
+	priceBookSchedulerOnce sync.Once
+	priceBookLock          sync.Mutex
+)
+
+// StartPriceBookScheduler 启动价格簿本地切换，所有节点都需要运行：生效时间到达时先在内存中切换，避免等待选项同步；
+// 持久化生效版本与发送变更通知由后台任务 RunPriceBookActivation 完成
+func StartPriceBookScheduler() {
+	priceBookSchedulerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(PriceBookCheckInterval)
+			defer ticker.Stop()
+			for {
+				applyDuePriceBookLocally(time.Now())
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+func applyDuePriceBookLocally(now time.Time) {
+	priceBookLock.Lock()
+	defer priceBookLock.Unlock()
+
+	version, err := model.GetDuePriceBookVersion(now.Unix())
+	if err != nil {
+		common.SysError("failed to query price book versions: " + err.Error())
+		return
+	}
+	// 已生效的版本通过选项同步传播，这里只处理刚到生效时间的版本
+	if version == nil || version.Status != model.PriceBookStatusScheduled || version.Id == ratio_setting.GetActivePriceBookVersion() {
+		return
+	}
+	if err = model.ApplyPriceBookVersionLocally(version); err != nil {
+		common.SysError(fmt.Sprintf("failed to apply price book version %d: %s", version.Id, err.Error()))
+	}
+}
+
+// RunPriceBookActivation 持久化到达生效时间的版本并发送即将生效的变更通知，由后台任务调度器定期调用
+func RunPriceBookActivation() error {
+	now := time.Now()
+	priceBookLock.Lock()
+	defer priceBookLock.Unlock()
+
+	version, err := model.GetDuePriceBookVersion(now.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to query price book versions: %w", err)
+	}
+	var errs []error
+	if version != nil && version.Status == model.PriceBookStatusScheduled {
+		if err = model.ActivatePriceBookVersion(version); err != nil {
+			errs = append(errs, fmt.Errorf("failed to activate price book version %d: %w", version.Id, err))
+		} else {
+			common.SysLog(fmt.Sprintf("price book version %d activated", version.Id))
+		}
+	}
+	if err = notifyUpcomingPriceBookVersions(now); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// ActivatePriceBookVersionNow 立即生效指定版本；历史版本重新生效时保留其原生效时间
+func ActivatePriceBookVersionNow(version *model.PriceBookVersion) error {
+	priceBookLock.Lock()
+	defer priceBookLock.Unlock()
+	if version.Status == model.PriceBookStatusScheduled {
+		version.EffectiveFrom = common.GetTimestamp()
+		if err := model.SavePriceBookVersion(version); err != nil {
+			return err
+		}
+	}
+	return model.ActivatePriceBookVersion(version)
+}
+
+// PriceBookBaseSnapshot 返回比较基准：against 为 0 时使用当前生效的价格配置
+func PriceBookBaseSnapshot(against int) (ratio_setting.PriceBookSnapshot, error) {
+	if against == 0 {
+		return ratio_setting.CurrentPriceBookSnapshot(), nil
+	}
+	version, err := model.GetPriceBookVersionById(against)
+	if err != nil {
+		return ratio_setting.PriceBookSnapshot{}, err
+	}
+	return version.GetSnapshot()
+}
+
+func notifyUpcomingPriceBookVersions(now time.Time) error {
+	setting := operation_setting.GetPriceBookSetting()
+	if setting.NotifyAheadHours <= 0 {
+		return nil
+	}
+	versions, err := model.GetPriceBookVersionsToNotify(now.Unix(), now.Add(time.Duration(setting.NotifyAheadHours)*time.Hour).Unix())
+	if err != nil {
+		return fmt.Errorf("failed to query price book versions to notify: %w", err)
+	}
+	var errs []error
+	for _, version := range versions {
+		snapshot, err := version.GetSnapshot()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse price book version %d: %w", version.Id, err))
+			continue
+		}
+		changes := ratio_setting.DiffPriceBookSnapshots(ratio_setting.CurrentPriceBookSnapshot(), snapshot)
+		if len(changes) > 0 {
+			title, content := buildPriceBookNotification(version, changes, setting.MaxNotifyChanges)
+			if _, err = PublishSystemMessageToAll(title, content, setting.NotifyEmail); err != nil {
+				errs = append(errs, fmt.Errorf("failed to notify price book version %d: %w", version.Id, err))
+				continue
+			}
+		}
+		if err = model.MarkPriceBookVersionNotified(version.Id, now.Unix()); err != nil {
+			errs = append(errs, fmt.Errorf("failed to mark price book version %d notified: %w", version.Id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var priceBookKeyLabels = map[string]string{
+	ratio_setting.PriceBookKeyModelRatio:            "模型倍率",
+	ratio_setting.PriceBookKeyModelPrice:            "模型按次价格",
+	ratio_setting.PriceBookKeyCompletionRatio:       "补全倍率",
+	ratio_setting.PriceBookKeyCacheRatio:            "缓存倍率",
+	ratio_setting.PriceBookKeyCreateCacheRatio:      "缓存创建倍率",
+	ratio_setting.PriceBookKeyImageRatio:            "图片倍率",
+	ratio_setting.PriceBookKeyAudioRatio:            "音频倍率",
+	ratio_setting.PriceBookKeyAudioCompletionRatio:  "音频补全倍率",
+	ratio_setting.PriceBookKeyGroupRatio:            "分组倍率",
+	ratio_setting.PriceBookKeyGroupGroupRatio:       "分组间倍率",
+	ratio_setting.PriceBookKeyModelContextTiers:     "长上下文分档",
+	ratio_setting.PriceBookKeyGroupPricingSchedules: "分组分时计价",
+}
+
+// formatPriceBookValue 数值直接输出，分档与分时计价等结构化配置输出紧凑 JSON
+func formatPriceBookValue(value *float64, config any) string {
+	if config != nil {
+		data, err := common.Marshal(config)
+		if err != nil {
+			return "-"
+		}
+		return strings.ReplaceAll(string(data), "|", "\\|")
+	}
+	if value == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+func buildPriceBookNotification(version *model.PriceBookVersion, changes []ratio_setting.PriceBookChange, maxChanges int) (string, string) {
+	effectiveAt := time.Unix(version.EffectiveFrom, 0).Format("2006-01-02 15:04")
+	title := fmt.Sprintf("价格调整通知：%s 起生效", effectiveAt)
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("以下价格将于 **%s** 起生效", effectiveAt))
+	if name := strings.TrimSpace(version.Name); name != "" {
+		b.WriteString(fmt.Sprintf("（%s）", name))
+	}
+	b.WriteString("。\n\n")
+	if description := strings.TrimSpace(version.Description); description != "" {
+		b.WriteString(description + "\n\n")
+	}
+	b.WriteString("| 项目 | 名称 | 调整前 | 调整后 |\n| --- | --- | --- | --- |\n")
+	for i, change := range changes {
+		if maxChanges > 0 && i >= maxChanges {
+			b.WriteString(fmt.Sprintf("\n另有 %d 项调整，详见模型价格页面。\n", len(changes)-maxChanges))
+			break
+		}
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", priceBookKeyLabels[change.Key], change.Name,
+			formatPriceBookValue(change.Old, change.OldConfig), formatPriceBookValue(change.New, change.NewConfig)))
+	}
+	return title, b.String()
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+func TestRealtimeTierRatiosSelectPerResponse(t *testing.T) {
+	original := ratio_setting.ModelContextTiers2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelContextTiersByJSONString(original)
+	})
+	if err := ratio_setting.UpdateModelContextTiersByJSONString(`{"tiered-realtime": [{"min_prompt_tokens": 1000, "model_ratio": 4, "completion_ratio": 8}]}`); err != nil {
+		t.Fatal(err)
+	}
+	relayInfo := &relaycommon.RelayInfo{OriginModelName: "tiered-realtime"}
+	relayInfo.PriceData.ModelRatio = 2
+	relayInfo.PriceData.CompletionRatio = 4
+	relayInfo.PriceData.BaseTierRatios = &types.ContextTierRatios{ModelRatio: 2, CompletionRatio: 4}
+
+	if ratios := realtimeTierRatios(relayInfo, 800); ratios.ModelRatio != 2 || ratios.CompletionRatio != 4 {
+		t.Fatalf("expected base ratios below the threshold, got %+v", ratios)
+	}
+	ratios := realtimeTierRatios(relayInfo, 1200)
+	if ratios.ModelRatio != 4 || ratios.CompletionRatio != 8 {
+		t.Fatalf("expected tier ratios above the threshold, got %+v", ratios)
+	}
+	// 选档不修改会话的基础倍率，后续较短的响应仍按基础倍率计费
+	if ratios := realtimeTierRatios(relayInfo, 500); ratios.ModelRatio != 2 {
+		t.Fatalf("expected base ratios for a later short response, got %+v", ratios)
+	}
+
+	base := calculateAudioQuota(QuotaInfo{
+		InputDetails:    TokenDetails{TextTokens: 100},
+		OutputDetails:   TokenDetails{TextTokens: 100},
+		ModelName:       "tiered-realtime",
+		ModelRatio:      2,
+		CompletionRatio: 4,
+		GroupRatio:      1,
+	})
+	tiered := calculateAudioQuota(QuotaInfo{
+		InputDetails:    TokenDetails{TextTokens: 100},
+		OutputDetails:   TokenDetails{TextTokens: 100},
+		ModelName:       "tiered-realtime",
+		ModelRatio:      4,
+		CompletionRatio: 8,
+		GroupRatio:      1,
+	})
+	if tiered <= base {
+		t.Fatalf("expected tier completion ratio to be billed, base %d tiered %d", base, tiered)
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 跨渠道还原上下文时最多追溯的 response 轮数
+const maxStoredResponseChainLength = 50
+
+// GetPinnedResponseChannel 返回生成 previousResponseId 的渠道，渠道不可用或不在用户可用分组内时返回 nil
+func GetPinnedResponseChannel(c *gin.Context, modelName string, previousResponseId string) *model.Channel {
+	if !model_setting.GetResponsesSettings().ChannelPinningEnabled {
+		return nil
+	}
+	stored, err := model.GetStoredResponse(c.GetInt("id"), previousResponseId)
+	if err != nil {
+		logger.LogError(c, "failed to get stored response: "+err.Error())
+		return nil
+	}
+	if stored == nil {
+		return nil
+	}
+	return getUsablePinnedChannel(c, stored.ChannelId, modelName)
+}
+
+// normalizeResponsesInput 将字符串形式的 input 统一为输入项数组
+func normalizeResponsesInput(input json.RawMessage) ([]json.RawMessage, error) {
+	items := make([]json.RawMessage, 0)
+	if len(input) == 0 {
+		return items, nil
+	}
+	if common.GetJsonType(input) == "string" {
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{
+			"type":    "message",
+			"role":    "user",
+			"content": text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(items, item), nil
+	}
+	if err := common.Unmarshal(input, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// RecordStoredResponse 记录 response 所在渠道；开启本地保存时同时保存本轮原始输入与输出
+func RecordStoredResponse(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) {
+	if info.ResponsesUsageInfo == nil || info.ResponsesUsageInfo.ResponseId == "" {
+		return
+	}
+	// store=false 的 response 上游不会保存，本地也不记录
+	if string(request.Store) == "false" {
+		return
+	}
+	stored := &model.StoredResponse{
+		ResponseId:         info.ResponsesUsageInfo.ResponseId,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		ChannelId:          info.ChannelId,
+		Model:              info.OriginModelName,
+		PreviousResponseId: request.PreviousResponseID,
+		Status:             info.ResponsesUsageInfo.ResponseStatus,
+	}
+	if stored.Status == "" {
+		stored.Status = model.StoredResponseStatusCompleted
+	}
+	if model_setting.GetResponsesSettings().LocalStoreEnabled {
+		inputItems, err := normalizeResponsesInput(request.Input)
+		if err != nil {
+			logger.LogError(c, "failed to parse responses input: "+err.Error())
+		} else if input, err := common.Marshal(inputItems); err == nil {
+			stored.Input = string(input)
+		}
+		stored.Output = string(info.ResponsesUsageInfo.Output)
+	}
+	if err := model.SaveStoredResponse(stored); err != nil {
+		logger.LogError(c, "failed to save stored response: "+err.Error())
+	}
+}
+
+// ExpandResponsesHistory 当请求未能落到生成 previous_response_id 的渠道时，用本地保存的历史展开为完整输入，
+// 并移除 previous_response_id；历史不完整时保持原样交由上游处理
+func ExpandResponsesHistory(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) error {
+	if request.PreviousResponseID == "" || !model_setting.GetResponsesSettings().LocalStoreEnabled {
+		return nil
+	}
+	chain, err := model.GetStoredResponseChain(info.UserId, request.PreviousResponseID, maxStoredResponseChainLength)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 || chain[len(chain)-1].ChannelId == info.ChannelId {
+		return nil
+	}
+	for _, stored := range chain {
+		if !stored.HasLocalContent() {
+			return nil
+		}
+	}
+
+	items := make([]json.RawMessage, 0)
+	for _, stored := range chain {
+		var inputItems, outputItems []json.RawMessage
+		if stored.Input != "" {
+			if err = common.Unmarshal([]byte(stored.Input), &inputItems); err != nil {
+				return err
+			}
+		}
+		if stored.Output != "" {
+			if err = common.Unmarshal([]byte(stored.Output), &outputItems); err != nil {
+				return err
+			}
+		}
+		items = append(items, inputItems...)
+		for _, item := range outputItems {
+			// reasoning 项包含渠道私有的加密内容，其他渠道无法识别
+			var output struct {
+				Type string `json:"type"`
+			}
+			if err = common.Unmarshal(item, &output); err == nil && output.Type == "reasoning" {
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	inputItems, err := normalizeResponsesInput(request.Input)
+	if err != nil {
+		return err
+	}
+	items = append(items, inputItems...)
+
+	input, err := common.Marshal(items)
+	if err != nil {
+		return err
+	}
+	logger.LogInfo(c, fmt.Sprintf("expand previous_response_id %s with %d local history items", request.PreviousResponseID, len(items)-len(inputItems)))
+	request.Input = input
+	request.PreviousResponseID = ""
+	return nil
+}
+
+// BuildLocalStoredResponse 由本地记录还原 response 对象，用于上游渠道不可用时的查询
+func BuildLocalStoredResponse(stored *model.StoredResponse) map[string]any {
+	var output any = []any{}
+	if stored.Output != "" {
+		output = json.RawMessage(stored.Output)
+	}
+	return map[string]any{
+		"id":                   stored.ResponseId,
+		"object":               "response",
+		"created_at":           stored.CreatedAt,
+		"status":               stored.Status,
+		"model":                stored.Model,
+		"previous_response_id": stored.PreviousResponseId,
+		"output":               output,
+	}
+}
+
+// BuildLocalResponseInputItems 由本地记录还原 input_items 列表，按 OpenAI 默认的倒序返回
+func BuildLocalResponseInputItems(stored *model.StoredResponse) (map[string]any, error) {
+	items := make([]json.RawMessage, 0)
+	if stored.Input != "" {
+		if err := common.Unmarshal([]byte(stored.Input), &items); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(items)
+	return map[string]any{
+		"object":   "list",
+		"data":     items,
+		"has_more": false,
+	}, nil
+}
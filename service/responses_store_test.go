@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExpandResponsesHistoryAcrossChannels(t *testing.T) {
+	originalDB := model.DB
+	originalSettings := *model_setting.GetResponsesSettings()
+	t.Cleanup(func() {
+		model.DB = originalDB
+		*model_setting.GetResponsesSettings() = originalSettings
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:responses-store-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.StoredResponse{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	model_setting.GetResponsesSettings().LocalStoreEnabled = true
+
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("POST", "/v1/responses", nil)
+
+	// 第一轮在渠道 1 上完成
+	first := &relaycommon.RelayInfo{
+		UserId:             1,
+		ChannelMeta:        &relaycommon.ChannelMeta{ChannelId: 1},
+		ResponsesUsageInfo: &relaycommon.ResponsesUsageInfo{ResponseId: "resp_1", Output: json.RawMessage(`[{"type":"reasoning","id":"rs_1"},{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hello"}]}]`)},
+	}
+	RecordStoredResponse(ctx, first, &dto.OpenAIResponsesRequest{Input: json.RawMessage(`"hi"`)})
+
+	// 同一渠道上的后续请求保持 previous_response_id
+	request := &dto.OpenAIResponsesRequest{Input: json.RawMessage(`"again"`), PreviousResponseID: "resp_1"}
+	if err := ExpandResponsesHistory(ctx, first, request); err != nil {
+		t.Fatal(err)
+	}
+	if request.PreviousResponseID != "resp_1" {
+		t.Fatalf("expected previous_response_id kept on the same channel, got %q", request.PreviousResponseID)
+	}
+
+	// 落到其他渠道时展开为完整输入，并丢弃 reasoning 项
+	second := &relaycommon.RelayInfo{UserId: 1, ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 2}}
+	if err := ExpandResponsesHistory(ctx, second, request); err != nil {
+		t.Fatal(err)
+	}
+	if request.PreviousResponseID != "" {
+		t.Fatalf("expected previous_response_id removed, got %q", request.PreviousResponseID)
+	}
+	var items []map[string]any
+	if err := common.Unmarshal(request.Input, &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0]["content"] != "hi" || items[1]["role"] != "assistant" || items[2]["content"] != "again" {
+		t.Fatalf("unexpected expanded input: %s", string(request.Input))
+	}
+
+	// 其他用户无法引用该 response
+	other := &dto.OpenAIResponsesRequest{Input: json.RawMessage(`"x"`), PreviousResponseID: "resp_1"}
+	if err := ExpandResponsesHistory(ctx, &relaycommon.RelayInfo{UserId: 2, ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 2}}, other); err != nil {
+		t.Fatal(err)
+	}
+	if other.PreviousResponseID != "resp_1" {
+		t.Fatal("expected other user's request untouched")
+	}
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	sessionAffinityKeyPrefix       = "session_affinity:"
+	sessionAffinityStatsKeyPrefix  = "session_affinity_stats:"
+	sessionAffinityStatsChannelSet = "session_affinity_stats_channels"
+	sessionAffinityCleanupInterval = time.Minute
+)
+
+// 作为缓存前缀参与哈希的请求体字段，覆盖 OpenAI Chat / Responses、Claude 与 Gemini 格式
+var sessionAffinityPrefixPaths = []string{
+	"system",
+	"instructions",
+	"systemInstruction",
+	"system_instruction",
+	"tools",
+	"messages.0",
+	"input.0",
+	"contents.0",
+}
+
+type sessionAffinityPin struct {
+	channelId int
+	keyIndex  int
+	expireAt  time.Time
+}
+
+type sessionAffinityCounter struct {
+	affinityRequests atomic.Int64
+	affinityHits     atomic.Int64
+	promptTokens     atomic.Int64
+	cachedTokens     atomic.Int64
+}
+
+// sessionAffinityPins / sessionAffinityCounters 在未启用 Redis 时使用
+var (
+	sessionAffinityPins        sync.Map
+	sessionAffinityCounters    sync.Map
+	sessionAffinityCleanupOnce sync.Once
+)
+
+// ChannelAffinityStats 渠道的会话粘性与 prompt 缓存命中统计
+type ChannelAffinityStats struct {
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// 携带会话标识且成功完成的请求数
+	AffinityRequests int64 `json:"affinity_requests"`
+	// 其中沿用已有会话绑定（同一渠道与密钥）的请求数
+	AffinityHits int64 `json:"affinity_hits"`
+	// 输入 token 总数（含缓存读取）与缓存读取的 token 数
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	AffinityHitRatio float64 `json:"affinity_hit_ratio"`
+	CacheHitRatio    float64 `json:"cache_hit_ratio"`
+}
+
+func startSessionAffinityCleanupTask() {
+	sessionAffinityCleanupOnce.Do(func() {
+		ticker := time.NewTicker(sessionAffinityCleanupInterval)
+		go func() {
+			for range ticker.C {
+				now := time.Now()
+				sessionAffinityPins.Range(func(key, value any) bool {
+					if pin, ok := value.(sessionAffinityPin); ok && now.After(pin.expireAt) {
+						sessionAffinityPins.Delete(key)
+					}
+					return true
+				})
+			}
+		}()
+	})
+}
+
+// getSessionAffinitySource 按请求头、user 字段、缓存前缀的顺序取会话标识来源，均不可用时返回空字符串
+func getSessionAffinitySource(c *gin.Context, setting *operation_setting.SessionAffinitySetting) string {
+	if setting.HeaderName != "" {
+		if value := strings.TrimSpace(c.GetHeader(setting.HeaderName)); value != "" {
+			return "header:" + value
+		}
+	}
+	if !setting.UseUserField && !setting.UsePromptPrefix {
+		return ""
+	}
+	if !strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+		return ""
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil || len(body) == 0 {
+		return ""
+	}
+	if setting.UseUserField {
+		for _, path := range []string{"user", "metadata.user_id"} {
+			if value := gjson.GetBytes(body, path); value.Type == gjson.String && value.String() != "" {
+				return "user:" + value.String()
+			}
+		}
+	}
+	if setting.UsePromptPrefix {
+		hash := sha256.New()
+		found := false
+		for _, path := range sessionAffinityPrefixPaths {
+			value := gjson.GetBytes(body, path)
+			if !value.Exists() {
+				continue
+			}
+			found = true
+			hash.Write([]byte(path))
+			hash.Write([]byte(value.Raw))
+		}
+		if found {
+			return "prefix:" + hex.EncodeToString(hash.Sum(nil))
+		}
+	}
+	return ""
+}
+
+// getSessionAffinityKey 生成会话绑定的存储键，按用户与模型隔离，避免不同用户的相同标识互相影响
+func getSessionAffinityKey(c *gin.Context, modelName string) string {
+	source := getSessionAffinitySource(c, operation_setting.GetSessionAffinitySetting())
+	if source == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", c.GetInt("id"), modelName, source)))
+	return sessionAffinityKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func loadSessionAffinityPin(key string) (int, int, bool) {
+	if common.RedisEnabled {
+		value, err := common.RDB.Get(context.Background(), key).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				common.SysError("failed to get session affinity: " + err.Error())
+			}
+			return 0, 0, false
+		}
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 {
+			return 0, 0, false
+		}
+		channelId, err1 := strconv.Atoi(parts[0])
+		keyIndex, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return 0, 0, false
+		}
+		return channelId, keyIndex, true
+	}
+	value, ok := sessionAffinityPins.Load(key)
+	if !ok {
+		return 0, 0, false
+	}
+	pin := value.(sessionAffinityPin)
+	if time.Now().After(pin.expireAt) {
+		sessionAffinityPins.Delete(key)
+		return 0, 0, false
+	}
+	return pin.channelId, pin.keyIndex, true
+}
+
+func saveSessionAffinityPin(key string, channelId int, keyIndex int, ttl time.Duration) error {
+	if common.RedisEnabled {
+		return common.RDB.Set(context.Background(), key, fmt.Sprintf("%d:%d", channelId, keyIndex), ttl).Err()
+	}
+	startSessionAffinityCleanupTask()
+	sessionAffinityPins.Store(key, sessionAffinityPin{
+		channelId: channelId,
+		keyIndex:  keyIndex,
+		expireAt:  time.Now().Add(ttl),
+	})
+	return nil
+}
+
+// GetSessionAffinityChannel 返回会话已绑定的渠道；未开启、无会话标识、未绑定或渠道已不可用时返回 nil，由调用方常规选路
+func GetSessionAffinityChannel(c *gin.Context, modelName string) *model.Channel {
+	setting := operation_setting.GetSessionAffinitySetting()
+	if !setting.Enabled || modelName == "" {
+		return nil
+	}
+	key := getSessionAffinityKey(c, modelName)
+	if key == "" {
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityKey, key)
+
+	channelId, keyIndex, ok := loadSessionAffinityPin(key)
+	if !ok {
+		return nil
+	}
+	channel := getUsablePinnedChannel(c, channelId, modelName)
+	if channel == nil {
+		logger.LogDebug(c, fmt.Sprintf("session affinity channel #%d is unavailable, fallback to normal selection", channelId))
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeySessionAffinityChannelId, channelId)
+	common.SetContextKey(c, constant.ContextKeySessionAffinityKeyIndex, keyIndex)
+	return channel
+}
+
+// GetSessionAffinityKeyIndex 返回会话在该渠道上绑定的多密钥下标；重试时不再沿用，以便换用其他密钥
+func GetSessionAffinityKeyIndex(c *gin.Context, channelId int) (int, bool) {
+	if len(c.GetStringSlice("use_channel")) > 0 {
+		return 0, false
+	}
+	if common.GetContextKeyInt(c, constant.ContextKeySessionAffinityChannelId) != channelId {
+		return 0, false
+	}
+	index, ok := common.GetContextKey(c, constant.ContextKeySessionAffinityKeyIndex)
+	if !ok {
+		return 0, false
+	}
+	return index.(int), true
+}
+
+// RecordSessionAffinity 请求成功后将会话绑定到实际使用的渠道与密钥并刷新有效期
+func RecordSessionAffinity(c *gin.Context) {
+	key := common.GetContextKeyString(c, constant.ContextKeySessionAffinityKey)
+	if key == "" {
+		return
+	}
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	keyIndex := 0
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	ttl := time.Duration(operation_setting.GetSessionAffinitySetting().TTLSeconds) * time.Second
+	if ttl <= 0 {
+		return
+	}
+	if err := saveSessionAffinityPin(key, channelId, keyIndex, ttl); err != nil {
+		logger.LogError(c, "failed to save session affinity: "+err.Error())
+	}
+
+	hit := int64(0)
+	if pinnedChannelId := common.GetContextKeyInt(c, constant.ContextKeySessionAffinityChannelId); pinnedChannelId == channelId {
+		if pinnedIndex, ok := common.GetContextKey(c, constant.ContextKeySessionAffinityKeyIndex); ok && pinnedIndex.(int) == keyIndex {
+			hit = 1
+		}
+	}
+	incrSessionAffinityStats(channelId, map[string]int64{
+		"affinity_requests": 1,
+		"affinity_hits":     hit,
+	})
+}
+
+// RecordChannelCacheUsage 开启会话粘性时按渠道累计输入 token 与缓存读取 token，用于统计缓存命中率
+func RecordChannelCacheUsage(channelId int, promptTokens int, cachedTokens int) {
+	if !operation_setting.GetSessionAffinitySetting().Enabled || channelId == 0 || promptTokens <= 0 {
+		return
+	}
+	incrSessionAffinityStats(channelId, map[string]int64{
+		"prompt_tokens": int64(promptTokens),
+		"cached_tokens": int64(cachedTokens),
+	})
+}
+
+func incrSessionAffinityStats(channelId int, deltas map[string]int64) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := sessionAffinityStatsKeyPrefix + strconv.Itoa(channelId)
+		pipe := common.RDB.TxPipeline()
+		for field, delta := range deltas {
+			if delta != 0 {
+				pipe.HIncrBy(ctx, key, field, delta)
+			}
+		}
+		pipe.SAdd(ctx, sessionAffinityStatsChannelSet, channelId)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError("failed to record session affinity stats: " + err.Error())
+		}
+		return
+	}
+	value, _ := sessionAffinityCounters.LoadOrStore(channelId, &sessionAffinityCounter{})
+	counter := value.(*sessionAffinityCounter)
+	counter.affinityRequests.Add(deltas["affinity_requests"])
+	counter.affinityHits.Add(deltas["affinity_hits"])
+	counter.promptTokens.Add(deltas["prompt_tokens"])
+	counter.cachedTokens.Add(deltas["cached_tokens"])
+}
+
+func loadSessionAffinityStats() ([]*ChannelAffinityStats, error) {
+	statsList := make([]*ChannelAffinityStats, 0)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		members, err := common.RDB.SMembers(ctx, sessionAffinityStatsChannelSet).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			channelId, err := strconv.Atoi(member)
+			if err != nil {
+				continue
+			}
+			fields, err := common.RDB.HGetAll(ctx, sessionAffinityStatsKeyPrefix+member).Result()
+			if err != nil {
+				return nil, err
+			}
+			parse := func(field string) int64 {
+				value, _ := strconv.ParseInt(fields[field], 10, 64)
+				return value
+			}
+			statsList = append(statsList, &ChannelAffinityStats{
+				ChannelId:        channelId,
+				AffinityRequests: parse("affinity_requests"),
+				AffinityHits:     parse("affinity_hits"),
+				PromptTokens:     parse("prompt_tokens"),
+				CachedTokens:     parse("cached_tokens"),
+			})
+		}
+		return statsList, nil
+	}
+	sessionAffinityCounters.Range(func(key, value any) bool {
+		counter := value.(*sessionAffinityCounter)
+		statsList = append(statsList, &ChannelAffinityStats{
+			ChannelId:        key.(int),
+			AffinityRequests: counter.affinityRequests.Load(),
+			AffinityHits:     counter.affinityHits.Load(),
+			PromptTokens:     counter.promptTokens.Load(),
+			CachedTokens:     counter.cachedTokens.Load(),
+		})
+		return true
+	})
+	return statsList, nil
+}
+
+// GetChannelAffinityStats 返回各渠道的会话粘性命中率与 prompt 缓存命中率，按渠道 id 排序
+func GetChannelAffinityStats() ([]*ChannelAffinityStats, error) {
+	statsList, err := loadSessionAffinityStats()
+	if err != nil {
+		return nil, err
+	}
+	for _, stats := range statsList {
+		if channel, err := model.CacheGetChannel(stats.ChannelId); err == nil {
+			stats.ChannelName = channel.Name
+		}
+		if stats.AffinityRequests > 0 {
+			stats.AffinityHitRatio = float64(stats.AffinityHits) / float64(stats.AffinityRequests)
+		}
+		if stats.PromptTokens > 0 {
+			stats.CacheHitRatio = float64(stats.CachedTokens) / float64(stats.PromptTokens)
+		}
+	}
+	sort.Slice(statsList, func(i, j int) bool {
+		return statsList[i].ChannelId < statsList[j].ChannelId
+	})
+	return statsList, nil
+}
+
+// ResetChannelAffinityStats 清空会话粘性与缓存命中统计
+func ResetChannelAffinityStats() error {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		members, err := common.RDB.SMembers(ctx, sessionAffinityStatsChannelSet).Result()
+		if err != nil {
+			return err
+		}
+		keys := []string{sessionAffinityStatsChannelSet}
+		for _, member := range members {
+			keys = append(keys, sessionAffinityStatsKeyPrefix+member)
+		}
+		return common.RDB.Del(ctx, keys...).Err()
+	}
+	sessionAffinityCounters.Range(func(key, value any) bool {
+		sessionAffinityCounters.Delete(key)
+		return true
+	})
+	return nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newSessionAffinityTestContext(body string, sessionId string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	if sessionId != "" {
+		ctx.Request.Header.Set("X-Session-Id", sessionId)
+	}
+	ctx.Set("id", 1)
+	return ctx
+}
+
+func TestGetSessionAffinitySource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setting := operation_setting.SessionAffinitySetting{
+		HeaderName:      "X-Session-Id",
+		UseUserField:    true,
+		UsePromptPrefix: true,
+	}
+
+	source := getSessionAffinitySource(newSessionAffinityTestContext(`{"user":"u1"}`, "s1"), &setting)
+	if source != "header:s1" {
+		t.Fatalf("expected header source, got %q", source)
+	}
+	source = getSessionAffinitySource(newSessionAffinityTestContext(`{"metadata":{"user_id":"u2"}}`, ""), &setting)
+	if source != "user:u2" {
+		t.Fatalf("expected metadata.user_id source, got %q", source)
+	}
+
+	// 缓存前缀相同、后续轮次不同的请求应得到相同的会话标识
+	first := getSessionAffinitySource(newSessionAffinityTestContext(`{"messages":[{"role":"system","content":"sys"},{"role":"user","content":"a"}]}`, ""), &setting)
+	second := getSessionAffinitySource(newSessionAffinityTestContext(`{"messages":[{"role":"system","content":"sys"},{"role":"user","content":"b"}]}`, ""), &setting)
+	if !strings.HasPrefix(first, "prefix:") || first != second {
+		t.Fatalf("expected identical prefix source, got %q and %q", first, second)
+	}
+
+	setting.UsePromptPrefix = false
+	if source = getSessionAffinitySource(newSessionAffinityTestContext(`{"messages":[]}`, ""), &setting); source != "" {
+		t.Fatalf("expected empty source, got %q", source)
+	}
+}
+
+func TestRecordSessionAffinityWithoutRedis(t *testing.T) {
+	originalDB := model.DB
+	originalRedisEnabled := common.RedisEnabled
+	originalSetting := *operation_setting.GetSessionAffinitySetting()
+	t.Cleanup(func() {
+		_ = ResetChannelAffinityStats()
+		model.DB = originalDB
+		common.RedisEnabled = originalRedisEnabled
+		*operation_setting.GetSessionAffinitySetting() = originalSetting
+	})
+	db, err := gorm.Open(sqlite.Open("file:session-affinity-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Channel{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	if err := db.Create(&model.Channel{Id: 7, Name: "claude-main", Key: "k1"}).Error; err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	model.DB = db
+	common.RedisEnabled = false
+	operation_setting.GetSessionAffinitySetting().Enabled = true
+	operation_setting.GetSessionAffinitySetting().TTLSeconds = 60
+	gin.SetMode(gin.TestMode)
+
+	// 首次请求：建立绑定，不计命中
+	ctx := newSessionAffinityTestContext(`{}`, "s1")
+	key := getSessionAffinityKey(ctx, "gpt-4o")
+	common.SetContextKey(ctx, constant.ContextKeySessionAffinityKey, key)
+	common.SetContextKey(ctx, constant.ContextKeyChannelId, 7)
+	common.SetContextKey(ctx, constant.ContextKeyChannelIsMultiKey, true)
+	common.SetContextKey(ctx, constant.ContextKeyChannelMultiKeyIndex, 2)
+	RecordSessionAffinity(ctx)
+
+	channelId, keyIndex, ok := loadSessionAffinityPin(key)
+	if !ok || channelId != 7 || keyIndex != 2 {
+		t.Fatalf("unexpected pin: channel=%d index=%d ok=%v", channelId, keyIndex, ok)
+	}
+	if other := getSessionAffinityKey(newSessionAffinityTestContext(`{}`, "s1"), "gpt-4o-mini"); other == key {
+		t.Fatal("expected session affinity key to be scoped by model")
+	}
+
+	// 第二次请求沿用绑定：计为命中
+	ctx = newSessionAffinityTestContext(`{}`, "s1")
+	common.SetContextKey(ctx, constant.ContextKeySessionAffinityKey, key)
+	common.SetContextKey(ctx, constant.ContextKeySessionAffinityChannelId, 7)
+	common.SetContextKey(ctx, constant.ContextKeySessionAffinityKeyIndex, 2)
+	if index, ok := GetSessionAffinityKeyIndex(ctx, 7); !ok || index != 2 {
+		t.Fatalf("expected pinned key index 2, got %d ok=%v", index, ok)
+	}
+	if _, ok := GetSessionAffinityKeyIndex(ctx, 8); ok {
+		t.Fatal("expected no pinned key index for other channel")
+	}
+	common.SetContextKey(ctx, constant.ContextKeyChannelId, 7)
+	common.SetContextKey(ctx, constant.ContextKeyChannelIsMultiKey, true)
+	common.SetContextKey(ctx, constant.ContextKeyChannelMultiKeyIndex, 2)
+	RecordSessionAffinity(ctx)
+	RecordChannelCacheUsage(7, 1000, 800)
+
+	stats, err := GetChannelAffinityStats()
+	if err != nil {
+		t.Fatalf("get stats: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected stats for one channel, got %d", len(stats))
+	}
+	if stats[0].AffinityRequests != 2 || stats[0].AffinityHits != 1 || stats[0].AffinityHitRatio != 0.5 {
+		t.Fatalf("unexpected affinity stats: %+v", stats[0])
+	}
+	if stats[0].ChannelName != "claude-main" {
+		t.Fatalf("unexpected channel name: %q", stats[0].ChannelName)
+	}
+	if stats[0].CacheHitRatio != 0.8 {
+		t.Fatalf("unexpected cache hit ratio: %v", stats[0].CacheHitRatio)
+	}
+}
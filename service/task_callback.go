@@ -0,0 +1,314 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	taskCallbackMaxAttempts   = 6
+	taskCallbackRetryBase     = 30 * time.Second
+	taskCallbackAttemptLease  = 2 * time.Minute // 投递进行中时推迟重试，进程中途退出后由重试任务接手
+	taskCallbackRetryBatch    = 100
+	TaskCallbackRetryInterval = 30 * time.Second
+	TaskCallbackRetention     = 7 * 24 * time.Hour
+	taskCallbackMaxUrlLength  = 512
+	taskCallbackEventPrefix   = "task."
+)
+
+// TaskCallbackPayload 任务状态变化时回调给客户端的内容
+type TaskCallbackPayload struct {
+	Event      string `json:"event"`
+	TaskId     string `json:"task_id"`
+	Platform   string `json:"platform"`
+	Action     string `json:"action"`
+	Model      string `json:"model,omitempty"`
+	Status     string `json:"status"`
+	Progress   string `json:"progress"`
+	ResultUrl  string `json:"result_url,omitempty"`
+	FailReason string `json:"fail_reason,omitempty"`
+	SubmitTime int64  `json:"submit_time"`
+	StartTime  int64  `json:"start_time"`
+	FinishTime int64  `json:"finish_time"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+type taskCallbackRequest struct {
+	CallbackUrl    string `json:"callback_url"`
+	CallbackSecret string `json:"callback_secret"`
+}
+
+// ResolveTaskCallback 解析任务提交时的回调配置：请求体中的 callback_url / callback_secret 优先，其次为令牌上配置的默认回调
+// 请求体中的回调字段会被移除，避免连同密钥一起转发给上游
+func ResolveTaskCallback(c *gin.Context) (string, string, error) {
+	callbackUrl := common.GetContextKeyString(c, constant.ContextKeyTokenTaskCallbackUrl)
+	callbackSecret := common.GetContextKeyString(c, constant.ContextKeyTokenTaskCallbackSecret)
+
+	if strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return "", "", err
+		}
+		var body map[string]json.RawMessage
+		if len(requestBody) > 0 && common.Unmarshal(requestBody, &body) == nil {
+			_, hasUrl := body["callback_url"]
+			_, hasSecret := body["callback_secret"]
+			if hasUrl || hasSecret {
+				request := taskCallbackRequest{}
+				if err := common.Unmarshal(requestBody, &request); err != nil {
+					return "", "", fmt.Errorf("invalid callback_url or callback_secret: %w", err)
+				}
+				if request.CallbackUrl != "" {
+					callbackUrl = request.CallbackUrl
+					if request.CallbackSecret != "" {
+						callbackSecret = request.CallbackSecret
+					}
+				}
+				delete(body, "callback_url")
+				delete(body, "callback_secret")
+				if requestBody, err = common.Marshal(body); err != nil {
+					return "", "", err
+				}
+				c.Set(common.KeyRequestBody, requestBody)
+			}
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	if callbackUrl == "" {
+		return "", "", nil
+	}
+	if err := ValidateTaskCallback(callbackUrl, callbackSecret); err != nil {
+		return "", "", err
+	}
+	return callbackUrl, callbackSecret, nil
+}
+
+// ValidateTaskCallback 校验回调地址与签名密钥，令牌设置与任务提交共用
+func ValidateTaskCallback(callbackUrl string, callbackSecret string) error {
+	if callbackUrl == "" {
+		return nil
+	}
+	if len(callbackUrl) > taskCallbackMaxUrlLength {
+		return errors.New("callback_url is too long")
+	}
+	if !strings.HasPrefix(callbackUrl, "http://") && !strings.HasPrefix(callbackUrl, "https://") {
+		return errors.New("callback_url must be an http or https url")
+	}
+	if callbackSecret == "" {
+		return errors.New("callback_secret is required when callback_url is set")
+	}
+	return ValidateWebhookURL(callbackUrl)
+}
+
+// NotifyTaskStatusChanged 任务状态变化后记录一条回调投递并立即异步发送，失败由重试任务按退避间隔重试
+func NotifyTaskStatusChanged(task *model.Task) {
+	if task == nil || task.PrivateData.CallbackUrl == "" {
+		return
+	}
+	payload := TaskCallbackPayload{
+		Event:      taskCallbackEventPrefix + strings.ToLower(string(task.Status)),
+		TaskId:     task.TaskID,
+		Platform:   string(task.Platform),
+		Action:     task.Action,
+		Model:      task.Properties.OriginModelName,
+		Status:     string(task.Status),
+		Progress:   task.Progress,
+		SubmitTime: task.SubmitTime,
+		StartTime:  task.StartTime,
+		FinishTime: task.FinishTime,
+		Timestamp:  time.Now().Unix(),
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		// 成功的任务沿用 FailReason 字段保存结果地址，已归档时使用归档地址
+		payload.ResultUrl = task.FailReason
+		urls, videoURL := archivedMediaURLs(string(task.Platform), task.TaskID)
+		if archived, ok := archivedTaskResultURL(urls, videoURL, task.FailReason); ok {
+			payload.ResultUrl = archived
+		}
+	case model.TaskStatusFailure:
+		payload.FailReason = task.FailReason
+	}
+	sendTaskCallback(task.UserId, task.PrivateData.CallbackUrl, task.PrivateData.CallbackSecret, payload)
+}
+
+// NotifyMidjourneyTaskStatusChanged 与 NotifyTaskStatusChanged 相同，用于 /mj 接口提交的 Midjourney 任务；
+// Midjourney 任务的时间为毫秒，回调中统一转换为秒
+func NotifyMidjourneyTaskStatusChanged(task *model.Midjourney) {
+	if task == nil || task.CallbackUrl == "" || task.MjId == "" {
+		return
+	}
+	payload := TaskCallbackPayload{
+		Event:      taskCallbackEventPrefix + strings.ToLower(task.Status),
+		TaskId:     task.MjId,
+		Platform:   constant.TaskPlatformMidjourney,
+		Action:     task.Action,
+		Model:      CoverActionToModelName(task.Action),
+		Status:     task.Status,
+		Progress:   task.Progress,
+		SubmitTime: task.SubmitTime / 1000,
+		StartTime:  task.StartTime / 1000,
+		FinishTime: task.FinishTime / 1000,
+		Timestamp:  time.Now().Unix(),
+	}
+	switch task.Status {
+	case "SUCCESS":
+		archived := *task
+		RewriteMidjourneyMediaURLs(&archived)
+		payload.ResultUrl = archived.ImageUrl
+		if payload.ResultUrl == "" {
+			payload.ResultUrl = archived.VideoUrl
+		}
+	case "FAILURE":
+		payload.FailReason = task.FailReason
+	}
+	sendTaskCallback(task.UserId, task.CallbackUrl, task.CallbackSecret, payload)
+}
+
+func sendTaskCallback(userId int, callbackUrl string, secret string, payload TaskCallbackPayload) {
+	payloadBytes, err := common.Marshal(payload)
+	if err != nil {
+		common.SysLog("failed to marshal task callback payload: " + err.Error())
+		return
+	}
+	delivery := &model.TaskCallbackDelivery{
+		UserId:      userId,
+		TaskId:      payload.TaskId,
+		Event:       payload.Event,
+		Url:         callbackUrl,
+		Payload:     string(payloadBytes),
+		NextRetryAt: time.Now().Add(taskCallbackAttemptLease).Unix(),
+	}
+	if err := model.CreateTaskCallbackDelivery(delivery); err != nil {
+		common.SysLog(fmt.Sprintf("failed to create task callback delivery for task %s: %s", payload.TaskId, err.Error()))
+		return
+	}
+	gopool.Go(func() {
+		deliverTaskCallback(delivery, secret)
+	})
+}
+
+// ReplayTaskCallback 重新发送一条投递记录的内容，生成新的投递记录
+func ReplayTaskCallback(userId int, deliveryId int64) (*model.TaskCallbackDelivery, error) {
+	original, err := model.GetUserTaskCallbackDelivery(deliveryId, userId)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &model.TaskCallbackDelivery{
+		UserId:      original.UserId,
+		TaskId:      original.TaskId,
+		Event:       original.Event,
+		Url:         original.Url,
+		Payload:     original.Payload,
+		ReplayOf:    original.Id,
+		NextRetryAt: time.Now().Add(taskCallbackAttemptLease).Unix(),
+	}
+	if err := model.CreateTaskCallbackDelivery(delivery); err != nil {
+		return nil, err
+	}
+	gopool.Go(func() {
+		deliverTaskCallback(delivery, "")
+	})
+	return delivery, nil
+}
+
+// RetryTaskCallbacks 重试到期的回调投递，由后台任务调度器定期调用
+func RetryTaskCallbacks() error {
+	deliveries, err := model.GetDueTaskCallbackDeliveries(time.Now().Unix(), taskCallbackRetryBatch)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		deliverTaskCallback(delivery, "")
+	}
+	return nil
+}
+
+// CleanupTaskCallbackDeliveries 删除超过保留时间的已结束投递记录，由后台任务调度器定期调用
+func CleanupTaskCallbackDeliveries() error {
+	return model.DeleteTaskCallbackDeliveriesBefore(time.Now().Add(-TaskCallbackRetention).Unix())
+}
+
+// taskCallbackSecret 读取任务提交时保存的回调签名密钥，Midjourney 任务保存在 midjourneys 表中
+func taskCallbackSecret(userId int, taskId string) string {
+	task, exist, err := model.GetByTaskId(userId, taskId)
+	if err == nil && exist {
+		return task.PrivateData.CallbackSecret
+	}
+	if mjTask := model.GetByMJId(userId, taskId); mjTask != nil {
+		return mjTask.CallbackSecret
+	}
+	return ""
+}
+
+// deliverTaskCallback 认领并发送一次回调；secret 为空时从任务中读取
+func deliverTaskCallback(delivery *model.TaskCallbackDelivery, secret string) {
+	claimed, err := model.ClaimTaskCallbackDelivery(delivery.Id, delivery.Attempts, time.Now().Add(taskCallbackAttemptLease).Unix())
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to claim task callback delivery %d: %s", delivery.Id, err.Error()))
+		return
+	}
+	if !claimed {
+		return
+	}
+	attempts := delivery.Attempts + 1
+
+	if secret == "" {
+		secret = taskCallbackSecret(delivery.UserId, delivery.TaskId)
+		if secret == "" {
+			finishTaskCallbackAttempt(delivery.Id, attempts, 0, errors.New("task callback secret not found"), false)
+			return
+		}
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers := map[string]string{
+		"X-Webhook-Id":        strconv.FormatInt(delivery.Id, 10),
+		"X-Webhook-Event":     delivery.Event,
+		"X-Webhook-Timestamp": timestamp,
+		"X-Webhook-Signature": SignTaskCallback(secret, timestamp, []byte(delivery.Payload)),
+	}
+	statusCode, err := postWebhookRequest(delivery.Url, headers, []byte(delivery.Payload))
+	finishTaskCallbackAttempt(delivery.Id, attempts, statusCode, err, true)
+}
+
+// SignTaskCallback 回调签名：HMAC-SHA256(secret, timestamp + "." + body) 的十六进制，接收方应同时校验时间戳防止重放
+func SignTaskCallback(secret string, timestamp string, payload []byte) string {
+	signed := make([]byte, 0, len(timestamp)+1+len(payload))
+	signed = append(signed, timestamp...)
+	signed = append(signed, '.')
+	signed = append(signed, payload...)
+	return generateSignature(secret, signed)
+}
+
+func finishTaskCallbackAttempt(id int64, attempts int, statusCode int, err error, retryable bool) {
+	status := model.TaskCallbackStatusSuccess
+	lastError := ""
+	var nextRetryAt int64
+	if err != nil {
+		lastError = err.Error()
+		if retryable && attempts < taskCallbackMaxAttempts {
+			status = model.TaskCallbackStatusPending
+			nextRetryAt = time.Now().Add(taskCallbackRetryBase << (attempts - 1)).Unix()
+		} else {
+			status = model.TaskCallbackStatusFailed
+		}
+	}
+	if saveErr := model.FinishTaskCallbackAttempt(id, status, statusCode, lastError, nextRetryAt); saveErr != nil {
+		common.SysLog(fmt.Sprintf("failed to save task callback delivery %d: %s", id, saveErr.Error()))
+	}
+}
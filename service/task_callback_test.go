@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTaskCallbackDeliveryAndRetry(t *testing.T) {
+	fetchSetting := system_setting.GetFetchSetting()
+	originalDB, originalClient, originalSSRF := model.DB, httpClient, fetchSetting.EnableSSRFProtection
+	t.Cleanup(func() {
+		model.DB = originalDB
+		httpClient = originalClient
+		fetchSetting.EnableSSRFProtection = originalSSRF
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:task-callback-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Task{}, &model.TaskCallbackDelivery{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	httpClient = http.DefaultClient
+	fetchSetting.EnableSSRFProtection = false
+
+	type received struct {
+		body      []byte
+		timestamp string
+		signature string
+	}
+	requests := make(chan received, 4)
+	var statusCode atomic.Int32
+	statusCode.Store(http.StatusInternalServerError)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{body: body, timestamp: r.Header.Get("X-Webhook-Timestamp"), signature: r.Header.Get("X-Webhook-Signature")}
+		w.WriteHeader(int(statusCode.Load()))
+	}))
+	defer server.Close()
+
+	task := &model.Task{TaskID: "task_1", UserId: 1, Status: model.TaskStatusSuccess, FailReason: "https://cdn.example.com/video.mp4"}
+	task.PrivateData.CallbackUrl = server.URL
+	task.PrivateData.CallbackSecret = "secret"
+	if err := db.Create(task).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	waitDelivery := func() received {
+		t.Helper()
+		select {
+		case r := <-requests:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback was not delivered")
+		}
+		return received{}
+	}
+	waitStatus := func(id int64, attempts int) *model.TaskCallbackDelivery {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			delivery := &model.TaskCallbackDelivery{}
+			if err := db.First(delivery, id).Error; err == nil && delivery.Attempts == attempts && (delivery.LastStatusCode != 0 || delivery.Status != model.TaskCallbackStatusPending) {
+				return delivery
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("delivery %d did not finish attempt %d", id, attempts)
+		return nil
+	}
+
+	// 首次投递失败后等待重试
+	NotifyTaskStatusChanged(task)
+	first := waitDelivery()
+	if first.signature != SignTaskCallback("secret", first.timestamp, first.body) {
+		t.Fatal("callback signature mismatch")
+	}
+	var payload TaskCallbackPayload
+	if err := common.Unmarshal(first.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "task.success" || payload.TaskId != "task_1" || payload.ResultUrl != "https://cdn.example.com/video.mp4" {
+		t.Fatalf("unexpected callback payload: %+v", payload)
+	}
+	var delivery model.TaskCallbackDelivery
+	if err := db.Where("task_id = ?", "task_1").First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	failed := waitStatus(delivery.Id, 1)
+	if failed.Status != model.TaskCallbackStatusPending || failed.LastStatusCode != http.StatusInternalServerError || failed.NextRetryAt <= time.Now().Unix() {
+		t.Fatalf("unexpected delivery after failed attempt: %+v", failed)
+	}
+
+	// 重试任务从任务中读取密钥并重新发送
+	statusCode.Store(http.StatusOK)
+	if err := db.Model(&model.TaskCallbackDelivery{}).Where("id = ?", delivery.Id).Update("next_retry_at", time.Now().Unix()-1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := RetryTaskCallbacks(); err != nil {
+		t.Fatal(err)
+	}
+	retried := waitDelivery()
+	if retried.signature != SignTaskCallback("secret", retried.timestamp, retried.body) {
+		t.Fatal("retried callback signature mismatch")
+	}
+	// 重试任务同步发送，返回时结果已写入
+	succeeded := &model.TaskCallbackDelivery{}
+	if err := db.First(succeeded, delivery.Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if succeeded.Status != model.TaskCallbackStatusSuccess || succeeded.Attempts != 2 {
+		t.Fatalf("unexpected delivery after retry: %+v", succeeded)
+	}
+
+	// 重放生成新的投递记录
+	replay, err := ReplayTaskCallback(1, delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitDelivery()
+	if replayed := waitStatus(replay.Id, 1); replayed.Status != model.TaskCallbackStatusSuccess || replayed.ReplayOf != delivery.Id {
+		t.Fatalf("unexpected replayed delivery: %+v", replayed)
+	}
+	if _, err := ReplayTaskCallback(2, delivery.Id); err == nil {
+		t.Fatal("replaying another user's delivery should fail")
+	}
+}
+
+func TestResolveTaskCallbackStripsRequestFields(t *testing.T) {
+	fetchSetting := system_setting.GetFetchSetting()
+	originalSSRF := fetchSetting.EnableSSRFProtection
+	t.Cleanup(func() { fetchSetting.EnableSSRFProtection = originalSSRF })
+	fetchSetting.EnableSSRFProtection = false
+
+	body := `{"model":"veo","prompt":"cat","seed":12345678901234567890,"callback_url":"https://hooks.example.com/task","callback_secret":"s1"}`
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/video/generations", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	callbackUrl, callbackSecret, err := ResolveTaskCallback(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callbackUrl != "https://hooks.example.com/task" || callbackSecret != "s1" {
+		t.Fatalf("unexpected callback: %s %s", callbackUrl, callbackSecret)
+	}
+	forwarded, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(forwarded, []byte("callback")) || !bytes.Contains(forwarded, []byte("12345678901234567890")) {
+		t.Fatalf("unexpected forwarded body: %s", forwarded)
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/video/generations", bytes.NewBufferString(`{"callback_url":"https://hooks.example.com/task"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if _, _, err := ResolveTaskCallback(c); err == nil {
+		t.Fatal("callback_url without secret should be rejected")
+	}
+}
+
+func TestMidjourneyTaskCallbackUsesStoredSecret(t *testing.T) {
+	fetchSetting := system_setting.GetFetchSetting()
+	originalDB, originalClient, originalSSRF := model.DB, httpClient, fetchSetting.EnableSSRFProtection
+	t.Cleanup(func() {
+		model.DB = originalDB
+		httpClient = originalClient
+		fetchSetting.EnableSSRFProtection = originalSSRF
+	})
+
+	db, err := gorm.Open(sqlite.Open("file:mj-task-callback-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.Task{}, &model.Midjourney{}, &model.TaskCallbackDelivery{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB = db
+	httpClient = http.DefaultClient
+	fetchSetting.EnableSSRFProtection = false
+
+	type received struct {
+		body      []byte
+		timestamp string
+		signature string
+	}
+	requests := make(chan received, 2)
+	var statusCode atomic.Int32
+	statusCode.Store(http.StatusInternalServerError)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{body: body, timestamp: r.Header.Get("X-Webhook-Timestamp"), signature: r.Header.Get("X-Webhook-Signature")}
+		w.WriteHeader(int(statusCode.Load()))
+	}))
+	defer server.Close()
+	waitDelivery := func() received {
+		t.Helper()
+		select {
+		case r := <-requests:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback was not delivered")
+		}
+		return received{}
+	}
+
+	task := &model.Midjourney{
+		UserId:         1,
+		MjId:           "1720000000000001",
+		Action:         "IMAGINE",
+		Status:         "SUCCESS",
+		Progress:       "100%",
+		SubmitTime:     1720000000000,
+		FinishTime:     1720000060000,
+		ImageUrl:       "https://cdn.example.com/image.png",
+		CallbackUrl:    server.URL,
+		CallbackSecret: "mj-secret",
+	}
+	if err := task.Insert(); err != nil {
+		t.Fatal(err)
+	}
+
+	NotifyMidjourneyTaskStatusChanged(task)
+	first := waitDelivery()
+	var payload TaskCallbackPayload
+	if err := common.Unmarshal(first.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "task.success" || payload.TaskId != task.MjId || payload.Platform != "mj" ||
+		payload.ResultUrl != task.ImageUrl || payload.SubmitTime != 1720000000 || payload.FinishTime != 1720000060 {
+		t.Fatalf("unexpected callback payload: %+v", payload)
+	}
+
+	// 重试时从 midjourneys 表读取签名密钥
+	var delivery model.TaskCallbackDelivery
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := db.Where("task_id = ?", task.MjId).First(&delivery).Error; err == nil && delivery.Attempts == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first delivery attempt was not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	statusCode.Store(http.StatusOK)
+	if err := db.Model(&model.TaskCallbackDelivery{}).Where("id = ?", delivery.Id).Update("next_retry_at", time.Now().Unix()-1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := RetryTaskCallbacks(); err != nil {
+		t.Fatal(err)
+	}
+	retried := waitDelivery()
+	if retried.signature != SignTaskCallback("mj-secret", retried.timestamp, retried.body) {
+		t.Fatal("retried callback signature mismatch")
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// RefundFailedTask 任务失败或超时后按平台退款策略退还预扣额度，同一任务只会退还一次，返回退还的额度
+func RefundFailedTask(ctx context.Context, task *model.Task, reason string) int {
+	return settleTaskRefund(ctx, task, reason, 0, 0)
+}
+
+// RefundPartialTask 多输出任务成功但部分输出失败时，partial 策略下按失败输出的比例退还，全部输出失败时全额退还
+func RefundPartialTask(ctx context.Context, task *model.Task, totalOutputs int, failedOutputs int) int {
+	if totalOutputs <= 0 || failedOutputs <= 0 {
+		return 0
+	}
+	return settleTaskRefund(ctx, task, model.TaskRefundReasonPartial, totalOutputs, min(failedOutputs, totalOutputs))
+}
+
+// SunoOutputCounts 统计 Suno 任务结果中的歌曲数与生成失败的歌曲数
+func SunoOutputCounts(data []byte) (total int, failed int) {
+	var songs []dto.SunoSong
+	if err := common.Unmarshal(data, &songs); err != nil {
+		return 0, 0
+	}
+	for _, song := range songs {
+		if song.Status == "error" {
+			failed++
+		}
+	}
+	return len(songs), failed
+}
+
+func settleTaskRefund(ctx context.Context, task *model.Task, reason string, totalOutputs int, failedOutputs int) int {
+	policy := operation_setting.GetTaskRefundSetting().GetPolicy(string(task.Platform))
+	quota := taskRefundQuota(policy, reason, task.Quota, totalOutputs, failedOutputs)
+	if quota <= 0 {
+		return 0
+	}
+	refund := &model.TaskRefund{
+		TaskRecordId:  task.ID,
+		TaskId:        task.TaskID,
+		Platform:      string(task.Platform),
+		UserId:        task.UserId,
+		ChannelId:     task.ChannelId,
+		Reason:        reason,
+		Policy:        policy,
+		ChargedQuota:  task.Quota,
+		Quota:         quota,
+		TotalOutputs:  totalOutputs,
+		FailedOutputs: failedOutputs,
+	}
+	refunded, err := model.RefundTaskQuota(refund)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to refund task %s: %s", task.TaskID, err.Error()))
+		return 0
+	}
+	if !refunded {
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s already refunded, skip refund", task.TaskID))
+		return 0
+	}
+	model.RecordTaskRefundLog(refund, task.Group, task.Properties.OriginModelName, taskRefundLogContent(refund))
+	return quota
+}
+
+// taskRefundQuota 按退款策略计算应退还的额度
+func taskRefundQuota(policy string, reason string, chargedQuota int, totalOutputs int, failedOutputs int) int {
+	if chargedQuota <= 0 || policy == operation_setting.TaskRefundPolicyNone {
+		return 0
+	}
+	if reason != model.TaskRefundReasonPartial || failedOutputs >= totalOutputs {
+		return chargedQuota
+	}
+	if policy != operation_setting.TaskRefundPolicyPartial {
+		return 0
+	}
+	return chargedQuota * failedOutputs / totalOutputs
+}
+
+func taskRefundLogContent(refund *model.TaskRefund) string {
+	switch refund.Reason {
+	case model.TaskRefundReasonTimeout:
+		return fmt.Sprintf("异步任务超时 %s，补偿 %s", refund.TaskId, logger.LogQuota(int64(refund.Quota)))
+	case model.TaskRefundReasonPartial:
+		return fmt.Sprintf("异步任务 %s 部分输出失败（%d/%d），补偿 %s", refund.TaskId, refund.FailedOutputs, refund.TotalOutputs, logger.LogQuota(int64(refund.Quota)))
+	default:
+		return fmt.Sprintf("异步任务执行失败 %s，补偿 %s", refund.TaskId, logger.LogQuota(int64(refund.Quota)))
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTaskRefundSettlement(t *testing.T) {
+	setting := operation_setting.GetTaskRefundSetting()
+	originalSetting, originalDB, originalLogDB := *setting, model.DB, model.LOG_DB
+	t.Cleanup(func() {
+		*setting = originalSetting
+		model.DB = originalDB
+		model.LOG_DB = originalLogDB
+	})
+	db, err := gorm.Open(sqlite.Open("file:task-settlement-test?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.TaskRefund{}, &model.QuotaLedger{}, &model.Log{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+	model.DB, model.LOG_DB = db, db
+	setting.DefaultPolicy = operation_setting.TaskRefundPolicyPartial
+	setting.PlatformPolicies = map[string]string{"none": operation_setting.TaskRefundPolicyNone, "full": operation_setting.TaskRefundPolicyFull}
+
+	user := &model.User{Id: 1, Username: "refund", Quota: 100}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	failed := &model.Task{ID: 1, TaskID: "task_failed", Platform: "suno", UserId: 1, Quota: 40}
+	if quota := RefundFailedTask(ctx, failed, model.TaskRefundReasonFailed); quota != 40 {
+		t.Fatalf("expected full refund, got %d", quota)
+	}
+	// 同一任务重复结算不会再次退款
+	if quota := RefundFailedTask(ctx, failed, model.TaskRefundReasonTimeout); quota != 0 {
+		t.Fatalf("task should only be refunded once, got %d", quota)
+	}
+
+	partial := &model.Task{ID: 2, TaskID: "task_partial", Platform: "suno", UserId: 1, Quota: 30}
+	if quota := RefundPartialTask(ctx, partial, 3, 1); quota != 10 {
+		t.Fatalf("expected proportional refund, got %d", quota)
+	}
+	fullPolicy := &model.Task{ID: 3, TaskID: "task_full", Platform: "full", UserId: 1, Quota: 30}
+	if quota := RefundPartialTask(ctx, fullPolicy, 3, 1); quota != 0 {
+		t.Fatalf("full policy should not refund partial outputs, got %d", quota)
+	}
+	if quota := RefundPartialTask(ctx, fullPolicy, 2, 2); quota != 30 {
+		t.Fatalf("all outputs failed should refund in full, got %d", quota)
+	}
+	nonePolicy := &model.Task{ID: 4, TaskID: "task_none", Platform: "none", UserId: 1, Quota: 30}
+	if quota := RefundFailedTask(ctx, nonePolicy, model.TaskRefundReasonFailed); quota != 0 {
+		t.Fatalf("none policy should not refund, got %d", quota)
+	}
+
+	if err := db.First(user, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Quota != 180 {
+		t.Fatalf("expected quota 180 after refunds, got %d", user.Quota)
+	}
+	var ledgers int64
+	db.Model(&model.QuotaLedger{}).Where("type = ?", model.QuotaLedgerTypeRefund).Count(&ledgers)
+	refunds, total, err := model.GetUserTaskRefunds(1, "", 0, 10)
+	if err != nil || total != 3 || ledgers != 3 {
+		t.Fatalf("expected 3 refunds and ledgers, got %d refunds, %d ledgers, %v", total, ledgers, err)
+	}
+	if refunds[0].TaskId != "task_full" || refunds[0].Reason != model.TaskRefundReasonPartial || refunds[0].Policy != operation_setting.TaskRefundPolicyFull {
+		t.Fatalf("unexpected refund record: %+v", refunds[0])
+	}
+	var logs []*model.Log
+	db.Where("type = ?", model.LogTypeRefund).Order("id asc").Find(&logs)
+	if len(logs) != 3 || logs[0].Quota != 40 || !strings.Contains(logs[0].Other, `"task_id":"task_failed"`) {
+		t.Fatalf("unexpected refund logs: %+v", logs)
+	}
+}
+
+func TestSunoOutputCounts(t *testing.T) {
+	total, failed := SunoOutputCounts([]byte(`[{"id":"a","status":"complete"},{"id":"b","status":"error"}]`))
+	if total != 2 || failed != 1 {
+		t.Fatalf("unexpected counts: %d/%d", failed, total)
+	}
+	if total, failed := SunoOutputCounts([]byte(`"lyrics"`)); total != 0 || failed != 0 {
+		t.Fatalf("non song data should have no outputs: %d/%d", failed, total)
+	}
+}
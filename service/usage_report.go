@@ -0,0 +1,291 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	UsageReportCheckInterval = 10 * time.Minute
+	usageReportPeriodLayout  = "2006-01"
+	usageReportWebhookType   = "usage_report"
+)
+
+var (
+	usageReportRunLock sync.Mutex
+
+	errUsageReportAttachmentTooLarge = errors.New("usage report attachment too large")
+)
+
+// UsageReportModelItem 报告中单个模型的用量汇总
+type UsageReportModelItem struct {
+	ModelName string `json:"model_name"`
+	Count     int    `json:"count"`
+	TokenUsed int    `json:"token_used"`
+	Quota     int    `json:"quota"`
+}
+
+// UsageReport 单个用户的月度用量报告
+type UsageReport struct {
+	UserId      int                    `json:"user_id"`
+	Username    string                 `json:"username"`
+	Period      string                 `json:"period"`
+	StartTime   int64                  `json:"start_time"`
+	EndTime     int64                  `json:"end_time"`
+	TotalCount  int                    `json:"total_count"`
+	TotalTokens int                    `json:"total_tokens"`
+	TotalQuota  int                    `json:"total_quota"`
+	Models      []UsageReportModelItem `json:"models"`
+}
+
+type usageReportAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"` // base64
+}
+
+type usageReportWebhookPayload struct {
+	Type       string                 `json:"type"`
+	Report     *UsageReport           `json:"report"`
+	Attachment *usageReportAttachment `json:"attachment,omitempty"`
+	Timestamp  int64                  `json:"timestamp"`
+}
+
+// limitedBuffer 超过上限时拒绝写入，避免超大附件占用内存
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		return 0, errUsageReportAttachmentTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// RunUsageReportCheck 检查上月报告是否到期，到期且尚未生成时生成并投递，由后台任务调度器定期调用
+func RunUsageReportCheck() error {
+	return checkUsageReportDue(time.Now())
+}
+
+func checkUsageReportDue(now time.Time) error {
+	setting := operation_setting.GetUsageReportSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	day := setting.DayOfMonth
+	if day < 1 || day > 28 {
+		day = 1
+	}
+	dueAt := time.Date(now.Year(), now.Month(), day, setting.Hour, 0, 0, 0, now.Location())
+	if now.Before(dueAt) {
+		return nil
+	}
+	period := now.AddDate(0, 0, -now.Day()).Format(usageReportPeriodLayout)
+	if setting.LastReportPeriod == period {
+		return nil
+	}
+	if err := RunMonthlyUsageReports(period); err != nil {
+		return fmt.Errorf("failed to run usage reports for %s: %w", period, err)
+	}
+	return nil
+}
+
+// UsageReportPeriodRange 返回月份（YYYY-MM）对应的起止时间戳（闭区间）
+func UsageReportPeriodRange(period string) (int64, int64, error) {
+	start, err := time.ParseInLocation(usageReportPeriodLayout, period, time.Local)
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的报告月份 %s，格式应为 YYYY-MM", period)
+	}
+	end := start.AddDate(0, 1, 0)
+	return start.Unix(), end.Unix() - 1, nil
+}
+
+// RunMonthlyUsageReports 生成并投递指定月份的用户用量报告，完成后记录已生成月份
+func RunMonthlyUsageReports(period string) error {
+	if !usageReportRunLock.TryLock() {
+		return errors.New("用量报告正在生成中")
+	}
+	defer usageReportRunLock.Unlock()
+
+	startTime, endTime, err := UsageReportPeriodRange(period)
+	if err != nil {
+		return err
+	}
+	setting := operation_setting.GetUsageReportSetting()
+	userIds, err := model.GetQuotaDataUserIds(startTime, endTime)
+	if err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("generating usage reports for %s, %d users", period, len(userIds)))
+
+	delivered := 0
+	for _, userId := range userIds {
+		ok, err := deliverUserUsageReport(setting, userId, period, startTime, endTime)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to deliver usage report for user %d: %s", userId, err.Error()))
+			continue
+		}
+		if ok {
+			delivered++
+		}
+	}
+	common.SysLog(fmt.Sprintf("usage reports for %s delivered to %d users", period, delivered))
+	return model.UpdateOption("usage_report_setting.last_report_period", period)
+}
+
+// BuildUserUsageReport 基于数据看板数据汇总用户在时间范围内的用量
+func BuildUserUsageReport(userId int, period string, startTime int64, endTime int64) (*UsageReport, error) {
+	quotaData, err := model.GetQuotaDataByUserId(userId, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	report := &UsageReport{
+		UserId:    userId,
+		Period:    period,
+		StartTime: startTime,
+		EndTime:   endTime,
+	}
+	models := make(map[string]*UsageReportModelItem)
+	for _, data := range quotaData {
+		if report.Username == "" {
+			report.Username = data.Username
+		}
+		item, ok := models[data.ModelName]
+		if !ok {
+			item = &UsageReportModelItem{ModelName: data.ModelName}
+			models[data.ModelName] = item
+		}
+		item.Count += data.Count
+		item.TokenUsed += data.TokenUsed
+		item.Quota += data.Quota
+		report.TotalCount += data.Count
+		report.TotalTokens += data.TokenUsed
+		report.TotalQuota += data.Quota
+	}
+	for _, item := range models {
+		report.Models = append(report.Models, *item)
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].Quota > report.Models[j].Quota
+	})
+	return report, nil
+}
+
+func buildUsageReportAttachment(setting *operation_setting.UsageReportSetting, report *UsageReport) (*common.EmailAttachment, error) {
+	format, err := ParseLogExportFormat(setting.AttachmentFormat)
+	if err != nil {
+		return nil, err
+	}
+	buf := &limitedBuffer{limit: setting.MaxAttachmentMB * 1024 * 1024}
+	err = ExportLogs(buf, format, model.LogExportFilter{
+		UserId:         report.UserId,
+		LogType:        model.LogTypeConsume,
+		StartTimestamp: report.StartTime,
+		EndTimestamp:   report.EndTime,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &common.EmailAttachment{
+		Name:        fmt.Sprintf("usage-%s-%d.%s", report.Period, report.UserId, format),
+		ContentType: format.ContentType(),
+		Content:     buf.Bytes(),
+	}, nil
+}
+
+func renderUsageReportContent(report *UsageReport, attachmentOmitted bool) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("以下是您 %s 的用量报告：\n\n", report.Period))
+	b.WriteString(fmt.Sprintf("- 请求次数：%d\n- Token 用量：%d\n- 消耗额度：%s\n\n", report.TotalCount, report.TotalTokens, logger.FormatQuota(report.TotalQuota)))
+	b.WriteString("| 模型 | 请求次数 | Token 用量 | 消耗额度 |\n| --- | --- | --- | --- |\n")
+	for _, item := range report.Models {
+		b.WriteString(fmt.Sprintf("| %s | %d | %d | %s |\n", item.ModelName, item.Count, item.TokenUsed, logger.FormatQuota(item.Quota)))
+	}
+	if attachmentOmitted {
+		b.WriteString("\n明细日志超过附件大小上限，请登录控制台导出。")
+	} else {
+		b.WriteString("\n消费明细见附件。")
+	}
+	return b.String()
+}
+
+func deliverUserUsageReport(setting *operation_setting.UsageReportSetting, userId int, period string, startTime int64, endTime int64) (bool, error) {
+	report, err := BuildUserUsageReport(userId, period, startTime, endTime)
+	if err != nil {
+		return false, err
+	}
+	if report.TotalCount == 0 {
+		return false, nil
+	}
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		return false, err
+	}
+	report.Username = user.Username
+	userSetting := user.GetSetting()
+	sendEmail := setting.EmailEnabled && userSetting.UsageReportEnabled
+	if !sendEmail && setting.WebhookUrl == "" {
+		return false, nil
+	}
+
+	attachment, err := buildUsageReportAttachment(setting, report)
+	if err != nil && !errors.Is(err, errUsageReportAttachmentTooLarge) {
+		return false, err
+	}
+
+	if sendEmail {
+		email := strings.TrimSpace(userSetting.NotificationEmail)
+		if email == "" {
+			email = user.Email
+		}
+		var attachments []common.EmailAttachment
+		if attachment != nil {
+			attachments = append(attachments, *attachment)
+		}
+		subject := fmt.Sprintf("%s 用量报告", period)
+		err = common.SendEmailWithAttachments(subject, email, renderUsageReportContent(report, attachment == nil), attachments, common.EmailRecipientContext{
+			Username: user.Username,
+			CAHID:    user.CAHID,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if setting.WebhookUrl != "" {
+		payload := usageReportWebhookPayload{
+			Type:      usageReportWebhookType,
+			Report:    report,
+			Timestamp: time.Now().Unix(),
+		}
+		if attachment != nil {
+			payload.Attachment = &usageReportAttachment{
+				Name:        attachment.Name,
+				ContentType: attachment.ContentType,
+				Content:     base64.StdEncoding.EncodeToString(attachment.Content),
+			}
+		}
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return false, fmt.Errorf("failed to marshal usage report payload: %v", err)
+		}
+		if err = postWebhookPayload(setting.WebhookUrl, setting.WebhookSecret, payloadBytes); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package model_setting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ModelFallbackWildcardGroup 在 Chains 中表示对所有分组生效的回退链
+const ModelFallbackWildcardGroup = "*"
+
+// ModelFallbackSettings 定义模型回退链配置：某模型的所有渠道重试耗尽后，按顺序尝试回退模型
+type ModelFallbackSettings struct {
+	Enabled bool `json:"enabled"`
+	// Chains 模型 -> 分组 -> 有序的回退模型列表，分组可使用 "*" 作为通配
+	Chains map[string]map[string][]string `json:"chains"`
+}
+
+// 默认配置
+var defaultModelFallbackSettings = ModelFallbackSettings{
+	Enabled: false,
+	Chains:  map[string]map[string][]string{},
+}
+
+// 全局实例
+var modelFallbackSettings = defaultModelFallbackSettings
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback", &modelFallbackSettings)
+}
+
+func GetModelFallbackSettings() *ModelFallbackSettings {
+	return &modelFallbackSettings
+}
+
+// GetModelFallbackChain 返回模型在指定分组下的回退链，分组未单独配置时使用通配分组
+func GetModelFallbackChain(modelName string, group string) []string {
+	if !modelFallbackSettings.Enabled {
+		return nil
+	}
+	groups, ok := modelFallbackSettings.Chains[strings.TrimSpace(modelName)]
+	if !ok {
+		return nil
+	}
+	if chain, ok := groups[group]; ok && group != "" {
+		return chain
+	}
+	return groups[ModelFallbackWildcardGroup]
+}
+
+// CheckModelFallbackChains 校验回退链配置 JSON：模型、分组与回退模型名均不能为空，且回退链不能包含模型自身
+func CheckModelFallbackChains(jsonStr string) error {
+	if strings.TrimSpace(jsonStr) == "" {
+		return nil
+	}
+	chains := make(map[string]map[string][]string)
+	if err := json.Unmarshal([]byte(jsonStr), &chains); err != nil {
+		return fmt.Errorf("模型回退链格式错误: %w", err)
+	}
+	for modelName, groups := range chains {
+		if strings.TrimSpace(modelName) == "" {
+			return errors.New("模型回退链中的模型名称不能为空")
+		}
+		for group, chain := range groups {
+			if strings.TrimSpace(group) == "" {
+				return fmt.Errorf("模型 %s 的回退链分组名称不能为空", modelName)
+			}
+			for _, fallback := range chain {
+				fallback = strings.TrimSpace(fallback)
+				if fallback == "" {
+					return fmt.Errorf("模型 %s 分组 %s 的回退链中存在空模型名称", modelName, group)
+				}
+				if fallback == modelName {
+					return fmt.Errorf("模型 %s 的回退链不能包含自身", modelName)
+				}
+			}
+		}
+	}
+	return nil
+}
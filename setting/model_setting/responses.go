@@ -0,0 +1,29 @@
+package model_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponsesSettings Responses API 的会话状态设置
+type ResponsesSettings struct {
+	// 携带 previous_response_id 的请求优先路由到生成该 response 的渠道
+	ChannelPinningEnabled bool `json:"channel_pinning_enabled"`
+	// 本地保存 response 的输入与输出，使 previous_response_id 在跨渠道（含非 OpenAI 渠道）时仍可用
+	LocalStoreEnabled bool `json:"local_store_enabled"`
+	// response 记录保留天数，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var responsesSettings = ResponsesSettings{
+	ChannelPinningEnabled: true,
+	LocalStoreEnabled:     false,
+	RetentionDays:         30,
+}
+
+func init() {
+	config.GlobalConfig.Register("responses", &responsesSettings)
+}
+
+func GetResponsesSettings() *ResponsesSettings {
+	return &responsesSettings
+}
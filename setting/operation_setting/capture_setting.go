@@ -0,0 +1,116 @@
+package operation_setting
+
+import (
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	CaptureSinkTypeLangfuse = "langfuse"
+	CaptureSinkTypeJSONL    = "jsonl"
+	CaptureSinkTypeS3       = "s3"
+	CaptureSinkTypeKafka    = "kafka"
+	CaptureSinkTypeOTLP     = "otlp"
+)
+
+// CaptureSinkConfig 训练数据采集的一个写入目标
+type CaptureSinkConfig struct {
+	// Name 唯一名称，分组通过名称选择写入目标
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	// Dir / MaxFileSizeMB jsonl：写入目录，按天切分文件，超过大小后切分到下一个文件
+	Dir           string `json:"dir,omitempty"`
+	MaxFileSizeMB int    `json:"max_file_size_mb,omitempty"`
+	// Prefix s3：对象键前缀，使用系统对象存储配置，每批记录写入一个对象
+	Prefix string `json:"prefix,omitempty"`
+	// Endpoint kafka：Kafka REST Proxy 地址；otlp：OTLP/HTTP 日志接收地址
+	Endpoint string `json:"endpoint,omitempty"`
+	// Topic kafka：写入的主题
+	Topic string `json:"topic,omitempty"`
+	// Headers kafka / otlp：附加的请求头，如鉴权
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// CaptureRedactRule 自定义脱敏规则，Pattern 为正则表达式
+type CaptureRedactRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// CaptureSetting 训练数据采集配置：按分组采集率抽样的请求与响应经脱敏后写入各目标，
+// 每个目标有独立的有界队列，队列满时丢弃记录，写入慢的目标不会阻塞中继请求
+type CaptureSetting struct {
+	Sinks []CaptureSinkConfig `json:"sinks"`
+	// DefaultSinks 未单独配置的分组写入的目标名称
+	DefaultSinks []string `json:"default_sinks"`
+	// GroupSinks 按分组覆盖写入目标，空列表表示该分组不写入
+	GroupSinks map[string][]string `json:"group_sinks"`
+	// QueueSize 每个目标的队列长度
+	QueueSize int `json:"queue_size"`
+	// BatchSize / FlushIntervalSeconds 攒够一批或到达间隔后写入
+	BatchSize            int `json:"batch_size"`
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+	// WriteTimeoutSeconds 单批写入的超时时间
+	WriteTimeoutSeconds int `json:"write_timeout_seconds"`
+	// RedactEnabled 写入前脱敏，BuiltinRedactRules 可选 email、phone、id_card、bank_card、api_key、ip
+	RedactEnabled      bool                `json:"redact_enabled"`
+	BuiltinRedactRules []string            `json:"builtin_redact_rules"`
+	RedactRules        []CaptureRedactRule `json:"redact_rules"`
+}
+
+// 默认配置
+var captureSetting = CaptureSetting{
+	Sinks: []CaptureSinkConfig{
+		{Name: "langfuse", Type: CaptureSinkTypeLangfuse, Enabled: true},
+	},
+	DefaultSinks:         []string{"langfuse"},
+	GroupSinks:           map[string][]string{},
+	QueueSize:            1000,
+	BatchSize:            50,
+	FlushIntervalSeconds: 5,
+	WriteTimeoutSeconds:  10,
+	RedactEnabled:        true,
+	BuiltinRedactRules:   []string{"email", "phone", "id_card", "bank_card", "api_key"},
+	RedactRules:          []CaptureRedactRule{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("capture_setting", &captureSetting)
+}
+
+// captureSettingVersion 采集配置版本，写入目标按版本缓存，版本变化后才重新比对配置
+var captureSettingVersion atomic.Int64
+
+func GetCaptureSetting() *CaptureSetting {
+	return &captureSetting
+}
+
+// CaptureSettingUpdated 采集配置修改后调用，写入目标在下次采集时按新配置刷新
+func CaptureSettingUpdated() {
+	captureSettingVersion.Add(1)
+}
+
+func GetCaptureSettingVersion() int64 {
+	return captureSettingVersion.Load()
+}
+
+// GetGroupSinks 返回分组写入的目标名称，未单独配置的分组使用默认目标
+func (s *CaptureSetting) GetGroupSinks(group string) []string {
+	if sinks, ok := s.GroupSinks[group]; ok {
+		return sinks
+	}
+	return s.DefaultSinks
+}
+
+func (s *CaptureSetting) GetSink(name string) (CaptureSinkConfig, bool) {
+	for _, sink := range s.Sinks {
+		if sink.Name == name {
+			return sink, true
+		}
+	}
+	return CaptureSinkConfig{}, false
+}
@@ -0,0 +1,40 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// LogArchiveSetting 日志归档配置：定期将超过保留天数的日志压缩写入对象存储并从数据库删除
+type LogArchiveSetting struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays 数据库中保留的天数，更早的日志会被归档
+	RetentionDays int `json:"retention_days"`
+	// IntervalMinutes 归档任务执行间隔
+	IntervalMinutes int `json:"interval_minutes"`
+	// BatchSize 每批归档的日志条数
+	BatchSize int `json:"batch_size"`
+	// MaxBatchesPerRun 单次任务最多归档的批数，避免长时间占用数据库
+	MaxBatchesPerRun int `json:"max_batches_per_run"`
+	// Prefix 归档对象键前缀
+	Prefix string `json:"prefix"`
+	// MaxQueryArchives 单次日志查询最多扫描的归档文件数
+	MaxQueryArchives int `json:"max_query_archives"`
+}
+
+// 默认配置
+var logArchiveSetting = LogArchiveSetting{
+	Enabled:          false,
+	RetentionDays:    30,
+	IntervalMinutes:  60,
+	BatchSize:        50000,
+	MaxBatchesPerRun: 20,
+	Prefix:           "logs",
+	MaxQueryArchives: 62,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_archive_setting", &logArchiveSetting)
+}
+
+func GetLogArchiveSetting() *LogArchiveSetting {
+	return &logArchiveSetting
+}
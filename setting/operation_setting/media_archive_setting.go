@@ -0,0 +1,59 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	MediaArchiveBackendS3    = "s3"
+	MediaArchiveBackendLocal = "local"
+)
+
+// MediaArchiveSetting 生成结果归档配置：任务成功后将上游返回的视频、图片、音频保存到对象存储或本地磁盘，
+// 通过带签名的网关地址对外提供，避免上游地址过期
+type MediaArchiveSetting struct {
+	Enabled bool `json:"enabled"`
+	// Backend 存储后端，s3 使用对象存储配置，local 写入 LocalDir
+	Backend  string `json:"backend"`
+	LocalDir string `json:"local_dir"`
+	// Prefix 对象键前缀
+	Prefix string `json:"prefix"`
+	// MaxFileSizeMB 单个文件大小上限，超过时不归档
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// RetentionDays 默认保留天数
+	RetentionDays int `json:"retention_days"`
+	// GroupRetentionDays 按分组覆盖保留天数，0 表示该分组不归档
+	GroupRetentionDays map[string]int `json:"group_retention_days"`
+	// SignedUrlTTLMinutes 网关签名地址与对象存储预签名地址的有效期
+	SignedUrlTTLMinutes int `json:"signed_url_ttl_minutes"`
+	// QuotaPerGBDay 每 GB 每天的存储费用，按文件大小每天扣除一次，归档时扣除第一天，0 表示不计费
+	QuotaPerGBDay int `json:"quota_per_gb_day"`
+}
+
+// 默认配置
+var mediaArchiveSetting = MediaArchiveSetting{
+	Enabled:             false,
+	Backend:             MediaArchiveBackendS3,
+	LocalDir:            "./data/media",
+	Prefix:              "media",
+	MaxFileSizeMB:       512,
+	RetentionDays:       7,
+	GroupRetentionDays:  map[string]int{},
+	SignedUrlTTLMinutes: 1440,
+	QuotaPerGBDay:       0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("media_archive_setting", &mediaArchiveSetting)
+}
+
+func GetMediaArchiveSetting() *MediaArchiveSetting {
+	return &mediaArchiveSetting
+}
+
+// GetRetentionDays 返回分组的保留天数，未单独配置的分组使用默认值
+func (s *MediaArchiveSetting) GetRetentionDays(group string) int {
+	if days, ok := s.GroupRetentionDays[group]; ok {
+		return days
+	}
+	return s.RetentionDays
+}
@@ -0,0 +1,29 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PriceBookSetting 价格簿变更通知配置
+type PriceBookSetting struct {
+	// NotifyAheadHours 版本生效前多少小时向用户发送站内消息
+	NotifyAheadHours int `json:"notify_ahead_hours"`
+	// NotifyEmail 通知时同时发送邮件
+	NotifyEmail bool `json:"notify_email"`
+	// MaxNotifyChanges 通知内容中最多列出的变更条数
+	MaxNotifyChanges int `json:"max_notify_changes"`
+}
+
+// 默认配置
+var priceBookSetting = PriceBookSetting{
+	NotifyAheadHours: 72,
+	NotifyEmail:      false,
+	MaxNotifyChanges: 30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("price_book_setting", &priceBookSetting)
+}
+
+func GetPriceBookSetting() *PriceBookSetting {
+	return &priceBookSetting
+}
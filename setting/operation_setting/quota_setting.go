@@ -4,11 +4,13 @@ import "github.com/QuantumNous/new-api/setting/config"
 
 type QuotaSetting struct {
 	EnableFreeModelPreConsume bool `json:"enable_free_model_pre_consume"` // 是否对免费模型启用预消耗
+	LedgerRetentionDays       int  `json:"ledger_retention_days"`         // 额度流水明细保留天数，更早的流水按用户合并，0 表示不合并
 }
 
 // 默认配置
 var quotaSetting = QuotaSetting{
 	EnableFreeModelPreConsume: true,
+	LedgerRetentionDays:       90,
 }
 
 func init() {
@@ -0,0 +1,35 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// SessionAffinitySetting 会话粘性路由设置：同一会话的连续请求固定到同一渠道与多密钥下标，以复用上游的 prompt 缓存
+type SessionAffinitySetting struct {
+	Enabled bool `json:"enabled"`
+	// 客户端传入会话标识的请求头，为空时不读取请求头
+	HeaderName string `json:"header_name"`
+	// 请求头缺失时使用请求体中的 user / metadata.user_id 作为会话标识
+	UseUserField bool `json:"use_user_field"`
+	// 以上均缺失时使用缓存前缀（system、tools 与首条消息）的哈希作为会话标识
+	UsePromptPrefix bool `json:"use_prompt_prefix"`
+	// 会话绑定的有效期（秒），每次成功请求后刷新
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// 默认配置
+var sessionAffinitySetting = SessionAffinitySetting{
+	Enabled:         false,
+	HeaderName:      "X-Session-Id",
+	UseUserField:    true,
+	UsePromptPrefix: false,
+	TTLSeconds:      600,
+}
+
+func init() {
+	config.GlobalConfig.Register("session_affinity_setting", &sessionAffinitySetting)
+}
+
+func GetSessionAffinitySetting() *SessionAffinitySetting {
+	return &sessionAffinitySetting
+}
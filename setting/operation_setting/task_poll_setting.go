@@ -0,0 +1,66 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TaskPollSetting 异步任务进度拉取配置：每个任务按已运行时长与上游进度计算下次拉取时间，各平台独立并发拉取
+type TaskPollSetting struct {
+	// DispatchIntervalSeconds 检查到期任务的间隔
+	DispatchIntervalSeconds int `json:"dispatch_interval_seconds"`
+	// BatchSize 每次检查每个平台最多取出的到期任务数
+	BatchSize int `json:"batch_size"`
+	// MinIntervalSeconds / MaxIntervalSeconds 单个任务两次拉取之间的最小、最大间隔
+	MinIntervalSeconds int `json:"min_interval_seconds"`
+	MaxIntervalSeconds int `json:"max_interval_seconds"`
+	// AgeBackoffRatio 拉取间隔随任务已运行时长增加的比例，例如 0.1 表示任务每运行 10 秒间隔增加 1 秒
+	AgeBackoffRatio float64 `json:"age_backoff_ratio"`
+	// NearCompleteProgress 上游进度达到该百分比后按最小间隔拉取，0 表示不启用
+	NearCompleteProgress int `json:"near_complete_progress"`
+	// PlatformMinIntervalSeconds 按平台覆盖最小间隔，键为任务平台（如 suno 或渠道类型编号）
+	PlatformMinIntervalSeconds map[string]int `json:"platform_min_interval_seconds"`
+	// PlatformConcurrency 每个平台同时拉取的渠道数
+	PlatformConcurrency int `json:"platform_concurrency"`
+	// ChannelConcurrency 每个渠道同时拉取的任务数（逐个查询的视频任务）
+	ChannelConcurrency int `json:"channel_concurrency"`
+	// TimeoutMinutes 任务提交后超过该时长仍未完成则标记失败并退还额度，0 表示不限制
+	TimeoutMinutes int `json:"timeout_minutes"`
+	// PlatformTimeoutMinutes 按平台覆盖超时时长
+	PlatformTimeoutMinutes map[string]int `json:"platform_timeout_minutes"`
+}
+
+// 默认配置
+var taskPollSetting = TaskPollSetting{
+	DispatchIntervalSeconds:    5,
+	BatchSize:                  500,
+	MinIntervalSeconds:         10,
+	MaxIntervalSeconds:         300,
+	AgeBackoffRatio:            0.1,
+	NearCompleteProgress:       90,
+	PlatformMinIntervalSeconds: map[string]int{},
+	PlatformConcurrency:        4,
+	ChannelConcurrency:         2,
+	TimeoutMinutes:             360,
+	PlatformTimeoutMinutes:     map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_poll_setting", &taskPollSetting)
+}
+
+func GetTaskPollSetting() *TaskPollSetting {
+	return &taskPollSetting
+}
+
+func (s *TaskPollSetting) GetMinIntervalSeconds(platform string) int {
+	if seconds, ok := s.PlatformMinIntervalSeconds[platform]; ok && seconds > 0 {
+		return seconds
+	}
+	return max(s.MinIntervalSeconds, 1)
+}
+
+func (s *TaskPollSetting) GetTimeoutMinutes(platform string) int {
+	if minutes, ok := s.PlatformTimeoutMinutes[platform]; ok {
+		return minutes
+	}
+	return s.TimeoutMinutes
+}
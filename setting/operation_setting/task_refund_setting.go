@@ -0,0 +1,51 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	TaskRefundPolicyFull    = "full"    // 任务失败或超时时全额退还预扣额度
+	TaskRefundPolicyPartial = "partial" // 在 full 的基础上，多输出任务部分输出失败时按失败比例退还
+	TaskRefundPolicyNone    = "none"    // 不退还
+)
+
+// TaskRefundSetting 异步任务结算配置：按次预扣的任务在失败、超时或部分输出失败时的退款策略
+type TaskRefundSetting struct {
+	// DefaultPolicy 未单独配置的平台使用的退款策略
+	DefaultPolicy string `json:"default_policy"`
+	// PlatformPolicies 按平台覆盖退款策略，键为任务平台（如 suno 或渠道类型编号）
+	PlatformPolicies map[string]string `json:"platform_policies"`
+}
+
+// 默认配置
+var taskRefundSetting = TaskRefundSetting{
+	DefaultPolicy:    TaskRefundPolicyPartial,
+	PlatformPolicies: map[string]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_refund_setting", &taskRefundSetting)
+}
+
+func GetTaskRefundSetting() *TaskRefundSetting {
+	return &taskRefundSetting
+}
+
+// GetPolicy 返回平台的退款策略，未配置或配置无效时回退到默认策略
+func (s *TaskRefundSetting) GetPolicy(platform string) string {
+	if policy, ok := s.PlatformPolicies[platform]; ok && isValidTaskRefundPolicy(policy) {
+		return policy
+	}
+	if isValidTaskRefundPolicy(s.DefaultPolicy) {
+		return s.DefaultPolicy
+	}
+	return TaskRefundPolicyFull
+}
+
+func isValidTaskRefundPolicy(policy string) bool {
+	switch policy {
+	case TaskRefundPolicyFull, TaskRefundPolicyPartial, TaskRefundPolicyNone:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UsageReportSetting 月度用量报告配置
+type UsageReportSetting struct {
+	Enabled bool `json:"enabled"`
+	// DayOfMonth / Hour 每月生成上月报告的日期与小时（服务器本地时间）
+	DayOfMonth int `json:"day_of_month"`
+	Hour       int `json:"hour"`
+	// EmailEnabled 向开启了用量报告的用户发送带附件的报告邮件
+	EmailEnabled bool `json:"email_enabled"`
+	// WebhookUrl 非空时将每个用户的报告推送到该地址，WebhookSecret 用于签名
+	WebhookUrl    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+	// AttachmentFormat 明细附件格式：csv、jsonl 或 parquet
+	AttachmentFormat string `json:"attachment_format"`
+	// MaxAttachmentMB 明细附件大小上限，超出时仅发送汇总
+	MaxAttachmentMB int `json:"max_attachment_mb"`
+	// LastReportPeriod 最近一次已生成报告的月份（YYYY-MM），由调度器维护
+	LastReportPeriod string `json:"last_report_period"`
+}
+
+// 默认配置
+var usageReportSetting = UsageReportSetting{
+	Enabled:          false,
+	DayOfMonth:       1,
+	Hour:             9,
+	EmailEnabled:     true,
+	AttachmentFormat: "csv",
+	MaxAttachmentMB:  8,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("usage_report_setting", &usageReportSetting)
+}
+
+func GetUsageReportSetting() *UsageReportSetting {
+	return &usageReportSetting
+}
@@ -85,6 +85,9 @@ var defaultCreateCacheRatio = map[string]float64{
 var cacheRatioMap map[string]float64
 var cacheRatioMapMutex sync.RWMutex
 
+var createCacheRatioMap map[string]float64
+var createCacheRatioMapMutex sync.RWMutex
+
 // GetCacheRatioMap returns the cache ratio map
 func GetCacheRatioMap() map[string]float64 {
 	cacheRatioMapMutex.RLock()
@@ -127,13 +130,49 @@ func GetCacheRatio(name string) (float64, bool) {
 }
 
 func GetCreateCacheRatio(name string) (float64, bool) {
-	ratio, ok := defaultCreateCacheRatio[name]
+	createCacheRatioMapMutex.RLock()
+	defer createCacheRatioMapMutex.RUnlock()
+	ratio, ok := createCacheRatioMap[name]
 	if !ok {
 		return 1.25, false // Default to 1.25 if not found
 	}
 	return ratio, true
 }
 
+// CreateCacheRatio2JSONString converts the cache creation ratio map to a JSON string
+func CreateCacheRatio2JSONString() string {
+	createCacheRatioMapMutex.RLock()
+	defer createCacheRatioMapMutex.RUnlock()
+	jsonBytes, err := json.Marshal(createCacheRatioMap)
+	if err != nil {
+		common.SysLog("error marshalling create cache ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+// UpdateCreateCacheRatioByJSONString updates the cache creation ratio map from a JSON string
+func UpdateCreateCacheRatioByJSONString(jsonStr string) error {
+	tmp := make(map[string]float64)
+	if err := json.Unmarshal([]byte(jsonStr), &tmp); err != nil {
+		return err
+	}
+	createCacheRatioMapMutex.Lock()
+	createCacheRatioMap = tmp
+	createCacheRatioMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+func GetCreateCacheRatioCopy() map[string]float64 {
+	createCacheRatioMapMutex.RLock()
+	defer createCacheRatioMapMutex.RUnlock()
+	copyMap := make(map[string]float64, len(createCacheRatioMap))
+	for k, v := range createCacheRatioMap {
+		copyMap[k] = v
+	}
+	return copyMap
+}
+
 func GetCacheRatioCopy() map[string]float64 {
 	cacheRatioMapMutex.RLock()
 	defer cacheRatioMapMutex.RUnlock()
@@ -0,0 +1,137 @@
+package ratio_setting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// ContextTier 长上下文分档倍率：提示 token 数超过 MinPromptTokens 时整单按该档计费
+// CompletionRatio / CacheRatio / CacheCreationRatio 为 0 时沿用基础倍率
+type ContextTier struct {
+	MinPromptTokens    int     `json:"min_prompt_tokens"`
+	ModelRatio         float64 `json:"model_ratio"`
+	CompletionRatio    float64 `json:"completion_ratio,omitempty"`
+	CacheRatio         float64 `json:"cache_ratio,omitempty"`
+	CacheCreationRatio float64 `json:"cache_creation_ratio,omitempty"`
+}
+
+// 示例：{"gemini-2.5-pro": [{"min_prompt_tokens": 200000, "model_ratio": 1.25, "completion_ratio": 6}]}
+var modelContextTiersMap = map[string][]ContextTier{}
+var modelContextTiersMapMutex sync.RWMutex
+
+func ModelContextTiers2JSONString() string {
+	modelContextTiersMapMutex.RLock()
+	defer modelContextTiersMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(modelContextTiersMap)
+	if err != nil {
+		common.SysError("error marshalling model context tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseModelContextTiers(jsonStr string) (map[string][]ContextTier, error) {
+	tiersMap := make(map[string][]ContextTier)
+	if jsonStr == "" {
+		return tiersMap, nil
+	}
+	if err := common.Unmarshal([]byte(jsonStr), &tiersMap); err != nil {
+		return nil, err
+	}
+	for name, tiers := range tiersMap {
+		seen := make(map[int]bool, len(tiers))
+		for _, tier := range tiers {
+			if tier.MinPromptTokens <= 0 {
+				return nil, fmt.Errorf("model %s: min_prompt_tokens must be greater than 0", name)
+			}
+			if seen[tier.MinPromptTokens] {
+				return nil, fmt.Errorf("model %s: duplicate min_prompt_tokens %d", name, tier.MinPromptTokens)
+			}
+			seen[tier.MinPromptTokens] = true
+			if tier.ModelRatio <= 0 {
+				return nil, fmt.Errorf("model %s: model_ratio must be greater than 0", name)
+			}
+			if tier.CompletionRatio < 0 || tier.CacheRatio < 0 || tier.CacheCreationRatio < 0 {
+				return nil, errors.New("model " + name + ": ratio must be not less than 0")
+			}
+		}
+		sort.Slice(tiers, func(i, j int) bool {
+			return tiers[i].MinPromptTokens < tiers[j].MinPromptTokens
+		})
+	}
+	return tiersMap, nil
+}
+
+func CheckModelContextTiers(jsonStr string) error {
+	_, err := parseModelContextTiers(jsonStr)
+	return err
+}
+
+func UpdateModelContextTiersByJSONString(jsonStr string) error {
+	tiersMap, err := parseModelContextTiers(jsonStr)
+	if err != nil {
+		return err
+	}
+	modelContextTiersMapMutex.Lock()
+	modelContextTiersMap = tiersMap
+	modelContextTiersMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetModelContextTiers 返回模型的分档配置（按阈值升序），未配置时返回 nil
+func GetModelContextTiers(name string) []ContextTier {
+	modelContextTiersMapMutex.RLock()
+	defer modelContextTiersMapMutex.RUnlock()
+	tiers, ok := modelContextTiersMap[FormatMatchingModelName(name)]
+	if !ok {
+		return nil
+	}
+	return append([]ContextTier(nil), tiers...)
+}
+
+func GetModelContextTiersCopy() map[string][]ContextTier {
+	modelContextTiersMapMutex.RLock()
+	defer modelContextTiersMapMutex.RUnlock()
+	copyMap := make(map[string][]ContextTier, len(modelContextTiersMap))
+	for k, v := range modelContextTiersMap {
+		copyMap[k] = append([]ContextTier(nil), v...)
+	}
+	return copyMap
+}
+
+// SelectContextTier 按提示 token 数在基础倍率之上选择分档，返回分档后的倍率、分档序号（从 1 开始，0 表示未命中）与阈值
+func SelectContextTier(name string, promptTokens int, base types.ContextTierRatios) (types.ContextTierRatios, int, int) {
+	tiers := GetModelContextTiers(name)
+	for i := len(tiers) - 1; i >= 0; i-- {
+		tier := tiers[i]
+		if promptTokens <= tier.MinPromptTokens {
+			continue
+		}
+		ratios := base
+		ratios.ModelRatio = tier.ModelRatio
+		if tier.CompletionRatio > 0 {
+			ratios.CompletionRatio = tier.CompletionRatio
+		}
+		if tier.CacheRatio > 0 {
+			ratios.CacheRatio = tier.CacheRatio
+		}
+		if tier.CacheCreationRatio > 0 {
+			// 保持 5m / 1h 缓存写入与基础缓存写入倍率的比例
+			if base.CacheCreationRatio > 0 {
+				ratios.CacheCreation5mRatio = base.CacheCreation5mRatio * tier.CacheCreationRatio / base.CacheCreationRatio
+				ratios.CacheCreation1hRatio = base.CacheCreation1hRatio * tier.CacheCreationRatio / base.CacheCreationRatio
+			} else {
+				ratios.CacheCreation5mRatio = tier.CacheCreationRatio
+				ratios.CacheCreation1hRatio = tier.CacheCreationRatio
+			}
+			ratios.CacheCreationRatio = tier.CacheCreationRatio
+		}
+		return ratios, i + 1, tier.MinPromptTokens
+	}
+	return base, 0, 0
+}
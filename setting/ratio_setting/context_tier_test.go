@@ -0,0 +1,68 @@
+package ratio_setting
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/types"
+)
+
+func TestSelectContextTierPicksHighestExceededTier(t *testing.T) {
+	original := ModelContextTiers2JSONString()
+	t.Cleanup(func() {
+		_ = UpdateModelContextTiersByJSONString(original)
+	})
+	err := UpdateModelContextTiersByJSONString(`{"tiered-model": [
+		{"min_prompt_tokens": 500000, "model_ratio": 4},
+		{"min_prompt_tokens": 200000, "model_ratio": 2, "completion_ratio": 6, "cache_creation_ratio": 2.5}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := types.ContextTierRatios{
+		ModelRatio:           1,
+		CompletionRatio:      5,
+		CacheRatio:           0.1,
+		CacheCreationRatio:   1.25,
+		CacheCreation5mRatio: 1.25,
+		CacheCreation1hRatio: 2,
+	}
+
+	ratios, tier, threshold := SelectContextTier("tiered-model", 200000, base)
+	if tier != 0 || threshold != 0 || ratios != base {
+		t.Fatalf("expected base tier at threshold, got tier %d %+v", tier, ratios)
+	}
+
+	ratios, tier, threshold = SelectContextTier("tiered-model", 200001, base)
+	if tier != 1 || threshold != 200000 || ratios.ModelRatio != 2 || ratios.CompletionRatio != 6 || ratios.CacheRatio != 0.1 {
+		t.Fatalf("unexpected first tier: %d %+v", tier, ratios)
+	}
+	if ratios.CacheCreation5mRatio != 2.5 || ratios.CacheCreation1hRatio != 4 {
+		t.Fatalf("expected cache creation ratios to keep proportion, got %+v", ratios)
+	}
+
+	ratios, tier, _ = SelectContextTier("tiered-model", 600000, base)
+	if tier != 2 || ratios.ModelRatio != 4 || ratios.CompletionRatio != 5 {
+		t.Fatalf("unexpected second tier: %d %+v", tier, ratios)
+	}
+
+	if _, tier, _ = SelectContextTier("other-model", 600000, base); tier != 0 {
+		t.Fatalf("expected no tier for unconfigured model")
+	}
+}
+
+func TestCheckModelContextTiersRejectsInvalidTiers(t *testing.T) {
+	invalid := []string{
+		`{"m": [{"min_prompt_tokens": 0, "model_ratio": 1}]}`,
+		`{"m": [{"min_prompt_tokens": 100, "model_ratio": 0}]}`,
+		`{"m": [{"min_prompt_tokens": 100, "model_ratio": 1}, {"min_prompt_tokens": 100, "model_ratio": 2}]}`,
+		`{"m": [{"min_prompt_tokens": 100, "model_ratio": 1, "cache_ratio": -1}]}`,
+	}
+	for _, jsonStr := range invalid {
+		if err := CheckModelContextTiers(jsonStr); err == nil {
+			t.Fatalf("expected error for %s", jsonStr)
+		}
+	}
+	if err := CheckModelContextTiers(`{}`); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package ratio_setting
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// GroupPricingSchedule 分组分时计价：在指定时区的时间窗口内，分组倍率再乘以窗口倍率
+type GroupPricingSchedule struct {
+	Timezone string               `json:"timezone,omitempty"` // IANA 时区，为空时使用 UTC
+	Windows  []GroupPricingWindow `json:"windows"`
+}
+
+// GroupPricingWindow 时间窗口：Weekdays 为窗口开始所在的星期（0 为周日），为空表示每天；
+// End 不大于 Start 时窗口跨越零点
+type GroupPricingWindow struct {
+	Name       string  `json:"name,omitempty"`
+	Weekdays   []int   `json:"weekdays,omitempty"`
+	Start      string  `json:"start"` // HH:MM
+	End        string  `json:"end"`   // HH:MM
+	Multiplier float64 `json:"multiplier"`
+}
+
+// GroupPricingWindowState 某一时刻命中（或即将开始）的窗口及其起止时间
+type GroupPricingWindowState struct {
+	Name       string  `json:"name"`
+	Multiplier float64 `json:"multiplier"`
+	StartAt    int64   `json:"start_at"`
+	EndAt      int64   `json:"end_at"`
+}
+
+// 示例：{"default": {"timezone": "Asia/Shanghai", "windows": [{"name": "off-peak", "start": "00:00", "end": "08:00", "multiplier": 0.5}]}}
+var groupPricingSchedules = map[string]GroupPricingSchedule{}
+var groupPricingLocations = map[string]*time.Location{}
+var groupPricingSchedulesMutex sync.RWMutex
+
+func GroupPricingSchedules2JSONString() string {
+	groupPricingSchedulesMutex.RLock()
+	defer groupPricingSchedulesMutex.RUnlock()
+	jsonBytes, err := common.Marshal(groupPricingSchedules)
+	if err != nil {
+		common.SysError("error marshalling group pricing schedules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseClockMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseGroupPricingSchedules(jsonStr string) (map[string]GroupPricingSchedule, map[string]*time.Location, error) {
+	schedules := make(map[string]GroupPricingSchedule)
+	locations := make(map[string]*time.Location)
+	if jsonStr == "" {
+		return schedules, locations, nil
+	}
+	if err := common.Unmarshal([]byte(jsonStr), &schedules); err != nil {
+		return nil, nil, err
+	}
+	for group, schedule := range schedules {
+		location := time.UTC
+		if schedule.Timezone != "" {
+			loc, err := time.LoadLocation(schedule.Timezone)
+			if err != nil {
+				return nil, nil, fmt.Errorf("group %s: invalid timezone %s", group, schedule.Timezone)
+			}
+			location = loc
+		}
+		locations[group] = location
+		for _, window := range schedule.Windows {
+			if _, err := parseClockMinutes(window.Start); err != nil {
+				return nil, nil, fmt.Errorf("group %s: %s", group, err.Error())
+			}
+			if _, err := parseClockMinutes(window.End); err != nil {
+				return nil, nil, fmt.Errorf("group %s: %s", group, err.Error())
+			}
+			for _, weekday := range window.Weekdays {
+				if weekday < 0 || weekday > 6 {
+					return nil, nil, fmt.Errorf("group %s: weekday must be between 0 and 6", group)
+				}
+			}
+			if window.Multiplier < 0 {
+				return nil, nil, errors.New("group " + group + ": multiplier must be not less than 0")
+			}
+		}
+	}
+	return schedules, locations, nil
+}
+
+func CheckGroupPricingSchedules(jsonStr string) error {
+	_, _, err := parseGroupPricingSchedules(jsonStr)
+	return err
+}
+
+func UpdateGroupPricingSchedulesByJSONString(jsonStr string) error {
+	schedules, locations, err := parseGroupPricingSchedules(jsonStr)
+	if err != nil {
+		return err
+	}
+	groupPricingSchedulesMutex.Lock()
+	groupPricingSchedules = schedules
+	groupPricingLocations = locations
+	groupPricingSchedulesMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+func GetGroupPricingSchedulesCopy() map[string]GroupPricingSchedule {
+	groupPricingSchedulesMutex.RLock()
+	defer groupPricingSchedulesMutex.RUnlock()
+	copyMap := make(map[string]GroupPricingSchedule, len(groupPricingSchedules))
+	for k, v := range groupPricingSchedules {
+		copyMap[k] = v
+	}
+	return copyMap
+}
+
+func getGroupPricingSchedule(group string) (GroupPricingSchedule, *time.Location, bool) {
+	groupPricingSchedulesMutex.RLock()
+	defer groupPricingSchedulesMutex.RUnlock()
+	schedule, ok := groupPricingSchedules[group]
+	if !ok || len(schedule.Windows) == 0 {
+		return schedule, nil, false
+	}
+	return schedule, groupPricingLocations[group], true
+}
+
+func windowMatchesWeekday(window GroupPricingWindow, weekday time.Weekday) bool {
+	if len(window.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range window.Weekdays {
+		if time.Weekday(w) == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// windowOccurrence 返回窗口在 day 当天开始的那一次的起止时间
+func windowOccurrence(window GroupPricingWindow, day time.Time) (time.Time, time.Time) {
+	start, _ := parseClockMinutes(window.Start)
+	end, _ := parseClockMinutes(window.End)
+	startAt := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, day.Location())
+	duration := end - start
+	if duration <= 0 {
+		duration += 24 * 60
+	}
+	return startAt, startAt.Add(time.Duration(duration) * time.Minute)
+}
+
+// GetGroupPricingWindows 返回分组在 now 时刻命中的窗口与之后最近开始的窗口；窗口重叠时取第一个命中的窗口
+func GetGroupPricingWindows(group string, now time.Time) (active *GroupPricingWindowState, next *GroupPricingWindowState) {
+	schedule, location, ok := getGroupPricingSchedule(group)
+	if !ok {
+		return nil, nil
+	}
+	local := now.In(location)
+	// 从前一天开始检查，以覆盖跨零点的窗口；向后检查一周以找到下一个窗口
+	for offset := -1; offset <= 7; offset++ {
+		day := local.AddDate(0, 0, offset)
+		for _, window := range schedule.Windows {
+			if !windowMatchesWeekday(window, day.Weekday()) {
+				continue
+			}
+			startAt, endAt := windowOccurrence(window, day)
+			state := &GroupPricingWindowState{
+				Name:       window.Name,
+				Multiplier: window.Multiplier,
+				StartAt:    startAt.Unix(),
+				EndAt:      endAt.Unix(),
+			}
+			if active == nil && !local.Before(startAt) && local.Before(endAt) {
+				active = state
+			} else if startAt.After(local) && (next == nil || state.StartAt < next.StartAt) {
+				next = state
+			}
+		}
+	}
+	return active, next
+}
+
+// GetGroupPricingMultiplier 返回分组在 now 时刻的分时倍率，未命中窗口时返回 1
+func GetGroupPricingMultiplier(group string, now time.Time) (float64, *GroupPricingWindowState) {
+	active, _ := GetGroupPricingWindows(group, now)
+	if active == nil {
+		return 1, nil
+	}
+	return active.Multiplier, active
+}
@@ -0,0 +1,65 @@
+package ratio_setting
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupPricingWindowsAcrossMidnight(t *testing.T) {
+	original := GroupPricingSchedules2JSONString()
+	t.Cleanup(func() {
+		_ = UpdateGroupPricingSchedulesByJSONString(original)
+	})
+	err := UpdateGroupPricingSchedulesByJSONString(`{"batch": {"timezone": "Asia/Shanghai", "windows": [
+		{"name": "night", "weekdays": [1, 2, 3, 4, 5], "start": "22:00", "end": "06:00", "multiplier": 0.5},
+		{"name": "weekend", "weekdays": [0, 6], "start": "00:00", "end": "00:00", "multiplier": 0.6}
+	]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, _ := time.LoadLocation("Asia/Shanghai")
+
+	// 周二 03:00 命中周一 22:00 开始的夜间窗口
+	multiplier, window := GetGroupPricingMultiplier("batch", time.Date(2026, 10, 13, 3, 0, 0, 0, location))
+	if window == nil || window.Name != "night" || multiplier != 0.5 {
+		t.Fatalf("expected night window, got %v %+v", multiplier, window)
+	}
+	if window.StartAt != time.Date(2026, 10, 12, 22, 0, 0, 0, location).Unix() ||
+		window.EndAt != time.Date(2026, 10, 13, 6, 0, 0, 0, location).Unix() {
+		t.Fatalf("unexpected window range: %+v", window)
+	}
+
+	// 周二 12:00 未命中，下一个窗口为当晚 22:00
+	active, next := GetGroupPricingWindows("batch", time.Date(2026, 10, 13, 12, 0, 0, 0, location))
+	if active != nil {
+		t.Fatalf("expected no active window, got %+v", active)
+	}
+	if next == nil || next.StartAt != time.Date(2026, 10, 13, 22, 0, 0, 0, location).Unix() {
+		t.Fatalf("unexpected next window: %+v", next)
+	}
+
+	// 周六全天
+	multiplier, window = GetGroupPricingMultiplier("batch", time.Date(2026, 10, 17, 15, 0, 0, 0, location))
+	if window == nil || window.Name != "weekend" || multiplier != 0.6 {
+		t.Fatalf("expected weekend window, got %v %+v", multiplier, window)
+	}
+
+	multiplier, window = GetGroupPricingMultiplier("other", time.Date(2026, 10, 17, 15, 0, 0, 0, location))
+	if window != nil || multiplier != 1 {
+		t.Fatalf("expected no window for unscheduled group, got %v %+v", multiplier, window)
+	}
+}
+
+func TestCheckGroupPricingSchedulesRejectsInvalidConfig(t *testing.T) {
+	invalid := []string{
+		`{"default": {"timezone": "Mars/Base", "windows": []}}`,
+		`{"default": {"windows": [{"start": "25:00", "end": "06:00", "multiplier": 0.5}]}}`,
+		`{"default": {"windows": [{"weekdays": [7], "start": "01:00", "end": "06:00", "multiplier": 0.5}]}}`,
+		`{"default": {"windows": [{"start": "01:00", "end": "06:00", "multiplier": -1}]}}`,
+	}
+	for _, jsonStr := range invalid {
+		if err := CheckGroupPricingSchedules(jsonStr); err == nil {
+			t.Fatalf("expected error for %s", jsonStr)
+		}
+	}
+}
@@ -179,6 +179,20 @@ func GetGroupGroupRatio(userGroup, usingGroup string) (float64, bool) {
 	return ratio, true
 }
 
+func GetGroupGroupRatioCopy() map[string]map[string]float64 {
+	groupGroupRatioMutex.RLock()
+	defer groupGroupRatioMutex.RUnlock()
+	copyMap := make(map[string]map[string]float64, len(GroupGroupRatio))
+	for userGroup, ratios := range GroupGroupRatio {
+		copyRatios := make(map[string]float64, len(ratios))
+		for usingGroup, ratio := range ratios {
+			copyRatios[usingGroup] = ratio
+		}
+		copyMap[userGroup] = copyRatios
+	}
+	return copyMap
+}
+
 func GroupGroupRatio2JSONString() string {
 	groupGroupRatioMutex.RLock()
 	defer groupGroupRatioMutex.RUnlock()
@@ -352,6 +352,11 @@ func InitRatioSettings() {
 	cacheRatioMap = defaultCacheRatio
 	cacheRatioMapMutex.Unlock()
 
+	// Initialize createCacheRatioMap
+	createCacheRatioMapMutex.Lock()
+	createCacheRatioMap = defaultCreateCacheRatio
+	createCacheRatioMapMutex.Unlock()
+
 	// initialize imageRatioMap
 	imageRatioMapMutex.Lock()
 	imageRatioMap = defaultImageRatio
@@ -715,6 +720,16 @@ func GetImageRatio(name string) (float64, bool) {
 	return ratio, true
 }
 
+func GetImageRatioCopy() map[string]float64 {
+	imageRatioMapMutex.RLock()
+	defer imageRatioMapMutex.RUnlock()
+	copyMap := make(map[string]float64, len(imageRatioMap))
+	for k, v := range imageRatioMap {
+		copyMap[k] = v
+	}
+	return copyMap
+}
+
 func AudioRatio2JSONString() string {
 	audioRatioMapMutex.RLock()
 	defer audioRatioMapMutex.RUnlock()
@@ -0,0 +1,287 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	PriceBookKeyModelRatio            = "ModelRatio"
+	PriceBookKeyModelPrice            = "ModelPrice"
+	PriceBookKeyCompletionRatio       = "CompletionRatio"
+	PriceBookKeyCacheRatio            = "CacheRatio"
+	PriceBookKeyCreateCacheRatio      = "CreateCacheRatio"
+	PriceBookKeyImageRatio            = "ImageRatio"
+	PriceBookKeyAudioRatio            = "AudioRatio"
+	PriceBookKeyAudioCompletionRatio  = "AudioCompletionRatio"
+	PriceBookKeyGroupRatio            = "GroupRatio"
+	PriceBookKeyGroupGroupRatio       = "GroupGroupRatio"
+	PriceBookKeyModelContextTiers     = "ModelContextTiers"
+	PriceBookKeyGroupPricingSchedules = "GroupPricingSchedules"
+)
+
+// PriceBookSnapshot 价格簿版本保存的完整价格配置，覆盖计费读取的所有倍率与价格，键与对应的全局选项一致。
+// 为 nil 的配置项（早期版本未保存的项）不参与比较，生效时保持当前配置不变
+type PriceBookSnapshot struct {
+	ModelRatio            map[string]float64              `json:"ModelRatio"`
+	ModelPrice            map[string]float64              `json:"ModelPrice"`
+	CompletionRatio       map[string]float64              `json:"CompletionRatio"`
+	CacheRatio            map[string]float64              `json:"CacheRatio"`
+	CreateCacheRatio      map[string]float64              `json:"CreateCacheRatio"`
+	ImageRatio            map[string]float64              `json:"ImageRatio"`
+	AudioRatio            map[string]float64              `json:"AudioRatio"`
+	AudioCompletionRatio  map[string]float64              `json:"AudioCompletionRatio"`
+	GroupRatio            map[string]float64              `json:"GroupRatio"`
+	GroupGroupRatio       map[string]map[string]float64   `json:"GroupGroupRatio"`
+	ModelContextTiers     map[string][]ContextTier        `json:"ModelContextTiers"`
+	GroupPricingSchedules map[string]GroupPricingSchedule `json:"GroupPricingSchedules"`
+}
+
+// PriceBookChange 两个价格簿快照之间的单项差异，Old/New 为 nil 表示新增或删除；
+// 长上下文分档与分时计价按模型或分组整体比较，差异记录在 OldConfig/NewConfig 中
+type PriceBookChange struct {
+	Key       string   `json:"key"`
+	Name      string   `json:"name"`
+	Old       *float64 `json:"old"`
+	New       *float64 `json:"new"`
+	OldConfig any      `json:"old_config,omitempty"`
+	NewConfig any      `json:"new_config,omitempty"`
+}
+
+// IsPriceBookKey 判断全局选项是否属于价格簿管理的价格配置
+func IsPriceBookKey(key string) bool {
+	switch key {
+	case PriceBookKeyModelRatio, PriceBookKeyModelPrice, PriceBookKeyCompletionRatio, PriceBookKeyCacheRatio,
+		PriceBookKeyCreateCacheRatio, PriceBookKeyImageRatio, PriceBookKeyAudioRatio, PriceBookKeyAudioCompletionRatio,
+		PriceBookKeyGroupRatio, PriceBookKeyGroupGroupRatio, PriceBookKeyModelContextTiers, PriceBookKeyGroupPricingSchedules:
+		return true
+	}
+	return false
+}
+
+// 当前生效的价格簿版本，0 表示尚未启用价格簿
+var activePriceBookVersion atomic.Int64
+
+func GetActivePriceBookVersion() int {
+	return int(activePriceBookVersion.Load())
+}
+
+func SetActivePriceBookVersion(version int) {
+	activePriceBookVersion.Store(int64(version))
+}
+
+// CurrentPriceBookSnapshot 返回当前内存中生效的价格配置
+func CurrentPriceBookSnapshot() PriceBookSnapshot {
+	return PriceBookSnapshot{
+		ModelRatio:            GetModelRatioCopy(),
+		ModelPrice:            GetModelPriceCopy(),
+		CompletionRatio:       GetCompletionRatioCopy(),
+		CacheRatio:            GetCacheRatioCopy(),
+		CreateCacheRatio:      GetCreateCacheRatioCopy(),
+		ImageRatio:            GetImageRatioCopy(),
+		AudioRatio:            GetAudioRatioCopy(),
+		AudioCompletionRatio:  GetAudioCompletionRatioCopy(),
+		GroupRatio:            GetGroupRatioCopy(),
+		GroupGroupRatio:       GetGroupGroupRatioCopy(),
+		ModelContextTiers:     GetModelContextTiersCopy(),
+		GroupPricingSchedules: GetGroupPricingSchedulesCopy(),
+	}
+}
+
+// ratioEntries 返回按名称取值的倍率与价格配置；分组间倍率按 "用户分组->使用分组" 展开
+func (s PriceBookSnapshot) ratioEntries() map[string]map[string]float64 {
+	var groupGroupRatio map[string]float64
+	if s.GroupGroupRatio != nil {
+		groupGroupRatio = make(map[string]float64)
+	}
+	for userGroup, ratios := range s.GroupGroupRatio {
+		for usingGroup, ratio := range ratios {
+			groupGroupRatio[userGroup+"->"+usingGroup] = ratio
+		}
+	}
+	return map[string]map[string]float64{
+		PriceBookKeyModelRatio:           s.ModelRatio,
+		PriceBookKeyModelPrice:           s.ModelPrice,
+		PriceBookKeyCompletionRatio:      s.CompletionRatio,
+		PriceBookKeyCacheRatio:           s.CacheRatio,
+		PriceBookKeyCreateCacheRatio:     s.CreateCacheRatio,
+		PriceBookKeyImageRatio:           s.ImageRatio,
+		PriceBookKeyAudioRatio:           s.AudioRatio,
+		PriceBookKeyAudioCompletionRatio: s.AudioCompletionRatio,
+		PriceBookKeyGroupRatio:           s.GroupRatio,
+		PriceBookKeyGroupGroupRatio:      groupGroupRatio,
+	}
+}
+
+// configEntries 返回按模型或分组整体比较的结构化配置
+func (s PriceBookSnapshot) configEntries() map[string]map[string]any {
+	var contextTiers, schedules map[string]any
+	if s.ModelContextTiers != nil {
+		contextTiers = make(map[string]any, len(s.ModelContextTiers))
+	}
+	for name, tiers := range s.ModelContextTiers {
+		contextTiers[name] = tiers
+	}
+	if s.GroupPricingSchedules != nil {
+		schedules = make(map[string]any, len(s.GroupPricingSchedules))
+	}
+	for name, schedule := range s.GroupPricingSchedules {
+		schedules[name] = schedule
+	}
+	return map[string]map[string]any{
+		PriceBookKeyModelContextTiers:     contextTiers,
+		PriceBookKeyGroupPricingSchedules: schedules,
+	}
+}
+
+// FillMissing 用 base 补齐快照中未提供的配置项，便于只提交部分变更
+func (s *PriceBookSnapshot) FillMissing(base PriceBookSnapshot) {
+	if s.ModelRatio == nil {
+		s.ModelRatio = base.ModelRatio
+	}
+	if s.ModelPrice == nil {
+		s.ModelPrice = base.ModelPrice
+	}
+	if s.CompletionRatio == nil {
+		s.CompletionRatio = base.CompletionRatio
+	}
+	if s.CacheRatio == nil {
+		s.CacheRatio = base.CacheRatio
+	}
+	if s.CreateCacheRatio == nil {
+		s.CreateCacheRatio = base.CreateCacheRatio
+	}
+	if s.ImageRatio == nil {
+		s.ImageRatio = base.ImageRatio
+	}
+	if s.AudioRatio == nil {
+		s.AudioRatio = base.AudioRatio
+	}
+	if s.AudioCompletionRatio == nil {
+		s.AudioCompletionRatio = base.AudioCompletionRatio
+	}
+	if s.GroupRatio == nil {
+		s.GroupRatio = base.GroupRatio
+	}
+	if s.GroupGroupRatio == nil {
+		s.GroupGroupRatio = base.GroupGroupRatio
+	}
+	if s.ModelContextTiers == nil {
+		s.ModelContextTiers = base.ModelContextTiers
+	}
+	if s.GroupPricingSchedules == nil {
+		s.GroupPricingSchedules = base.GroupPricingSchedules
+	}
+}
+
+// Validate 校验快照中的倍率与价格，长上下文分档与分时计价按对应选项的规则校验
+func (s PriceBookSnapshot) Validate() error {
+	for key, values := range s.ratioEntries() {
+		for name, value := range values {
+			if value < 0 {
+				return fmt.Errorf("%s of %s must be not less than 0", key, name)
+			}
+		}
+	}
+	values, err := s.OptionValues()
+	if err != nil {
+		return err
+	}
+	if value, ok := values[PriceBookKeyModelContextTiers]; ok {
+		if err = CheckModelContextTiers(value); err != nil {
+			return fmt.Errorf("%s: %w", PriceBookKeyModelContextTiers, err)
+		}
+	}
+	if value, ok := values[PriceBookKeyGroupPricingSchedules]; ok {
+		if err = CheckGroupPricingSchedules(value); err != nil {
+			return fmt.Errorf("%s: %w", PriceBookKeyGroupPricingSchedules, err)
+		}
+	}
+	return nil
+}
+
+// OptionValues 返回快照对应的全局选项键值（JSON 字符串），不包含为 nil 的配置项
+func (s PriceBookSnapshot) OptionValues() (map[string]string, error) {
+	entries := map[string]any{
+		PriceBookKeyModelRatio:            s.ModelRatio,
+		PriceBookKeyModelPrice:            s.ModelPrice,
+		PriceBookKeyCompletionRatio:       s.CompletionRatio,
+		PriceBookKeyCacheRatio:            s.CacheRatio,
+		PriceBookKeyCreateCacheRatio:      s.CreateCacheRatio,
+		PriceBookKeyImageRatio:            s.ImageRatio,
+		PriceBookKeyAudioRatio:            s.AudioRatio,
+		PriceBookKeyAudioCompletionRatio:  s.AudioCompletionRatio,
+		PriceBookKeyGroupRatio:            s.GroupRatio,
+		PriceBookKeyGroupGroupRatio:       s.GroupGroupRatio,
+		PriceBookKeyModelContextTiers:     s.ModelContextTiers,
+		PriceBookKeyGroupPricingSchedules: s.GroupPricingSchedules,
+	}
+	values := make(map[string]string, len(entries))
+	for key, entry := range entries {
+		jsonBytes, err := common.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		if string(jsonBytes) == "null" {
+			continue
+		}
+		values[key] = string(jsonBytes)
+	}
+	return values, nil
+}
+
+// DiffPriceBookSnapshots 比较两个快照，结果按配置项与名称排序
+func DiffPriceBookSnapshots(from PriceBookSnapshot, to PriceBookSnapshot) []PriceBookChange {
+	changes := make([]PriceBookChange, 0)
+	toEntries := to.ratioEntries()
+	for key, oldValues := range from.ratioEntries() {
+		newValues := toEntries[key]
+		if oldValues == nil || newValues == nil {
+			continue
+		}
+		for name, oldValue := range oldValues {
+			newValue, ok := newValues[name]
+			if !ok {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, Old: common.GetPointer(oldValue)})
+			} else if newValue != oldValue {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, Old: common.GetPointer(oldValue), New: common.GetPointer(newValue)})
+			}
+		}
+		for name, newValue := range newValues {
+			if _, ok := oldValues[name]; !ok {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, New: common.GetPointer(newValue)})
+			}
+		}
+	}
+	toConfigs := to.configEntries()
+	for key, oldConfigs := range from.configEntries() {
+		newConfigs := toConfigs[key]
+		if oldConfigs == nil || newConfigs == nil {
+			continue
+		}
+		for name, oldConfig := range oldConfigs {
+			newConfig, ok := newConfigs[name]
+			if !ok {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, OldConfig: oldConfig})
+			} else if !reflect.DeepEqual(oldConfig, newConfig) {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, OldConfig: oldConfig, NewConfig: newConfig})
+			}
+		}
+		for name, newConfig := range newConfigs {
+			if _, ok := oldConfigs[name]; !ok {
+				changes = append(changes, PriceBookChange{Key: key, Name: name, NewConfig: newConfig})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Key != changes[j].Key {
+			return changes[i].Key < changes[j].Key
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
@@ -0,0 +1,78 @@
+package ratio_setting
+
+import "testing"
+
+func TestDiffPriceBookSnapshots(t *testing.T) {
+	from := PriceBookSnapshot{
+		ModelRatio: map[string]float64{"a": 1, "b": 2},
+		GroupRatio: map[string]float64{"default": 1},
+	}
+	to := PriceBookSnapshot{
+		ModelRatio: map[string]float64{"a": 1.5, "c": 3},
+		GroupRatio: map[string]float64{"default": 1},
+	}
+	changes := DiffPriceBookSnapshots(from, to)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+	if changes[0].Name != "a" || *changes[0].Old != 1 || *changes[0].New != 1.5 {
+		t.Fatalf("unexpected change for a: %+v", changes[0])
+	}
+	if changes[1].Name != "b" || changes[1].New != nil {
+		t.Fatalf("expected b to be removed: %+v", changes[1])
+	}
+	if changes[2].Name != "c" || changes[2].Old != nil || *changes[2].New != 3 {
+		t.Fatalf("expected c to be added: %+v", changes[2])
+	}
+}
+
+func TestDiffPriceBookSnapshotsCoversAllPricingOptions(t *testing.T) {
+	from := PriceBookSnapshot{
+		ImageRatio:        map[string]float64{"gpt-image-1": 2},
+		CreateCacheRatio:  map[string]float64{"claude": 1.25},
+		GroupGroupRatio:   map[string]map[string]float64{"vip": {"default": 0.8}},
+		ModelContextTiers: map[string][]ContextTier{"gemini": {{MinPromptTokens: 200000, ModelRatio: 2}}},
+		GroupPricingSchedules: map[string]GroupPricingSchedule{
+			"default": {Windows: []GroupPricingWindow{{Start: "00:00", End: "08:00", Multiplier: 0.5}}},
+		},
+	}
+	to := PriceBookSnapshot{
+		ImageRatio:        map[string]float64{"gpt-image-1": 3},
+		CreateCacheRatio:  map[string]float64{"claude": 1.25},
+		GroupGroupRatio:   map[string]map[string]float64{"vip": {"default": 0.7}},
+		ModelContextTiers: map[string][]ContextTier{"gemini": {{MinPromptTokens: 200000, ModelRatio: 2.5}}},
+		GroupPricingSchedules: map[string]GroupPricingSchedule{
+			"default": {Windows: []GroupPricingWindow{{Start: "00:00", End: "08:00", Multiplier: 0.5}}},
+		},
+	}
+	changes := DiffPriceBookSnapshots(from, to)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+	if changes[0].Key != PriceBookKeyGroupGroupRatio || changes[0].Name != "vip->default" || *changes[0].New != 0.7 {
+		t.Fatalf("unexpected group group ratio change: %+v", changes[0])
+	}
+	if changes[1].Key != PriceBookKeyImageRatio || *changes[1].Old != 2 || *changes[1].New != 3 {
+		t.Fatalf("unexpected image ratio change: %+v", changes[1])
+	}
+	if changes[2].Key != PriceBookKeyModelContextTiers || changes[2].Name != "gemini" || changes[2].OldConfig == nil || changes[2].NewConfig == nil {
+		t.Fatalf("unexpected context tier change: %+v", changes[2])
+	}
+}
+
+func TestPriceBookSnapshotOptionValuesSkipMissingOptions(t *testing.T) {
+	// 早期版本只保存了部分配置项，生效时不能清空其余配置
+	snapshot := PriceBookSnapshot{ModelRatio: map[string]float64{"a": 1}, AudioRatio: map[string]float64{}}
+	values, err := snapshot.OptionValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[PriceBookKeyModelRatio] != `{"a":1}` || values[PriceBookKeyAudioRatio] != `{}` {
+		t.Fatalf("unexpected option values: %v", values)
+	}
+
+	snapshot.ModelContextTiers = map[string][]ContextTier{"bad": {{MinPromptTokens: -1, ModelRatio: 1}}}
+	if err := snapshot.Validate(); err == nil {
+		t.Fatal("expected invalid context tiers to be rejected")
+	}
+}
@@ -0,0 +1,37 @@
+package system_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ObjectStorageSettings S3 兼容对象存储配置（AWS S3、MinIO、R2 等）
+type ObjectStorageSettings struct {
+	Endpoint        string `json:"endpoint"` // 例如 https://s3.us-east-1.amazonaws.com 或 http://127.0.0.1:9000
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKeyId     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	UsePathStyle    bool   `json:"use_path_style"` // MinIO 等自建服务通常需要路径风格访问
+}
+
+// 默认配置
+var defaultObjectStorageSettings = ObjectStorageSettings{
+	Region:       "us-east-1",
+	UsePathStyle: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("object_storage", &defaultObjectStorageSettings)
+}
+
+func GetObjectStorageSettings() *ObjectStorageSettings {
+	return &defaultObjectStorageSettings
+}
+
+func (s *ObjectStorageSettings) IsConfigured() bool {
+	return strings.TrimSpace(s.Endpoint) != "" && strings.TrimSpace(s.Bucket) != "" &&
+		s.AccessKeyId != "" && s.SecretAccessKey != ""
+}
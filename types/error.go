@@ -67,14 +67,16 @@ const (
 	ErrorCodeBadRequestBody ErrorCode = "bad_request_body"
 
 	// response error
-	ErrorCodeReadResponseBodyFailed ErrorCode = "read_response_body_failed"
-	ErrorCodeBadResponseStatusCode  ErrorCode = "bad_response_status_code"
-	ErrorCodeBadResponse            ErrorCode = "bad_response"
-	ErrorCodeBadResponseBody        ErrorCode = "bad_response_body"
-	ErrorCodeEmptyResponse          ErrorCode = "empty_response"
-	ErrorCodeAwsInvokeError         ErrorCode = "aws_invoke_error"
-	ErrorCodeModelNotFound          ErrorCode = "model_not_found"
-	ErrorCodePromptBlocked          ErrorCode = "prompt_blocked"
+	ErrorCodeReadResponseBodyFailed     ErrorCode = "read_response_body_failed"
+	ErrorCodeBadResponseStatusCode      ErrorCode = "bad_response_status_code"
+	ErrorCodeBadResponse                ErrorCode = "bad_response"
+	ErrorCodeBadResponseBody            ErrorCode = "bad_response_body"
+	ErrorCodeEmptyResponse              ErrorCode = "empty_response"
+	ErrorCodeAwsInvokeError             ErrorCode = "aws_invoke_error"
+	ErrorCodeModelNotFound              ErrorCode = "model_not_found"
+	ErrorCodeContextLengthExceeded      ErrorCode = "context_length_exceeded"
+	ErrorCodeModelCapabilityUnsupported ErrorCode = "model_capability_unsupported"
+	ErrorCodePromptBlocked              ErrorCode = "prompt_blocked"
 
 	// sql error
 	ErrorCodeQueryDataError  ErrorCode = "query_data_error"
@@ -0,0 +1,96 @@
+package types
+
+import "fmt"
+
+const (
+	ModalityText  = "text"
+	ModalityImage = "image"
+	ModalityAudio = "audio"
+	ModalityVideo = "video"
+	ModalityFile  = "file"
+)
+
+// ModelCapabilityRequirement 描述一次请求对模型能力的要求，
+// 由请求校验阶段生成，供渠道选择时跳过不满足要求的渠道。
+type ModelCapabilityRequirement struct {
+	InputModalities []string `json:"input_modalities,omitempty"`
+	Tools           bool     `json:"tools,omitempty"`
+	Reasoning       bool     `json:"reasoning,omitempty"`
+}
+
+func (r *ModelCapabilityRequirement) IsEmpty() bool {
+	return r == nil || (len(r.InputModalities) == 0 && !r.Tools && !r.Reasoning)
+}
+
+// NewModelCapabilityRequirement 根据请求的 token 统计元数据推导能力要求
+func NewModelCapabilityRequirement(meta *TokenCountMeta, reasoning bool) *ModelCapabilityRequirement {
+	req := &ModelCapabilityRequirement{Reasoning: reasoning}
+	if meta == nil {
+		return req
+	}
+	req.Tools = meta.ToolsCount > 0
+	seen := make(map[string]bool)
+	for _, file := range meta.Files {
+		if file == nil {
+			continue
+		}
+		modality := ""
+		switch file.FileType {
+		case FileTypeImage:
+			modality = ModalityImage
+		case FileTypeAudio:
+			modality = ModalityAudio
+		case FileTypeVideo:
+			modality = ModalityVideo
+		default:
+			continue
+		}
+		if !seen[modality] {
+			seen[modality] = true
+			req.InputModalities = append(req.InputModalities, modality)
+		}
+	}
+	return req
+}
+
+// ModelCapability 模型能力元数据，零值字段表示未知
+type ModelCapability struct {
+	ContextLength     int      `json:"context_length,omitempty"`
+	MaxOutputTokens   int      `json:"max_output_tokens,omitempty"`
+	InputModalities   []string `json:"input_modalities,omitempty"`
+	OutputModalities  []string `json:"output_modalities,omitempty"`
+	SupportsTools     *bool    `json:"supports_tools,omitempty"`
+	SupportsReasoning *bool    `json:"supports_reasoning,omitempty"`
+}
+
+func (c ModelCapability) supportsInputModality(modality string) bool {
+	// 未配置模态信息时视为未知，不做限制
+	if len(c.InputModalities) == 0 {
+		return true
+	}
+	for _, m := range c.InputModalities {
+		if m == modality {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsatisfied 返回第一个未被满足的能力要求描述，全部满足时返回空字符串
+func (c ModelCapability) Unsatisfied(req *ModelCapabilityRequirement) string {
+	if req.IsEmpty() {
+		return ""
+	}
+	for _, modality := range req.InputModalities {
+		if !c.supportsInputModality(modality) {
+			return fmt.Sprintf("%s input", modality)
+		}
+	}
+	if req.Tools && c.SupportsTools != nil && !*c.SupportsTools {
+		return "tool use"
+	}
+	if req.Reasoning && c.SupportsReasoning != nil && !*c.SupportsReasoning {
+		return "reasoning"
+	}
+	return ""
+}
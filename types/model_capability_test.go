@@ -0,0 +1,40 @@
+package types
+
+import "testing"
+
+func TestModelCapabilityRequirementFromMeta(t *testing.T) {
+	meta := &TokenCountMeta{
+		ToolsCount: 2,
+		Files: []*FileMeta{
+			{FileType: FileTypeImage},
+			{FileType: FileTypeImage},
+			{FileType: FileTypeFile},
+		},
+	}
+	req := NewModelCapabilityRequirement(meta, false)
+	if !req.Tools {
+		t.Fatalf("expected tools requirement")
+	}
+	if len(req.InputModalities) != 1 || req.InputModalities[0] != ModalityImage {
+		t.Fatalf("expected single image modality, got %v", req.InputModalities)
+	}
+	if NewModelCapabilityRequirement(&TokenCountMeta{}, false).IsEmpty() != true {
+		t.Fatalf("expected empty requirement for plain text request")
+	}
+}
+
+func TestModelCapabilityUnsatisfied(t *testing.T) {
+	no := false
+	textOnly := ModelCapability{InputModalities: []string{ModalityText}, SupportsTools: &no}
+	if got := textOnly.Unsatisfied(&ModelCapabilityRequirement{InputModalities: []string{ModalityImage}}); got != "image input" {
+		t.Fatalf("expected image input to be unsatisfied, got %q", got)
+	}
+	if got := textOnly.Unsatisfied(&ModelCapabilityRequirement{Tools: true}); got != "tool use" {
+		t.Fatalf("expected tool use to be unsatisfied, got %q", got)
+	}
+
+	unknown := ModelCapability{ContextLength: 8192}
+	if got := unknown.Unsatisfied(&ModelCapabilityRequirement{InputModalities: []string{ModalityImage}, Tools: true, Reasoning: true}); got != "" {
+		t.Fatalf("expected unknown capabilities not to block, got %q", got)
+	}
+}
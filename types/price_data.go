@@ -29,6 +29,8 @@ type GroupRatioInfo struct {
 	GroupRatio        float64
 	GroupSpecialRatio float64
 	HasSpecialRatio   bool
+	TimeMultiplier    float64 // 分组分时倍率，已乘入 GroupRatio；0 表示未命中时间窗口
+	TimeWindow        string  // 命中的时间窗口名称
 }
 
 type PriceData struct {
@@ -47,6 +49,40 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	ContextTier          int                // 命中的长上下文分档（从 1 开始），0 表示基础倍率
+	ContextTierThreshold int                // 命中分档的提示 token 阈值
+	BaseTierRatios       *ContextTierRatios // 分档前的基础倍率，结算时按实际提示 token 重新选档
+	PriceBookVersion     int                // 计价时生效的价格簿版本，0 表示未启用价格簿
+}
+
+// ContextTierRatios 可按上下文长度分档的倍率
+type ContextTierRatios struct {
+	ModelRatio           float64
+	CompletionRatio      float64
+	CacheRatio           float64
+	CacheCreationRatio   float64
+	CacheCreation5mRatio float64
+	CacheCreation1hRatio float64
+}
+
+func (p PriceData) TierRatios() ContextTierRatios {
+	return ContextTierRatios{
+		ModelRatio:           p.ModelRatio,
+		CompletionRatio:      p.CompletionRatio,
+		CacheRatio:           p.CacheRatio,
+		CacheCreationRatio:   p.CacheCreationRatio,
+		CacheCreation5mRatio: p.CacheCreation5mRatio,
+		CacheCreation1hRatio: p.CacheCreation1hRatio,
+	}
+}
+
+func (p *PriceData) SetTierRatios(ratios ContextTierRatios) {
+	p.ModelRatio = ratios.ModelRatio
+	p.CompletionRatio = ratios.CompletionRatio
+	p.CacheRatio = ratios.CacheRatio
+	p.CacheCreationRatio = ratios.CacheCreationRatio
+	p.CacheCreation5mRatio = ratios.CacheCreation5mRatio
+	p.CacheCreation1hRatio = ratios.CacheCreation1hRatio
 }
 
 type PerCallPriceData struct {
@@ -56,5 +92,5 @@ type PerCallPriceData struct {
 }
 
 func (p PriceData) ToSetting() string {
-	return fmt.Sprintf("ModelPrice: %f, ModelRatio: %f, CompletionRatio: %f, CacheRatio: %f, GroupRatio: %f, UsePrice: %t, CacheCreationRatio: %f, CacheCreation5mRatio: %f, CacheCreation1hRatio: %f, QuotaToPreConsume: %d, ImageRatio: %f, AudioRatio: %f, AudioCompletionRatio: %f", p.ModelPrice, p.ModelRatio, p.CompletionRatio, p.CacheRatio, p.GroupRatioInfo.GroupRatio, p.UsePrice, p.CacheCreationRatio, p.CacheCreation5mRatio, p.CacheCreation1hRatio, p.QuotaToPreConsume, p.ImageRatio, p.AudioRatio, p.AudioCompletionRatio)
+	return fmt.Sprintf("ModelPrice: %f, ModelRatio: %f, CompletionRatio: %f, CacheRatio: %f, GroupRatio: %f, UsePrice: %t, CacheCreationRatio: %f, CacheCreation5mRatio: %f, CacheCreation1hRatio: %f, QuotaToPreConsume: %d, ImageRatio: %f, AudioRatio: %f, AudioCompletionRatio: %f, ContextTier: %d", p.ModelPrice, p.ModelRatio, p.CompletionRatio, p.CacheRatio, p.GroupRatioInfo.GroupRatio, p.UsePrice, p.CacheCreationRatio, p.CacheCreation5mRatio, p.CacheCreation1hRatio, p.QuotaToPreConsume, p.ImageRatio, p.AudioRatio, p.AudioCompletionRatio, p.ContextTier)
 }
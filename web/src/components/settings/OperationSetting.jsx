@@ -36,6 +36,7 @@ const OperationSetting = () => {
     QuotaForInviter: 0,
     QuotaForInvitee: 0,
     'quota_setting.enable_free_model_pre_consume': true,
+    'quota_setting.ledger_retention_days': 90,
 
     /* 通用设置 */
     TopUpLink: '',
@@ -163,6 +163,10 @@ const EditChannelModal = (props) => {
     allow_service_tier: false,
     disable_store: false, // false = 允许透传（默认开启）
     allow_safety_identifier: false,
+    // 临时禁用与缓存创建跳过设置（存入 settings）
+    temp_disable_keywords: [],
+    temp_disable_minutes: 5,
+    cache_creation_skip_threshold: 0,
   };
   const [batch, setBatch] = useState(false);
   const [multiToSingle, setMultiToSingle] = useState(false);
@@ -571,6 +575,11 @@ const EditChannelModal = (props) => {
           data.disable_store = parsedSettings.disable_store || false;
           data.allow_safety_identifier =
             parsedSettings.allow_safety_identifier || false;
+          data.temp_disable_keywords =
+            parsedSettings.temp_disable_keywords || [];
+          data.temp_disable_minutes = parsedSettings.temp_disable_minutes || 5;
+          data.cache_creation_skip_threshold =
+            parsedSettings.cache_creation_skip_threshold || 0;
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
@@ -581,6 +590,9 @@ const EditChannelModal = (props) => {
           data.allow_service_tier = false;
           data.disable_store = false;
           data.allow_safety_identifier = false;
+          data.temp_disable_keywords = [];
+          data.temp_disable_minutes = 5;
+          data.cache_creation_skip_threshold = 0;
         }
       } else {
         // 兼容历史数据：老渠道没有 settings 时，默认按 json 展示
@@ -590,6 +602,9 @@ const EditChannelModal = (props) => {
         data.allow_service_tier = false;
         data.disable_store = false;
         data.allow_safety_identifier = false;
+        data.temp_disable_keywords = [];
+        data.temp_disable_minutes = 5;
+        data.cache_creation_skip_threshold = 0;
       }
 
       if (
@@ -1199,6 +1214,15 @@ const EditChannelModal = (props) => {
       }
     }
 
+    settings.temp_disable_keywords = (localInputs.temp_disable_keywords || [])
+      .map((keyword) => (keyword || '').trim())
+      .filter(Boolean);
+    settings.temp_disable_minutes = localInputs.temp_disable_minutes || 0;
+    if (localInputs.type === 14) {
+      settings.cache_creation_skip_threshold =
+        localInputs.cache_creation_skip_threshold || 0;
+    }
+
     localInputs.settings = JSON.stringify(settings);
 
     // 清理不需要发送到后端的字段
@@ -1217,6 +1241,9 @@ const EditChannelModal = (props) => {
     delete localInputs.allow_service_tier;
     delete localInputs.disable_store;
     delete localInputs.allow_safety_identifier;
+    delete localInputs.temp_disable_keywords;
+    delete localInputs.temp_disable_minutes;
+    delete localInputs.cache_creation_skip_threshold;
 
     let res;
     localInputs.auto_ban = localInputs.auto_ban ? 1 : 0;
@@ -2032,6 +2059,7 @@ const EditChannelModal = (props) => {
                           optionList={[
                             { label: t('随机'), value: 'random' },
                             { label: t('轮询'), value: 'polling' },
+                            { label: t('余量最多优先'), value: 'least_used' },
                           ]}
                           style={{ width: '100%' }}
                           value={inputs.multi_key_mode || 'random'}
@@ -2663,6 +2691,52 @@ const EditChannelModal = (props) => {
                       initValue={autoBan}
                     />
 
+                    <Row gutter={12}>
+                      <Col span={16}>
+                        <Form.TagInput
+                          field='temp_disable_keywords'
+                          label={t('临时禁用关键词')}
+                          placeholder={t('输入关键词后回车')}
+                          addOnBlur
+                          onChange={(value) =>
+                            handleInputChange('temp_disable_keywords', value)
+                          }
+                          extraText={t(
+                            '上游错误信息包含任一关键词时临时禁用该渠道并重试其他渠道，留空则不启用',
+                          )}
+                        />
+                      </Col>
+                      <Col span={8}>
+                        <Form.InputNumber
+                          field='temp_disable_minutes'
+                          label={t('临时禁用时长（分钟）')}
+                          min={1}
+                          onNumberChange={(value) =>
+                            handleInputChange('temp_disable_minutes', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                    </Row>
+
+                    {inputs.type === 14 && (
+                      <Form.InputNumber
+                        field='cache_creation_skip_threshold'
+                        label={t('缓存创建跳过阈值')}
+                        min={0}
+                        onNumberChange={(value) =>
+                          handleInputChange(
+                            'cache_creation_skip_threshold',
+                            value,
+                          )
+                        }
+                        extraText={t(
+                          '单次请求缓存创建 tokens 超过该值时按缓存命中计费，0 表示不启用',
+                        )}
+                        style={{ width: '100%' }}
+                      />
+                    )}
+
                     <Form.TextArea
                       field='param_override'
                       label={t('参数覆盖')}
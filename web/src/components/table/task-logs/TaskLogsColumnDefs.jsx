@@ -125,6 +125,24 @@ const renderType = (type, t) => {
           {t('参照生视频')}
         </Tag>
       );
+    case 'IMAGINE':
+      return (
+        <Tag color='blue' shape='circle' prefixIcon={<Sparkles size={14} />}>
+          {t('绘图')}
+        </Tag>
+      );
+    case 'VARIATION':
+      return (
+        <Tag color='purple' shape='circle' prefixIcon={<Sparkles size={14} />}>
+          {t('变换')}
+        </Tag>
+      );
+    case 'UPSCALE':
+      return (
+        <Tag color='orange' shape='circle' prefixIcon={<Sparkles size={14} />}>
+          {t('放大')}
+        </Tag>
+      );
     default:
       return (
         <Tag color='white' shape='circle' prefixIcon={<HelpCircle size={14} />}>
@@ -152,6 +170,12 @@ const renderPlatform = (platform, t) => {
           Suno
         </Tag>
       );
+    case 'mj':
+      return (
+        <Tag color='blue' shape='circle' prefixIcon={<Sparkles size={14} />}>
+          Midjourney
+        </Tag>
+      );
     default:
       return (
         <Tag color='white' shape='circle' prefixIcon={<HelpCircle size={14} />}>
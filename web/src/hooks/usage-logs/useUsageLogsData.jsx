@@ -538,7 +538,12 @@ export const useLogsData = () => {
       const newPageData = data.items;
       setActivePage(data.page);
       setPageSize(data.page_size);
-      setLogCount(data.total);
+      // 归档日志的总数未完整统计时，至少保留下一页的入口
+      setLogCount(
+        data.total_truncated
+          ? Math.max(data.total, data.page * data.page_size) + data.page_size
+          : data.total,
+      );
 
       setLogsFormat(newPageData);
     } else {
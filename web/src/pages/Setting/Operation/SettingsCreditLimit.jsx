@@ -38,6 +38,7 @@ export default function SettingsCreditLimit(props) {
     QuotaForInviter: '',
     QuotaForInvitee: '',
     'quota_setting.enable_free_model_pre_consume': true,
+    'quota_setting.ledger_retention_days': 90,
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -173,6 +174,24 @@ export default function SettingsCreditLimit(props) {
                 />
               </Col>
             </Row>
+            <Row>
+              <Col xs={24} sm={12} md={8} lg={8} xl={6}>
+                <Form.InputNumber
+                  label={t('额度流水保留天数')}
+                  step={1}
+                  min={0}
+                  suffix={t('天')}
+                  extraText={t('更早的额度流水按用户合并为一条，0 表示不合并')}
+                  field={'quota_setting.ledger_retention_days'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'quota_setting.ledger_retention_days': parseInt(value),
+                    })
+                  }
+                />
+              </Col>
+            </Row>
 
             <Row>
               <Button size='default' onClick={onSubmit}>